@@ -0,0 +1,96 @@
+/*
+Copyright 2021 The TestGrid Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package config
+
+import (
+	"time"
+)
+
+// WithAdaptiveFrequency adapts how often Send dispatches each group to how
+// often its results change, as reported by ReportChange.
+//
+// Each group starts at the Send frequency, clamped to [min, max]. A change
+// halves the group's interval, down to min, while each report in a streak
+// without changes doubles it, up to max. Updating the group's configuration
+// resets its interval.
+//
+// Send dispatches each group at its own interval rather than the frequency
+// passed to Send, except that a zero frequency still sends each group once.
+func WithAdaptiveFrequency(min, max time.Duration) QueueOption {
+	return func(q *TestGroupQueue) {
+		q.adaptiveMin = min
+		q.adaptiveMax = max
+	}
+}
+
+// ReportChange reports whether processing the group changed its results.
+//
+// Adapts the group's interval when it is next dispatched, see WithAdaptiveFrequency.
+func (q *TestGroupQueue) ReportChange(name string, changed bool) error {
+	q.lock.Lock()
+	defer q.lock.Unlock()
+	name = q.lookupLocked(name)
+	it, ok := q.items[name]
+	if !ok {
+		return ErrNotFound
+	}
+	if q.adaptiveMax <= 0 {
+		return nil
+	}
+	interval := q.adaptedLocked(it, q.frequency)
+	if changed {
+		it.unchanged = 0
+		interval /= 2
+	} else {
+		it.unchanged++
+		interval *= 2
+	}
+	it.interval = q.clampInterval(interval)
+	return nil
+}
+
+// intervalLocked returns how long after dispatch the item is next due.
+func (q *TestGroupQueue) intervalLocked(it *item, frequency time.Duration) time.Duration {
+	return q.slowIntervalLocked(it, q.adaptedLocked(it, frequency))
+}
+
+// adaptedLocked returns the item's adapted interval, see WithAdaptiveFrequency.
+func (q *TestGroupQueue) adaptedLocked(it *item, frequency time.Duration) time.Duration {
+	switch {
+	case q.adaptiveMax <= 0:
+		return frequency
+	case it.interval > 0:
+		return it.interval
+	}
+	return q.clampInterval(frequency)
+}
+
+func (q *TestGroupQueue) clampInterval(d time.Duration) time.Duration {
+	switch {
+	case d < q.adaptiveMin:
+		return q.adaptiveMin
+	case d > q.adaptiveMax:
+		return q.adaptiveMax
+	}
+	return d
+}
+
+// resetAdaptive forgets the item's adapted interval.
+func (it *item) resetAdaptive() {
+	it.interval = 0
+	it.unchanged = 0
+}
@@ -0,0 +1,166 @@
+/*
+Copyright 2021 The TestGrid Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package config
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	configpb "github.com/GoogleCloudPlatform/testgrid/pb/config"
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestReportChange(t *testing.T) {
+	cases := []struct {
+		name    string
+		opts    []QueueOption
+		reports []bool
+		want    QueueItem
+	}{
+		{
+			name:    "disabled",
+			reports: []bool{false, false},
+			want:    QueueItem{Name: "hello"},
+		},
+		{
+			name: "unreported starts at min",
+			opts: []QueueOption{WithAdaptiveFrequency(time.Minute, time.Hour)},
+			want: QueueItem{Name: "hello", Interval: time.Minute},
+		},
+		{
+			name:    "unchanged grows",
+			opts:    []QueueOption{WithAdaptiveFrequency(time.Minute, time.Hour)},
+			reports: []bool{false, false},
+			want:    QueueItem{Name: "hello", Interval: 4 * time.Minute, Unchanged: 2},
+		},
+		{
+			name:    "growth stops at max",
+			opts:    []QueueOption{WithAdaptiveFrequency(time.Minute, time.Hour)},
+			reports: []bool{false, false, false, false, false, false, false, false},
+			want:    QueueItem{Name: "hello", Interval: time.Hour, Unchanged: 8},
+		},
+		{
+			name:    "change shrinks and ends the streak",
+			opts:    []QueueOption{WithAdaptiveFrequency(time.Minute, time.Hour)},
+			reports: []bool{false, false, false, true},
+			want:    QueueItem{Name: "hello", Interval: 4 * time.Minute},
+		},
+		{
+			name:    "shrinking stops at min",
+			opts:    []QueueOption{WithAdaptiveFrequency(time.Minute, time.Hour)},
+			reports: []bool{false, true, true, true},
+			want:    QueueItem{Name: "hello", Interval: time.Minute},
+		},
+	}
+
+	now := time.Date(2021, 1, 2, 3, 4, 5, 0, time.UTC)
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			q := NewTestGroupQueue(tc.opts...)
+			q.Init([]*configpb.TestGroup{{Name: "hello"}}, now)
+			for _, changed := range tc.reports {
+				if err := q.ReportChange("hello", changed); err != nil {
+					t.Fatalf("ReportChange() got unexpected error: %v", err)
+				}
+			}
+			tc.want.When = now
+			if diff := cmp.Diff([]QueueItem{tc.want}, q.Items()); diff != "" {
+				t.Errorf("Items() got unexpected diff (-want +got):\n%s", diff)
+			}
+		})
+	}
+
+	if err := NewTestGroupQueue().ReportChange("missing", true); err == nil {
+		t.Error("ReportChange() wanted an error for a missing group")
+	}
+}
+
+func TestAdaptiveFrequencyReset(t *testing.T) {
+	now := time.Date(2021, 1, 2, 3, 4, 5, 0, time.UTC)
+	q := NewTestGroupQueue(WithAdaptiveFrequency(time.Minute, time.Hour))
+	q.Init([]*configpb.TestGroup{{Name: "hello"}}, now)
+	report := func() {
+		for i := 0; i < 3; i++ {
+			if err := q.ReportChange("hello", false); err != nil {
+				t.Fatalf("ReportChange() got unexpected error: %v", err)
+			}
+		}
+	}
+
+	report()
+	q.Init([]*configpb.TestGroup{{Name: "hello"}}, now)
+	want := []QueueItem{{Name: "hello", When: now, Interval: 8 * time.Minute, Unchanged: 3}}
+	if diff := cmp.Diff(want, q.Items()); diff != "" {
+		t.Errorf("Init() with the same config got unexpected diff (-want +got):\n%s", diff)
+	}
+
+	q.Init([]*configpb.TestGroup{{Name: "hello", DaysOfResults: 7}}, now)
+	want = []QueueItem{{Name: "hello", When: now, Interval: time.Minute}}
+	if diff := cmp.Diff(want, q.Items()); diff != "" {
+		t.Errorf("Init() with a new config got unexpected diff (-want +got):\n%s", diff)
+	}
+}
+
+func TestAdaptiveFrequency(t *testing.T) {
+	start := time.Date(2021, 1, 2, 3, 4, 5, 0, time.UTC)
+	const (
+		min = time.Minute
+		max = time.Hour
+	)
+	clock := NewFakeClock(start)
+	q := NewTestGroupQueue(WithClock(clock), WithAdaptiveFrequency(min, max))
+	q.Init([]*configpb.TestGroup{{Name: "churning"}, {Name: "stable"}}, start)
+
+	dispatches := map[string]int{}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	err := q.SendFunc(ctx, func(_ context.Context, tg *configpb.TestGroup) error {
+		dispatches[tg.Name]++
+		if err := q.ReportChange(tg.Name, tg.Name == "churning"); err != nil {
+			t.Errorf("ReportChange(%q) got unexpected error: %v", tg.Name, err)
+		}
+		if clock.Now().Sub(start) >= 6*time.Hour {
+			cancel()
+			return nil
+		}
+		if _, _, when := q.Status(); when.After(clock.Now()) {
+			clock.Advance(when.Sub(clock.Now()))
+		}
+		return nil
+	}, 10*time.Minute)
+	if err != nil && err != context.Canceled {
+		t.Fatalf("SendFunc() got unexpected error: %v", err)
+	}
+
+	intervals := map[string]time.Duration{}
+	for _, it := range q.Items() {
+		if it.Interval < min || it.Interval > max {
+			t.Errorf("Items() got %s interval %s, want within [%s, %s]", it.Name, it.Interval, min, max)
+		}
+		intervals[it.Name] = it.Interval
+	}
+	if got := intervals["churning"]; got != min {
+		t.Errorf("churning interval got %s, want %s", got, min)
+	}
+	if got := intervals["stable"]; got != max {
+		t.Errorf("stable interval got %s, want %s", got, max)
+	}
+	if dispatches["churning"] <= 10*dispatches["stable"] {
+		t.Errorf("churning dispatched %d times, want many more than stable's %d", dispatches["churning"], dispatches["stable"])
+	}
+}
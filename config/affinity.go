@@ -0,0 +1,81 @@
+/*
+Copyright 2021 The TestGrid Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package config
+
+import (
+	"hash/fnv"
+)
+
+// WithAffinity dispatches each group from the same concurrent Send, when affinity, see WithMultipleSenders.
+//
+// Hashes each group's name to one of the active calls to Send, SendFunc
+// or SendDispatch, which alone dispatches the group, so a stateful worker
+// keeps seeing the same groups. Groups move between calls as calls start
+// and stop. Affinity trades balance for locality: a call whose groups are
+// all slow falls behind while other calls idle, as none takes its groups.
+// SendWindowed ignores affinity, batching every due group.
+func WithAffinity(affinity bool) QueueOption {
+	return func(q *TestGroupQueue) {
+		q.affinity = affinity
+	}
+}
+
+// join records an active call to Send, returning its worker ID, see WithAffinity.
+func (q *TestGroupQueue) join() int {
+	q.lock.Lock()
+	defer q.lock.Unlock()
+	defer q.rouse() // groups move to the new worker
+	q.workerSeq++
+	q.workers = append(q.workers, q.workerSeq)
+	return q.workerSeq
+}
+
+// leave undoes join.
+func (q *TestGroupQueue) leave(worker int) {
+	q.lock.Lock()
+	defer q.lock.Unlock()
+	defer q.rouse() // groups move to the remaining workers
+	for i, w := range q.workers {
+		if w == worker {
+			q.workers = append(q.workers[:i], q.workers[i+1:]...)
+			break
+		}
+	}
+}
+
+// ownsLocked returns whether the worker dispatches the item, which it always does without affinity.
+func (q *TestGroupQueue) ownsLocked(worker int, it *item) bool {
+	if !q.affinity || len(q.workers) <= 1 {
+		return true
+	}
+	return q.workers[workerOf(it.tg.Name, len(q.workers))] == worker
+}
+
+// workerOf returns the index of the worker of n the group named name belongs to.
+//
+// Mixes the bits of a 64-bit FNV-1a hash, whose high bits barely depend on
+// the last bytes of similar names. Unrelated to ShardOf's hash, so the
+// groups of a shard still spread across workers.
+func workerOf(name string, n int) int {
+	h := fnv.New64a()
+	h.Write([]byte(name))
+	x := h.Sum64()
+	x ^= x >> 33 // the MurmurHash3 finalizer
+	x *= 0xff51afd7ed558ccd
+	x ^= x >> 33
+	return int(x % uint64(n))
+}
@@ -0,0 +1,115 @@
+/*
+Copyright 2021 The TestGrid Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package config
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	configpb "github.com/GoogleCloudPlatform/testgrid/pb/config"
+)
+
+func TestWorkerOf(t *testing.T) {
+	const n = 4
+	workers := map[int]bool{}
+	for i := 0; i < 100; i++ {
+		name := fmt.Sprintf("group-%d", i)
+		if ShardOf(name, n) != 1 { // as many workers as shards
+			continue
+		}
+		w := workerOf(name, n)
+		if w < 0 || w >= n {
+			t.Fatalf("workerOf(%q, %d) got %d, want [0, %d)", name, n, w, n)
+		}
+		workers[w] = true
+	}
+	if len(workers) != n {
+		t.Errorf("workerOf() put the groups of a shard on workers %v, want all %d", workers, n)
+	}
+}
+
+func TestAffinity(t *testing.T) {
+	now := time.Date(2021, 1, 2, 3, 4, 5, 0, time.UTC)
+	const n = 20
+	clock := NewFakeClock(now)
+	q := NewTestGroupQueue(WithClock(clock), WithMultipleSenders(), WithAffinity(true))
+	var groups []*configpb.TestGroup
+	for i := 0; i < n; i++ {
+		groups = append(groups, &configpb.TestGroup{Name: fmt.Sprintf("group-%d", i)})
+	}
+	q.Init(groups, now.Add(time.Minute))
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	var lock sync.Mutex
+	handled := map[string]map[string]bool{} // workers handling each group
+	dispatches := make(chan struct{}, 2*n)
+	var wg sync.WaitGroup
+	for _, worker := range []string{"a", "b"} {
+		wg.Add(1)
+		go func(worker string) {
+			defer wg.Done()
+			q.SendFunc(ctx, func(_ context.Context, tg *configpb.TestGroup) error {
+				lock.Lock()
+				if handled[tg.Name] == nil {
+					handled[tg.Name] = map[string]bool{}
+				}
+				handled[tg.Name][worker] = true
+				lock.Unlock()
+				dispatches <- struct{}{}
+				return nil
+			}, 10*time.Minute)
+		}(worker)
+	}
+
+	for _, advance := range []time.Duration{time.Minute, 10 * time.Minute, 10 * time.Minute} {
+		if err := clock.BlockUntil(ctx, 2); err != nil { // both sleeping
+			t.Fatalf("BlockUntil() got unexpected error: %v", err)
+		}
+		clock.Advance(advance)
+		for i := 0; i < n; i++ {
+			select {
+			case <-dispatches:
+			case <-ctx.Done():
+				t.Fatalf("SendFunc() only dispatched %d groups after advancing %s", i, advance)
+			}
+		}
+	}
+	cancel()
+	wg.Wait()
+
+	workers := map[int]string{} // handling the groups hashed to each index
+	for name, got := range handled {
+		if len(got) != 1 {
+			t.Errorf("%s handled by %v, want one worker", name, got)
+			continue
+		}
+		for worker := range got {
+			i := workerOf(name, 2)
+			if prev, ok := workers[i]; ok && prev != worker {
+				t.Errorf("%s handled by %s, want %s like other groups hashed to %d", name, worker, prev, i)
+			}
+			workers[i] = worker
+		}
+	}
+	if len(workers) != 2 || workers[0] == workers[1] {
+		t.Errorf("got workers %v, want each index on its own worker", workers)
+	}
+}
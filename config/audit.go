@@ -0,0 +1,148 @@
+/*
+Copyright 2021 The TestGrid Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package config
+
+import (
+	"encoding/json"
+	"io"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// AuditVersion identifies the format of AuditRecord lines.
+const AuditVersion = 1
+
+// DefaultAuditBuffer is how many records an AuditLog holds before dropping.
+const DefaultAuditBuffer = 1024
+
+// Audit events.
+const (
+	AuditInit     = "init"     // Init replaced the groups.
+	AuditFix      = "fix"      // A group was rescheduled.
+	AuditDispatch = "dispatch" // Send dispatched a due group.
+	AuditRequeue  = "requeue"  // A dispatched group stayed in the queue undelivered.
+)
+
+// AuditRecord is a single line of the audit log.
+type AuditRecord struct {
+	Version int       `json:"version"`
+	Time    time.Time `json:"time"`
+	Event   string    `json:"event"`
+	Group   string    `json:"group,omitempty"`
+
+	Groups   int `json:"groups,omitempty"`   // init: groups in the queue.
+	Rejected int `json:"rejected,omitempty"` // init: invalid groups.
+
+	When *time.Time `json:"when,omitempty"` // init, dispatch, requeue: when the group is due.
+	Old  *time.Time `json:"old,omitempty"`  // fix: the previous time.
+	New  *time.Time `json:"new,omitempty"`  // fix: the new time.
+
+	LatenessSeconds float64 `json:"lateness_seconds,omitempty"` // dispatch: how long after when.
+
+	Reason string `json:"reason,omitempty"` // fix, requeue: why.
+}
+
+// AuditLog appends queue decisions to a writer as JSON lines.
+//
+// Records are written by a background goroutine, so the queue never waits
+// on the writer. Records arriving while the buffer is full are dropped.
+type AuditLog struct {
+	records chan AuditRecord
+	done    chan struct{}
+	dropped int64
+	err     error // first write error
+
+	lock   sync.RWMutex
+	closed bool
+}
+
+// NewAuditLog returns a log writing to w, buffering up to size records.
+//
+// Uses DefaultAuditBuffer when size is not positive.
+// Call Close to flush buffered records.
+func NewAuditLog(w io.Writer, size int) *AuditLog {
+	if size <= 0 {
+		size = DefaultAuditBuffer
+	}
+	a := &AuditLog{
+		records: make(chan AuditRecord, size),
+		done:    make(chan struct{}),
+	}
+	go a.write(w)
+	return a
+}
+
+// WithAuditLog records the queue's decisions to the log.
+func WithAuditLog(a *AuditLog) QueueOption {
+	return func(q *TestGroupQueue) {
+		q.auditLog = a
+	}
+}
+
+func (a *AuditLog) write(w io.Writer) {
+	defer close(a.done)
+	enc := json.NewEncoder(w)
+	for r := range a.records {
+		if err := enc.Encode(r); err != nil && a.err == nil {
+			a.err = err
+		}
+	}
+}
+
+// record appends r without blocking, dropping it if the buffer is full.
+func (a *AuditLog) record(r AuditRecord) {
+	if a == nil {
+		return
+	}
+	a.lock.RLock()
+	defer a.lock.RUnlock()
+	if !a.closed {
+		r.Version = AuditVersion
+		r.Time = r.Time.UTC()
+		select {
+		case a.records <- r:
+			return
+		default:
+		}
+	}
+	atomic.AddInt64(&a.dropped, 1)
+}
+
+// Dropped returns the number of records discarded because the buffer was full
+// or the log was closed.
+func (a *AuditLog) Dropped() int64 {
+	return atomic.LoadInt64(&a.dropped)
+}
+
+// Close flushes buffered records, returning the first write error.
+//
+// Records after Close are dropped.
+func (a *AuditLog) Close() error {
+	a.lock.Lock()
+	if !a.closed {
+		a.closed = true
+		close(a.records)
+	}
+	a.lock.Unlock()
+	<-a.done
+	return a.err
+}
+
+func timePtr(t time.Time) *time.Time {
+	return &t
+}
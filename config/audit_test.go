@@ -0,0 +1,157 @@
+/*
+Copyright 2021 The TestGrid Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package config
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"testing"
+	"time"
+
+	configpb "github.com/GoogleCloudPlatform/testgrid/pb/config"
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestAuditLog(t *testing.T) {
+	start := time.Date(2021, 1, 2, 3, 4, 5, 0, time.UTC)
+	clock := NewFakeClock(start)
+	var buf bytes.Buffer
+	log := NewAuditLog(&buf, 0)
+	q := NewTestGroupQueue(WithClock(clock), WithAuditLog(log))
+
+	q.Init([]*configpb.TestGroup{
+		{
+			Name: "hi",
+		},
+		{
+			Name: "there",
+		},
+		{},
+	}, start)
+	if err := q.Fix("there", start.Add(-time.Minute)); err != nil {
+		t.Fatalf("Fix() got unexpected error: %v", err)
+	}
+	clock.Advance(30 * time.Second)
+	boom := errors.New("boom")
+	err := q.SendFunc(context.Background(), func(context.Context, *configpb.TestGroup) error {
+		return boom
+	}, time.Hour)
+	if err != boom {
+		t.Fatalf("SendFunc() got %v, want %v", err, boom)
+	}
+	if _, err := q.Prioritize("there"); err != nil {
+		t.Fatalf("Prioritize() got unexpected error: %v", err)
+	}
+	if err := log.Close(); err != nil {
+		t.Fatalf("Close() got unexpected error: %v", err)
+	}
+
+	now := start.Add(30 * time.Second)
+	want := []AuditRecord{
+		{
+			Version:  AuditVersion,
+			Time:     start,
+			Event:    AuditInit,
+			Groups:   2,
+			Rejected: 1,
+			When:     timePtr(start),
+		},
+		{
+			Version: AuditVersion,
+			Time:    start,
+			Event:   AuditFix,
+			Group:   "there",
+			Old:     timePtr(start),
+			New:     timePtr(start.Add(-time.Minute)),
+		},
+		{
+			Version:         AuditVersion,
+			Time:            now,
+			Event:           AuditDispatch,
+			Group:           "there",
+			When:            timePtr(start.Add(-time.Minute)),
+			LatenessSeconds: 90,
+		},
+		{
+			Version: AuditVersion,
+			Time:    now,
+			Event:   AuditRequeue,
+			Group:   "there",
+			When:    timePtr(now.Add(time.Hour)),
+			Reason:  "boom",
+		},
+		{
+			Version: AuditVersion,
+			Time:    now,
+			Event:   AuditFix,
+			Group:   "there",
+			Old:     timePtr(now.Add(time.Hour)),
+			New:     timePtr(start.Add(-time.Nanosecond)),
+			Reason:  "prioritize",
+		},
+	}
+	var got []AuditRecord
+	dec := json.NewDecoder(&buf)
+	for dec.More() {
+		var r AuditRecord
+		if err := dec.Decode(&r); err != nil {
+			t.Fatalf("Decode() got unexpected error: %v", err)
+		}
+		got = append(got, r)
+	}
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Errorf("AuditLog got unexpected records (-want +got):\n%s", diff)
+	}
+	if n := log.Dropped(); n != 0 {
+		t.Errorf("Dropped() got %d, want 0", n)
+	}
+}
+
+// blockingWriter blocks writes until unblocked.
+type blockingWriter struct {
+	unblock chan struct{}
+	buf     bytes.Buffer
+}
+
+func (w *blockingWriter) Write(p []byte) (int, error) {
+	<-w.unblock
+	return w.buf.Write(p)
+}
+
+func TestAuditLogDrops(t *testing.T) {
+	w := blockingWriter{unblock: make(chan struct{})}
+	log := NewAuditLog(&w, 2)
+	for i := 0; i < 10; i++ {
+		log.record(AuditRecord{Event: AuditDispatch}) // never blocks
+	}
+	close(w.unblock)
+	if err := log.Close(); err != nil {
+		t.Fatalf("Close() got unexpected error: %v", err)
+	}
+	log.record(AuditRecord{Event: AuditDispatch})
+
+	lines := bytes.Count(w.buf.Bytes(), []byte("\n"))
+	// The writer may have taken one record from the buffer before blocking.
+	if lines < 2 || lines > 3 {
+		t.Errorf("AuditLog wrote %d records, want 2 or 3", lines)
+	}
+	if got, want := log.Dropped(), int64(11-lines); got != want {
+		t.Errorf("Dropped() got %d, want %d", got, want)
+	}
+}
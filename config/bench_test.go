@@ -0,0 +1,232 @@
+/*
+Copyright 2021 The TestGrid Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package config
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	configpb "github.com/GoogleCloudPlatform/testgrid/pb/config"
+	"github.com/sirupsen/logrus"
+)
+
+// dispatchQueue returns a queue of n groups due at start.
+func dispatchQueue(n int, clock Clock, start time.Time) *TestGroupQueue {
+	level := logrus.GetLevel()
+	logrus.SetLevel(logrus.WarnLevel) // skip logging each added group
+	defer logrus.SetLevel(level)
+	groups := make([]*configpb.TestGroup, n)
+	for i := range groups {
+		groups[i] = &configpb.TestGroup{Name: fmt.Sprintf("group-%d", i)}
+	}
+	q := NewTestGroupQueue(WithClock(clock))
+	q.Init(groups, start)
+	return q
+}
+
+// drain sends n groups from the queue to a receiver that accepts them as fast as possible.
+func drain(q *TestGroupQueue, n int) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	ch := make(chan *configpb.TestGroup)
+	go func() {
+		for i := 0; i < n; i++ {
+			<-ch
+		}
+		cancel()
+	}()
+	q.Send(ctx, ch, time.Hour)
+}
+
+// BenchmarkDispatch measures Send dispatching each of a queue of due groups to a draining receiver.
+func BenchmarkDispatch(b *testing.B) {
+	start := time.Date(2021, 1, 2, 3, 4, 5, 0, time.UTC)
+	q := dispatchQueue(b.N, NewFakeClock(start), start)
+	b.ReportAllocs()
+	b.ResetTimer()
+	drain(q, b.N)
+}
+
+func TestDispatchAllocs(t *testing.T) {
+	const groups = 1000
+	start := time.Date(2021, 1, 2, 3, 4, 5, 0, time.UTC)
+	clock := NewFakeClock(start)
+	q := dispatchQueue(groups, clock, start)
+	allocs := testing.AllocsPerRun(3, func() {
+		drain(q, groups)
+		clock.Advance(time.Hour) // everything is due again
+	})
+	if got := allocs / groups; got > 2 {
+		t.Errorf("Send() got %.2f allocations per dispatch, want at most 2", got)
+	}
+}
+
+// quiet raises the log level for the rest of the benchmark, skipping logs of each fixed group.
+func quiet(b *testing.B) {
+	level := logrus.GetLevel()
+	logrus.SetLevel(logrus.WarnLevel)
+	b.Cleanup(func() { logrus.SetLevel(level) })
+}
+
+// scatter returns when each of the first n groups of a dispatchQueue is due, spread over an hour after start.
+func scatter(n, size int, start time.Time) map[string]time.Time {
+	whens := make(map[string]time.Time, n)
+	for i := 0; i < n; i++ {
+		whens[fmt.Sprintf("group-%d", i)] = start.Add(time.Duration(i*7919%size) * time.Hour / time.Duration(size))
+	}
+	return whens
+}
+
+// BenchmarkFixAll measures FixAll rescheduling a percentage of a large queue at once.
+func BenchmarkFixAll(b *testing.B) {
+	start := time.Date(2021, 1, 2, 3, 4, 5, 0, time.UTC)
+	for _, size := range []int{1000, 10000, 100000} {
+		for _, percent := range []int{1, 10, 100} {
+			b.Run(fmt.Sprintf("groups=%d/fixed=%d%%", size, percent), func(b *testing.B) {
+				q := dispatchQueue(size, NewFakeClock(start), start)
+				n := size * percent / 100
+				whens := []map[string]time.Time{ // alternate, so every call changes each group
+					scatter(n, size, start),
+					scatter(n, size, start.Add(time.Hour)),
+				}
+				quiet(b)
+				b.ReportAllocs()
+				b.ResetTimer()
+				for i := 0; i < b.N; i++ {
+					if err := q.FixAll(whens[i%2]); err != nil {
+						b.Fatalf("FixAll() got unexpected error: %v", err)
+					}
+				}
+			})
+		}
+	}
+}
+
+// BenchmarkFixEach compares rescheduling every group of a large queue by
+// building a map for FixAll against calling FixEach.
+func BenchmarkFixEach(b *testing.B) {
+	const size = 100000
+	start := time.Date(2021, 1, 2, 3, 4, 5, 0, time.UTC)
+	when := func(name string, i int) time.Time { // alternate, so every call changes each group
+		n, _ := strconv.Atoi(strings.TrimPrefix(name, "group-"))
+		return start.Add(time.Duration(i%2)*time.Hour + time.Duration(n*7919%size)*time.Hour/size)
+	}
+	b.Run("FixAll", func(b *testing.B) {
+		q := dispatchQueue(size, NewFakeClock(start), start)
+		quiet(b)
+		b.ReportAllocs()
+		b.ResetTimer()
+		for i := 0; i < b.N; i++ {
+			whens := make(map[string]time.Time, size)
+			for _, it := range q.Items() {
+				whens[it.Name] = when(it.Name, i)
+			}
+			if err := q.FixAll(whens); err != nil {
+				b.Fatalf("FixAll() got unexpected error: %v", err)
+			}
+		}
+	})
+	b.Run("FixEach", func(b *testing.B) {
+		q := dispatchQueue(size, NewFakeClock(start), start)
+		quiet(b)
+		b.ReportAllocs()
+		b.ResetTimer()
+		for i := 0; i < b.N; i++ {
+			err := q.FixEach(func(name string, _ time.Time) (time.Time, bool) {
+				return when(name, i), true
+			})
+			if err != nil {
+				b.Fatalf("FixEach() got unexpected error: %v", err)
+			}
+		}
+	})
+}
+
+// BenchmarkFix measures Fix rescheduling one group at a time in a large queue.
+func BenchmarkFix(b *testing.B) {
+	start := time.Date(2021, 1, 2, 3, 4, 5, 0, time.UTC)
+	for _, size := range []int{1000, 10000, 100000} {
+		b.Run(fmt.Sprintf("groups=%d", size), func(b *testing.B) {
+			q := dispatchQueue(size, NewFakeClock(start), start)
+			names := make([]string, size)
+			for i := range names {
+				names[i] = fmt.Sprintf("group-%d", i)
+			}
+			quiet(b)
+			b.ReportAllocs()
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				when := start.Add(time.Duration(i*7919%size) * time.Hour / time.Duration(size))
+				if err := q.Fix(names[i%size], when); err != nil {
+					b.Fatalf("Fix() got unexpected error: %v", err)
+				}
+			}
+		})
+	}
+}
+
+// BenchmarkStore compares the heap against scanning for the next group in small queues, see WithLinearScan.
+//
+// Each op pops the next group due and pushes it back an hour later, as
+// dispatching does, then fixes another group to a nearby time.
+func BenchmarkStore(b *testing.B) {
+	start := time.Date(2021, 1, 2, 3, 4, 5, 0, time.UTC)
+	stores := []struct {
+		name  string
+		store func(*priorityQueue) scheduleStore
+	}{
+		{
+			name:  "heap",
+			store: func(pq *priorityQueue) scheduleStore { return pq },
+		},
+		{
+			name:  "scan",
+			store: func(pq *priorityQueue) scheduleStore { return (*scanQueue)(pq) },
+		},
+	}
+	for _, size := range []int{2, 4, 8, 16, 32, 64} {
+		for _, s := range stores {
+			b.Run(fmt.Sprintf("groups=%d/%s", size, s.name), func(b *testing.B) {
+				pq := make(priorityQueue, 0, size)
+				store := s.store(&pq)
+				items := make([]*item, size)
+				for i := range items {
+					items[i] = &item{
+						tg:   &configpb.TestGroup{Name: fmt.Sprintf("group-%d", i)},
+						when: start.Add(time.Duration(i*7919%size) * time.Minute),
+						seq:  uint64(i),
+					}
+					store.push(items[i])
+				}
+				b.ReportAllocs()
+				b.ResetTimer()
+				for i := 0; i < b.N; i++ {
+					it := store.pop()
+					it.when = it.when.Add(time.Hour)
+					store.push(it)
+					it = items[i%size]
+					it.when = it.when.Add(time.Duration(i*7919%size) * time.Second)
+					store.fix(it)
+				}
+			})
+		}
+	}
+}
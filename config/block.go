@@ -0,0 +1,74 @@
+/*
+Copyright 2021 The TestGrid Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package config
+
+import (
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+// WithBlockWarn logs a warning naming the group while Send is blocked delivering it for d.
+//
+// Repeats the warning every d until a receiver accepts the group, so
+// operators can tell which group jams a slow consumer. Only Send waits on
+// receivers this way; zero disables the warning.
+func WithBlockWarn(d time.Duration) QueueOption {
+	return func(q *TestGroupQueue) {
+		q.blockWarn = d
+	}
+}
+
+// blockWatchdog warns while Send is blocked delivering a group, see WithBlockWarn.
+type blockWatchdog struct {
+	q     *TestGroupQueue
+	name  string
+	since time.Time
+	timer Timer
+	c     <-chan time.Time // nil when disabled
+}
+
+// watchBlocked starts warning about the group until stop is called.
+func (q *TestGroupQueue) watchBlocked(name string) blockWatchdog {
+	if q.blockWarn <= 0 {
+		return blockWatchdog{}
+	}
+	w := blockWatchdog{
+		q:     q,
+		name:  name,
+		since: q.now(),
+		timer: q.clockTimer(q.blockWarn),
+	}
+	w.c = w.timer.C()
+	return w
+}
+
+// warn logs how long Send has been blocked, rearming the timer.
+func (w *blockWatchdog) warn() {
+	logrus.WithFields(logrus.Fields{
+		"group":   w.name,
+		"elapsed": w.q.now().Sub(w.since),
+	}).Warning("Send blocked delivering group to receivers")
+	w.timer = w.q.clockTimer(w.q.blockWarn)
+	w.c = w.timer.C()
+}
+
+func (w *blockWatchdog) stop() {
+	if w.timer != nil {
+		w.timer.Stop()
+	}
+}
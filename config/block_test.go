@@ -0,0 +1,116 @@
+/*
+Copyright 2021 The TestGrid Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package config
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	configpb "github.com/GoogleCloudPlatform/testgrid/pb/config"
+	"github.com/google/go-cmp/cmp"
+	logtest "github.com/sirupsen/logrus/hooks/test"
+)
+
+func TestBlockWarn(t *testing.T) {
+	now := time.Date(2021, 1, 2, 3, 4, 5, 0, time.UTC)
+	cases := []struct {
+		name     string
+		warn     time.Duration
+		advances int // of a minute each while blocked
+		want     []time.Duration
+	}{
+		{
+			name:     "disabled",
+			advances: 3,
+		},
+		{
+			name:     "before threshold",
+			warn:     5 * time.Minute,
+			advances: 4,
+		},
+		{
+			name:     "repeats",
+			warn:     time.Minute,
+			advances: 3,
+			want:     []time.Duration{time.Minute, 2 * time.Minute, 3 * time.Minute},
+		},
+		{
+			name:     "every threshold",
+			warn:     2 * time.Minute,
+			advances: 5,
+			want:     []time.Duration{2 * time.Minute, 4 * time.Minute},
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			hook := logtest.NewGlobal()
+			defer hook.Reset()
+			clock := NewFakeClock(now)
+			q := NewTestGroupQueue(WithClock(clock), WithSleepTimer(never), WithBlockWarn(tc.warn))
+			q.Init([]*configpb.TestGroup{{Name: "hello"}}, now)
+
+			ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+			defer cancel()
+			ch := make(chan *configpb.TestGroup)
+			errs := make(chan error, 1)
+			go func() {
+				errs <- q.Send(ctx, ch, time.Hour)
+			}()
+			for q.Diagnose().Reason != DiagnosisBlocked && ctx.Err() == nil {
+				time.Sleep(time.Millisecond)
+			}
+			for i := 0; i < tc.advances; i++ {
+				if tc.warn > 0 {
+					if err := clock.BlockUntil(ctx, 1); err != nil {
+						t.Fatalf("BlockUntil() got unexpected error: %v", err)
+					}
+				}
+				clock.Advance(time.Minute)
+			}
+			if tc.warn > 0 {
+				// wait for the last warning to rearm the timer
+				if err := clock.BlockUntil(ctx, 1); err != nil {
+					t.Fatalf("BlockUntil() got unexpected error: %v", err)
+				}
+			}
+			if tg := <-ch; tg.Name != "hello" {
+				t.Errorf("Send() got %q, want hello", tg.Name)
+			}
+			cancel()
+			<-errs
+
+			var got []time.Duration
+			for _, e := range hook.AllEntries() {
+				if e.Message != "Send blocked delivering group to receivers" {
+					continue
+				}
+				if name := e.Data["group"]; name != "hello" {
+					t.Errorf("warning got group %v, want hello", name)
+				}
+				got = append(got, e.Data["elapsed"].(time.Duration))
+			}
+			if diff := cmp.Diff(tc.want, got); diff != "" {
+				t.Errorf("Send() got unexpected warnings (-want +got):\n%s", diff)
+			}
+			if n := clock.Timers(); n != 0 {
+				t.Errorf("Send() left %d timers", n)
+			}
+		})
+	}
+}
@@ -0,0 +1,141 @@
+/*
+Copyright 2021 The TestGrid Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package config
+
+import (
+	"strings"
+	"time"
+
+	configpb "github.com/GoogleCloudPlatform/testgrid/pb/config"
+	"github.com/GoogleCloudPlatform/testgrid/util/gcs"
+)
+
+// UnknownBucket holds groups whose gcs_prefix has no parseable bucket, see SetBucketLimits.
+const UnknownBucket = ""
+
+// groupBucket returns the bucket of the group's first gcs_prefix, or UnknownBucket.
+func groupBucket(tg *configpb.TestGroup) string {
+	prefix := strings.TrimSpace(strings.SplitN(tg.GetGcsPrefix(), ",", 2)[0])
+	if prefix == "" {
+		return UnknownBucket
+	}
+	p, err := gcs.NewPath("gs://" + prefix)
+	if err != nil {
+		return UnknownBucket
+	}
+	return p.Bucket()
+}
+
+// SetBucketLimits replaces the maximum groups in flight from each GCS bucket.
+//
+// Groups belong to the bucket of their gcs_prefix, or UnknownBucket when it
+// has none. Buckets without a limit are unlimited, as are all buckets when
+// limits is empty.
+//
+// A group is in flight from when Send dispatches it until Ack is called, its
+// Dispatch is settled or times out, or the SendFunc or SendFuncDelay handler
+// returns. Send skips due groups whose bucket is at its limit, dispatching the
+// next eligible group instead, and waits when no due group is eligible.
+func (q *TestGroupQueue) SetBucketLimits(limits map[string]int) {
+	q.lock.Lock()
+	defer q.lock.Unlock()
+	defer q.rouse()
+	q.bucketLimits = make(map[string]int, len(limits))
+	for bucket, n := range limits {
+		q.bucketLimits[bucket] = n
+	}
+}
+
+// InFlight returns the number of groups in flight from each bucket with any.
+func (q *TestGroupQueue) InFlight() map[string]int {
+	q.lock.RLock()
+	defer q.lock.RUnlock()
+	out := make(map[string]int, len(q.bucketLoad))
+	for bucket, n := range q.bucketLoad {
+		out[bucket] = n
+	}
+	return out
+}
+
+// limitedLocked returns true when the item's bucket or class is at its limit.
+func (q *TestGroupQueue) limitedLocked(it *item) bool {
+	return q.bucketFullLocked(it) || q.classFullLocked(it)
+}
+
+// bucketFullLocked returns true when the item's bucket is at its limit.
+func (q *TestGroupQueue) bucketFullLocked(it *item) bool {
+	limit, ok := q.bucketLimits[it.bucket]
+	if !ok || q.bucketLoad[it.bucket] < limit {
+		return false
+	}
+	_, flying := q.inFlight[it.tg.Name] // already counted
+	return !flying
+}
+
+// eligibleLocked returns the chosen item if its bucket and class have room,
+// otherwise the next due item whose bucket and class have room, or nil if
+// there is none. Only considers items the worker owns, see WithAffinity.
+func (q *TestGroupQueue) eligibleLocked(chosen *item, now time.Time, worker int) *item {
+	if !q.limitedLocked(chosen) && q.ownsLocked(worker, chosen) {
+		return chosen
+	}
+	return q.store().firstDue(now, func(it *item) bool {
+		return !q.limitedLocked(it) && q.ownsLocked(worker, it)
+	})
+}
+
+// launchLocked records the group as in flight when its bucket or class is limited.
+func (q *TestGroupQueue) launchLocked(it *item) {
+	q.launchClassLocked(it)
+	if len(q.bucketLimits) == 0 {
+		return
+	}
+	name := it.tg.Name
+	if _, ok := q.inFlight[name]; ok {
+		return
+	}
+	if q.inFlight == nil {
+		q.inFlight = map[string]string{}
+		q.bucketLoad = map[string]int{}
+	}
+	q.inFlight[name] = it.bucket
+	q.bucketLoad[it.bucket]++
+}
+
+// landLocked records the group is no longer in flight.
+func (q *TestGroupQueue) landLocked(name string) {
+	landed := q.landClassLocked(name)
+	bucket, ok := q.inFlight[name]
+	if !ok {
+		if landed {
+			q.rouse()
+		}
+		return
+	}
+	delete(q.inFlight, name)
+	if q.bucketLoad[bucket]--; q.bucketLoad[bucket] <= 0 {
+		delete(q.bucketLoad, bucket)
+	}
+	q.rouse()
+}
+
+// land records the group is no longer in flight.
+func (q *TestGroupQueue) land(name string) {
+	q.lock.Lock()
+	defer q.lock.Unlock()
+	q.landLocked(name)
+}
@@ -0,0 +1,168 @@
+/*
+Copyright 2021 The TestGrid Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package config
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	configpb "github.com/GoogleCloudPlatform/testgrid/pb/config"
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestGroupBucket(t *testing.T) {
+	cases := []struct {
+		prefix string
+		want   string
+	}{
+		{
+			want: UnknownBucket,
+		},
+		{
+			prefix: "bucket/path/to/job",
+			want:   "bucket",
+		},
+		{
+			prefix: "bucket",
+			want:   "bucket",
+		},
+		{
+			prefix: " first/job, second/job",
+			want:   "first",
+		},
+		{
+			prefix: "bucket:80/path",
+			want:   UnknownBucket,
+		},
+		{
+			prefix: "bucket/path?query",
+			want:   UnknownBucket,
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.prefix, func(t *testing.T) {
+			if got := groupBucket(&configpb.TestGroup{GcsPrefix: tc.prefix}); got != tc.want {
+				t.Errorf("groupBucket(%q) got %q, want %q", tc.prefix, got, tc.want)
+			}
+		})
+	}
+}
+
+func TestBucketLimits(t *testing.T) {
+	now := time.Now()
+	var q TestGroupQueue
+	q.Init([]*configpb.TestGroup{
+		{Name: "slow-1", GcsPrefix: "slow/1"},
+		{Name: "slow-2", GcsPrefix: "slow/2"},
+		{Name: "fast-1", GcsPrefix: "fast/1"},
+		{Name: "slow-3", GcsPrefix: "slow/3"},
+		{Name: "fast-2", GcsPrefix: "fast/2"},
+		{Name: "odd-1", GcsPrefix: "odd:1/x"},
+		{Name: "odd-2"},
+	}, now)
+	q.SetBucketLimits(map[string]int{
+		"slow":        1,
+		UnknownBucket: 1,
+	})
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	ch := make(chan *configpb.TestGroup)
+	errCh := make(chan error, 1)
+	go func() {
+		errCh <- q.Send(ctx, ch, 0)
+	}()
+	receive := func(want ...string) {
+		t.Helper()
+		var got []string
+		for range want {
+			select {
+			case tg := <-ch:
+				got = append(got, tg.Name)
+			case <-ctx.Done():
+				t.Fatalf("Send() stopped after %v, want %v", got, want)
+			}
+		}
+		if diff := cmp.Diff(want, got); diff != "" {
+			t.Fatalf("Send() got unexpected groups (-want +got):\n%s", diff)
+		}
+	}
+	stalled := func() {
+		t.Helper()
+		select {
+		case tg := <-ch:
+			t.Fatalf("Send() dispatched %s beyond its bucket limit", tg.Name)
+		case <-time.After(50 * time.Millisecond):
+		}
+	}
+	ack := func(name string) {
+		t.Helper()
+		if err := q.Ack(name, nil); err != nil && err != ErrNotFound {
+			t.Fatalf("Ack(%s) got unexpected error: %v", name, err)
+		}
+	}
+
+	receive("slow-1", "fast-1", "fast-2", "odd-1")
+	stalled()
+	want := map[string]int{"slow": 1, "fast": 2, UnknownBucket: 1}
+	if diff := cmp.Diff(want, q.InFlight()); diff != "" {
+		t.Errorf("InFlight() got unexpected diff (-want +got):\n%s", diff)
+	}
+
+	ack("odd-1")
+	receive("odd-2")
+	stalled()
+	ack("slow-1")
+	receive("slow-2")
+	stalled()
+	ack("slow-2")
+	receive("slow-3")
+
+	if err := <-errCh; err != nil {
+		t.Errorf("Send() got unexpected error: %v", err)
+	}
+}
+
+func TestBucketLimitsSendFunc(t *testing.T) {
+	now := time.Now()
+	var q TestGroupQueue
+	q.Init([]*configpb.TestGroup{
+		{Name: "slow-1", GcsPrefix: "slow/1"},
+		{Name: "slow-2", GcsPrefix: "slow/2"},
+		{Name: "fast-1", GcsPrefix: "fast/1"},
+	}, now)
+	q.SetBucketLimits(map[string]int{"slow": 1})
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	var got []string
+	err := q.SendFunc(ctx, func(_ context.Context, tg *configpb.TestGroup) error {
+		got = append(got, tg.Name)
+		return nil
+	}, 0)
+	if err != nil {
+		t.Errorf("SendFunc() got unexpected error: %v", err)
+	}
+	if diff := cmp.Diff([]string{"slow-1", "slow-2", "fast-1"}, got); diff != "" {
+		t.Errorf("SendFunc() got unexpected order (-want +got):\n%s", diff)
+	}
+	if n := len(q.InFlight()); n != 0 {
+		t.Errorf("InFlight() got %d buckets after SendFunc, want none", n)
+	}
+}
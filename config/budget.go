@@ -0,0 +1,91 @@
+/*
+Copyright 2021 The TestGrid Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package config
+
+import (
+	"time"
+)
+
+// WithErrorBudget deprioritizes groups that fail too often.
+//
+// A group with at least failures failed Acks within the trailing window is
+// over budget. Send only dispatches over-budget groups when no group within
+// budget is due, so failing groups consume spare capacity rather than
+// crowding out healthy groups.
+//
+// Over-budget groups remain in the queue: callers wishing to dead-letter a
+// persistently failing group must Remove it.
+func WithErrorBudget(failures int, window time.Duration) QueueOption {
+	return func(q *TestGroupQueue) {
+		q.budgetFailures = failures
+		q.budgetWindow = window
+	}
+}
+
+// Ack reports the result of processing the group, where a non-nil err is a failure.
+//
+// Failures count against the group's error budget, see WithErrorBudget.
+// The group is no longer in flight, even if removed from the queue, see SetBucketLimits and SetClassLimits.
+func (q *TestGroupQueue) Ack(name string, err error) error {
+	q.lock.Lock()
+	defer q.lock.Unlock()
+	return q.ackLocked(name, err)
+}
+
+// ackLocked records the result of processing the group, see Ack.
+func (q *TestGroupQueue) ackLocked(name string, err error) error {
+	name = q.lookupLocked(name)
+	q.landLocked(name)
+	it, ok := q.items[name]
+	if !ok {
+		return ErrNotFound
+	}
+	if q.budgetFailures <= 0 || err == nil {
+		return nil
+	}
+	now := q.now()
+	it.failures = append(q.recentFailures(it, now), now)
+	return nil
+}
+
+// recentFailures returns the failures within the budget window.
+func (q *TestGroupQueue) recentFailures(it *item, now time.Time) []time.Time {
+	cutoff := now.Add(-q.budgetWindow)
+	for len(it.failures) > 0 && !it.failures[0].After(cutoff) {
+		it.failures = it.failures[1:]
+	}
+	return it.failures
+}
+
+func (q *TestGroupQueue) overBudget(it *item, now time.Time) bool {
+	return q.budgetFailures > 0 && len(q.recentFailures(it, now)) >= q.budgetFailures
+}
+
+// preferHealthyLocked returns the next due item within budget, or head if there is none.
+func (q *TestGroupQueue) preferHealthyLocked(head *item, now time.Time) *item {
+	if !q.overBudget(head, now) {
+		return head
+	}
+	best := q.store().firstDue(now, func(it *item) bool {
+		return !q.overBudget(it, now)
+	})
+	if best == nil {
+		q.rescheduled(head.when) // deferred past later groups
+		return head
+	}
+	return best
+}
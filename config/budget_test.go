@@ -0,0 +1,132 @@
+/*
+Copyright 2021 The TestGrid Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package config
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	configpb "github.com/GoogleCloudPlatform/testgrid/pb/config"
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestErrorBudget(t *testing.T) {
+	start := time.Date(2021, 1, 2, 3, 4, 5, 0, time.UTC)
+	boom := errors.New("boom")
+	cases := []struct {
+		name  string
+		whens map[string]time.Duration
+		acks  map[string][]error
+		wait  time.Duration
+
+		want []string
+	}{
+		{
+			name: "within budget",
+			whens: map[string]time.Duration{
+				"flaky":   -time.Hour,
+				"healthy": 0,
+			},
+			acks: map[string][]error{
+				"flaky": {boom, nil},
+			},
+			want: []string{"flaky", "healthy"},
+		},
+		{
+			name: "over budget waits for healthy groups",
+			whens: map[string]time.Duration{
+				"broken":  -time.Hour,
+				"healthy": 0,
+				"other":   -time.Minute,
+			},
+			acks: map[string][]error{
+				"broken": {boom, boom},
+			},
+			want: []string{"other", "healthy", "broken"},
+		},
+		{
+			name: "over budget dispatched when nothing healthy is due",
+			whens: map[string]time.Duration{
+				"broken":  -time.Hour,
+				"healthy": time.Minute,
+			},
+			acks: map[string][]error{
+				"broken": {boom, boom},
+			},
+			want: []string{"broken", "healthy"},
+		},
+		{
+			name: "old failures expire",
+			whens: map[string]time.Duration{
+				"recovered": -time.Hour,
+				"healthy":   0,
+			},
+			acks: map[string][]error{
+				"recovered": {boom, boom},
+			},
+			wait: 2 * time.Hour,
+			want: []string{"recovered", "healthy"},
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			clock := NewFakeClock(start)
+			q := NewTestGroupQueue(WithClock(clock), WithErrorBudget(2, time.Hour), WithOrderCheck())
+			for name, d := range tc.whens {
+				if err := q.Add(&configpb.TestGroup{Name: name}, start.Add(d)); err != nil {
+					t.Fatalf("Add() got unexpected error: %v", err)
+				}
+			}
+			for name, errs := range tc.acks {
+				for _, err := range errs {
+					if err := q.Ack(name, err); err != nil {
+						t.Fatalf("Ack() got unexpected error: %v", err)
+					}
+				}
+			}
+			clock.Advance(tc.wait)
+
+			var got []string
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+			err := q.SendFunc(ctx, func(_ context.Context, tg *configpb.TestGroup) error {
+				got = append(got, tg.Name)
+				if len(got) == len(tc.want) {
+					cancel()
+					return nil
+				}
+				if depth, _, when := q.Status(); depth > 0 && when.After(clock.Now()) {
+					clock.Advance(when.Sub(clock.Now()))
+				}
+				return nil
+			}, 0)
+			if err != nil && err != context.Canceled {
+				t.Errorf("SendFunc() got unexpected error: %v", err)
+			}
+			if diff := cmp.Diff(tc.want, got); diff != "" {
+				t.Errorf("SendFunc() got unexpected order (-want +got):\n%s", diff)
+			}
+		})
+	}
+
+	if err := NewTestGroupQueue().Ack("missing", boom); err == nil {
+		t.Error("Ack() wanted an error for a missing group")
+	}
+}
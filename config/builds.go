@@ -0,0 +1,76 @@
+/*
+Copyright 2021 The TestGrid Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package config
+
+import (
+	configpb "github.com/GoogleCloudPlatform/testgrid/pb/config"
+	"github.com/sirupsen/logrus"
+)
+
+// SetBuildThreshold sets how many new builds NoteBuilds waits for before pulling each group forward.
+//
+// Updating a group with a large grid for a single new build is wasteful,
+// so such groups may wait for several builds to accumulate. A nil
+// threshold, the default, or a threshold below 1 pulls a group forward on
+// every new build.
+func (q *TestGroupQueue) SetBuildThreshold(threshold func(*configpb.TestGroup) int) {
+	q.lock.Lock()
+	defer q.lock.Unlock()
+	q.buildThreshold = threshold
+}
+
+// NoteBuilds records n new builds for the group, such as from a notification, pulling it forward once enough accumulate.
+//
+// Adds n to the group's pending builds, which the group keeps until Send
+// next dispatches it, even as Fix or FixAll reschedule it. Once the pending
+// builds reach the group's threshold, see SetBuildThreshold, the group
+// becomes due now unless it is already due.
+func (q *TestGroupQueue) NoteBuilds(name string, n int) (err error) {
+	q.lock.Lock()
+	defer q.lock.Unlock()
+	defer q.rouse()
+	defer q.recoverLocked(&err)
+
+	name = q.lookupLocked(name)
+	it, ok := q.items[name]
+	if !ok {
+		return ErrNotFound
+	}
+	if n <= 0 {
+		return nil
+	}
+	it.pending += n
+	threshold := 1
+	if q.buildThreshold != nil {
+		threshold = q.buildThreshold(it.tg)
+	}
+	if it.pending < threshold {
+		return nil
+	}
+	now := q.truncate(q.now())
+	if !it.when.After(now) {
+		return nil
+	}
+	logrus.WithFields(logrus.Fields{
+		"group":   name,
+		"pending": it.pending,
+	}).Info("Pulling forward group with new builds")
+	q.fixedLocked(it, now, "builds")
+	q.scheduleLocked(it, now)
+	q.reorderLocked(it)
+	return nil
+}
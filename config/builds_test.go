@@ -0,0 +1,179 @@
+/*
+Copyright 2021 The TestGrid Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package config
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	configpb "github.com/GoogleCloudPlatform/testgrid/pb/config"
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestNoteBuilds(t *testing.T) {
+	now := time.Date(2021, 1, 2, 3, 4, 5, 0, time.UTC)
+	later := now.Add(time.Hour)
+	threshold := func(tg *configpb.TestGroup) int {
+		return int(tg.DaysOfResults)
+	}
+	cases := []struct {
+		name      string
+		threshold func(*configpb.TestGroup) int
+		days      int32
+		notes     []int
+		fix       bool // between notes
+		want      time.Time
+		pending   int
+		err       error
+	}{
+		{
+			name:    "default threshold",
+			notes:   []int{1},
+			want:    now,
+			pending: 1,
+		},
+		{
+			name:      "below threshold",
+			threshold: threshold,
+			days:      3,
+			notes:     []int{1, 1},
+			want:      later,
+			pending:   2,
+		},
+		{
+			name:      "crosses threshold",
+			threshold: threshold,
+			days:      3,
+			notes:     []int{1, 1, 1},
+			want:      now,
+			pending:   3,
+		},
+		{
+			name:      "crosses threshold at once",
+			threshold: threshold,
+			days:      3,
+			notes:     []int{5},
+			want:      now,
+			pending:   5,
+		},
+		{
+			name:      "threshold below one",
+			threshold: threshold,
+			notes:     []int{1},
+			want:      now,
+			pending:   1,
+		},
+		{
+			name:      "survives fix",
+			threshold: threshold,
+			days:      3,
+			notes:     []int{2, 1},
+			fix:       true,
+			want:      now,
+			pending:   3,
+		},
+		{
+			name:      "no builds",
+			threshold: threshold,
+			days:      1,
+			notes:     []int{0, -1},
+			want:      later,
+		},
+		{
+			name:  "missing",
+			notes: []int{1},
+			want:  later,
+			err:   ErrNotFound,
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			q := NewTestGroupQueue(WithClock(NewFakeClock(now)))
+			q.Init([]*configpb.TestGroup{{Name: "hello", DaysOfResults: tc.days}}, later)
+			q.SetBuildThreshold(tc.threshold)
+			name := "hello"
+			if tc.err != nil {
+				name = "missing"
+			}
+			for i, n := range tc.notes {
+				if tc.fix && i > 0 {
+					if err := q.Fix("hello", later.Add(time.Minute)); err != nil {
+						t.Fatalf("Fix() got unexpected error: %v", err)
+					}
+				}
+				if err := q.NoteBuilds(name, n); !errors.Is(err, tc.err) {
+					t.Fatalf("NoteBuilds() got error %v, want %v", err, tc.err)
+				}
+			}
+			items := q.Items()
+			want := []QueueItem{{Name: "hello", When: tc.want, Pending: tc.pending}}
+			if diff := cmp.Diff(want, items); diff != "" {
+				t.Errorf("Items() got unexpected diff (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestNoteBuildsResetOnDispatch(t *testing.T) {
+	now := time.Date(2021, 1, 2, 3, 4, 5, 0, time.UTC)
+	clock := NewFakeClock(now)
+	q := NewTestGroupQueue(WithClock(clock))
+	q.Init([]*configpb.TestGroup{{Name: "hello"}}, now.Add(time.Hour))
+	q.SetBuildThreshold(func(*configpb.TestGroup) int { return 2 })
+
+	pending := func(want int) {
+		t.Helper()
+		if got := q.Items()[0].Pending; got != want {
+			t.Errorf("Items() got %d pending builds, want %d", got, want)
+		}
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	ch := make(chan *configpb.TestGroup, 1)
+	go q.Send(ctx, ch, time.Hour)
+	if err := clock.BlockUntil(ctx, 1); err != nil { // Send is sleeping
+		t.Fatalf("BlockUntil() got unexpected error: %v", err)
+	}
+
+	if err := q.NoteBuilds("hello", 1); err != nil {
+		t.Fatalf("NoteBuilds() got unexpected error: %v", err)
+	}
+	pending(1)
+	if err := q.NoteBuilds("hello", 1); err != nil {
+		t.Fatalf("NoteBuilds() got unexpected error: %v", err)
+	}
+	select {
+	case <-ch:
+	case <-ctx.Done():
+		t.Fatal("Send() never dispatched the group with new builds")
+	}
+	if err := clock.BlockUntil(ctx, 1); err != nil {
+		t.Fatalf("BlockUntil() got unexpected error: %v", err)
+	}
+	pending(0)
+
+	if err := q.NoteBuilds("hello", 1); err != nil {
+		t.Fatalf("NoteBuilds() got unexpected error: %v", err)
+	}
+	pending(1)
+	if when, err := q.When("hello"); err != nil || !when.Equal(now.Add(time.Hour)) {
+		t.Errorf("When() got %s, %v, want %s", when, err, now.Add(time.Hour))
+	}
+}
@@ -0,0 +1,90 @@
+/*
+Copyright 2021 The TestGrid Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package config
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	configpb "github.com/GoogleCloudPlatform/testgrid/pb/config"
+)
+
+// ErrFull is returned when adding a group to a queue at its maximum size.
+var ErrFull = errors.New("queue full")
+
+// WithMaxSize limits the number of groups Add, AddIfAbsent and AddBlocking allow in the queue.
+//
+// Add returns ErrFull and AddIfAbsent returns false rather than adding a
+// new group to a full queue, whereas AddBlocking waits for room. Updating
+// an existing group is always allowed. Init and Merge ignore the limit,
+// since they follow the configuration, and may leave the queue over it.
+func WithMaxSize(n int) QueueOption {
+	return func(q *TestGroupQueue) {
+		q.maxSize = n
+	}
+}
+
+// AddBlocking adds the group like Add, waiting for room while the queue is full, see WithMaxSize.
+//
+// The queue has room once Send delivers a group with a zero frequency, or
+// groups are removed, such as by Remove, PopAll or Init. Returns the
+// context's error if it is done first.
+//
+// Never call AddBlocking from the goroutine that consumes the queue, such
+// as by calling Send, as it will deadlock waiting for itself to make room.
+func (q *TestGroupQueue) AddBlocking(ctx context.Context, tg *configpb.TestGroup, when time.Time) error {
+	if err := validateGroup(tg); err != nil {
+		return invalidGroupError(tg, err)
+	}
+	for {
+		shrunk, err := q.add(tg, when)
+		if err != ErrFull {
+			return err
+		}
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-shrunk:
+		}
+	}
+}
+
+// fullLocked returns whether adding the group would exceed the maximum size.
+func (q *TestGroupQueue) fullLocked(name string) bool {
+	if q.maxSize <= 0 || q.store().Len() < q.maxSize {
+		return false
+	}
+	_, ok := q.items[q.lookupLocked(name)]
+	return !ok
+}
+
+// shrunkLocked returns a channel closed when the queue next shrinks.
+func (q *TestGroupQueue) shrunkLocked() <-chan struct{} {
+	if q.shrunk == nil {
+		q.shrunk = make(chan struct{})
+	}
+	return q.shrunk
+}
+
+// shrinkLocked wakes any callers of AddBlocking waiting for room.
+func (q *TestGroupQueue) shrinkLocked() {
+	if q.shrunk != nil {
+		close(q.shrunk)
+		q.shrunk = nil
+	}
+}
@@ -0,0 +1,140 @@
+/*
+Copyright 2021 The TestGrid Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package config
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	configpb "github.com/GoogleCloudPlatform/testgrid/pb/config"
+)
+
+func TestMaxSize(t *testing.T) {
+	now := time.Now()
+	q := NewTestGroupQueue(WithMaxSize(2))
+	if err := q.Add(&configpb.TestGroup{Name: "hi"}, now); err != nil {
+		t.Fatalf("Add(hi) got unexpected error: %v", err)
+	}
+	if !q.AddIfAbsent(&configpb.TestGroup{Name: "there"}, now) {
+		t.Fatal("AddIfAbsent(there) did not add to a queue with room")
+	}
+	if err := q.Add(&configpb.TestGroup{Name: "full"}, now); err != ErrFull {
+		t.Errorf("Add(full) got %v, want %v", err, ErrFull)
+	}
+	if q.AddIfAbsent(&configpb.TestGroup{Name: "full"}, now) {
+		t.Error("AddIfAbsent(full) added to a full queue")
+	}
+	if err := q.Add(&configpb.TestGroup{Name: "hi", DaysOfResults: 7}, now); err != nil {
+		t.Errorf("Add(hi) got unexpected error updating a full queue: %v", err)
+	}
+	if err := q.Init([]*configpb.TestGroup{{Name: "a"}, {Name: "b"}, {Name: "c"}}, now); err != nil {
+		t.Errorf("Init() got unexpected error: %v", err)
+	}
+	if got, want := q.Len(), 3; got != want {
+		t.Errorf("Init() got %d groups, want %d", got, want)
+	}
+}
+
+func TestAddBlocking(t *testing.T) {
+	now := time.Now()
+	cases := []struct {
+		name  string
+		group *configpb.TestGroup
+		room  func(*testing.T, *TestGroupQueue)
+		err   error
+	}{
+		{
+			name:  "update",
+			group: &configpb.TestGroup{Name: "hi", DaysOfResults: 7},
+		},
+		{
+			name:  "canceled",
+			group: &configpb.TestGroup{Name: "new"},
+			err:   context.Canceled,
+		},
+		{
+			name:  "remove",
+			group: &configpb.TestGroup{Name: "new"},
+			room: func(t *testing.T, q *TestGroupQueue) {
+				if err := q.Remove("hi"); err != nil {
+					t.Errorf("Remove() got unexpected error: %v", err)
+				}
+			},
+		},
+		{
+			name:  "pop all",
+			group: &configpb.TestGroup{Name: "new"},
+			room: func(_ *testing.T, q *TestGroupQueue) {
+				q.PopAll()
+			},
+		},
+		{
+			name:  "send",
+			group: &configpb.TestGroup{Name: "new"},
+			room: func(t *testing.T, q *TestGroupQueue) {
+				ctx, cancel := context.WithCancel(context.Background())
+				defer cancel()
+				err := q.SendFunc(ctx, func(context.Context, *configpb.TestGroup) error {
+					cancel() // after delivering one group
+					return nil
+				}, 0)
+				if err != context.Canceled {
+					t.Errorf("SendFunc() got %v, want %v", err, context.Canceled)
+				}
+			},
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			q := NewTestGroupQueue(WithMaxSize(2))
+			q.Init([]*configpb.TestGroup{{Name: "hi"}, {Name: "there"}}, now)
+			ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+			defer cancel()
+			errCh := make(chan error, 1)
+			go func() {
+				errCh <- q.AddBlocking(ctx, tc.group, now)
+			}()
+			if tc.room != nil {
+				select {
+				case err := <-errCh:
+					t.Fatalf("AddBlocking() returned %v before there was room", err)
+				case <-time.After(10 * time.Millisecond):
+				}
+				tc.room(t, q)
+			} else if tc.err != nil {
+				cancel()
+			}
+			if err := <-errCh; err != tc.err {
+				t.Fatalf("AddBlocking() got %v, want %v", err, tc.err)
+			}
+			if _, err := q.When(tc.group.Name); (err == nil) != (tc.err == nil) {
+				t.Errorf("When(%s) got %v, want added=%t", tc.group.Name, err, tc.err == nil)
+			}
+		})
+	}
+}
+
+func TestAddBlockingInvalid(t *testing.T) {
+	q := NewTestGroupQueue(WithMaxSize(1))
+	var invalid *InvalidGroupsError
+	if err := q.AddBlocking(context.Background(), &configpb.TestGroup{}, time.Now()); !errors.As(err, &invalid) {
+		t.Errorf("AddBlocking() got %v, want an *InvalidGroupsError", err)
+	}
+}
@@ -0,0 +1,108 @@
+/*
+Copyright 2021 The TestGrid Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package config
+
+import (
+	configpb "github.com/GoogleCloudPlatform/testgrid/pb/config"
+)
+
+// SetClassLimits replaces the maximum groups of each class in flight at once.
+//
+// Classify assigns each group a class, for example "large" for groups whose
+// grids need the most memory to update. Classes without a limit are
+// unlimited, as are all classes when classify is nil.
+//
+// As with SetBucketLimits, a group is in flight from when Send dispatches it
+// until Ack is called, or the SendFunc or SendFuncDelay handler returns, and
+// Send skips due groups whose class is at its limit, dispatching the next
+// eligible group instead. So a pool of SendFunc workers, see
+// WithMultipleSenders, processes at most the limit of each class at once.
+func (q *TestGroupQueue) SetClassLimits(classify func(*configpb.TestGroup) string, limits map[string]int) {
+	q.lock.Lock()
+	defer q.lock.Unlock()
+	defer q.rouse()
+	q.classify = classify
+	q.classLimits = make(map[string]int, len(limits))
+	for class, n := range limits {
+		q.classLimits[class] = n
+	}
+	for _, it := range q.store().all() {
+		it.class = q.classOf(it.tg)
+	}
+}
+
+// InFlightClasses returns the number of groups in flight of each class with any.
+func (q *TestGroupQueue) InFlightClasses() map[string]int {
+	q.lock.RLock()
+	defer q.lock.RUnlock()
+	out := make(map[string]int, len(q.classLoad))
+	for class, n := range q.classLoad {
+		out[class] = n
+	}
+	return out
+}
+
+// classOf returns the group's class, or the empty class without a classifier.
+func (q *TestGroupQueue) classOf(tg *configpb.TestGroup) string {
+	if q.classify == nil {
+		return ""
+	}
+	return q.classify(tg)
+}
+
+// classFullLocked returns true when the item's class is at its limit.
+func (q *TestGroupQueue) classFullLocked(it *item) bool {
+	if q.classify == nil {
+		return false
+	}
+	limit, ok := q.classLimits[it.class]
+	if !ok || q.classLoad[it.class] < limit {
+		return false
+	}
+	_, flying := q.classFlight[it.tg.Name] // already counted
+	return !flying
+}
+
+// launchClassLocked records the group as in flight when its class is limited.
+func (q *TestGroupQueue) launchClassLocked(it *item) {
+	if q.classify == nil || len(q.classLimits) == 0 {
+		return
+	}
+	name := it.tg.Name
+	if _, ok := q.classFlight[name]; ok {
+		return
+	}
+	if q.classFlight == nil {
+		q.classFlight = map[string]string{}
+		q.classLoad = map[string]int{}
+	}
+	q.classFlight[name] = it.class
+	q.classLoad[it.class]++
+}
+
+// landClassLocked records the group is no longer in flight, returning whether it was.
+func (q *TestGroupQueue) landClassLocked(name string) bool {
+	class, ok := q.classFlight[name]
+	if !ok {
+		return false
+	}
+	delete(q.classFlight, name)
+	if q.classLoad[class]--; q.classLoad[class] <= 0 {
+		delete(q.classLoad, class)
+	}
+	return true
+}
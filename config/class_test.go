@@ -0,0 +1,169 @@
+/*
+Copyright 2021 The TestGrid Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package config
+
+import (
+	"context"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	configpb "github.com/GoogleCloudPlatform/testgrid/pb/config"
+	"github.com/google/go-cmp/cmp"
+)
+
+// sizeClass classifies groups by the prefix of their name.
+func sizeClass(tg *configpb.TestGroup) string {
+	return strings.SplitN(tg.Name, "-", 2)[0]
+}
+
+func TestClassLimits(t *testing.T) {
+	now := time.Now()
+	var q TestGroupQueue
+	q.Init([]*configpb.TestGroup{
+		{Name: "large-1"},
+		{Name: "large-2"},
+		{Name: "small-1"},
+		{Name: "large-3"},
+		{Name: "small-2"},
+	}, now)
+	q.SetClassLimits(sizeClass, map[string]int{"large": 2})
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	ch := make(chan *configpb.TestGroup)
+	errCh := make(chan error, 1)
+	go func() {
+		errCh <- q.Send(ctx, ch, 0)
+	}()
+	receive := func(want ...string) {
+		t.Helper()
+		var got []string
+		for range want {
+			select {
+			case tg := <-ch:
+				got = append(got, tg.Name)
+			case <-ctx.Done():
+				t.Fatalf("Send() stopped after %v, want %v", got, want)
+			}
+		}
+		if diff := cmp.Diff(want, got); diff != "" {
+			t.Fatalf("Send() got unexpected groups (-want +got):\n%s", diff)
+		}
+	}
+	stalled := func() {
+		t.Helper()
+		select {
+		case tg := <-ch:
+			t.Fatalf("Send() dispatched %s beyond its class limit", tg.Name)
+		case <-time.After(50 * time.Millisecond):
+		}
+	}
+
+	receive("large-1", "large-2", "small-1", "small-2")
+	stalled()
+	want := map[string]int{"large": 2, "small": 2}
+	if diff := cmp.Diff(want, q.InFlightClasses()); diff != "" {
+		t.Errorf("InFlightClasses() got unexpected diff (-want +got):\n%s", diff)
+	}
+	if diag := q.Diagnose(); diag.Reason != DiagnosisInFlight {
+		t.Errorf("Diagnose() got %s, want %s", diag.Reason, DiagnosisInFlight)
+	}
+
+	if err := q.Ack("large-2", nil); err != nil && err != ErrNotFound {
+		t.Fatalf("Ack() got unexpected error: %v", err)
+	}
+	receive("large-3")
+
+	if err := <-errCh; err != nil {
+		t.Errorf("Send() got unexpected error: %v", err)
+	}
+}
+
+func TestClassLimitsWorkers(t *testing.T) {
+	now := time.Now()
+	q := NewTestGroupQueue(WithMultipleSenders())
+	var groups []*configpb.TestGroup
+	for _, name := range []string{"large-1", "large-2", "large-3", "small-1", "small-2", "small-3", "small-4"} {
+		groups = append(groups, &configpb.TestGroup{Name: name})
+	}
+	q.Init(groups, now)
+	q.SetClassLimits(sizeClass, map[string]int{"large": 1})
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	var lock sync.Mutex
+	var got []string
+	load := map[string]int{}
+	most := map[string]int{}
+	handler := func(_ context.Context, tg *configpb.TestGroup) error {
+		class := sizeClass(tg)
+		lock.Lock()
+		got = append(got, tg.Name)
+		load[class]++
+		if load[class] > most[class] {
+			most[class] = load[class]
+		}
+		lock.Unlock()
+		time.Sleep(10 * time.Millisecond)
+		lock.Lock()
+		load[class]--
+		lock.Unlock()
+		return nil
+	}
+
+	var wg sync.WaitGroup
+	for i := 0; i < 3; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if err := q.SendFunc(ctx, handler, 0); err != nil {
+				t.Errorf("SendFunc() got unexpected error: %v", err)
+			}
+		}()
+	}
+	wg.Wait()
+
+	if len(got) != len(groups) {
+		t.Errorf("SendFunc() delivered %v, want all %d groups", got, len(groups))
+	}
+	if most["large"] != 1 {
+		t.Errorf("SendFunc() processed %d large groups at once, want 1", most["large"])
+	}
+	if n := len(q.InFlightClasses()); n != 0 {
+		t.Errorf("InFlightClasses() got %d classes after SendFunc, want none", n)
+	}
+}
+
+func TestClassLimitsReclassify(t *testing.T) {
+	now := time.Now()
+	var q TestGroupQueue
+	q.Init([]*configpb.TestGroup{{Name: "a"}, {Name: "b"}}, now)
+	q.SetClassLimits(func(*configpb.TestGroup) string { return "big" }, map[string]int{"big": 1})
+	q.SetClassLimits(nil, map[string]int{"big": 1})
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	ch := make(chan *configpb.TestGroup, 2)
+	if err := q.Send(ctx, ch, 0); err != nil {
+		t.Fatalf("Send() got unexpected error: %v", err)
+	}
+	if n := len(ch); n != 2 {
+		t.Errorf("Send() delivered %d groups without a classifier, want 2", n)
+	}
+}
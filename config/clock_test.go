@@ -0,0 +1,90 @@
+/*
+Copyright 2021 The TestGrid Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package config
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestFakeClock(t *testing.T) {
+	now := time.Date(2021, 1, 2, 3, 4, 5, 0, time.UTC)
+	c := NewFakeClock(now)
+
+	early := c.NewTimer(time.Second)
+	late := c.NewTimer(time.Minute)
+	stopped := c.NewTimer(time.Second)
+	immediate := c.NewTimer(0)
+	if n := c.Timers(); n != 3 {
+		t.Errorf("Timers() wanted 3, got %d", n)
+	}
+	if !stopped.Stop() {
+		t.Error("Stop() wanted true for a pending timer")
+	}
+	select {
+	case <-immediate.C():
+	default:
+		t.Error("immediate timer did not fire")
+	}
+
+	c.Advance(30 * time.Second)
+	if got, want := c.Now(), now.Add(30*time.Second); !got.Equal(want) {
+		t.Errorf("Now() wanted %v, got %v", want, got)
+	}
+	select {
+	case <-early.C():
+	default:
+		t.Error("early timer did not fire")
+	}
+	select {
+	case <-late.C():
+		t.Error("late timer fired early")
+	case <-stopped.C():
+		t.Error("stopped timer fired")
+	default:
+	}
+	if early.Stop() {
+		t.Error("Stop() wanted false for a fired timer")
+	}
+
+	c.Advance(30 * time.Second)
+	select {
+	case <-late.C():
+	default:
+		t.Error("late timer did not fire")
+	}
+	if n := c.Timers(); n != 0 {
+		t.Errorf("Timers() wanted 0, got %d", n)
+	}
+}
+
+func TestFakeClockBlockUntil(t *testing.T) {
+	c := NewFakeClock(time.Now())
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	go c.NewTimer(time.Hour)
+	if err := c.BlockUntil(ctx, 1); err != nil {
+		t.Errorf("BlockUntil() got unexpected error: %v", err)
+	}
+
+	ctx, cancel = context.WithCancel(context.Background())
+	cancel()
+	if err := c.BlockUntil(ctx, 2); err == nil {
+		t.Error("BlockUntil() wanted an error after the context expired")
+	}
+}
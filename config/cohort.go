@@ -0,0 +1,99 @@
+/*
+Copyright 2021 The TestGrid Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package config
+
+import (
+	"fmt"
+	"sort"
+	"time"
+
+	"bitbucket.org/creachadair/stringset"
+	"github.com/sirupsen/logrus"
+)
+
+// SetCohorts replaces the sets of groups dispatched adjacently, keyed by cohort name.
+//
+// Dispatching the first member of a cohort makes the other members due
+// immediately, so they are dispatched next, subject to any Coordinator.
+// The other members do not pull the cohort forward again until each has
+// been dispatched, so a cohort is pulled forward at most once per cycle.
+//
+// Membership is by name: members may be added to or removed from the queue,
+// including by Init, without calling SetCohorts again.
+// Returns an error without changing cohorts if a group belongs to multiple cohorts.
+func (q *TestGroupQueue) SetCohorts(cohorts map[string][]string) error {
+	names := make([]string, 0, len(cohorts))
+	for name := range cohorts {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	cohortOf := map[string]string{}
+	members := make(map[string][]string, len(cohorts))
+	for _, name := range names {
+		for _, group := range cohorts[name] {
+			if other, ok := cohortOf[group]; ok && other != name {
+				return fmt.Errorf("group %q in cohorts %q and %q", group, other, name)
+			}
+			cohortOf[group] = name
+		}
+		members[name] = append([]string(nil), cohorts[name]...)
+	}
+
+	q.lock.Lock()
+	defer q.lock.Unlock()
+	q.cohorts = members
+	q.cohortOf = cohortOf
+	q.pulled = map[string]stringset.Set{}
+	return nil
+}
+
+// pullCohortLocked makes the rest of the dispatched group's cohort due at now.
+//
+// Does nothing if the group is awaiting dispatch after an earlier member.
+func (q *TestGroupQueue) pullCohortLocked(name string, now time.Time) {
+	cohort, ok := q.cohortOf[name]
+	if !ok {
+		return
+	}
+	pending := q.pulled[cohort]
+	if pending.Contains(name) {
+		pending.Discard(name)
+		return
+	}
+	when := q.truncate(now)
+	pending = stringset.New()
+	for _, member := range q.cohorts[cohort] {
+		it, ok := q.items[member]
+		if !ok || member == name {
+			continue
+		}
+		pending.Add(member) // even if already due, so it does not start another cycle
+		if !it.when.After(when) {
+			continue
+		}
+		logrus.WithFields(logrus.Fields{
+			"cohort": cohort,
+			"group":  member,
+			"after":  name,
+		}).Info("Pulling cohort forward")
+		q.fixedLocked(it, when, "cohort")
+		q.scheduleLocked(it, when)
+		q.reorderLocked(it)
+	}
+	q.pulled[cohort] = pending
+}
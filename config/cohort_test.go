@@ -0,0 +1,124 @@
+/*
+Copyright 2021 The TestGrid Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package config
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"testing"
+	"time"
+
+	configpb "github.com/GoogleCloudPlatform/testgrid/pb/config"
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestCohorts(t *testing.T) {
+	start := time.Date(2021, 1, 2, 3, 4, 5, 0, time.UTC)
+	clock := NewFakeClock(start)
+	var buf bytes.Buffer
+	log := NewAuditLog(&buf, 0)
+	q := NewTestGroupQueue(WithClock(clock), WithAuditLog(log), WithOrderCheck())
+	if err := q.SetCohorts(map[string][]string{
+		"dash": {"a", "b", "c"},
+	}); err != nil {
+		t.Fatalf("SetCohorts() got unexpected error: %v", err)
+	}
+	whens := map[string]time.Duration{
+		"a": 0,
+		"b": 10 * time.Minute,
+		"c": 20 * time.Minute,
+		"x": 5 * time.Minute,
+	}
+	var groups []*configpb.TestGroup
+	for _, name := range []string{"a", "b", "c", "x"} {
+		groups = append(groups, &configpb.TestGroup{Name: name})
+	}
+	q.Init(groups, start)
+	for name, d := range whens {
+		q.Fix(name, start.Add(d))
+	}
+
+	send := func(n int) []string {
+		var got []string
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+		err := q.SendFunc(ctx, func(_ context.Context, tg *configpb.TestGroup) error {
+			got = append(got, tg.Name)
+			if len(got) == n {
+				cancel()
+				return nil
+			}
+			if _, _, when := q.Status(); when.After(clock.Now()) {
+				clock.Advance(when.Sub(clock.Now()))
+			}
+			return nil
+		}, time.Hour)
+		if err != nil && err != context.Canceled {
+			t.Fatalf("SendFunc() got unexpected error: %v", err)
+		}
+		return got
+	}
+
+	// Dispatching a pulls b and c forward once, the next cycle is already adjacent.
+	want := []string{"a", "b", "c", "x", "a", "b", "c", "x"}
+	if diff := cmp.Diff(want, send(len(want))); diff != "" {
+		t.Errorf("SendFunc() got unexpected order (-want +got):\n%s", diff)
+	}
+
+	// Membership survives Init, ignoring groups no longer present.
+	q.Init(groups[1:], start)
+	if err := q.Fix("b", clock.Now()); err != nil {
+		t.Fatalf("Fix() got unexpected error: %v", err)
+	}
+	want = []string{"b", "c", "x"}
+	if diff := cmp.Diff(want, send(len(want))); diff != "" {
+		t.Errorf("SendFunc() after Init got unexpected order (-want +got):\n%s", diff)
+	}
+
+	if err := log.Close(); err != nil {
+		t.Fatalf("Close() got unexpected error: %v", err)
+	}
+	var pulls []string
+	dec := json.NewDecoder(&buf)
+	for dec.More() {
+		var r AuditRecord
+		if err := dec.Decode(&r); err != nil {
+			t.Fatalf("Decode() got unexpected error: %v", err)
+		}
+		if r.Reason == "cohort" {
+			pulls = append(pulls, r.Group)
+		}
+	}
+	if diff := cmp.Diff([]string{"b", "c", "c"}, pulls); diff != "" {
+		t.Errorf("SendFunc() got unexpected cohort pulls (-want +got):\n%s", diff)
+	}
+}
+
+func TestSetCohortsConflict(t *testing.T) {
+	var q TestGroupQueue
+	err := q.SetCohorts(map[string][]string{
+		"one": {"a", "b"},
+		"two": {"b", "c"},
+	})
+	if err == nil {
+		t.Error("SetCohorts() wanted an error for a group in two cohorts")
+	}
+	if q.cohortOf != nil {
+		t.Errorf("SetCohorts() changed cohorts despite an error: %v", q.cohortOf)
+	}
+}
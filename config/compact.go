@@ -0,0 +1,43 @@
+/*
+Copyright 2021 The TestGrid Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package config
+
+import (
+	"github.com/sirupsen/logrus"
+)
+
+// Compact reallocates the queue's storage to fit the groups it holds.
+//
+// Neither the heap nor the index of groups ever give back memory, so a
+// long-lived queue keeps the footprint of its largest config after Init
+// or Remove shrink it. Compact reclaims that memory without changing the
+// schedule.
+func (q *TestGroupQueue) Compact() {
+	q.lock.Lock()
+	defer q.lock.Unlock()
+	before := cap(q.queue)
+	items := make(map[string]*item, len(q.items))
+	for name, it := range q.items {
+		items[name] = it
+	}
+	q.store().compact()
+	q.items = items
+	logrus.WithFields(logrus.Fields{
+		"before": before,
+		"after":  cap(q.queue),
+	}).Debug("Compacted queue")
+}
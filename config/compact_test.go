@@ -0,0 +1,61 @@
+/*
+Copyright 2021 The TestGrid Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package config
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	configpb "github.com/GoogleCloudPlatform/testgrid/pb/config"
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestCompact(t *testing.T) {
+	now := time.Date(2021, 1, 2, 3, 4, 5, 0, time.UTC)
+	q := NewTestGroupQueue(WithClock(NewFakeClock(now)))
+	var groups []*configpb.TestGroup
+	for i := 0; i < 1000; i++ {
+		groups = append(groups, &configpb.TestGroup{Name: fmt.Sprintf("group-%d", i)})
+	}
+	q.Init(groups, now)
+	q.Init([]*configpb.TestGroup{{Name: "hi"}, {Name: "there"}, {Name: "world"}}, now)
+	q.Fix("world", now.Add(-time.Minute))
+	if got := cap(q.queue); got < 1000 {
+		t.Fatalf("cap(queue) got %d before Compact(), want at least 1000", got)
+	}
+
+	q.Compact()
+
+	if got, want := cap(q.queue), len(q.queue); got != want {
+		t.Errorf("cap(queue) got %d after Compact(), want %d", got, want)
+	}
+	if err := q.Verify(); err != nil {
+		t.Errorf("Compact() corrupted the queue: %v", err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	var got []string
+	q.SendFunc(ctx, func(_ context.Context, tg *configpb.TestGroup) error {
+		got = append(got, tg.Name)
+		return nil
+	}, 0)
+	if diff := cmp.Diff([]string{"world", "hi", "there"}, got); diff != "" {
+		t.Errorf("SendFunc() got unexpected dispatches after Compact() (-want +got):\n%s", diff)
+	}
+}
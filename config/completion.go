@@ -0,0 +1,57 @@
+/*
+Copyright 2021 The TestGrid Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package config
+
+// WithCompletionSchedule reschedules each delivered group relative to when its delivery completed rather than when Send dispatched it.
+//
+// By default the interval is the gap between dispatches: Send reschedules a
+// group frequency after dispatching it, before a receiver accepts it or the
+// SendFunc handler returns, so slow receivers or handlers shorten the gap
+// between one update finishing and the next starting. With this option the
+// interval is the gap between updates: once a receiver accepts the group,
+// or the handler returns without error, the group is rescheduled the same
+// interval later, including any adapted interval, see
+// WithAdaptiveFrequency. Takes precedence over WithFixedRate.
+//
+// Groups whose schedule changed during delivery, such as by a Fix from the
+// handler or a delay from SendFuncDelay, keep their new schedule, as do
+// groups whose delivery failed. The Next time reported to SendDispatch
+// receivers remains the schedule at dispatch. SendWindowed is unaffected.
+func WithCompletionSchedule() QueueOption {
+	return func(q *TestGroupQueue) {
+		q.fromCompletion = true
+	}
+}
+
+// completedLocked reschedules a delivered group relative to now, see WithCompletionSchedule.
+func (q *TestGroupQueue) completedLocked(d Dispatch) {
+	it, ok := q.items[d.Group.Name]
+	if !ok || !it.when.Equal(d.Next) { // removed or changed during delivery
+		return
+	}
+	interval := q.intervalLocked(it, q.frequency)
+	if interval <= 0 {
+		return
+	}
+	when := q.truncate(q.now().Add(interval))
+	if when.Equal(it.when) {
+		return
+	}
+	q.fixedLocked(it, when, "completed")
+	q.scheduleLocked(it, when)
+	q.reorderLocked(it)
+}
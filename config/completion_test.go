@@ -0,0 +1,108 @@
+/*
+Copyright 2021 The TestGrid Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package config
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	configpb "github.com/GoogleCloudPlatform/testgrid/pb/config"
+)
+
+func TestCompletionSchedule(t *testing.T) {
+	now := time.Date(2021, 1, 2, 3, 4, 5, 0, time.UTC)
+	cases := []struct {
+		name       string
+		completion bool
+		opts       []QueueOption
+		handler    func(*TestGroupQueue) (time.Duration, error)
+		want       time.Duration // after now
+	}{
+		{
+			name: "after dispatch by default",
+			want: 10 * time.Minute,
+		},
+		{
+			name:       "after completion",
+			completion: true,
+			want:       15 * time.Minute,
+		},
+		{
+			name:       "after completion with fixed rate",
+			completion: true,
+			opts:       []QueueOption{WithFixedRate()},
+			want:       15 * time.Minute,
+		},
+		{
+			name:       "fixed by handler",
+			completion: true,
+			handler: func(q *TestGroupQueue) (time.Duration, error) {
+				return 0, q.Fix("hello", now.Add(time.Hour))
+			},
+			want: time.Hour,
+		},
+		{
+			name:       "delayed by handler",
+			completion: true,
+			handler: func(*TestGroupQueue) (time.Duration, error) {
+				return 30 * time.Minute, nil
+			},
+			want: 30 * time.Minute,
+		},
+		{
+			name:       "failed",
+			completion: true,
+			handler: func(*TestGroupQueue) (time.Duration, error) {
+				return 0, errors.New("boom")
+			},
+			want: 10 * time.Minute,
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			clock := NewFakeClock(now)
+			opts := append(tc.opts, WithClock(clock))
+			if tc.completion {
+				opts = append(opts, WithCompletionSchedule())
+			}
+			q := NewTestGroupQueue(opts...)
+			q.Init([]*configpb.TestGroup{{Name: "hello"}}, now)
+
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+			q.SendFuncDelay(ctx, func(context.Context, *configpb.TestGroup) (time.Duration, error) {
+				defer cancel()
+				clock.Advance(5 * time.Minute) // processing
+				if tc.handler == nil {
+					return 0, nil
+				}
+				return tc.handler(q)
+			}, 10*time.Minute)
+
+			when, err := q.When("hello")
+			if err != nil {
+				t.Fatalf("When() got unexpected error: %v", err)
+			}
+			if got := when.Sub(now); got != tc.want {
+				t.Errorf("When() got %s after now, want %s", got, tc.want)
+			}
+		})
+	}
+}
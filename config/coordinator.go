@@ -0,0 +1,180 @@
+/*
+Copyright 2021 The TestGrid Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package config
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// Coordinator limits how quickly multiple queues dispatch groups.
+//
+// Registered queues share a token bucket, acquiring a token before Send
+// dispatches each group. When several queues are waiting, the one whose
+// next group is most overdue receives the next token. The bucket refills
+// according to the clocks of the queues acquiring tokens, which should
+// therefore share a clock, see WithClock.
+type Coordinator struct {
+	qps   float64
+	burst float64
+
+	lock    sync.Mutex
+	tokens  float64
+	last    time.Time // of the last refill, zero before the first
+	waiters []waiter
+	waker   waker // woken whenever a token returns, a waiter leaves or the favored waiter changes
+}
+
+// waiter is a queue waiting for a token, and how overdue it last reported its next group.
+type waiter struct {
+	queue *TestGroupQueue
+	late  time.Duration
+}
+
+// NewCoordinator returns a coordinator allowing qps dispatches per second,
+// with bursts of up to burst dispatches.
+//
+// The bucket starts empty. Panics if qps or burst is not positive, which
+// would starve every queue.
+func NewCoordinator(qps float64, burst int) *Coordinator {
+	if !(qps > 0) { // including NaN
+		panic(fmt.Sprintf("non-positive qps for NewCoordinator: %v", qps))
+	}
+	if burst <= 0 {
+		panic(fmt.Sprintf("non-positive burst for NewCoordinator: %d", burst))
+	}
+	return &Coordinator{
+		qps:   qps,
+		burst: float64(burst),
+	}
+}
+
+// Register the queue so that Send acquires a token before each dispatch.
+func (c *Coordinator) Register(q *TestGroupQueue) {
+	q.lock.Lock()
+	defer q.lock.Unlock()
+	q.coordinator = c
+}
+
+// acquire blocks until q receives a token or the context expires.
+//
+// Must be called without holding the queue's lock.
+func (c *Coordinator) acquire(ctx context.Context, q *TestGroupQueue) error {
+	defer c.leave(q)
+	for {
+		late := q.lateness() // before locking c, which never waits on a queue's lock
+		c.lock.Lock()
+		gen := c.waker.generation()
+		if c.report(q, late) {
+			c.waker.wake()
+		}
+		c.refill(q.now())
+		favored := c.favored() == q
+		if c.tokens >= 1 && favored {
+			c.tokens--
+			c.lock.Unlock()
+			return nil
+		}
+		var timer Timer = noTimer{} // until the favored waiter takes the token and leaves
+		if c.tokens < 1 {
+			wait := time.Duration((1 - c.tokens) / c.qps * float64(time.Second))
+			if wait < time.Millisecond {
+				wait = time.Millisecond
+			}
+			timer = q.newTimer(wait)
+		}
+		c.lock.Unlock()
+
+		c.waker.wait(ctx, gen, timer)
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+	}
+}
+
+// release returns an unused token to the bucket.
+func (c *Coordinator) release() {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	c.tokens++
+	if c.tokens > c.burst {
+		c.tokens = c.burst
+	}
+	c.waker.wake()
+}
+
+func (c *Coordinator) leave(q *TestGroupQueue) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	for i, w := range c.waiters {
+		if w.queue == q {
+			c.waiters = append(c.waiters[:i], c.waiters[i+1:]...)
+			break
+		}
+	}
+	c.waker.wake()
+}
+
+// report records how overdue the waiting queue is, returning whether that changed the favored waiter.
+func (c *Coordinator) report(q *TestGroupQueue, late time.Duration) bool {
+	before := c.favored()
+	found := false
+	for i := range c.waiters {
+		if c.waiters[i].queue == q {
+			c.waiters[i].late = late
+			found = true
+			break
+		}
+	}
+	if !found {
+		c.waiters = append(c.waiters, waiter{queue: q, late: late})
+	}
+	return c.favored() != before
+}
+
+func (c *Coordinator) refill(now time.Time) {
+	if !c.last.IsZero() && now.After(c.last) {
+		c.tokens += now.Sub(c.last).Seconds() * c.qps
+		if c.tokens > c.burst {
+			c.tokens = c.burst
+		}
+	}
+	if now.After(c.last) {
+		c.last = now
+	}
+}
+
+// favored returns the waiting queue that last reported the most overdue group.
+func (c *Coordinator) favored() *TestGroupQueue {
+	var best *TestGroupQueue
+	var most time.Duration
+	for _, w := range c.waiters {
+		if best == nil || w.late > most {
+			best, most = w.queue, w.late
+		}
+	}
+	return best
+}
+
+// noTimer never fires, for waiting only until woken.
+type noTimer struct{}
+
+func (noTimer) C() <-chan time.Time { return nil }
+
+func (noTimer) Stop() bool { return false }
@@ -0,0 +1,169 @@
+/*
+Copyright 2021 The TestGrid Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package config
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"sync"
+	"testing"
+	"time"
+
+	configpb "github.com/GoogleCloudPlatform/testgrid/pb/config"
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestCoordinator(t *testing.T) {
+	const n = 5
+	now := time.Now()
+	groups := func(prefix string) []*configpb.TestGroup {
+		var tgs []*configpb.TestGroup
+		for i := 0; i < n; i++ {
+			tgs = append(tgs, &configpb.TestGroup{Name: fmt.Sprintf("%s-%d", prefix, i)})
+		}
+		return tgs
+	}
+	var stale, fresh TestGroupQueue
+	stale.Init(groups("stale"), now.Add(-time.Hour))
+	fresh.Init(groups("fresh"), now.Add(-time.Minute))
+
+	c := NewCoordinator(50, 1)
+	c.Register(&stale)
+	c.Register(&fresh)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	ch := make(chan *configpb.TestGroup)
+	var wg sync.WaitGroup
+	for _, q := range []*TestGroupQueue{&stale, &fresh} {
+		wg.Add(1)
+		go func(q *TestGroupQueue) {
+			defer wg.Done()
+			q.Send(ctx, ch, time.Hour)
+		}(q)
+	}
+
+	var got []string
+	for len(got) < 2*n {
+		select {
+		case tg := <-ch:
+			got = append(got, tg.Name)
+		case <-ctx.Done():
+			t.Fatalf("Send() only dispatched %v before timing out", got)
+		}
+	}
+	cancel()
+	wg.Wait()
+
+	var want []string
+	for _, tg := range append(groups("stale"), groups("fresh")...) {
+		want = append(want, tg.Name)
+	}
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Errorf("Send() got unexpected order (-want +got):\n%s", diff)
+	}
+}
+
+func TestCoordinatorRelease(t *testing.T) {
+	c := NewCoordinator(1, 2)
+	c.tokens = 1.5
+	c.release()
+	if c.tokens != 2 {
+		t.Errorf("release() wanted tokens capped at 2, got %f", c.tokens)
+	}
+}
+
+func TestNewCoordinatorInvalid(t *testing.T) {
+	cases := []struct {
+		name  string
+		qps   float64
+		burst int
+	}{
+		{name: "zero qps", qps: 0, burst: 1},
+		{name: "negative qps", qps: -1, burst: 1},
+		{name: "NaN qps", qps: math.NaN(), burst: 1},
+		{name: "zero burst", qps: 1, burst: 0},
+		{name: "negative burst", qps: 1, burst: -1},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			defer func() {
+				if r := recover(); r == nil {
+					t.Errorf("NewCoordinator(%v, %d) wanted a panic", tc.qps, tc.burst)
+				}
+			}()
+			NewCoordinator(tc.qps, tc.burst)
+		})
+	}
+}
+
+func TestCoordinatorClock(t *testing.T) {
+	now := time.Date(2021, 1, 2, 3, 4, 5, 0, time.UTC)
+	clock := NewFakeClock(now)
+	stale := NewTestGroupQueue(WithClock(clock))
+	stale.Init([]*configpb.TestGroup{{Name: "stale"}}, now.Add(-time.Hour))
+	fresh := NewTestGroupQueue(WithClock(clock))
+	fresh.Init([]*configpb.TestGroup{{Name: "fresh"}}, now.Add(-time.Minute))
+	c := NewCoordinator(1, 1)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	acquired := make(chan *TestGroupQueue, 2)
+	for _, q := range []*TestGroupQueue{fresh, stale} {
+		go func(q *TestGroupQueue) {
+			if err := c.acquire(ctx, q); err == nil {
+				acquired <- q
+			}
+		}(q)
+	}
+
+	// Both wait for the bucket to refill by the queues' clock.
+	if err := clock.BlockUntil(ctx, 2); err != nil {
+		t.Fatalf("BlockUntil() got unexpected error: %v", err)
+	}
+	select {
+	case <-acquired:
+		t.Fatal("acquire() returned before the clock advanced")
+	default:
+	}
+
+	clock.Advance(time.Second)
+	select {
+	case q := <-acquired:
+		if q != stale {
+			t.Error("acquire() did not favor the more overdue queue")
+		}
+	case <-ctx.Done():
+		t.Fatal("acquire() did not return after the bucket refilled")
+	}
+
+	// The fresh queue, woken when the stale one leaves, waits for the next token.
+	if err := clock.BlockUntil(ctx, 1); err != nil {
+		t.Fatalf("BlockUntil() got unexpected error: %v", err)
+	}
+	clock.Advance(time.Second)
+	select {
+	case q := <-acquired:
+		if q != fresh {
+			t.Error("acquire() returned for the wrong queue")
+		}
+	case <-ctx.Done():
+		t.Fatal("acquire() did not return after the bucket refilled again")
+	}
+}
@@ -0,0 +1,71 @@
+/*
+Copyright 2021 The TestGrid Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package config
+
+import (
+	"context"
+	"time"
+
+	configpb "github.com/GoogleCloudPlatform/testgrid/pb/config"
+	"github.com/sirupsen/logrus"
+)
+
+// SetCostEstimator makes Send skip groups it does not expect to finish before the context deadline.
+//
+// When the context passed to Send has a deadline, Send compares the time
+// remaining with how long estimate expects delivering the next group to
+// take. Groups that would overrun keep their place in the queue while
+// Send moves on to the next due group that fits, so a batch run near its
+// deadline updates many small groups rather than starting a huge one that
+// will be killed mid-write. Pinned groups are never skipped, see Pin.
+//
+// A nil estimate, the default, disables these skips, as does a context
+// without a deadline.
+func (q *TestGroupQueue) SetCostEstimator(estimate func(*configpb.TestGroup) time.Duration) {
+	q.lock.Lock()
+	defer q.lock.Unlock()
+	q.cost = estimate
+}
+
+// affordableLocked returns the due item Send should dispatch instead of chosen to meet the context deadline.
+//
+// Returns chosen when it fits, or nil when no eligible due group fits.
+func (q *TestGroupQueue) affordableLocked(ctx context.Context, chosen *item, now time.Time) *item {
+	if q.cost == nil {
+		return chosen
+	}
+	deadline, ok := ctx.Deadline()
+	if !ok {
+		return chosen
+	}
+	remaining := time.Until(deadline) // contexts expire in real time, whatever the clock
+	fits := func(it *item) bool {
+		return it.pinned || q.cost(it.tg) <= remaining
+	}
+	if fits(chosen) {
+		return chosen
+	}
+	logrus.WithFields(logrus.Fields{
+		"group":     chosen.tg.Name,
+		"remaining": remaining,
+	}).Info("Skipping group that would overrun the deadline")
+	q.skippedLocked(SkipCost)
+
+	return q.store().firstDue(now, func(it *item) bool {
+		return !q.bucketFullLocked(it) && fits(it)
+	})
+}
@@ -0,0 +1,112 @@
+/*
+Copyright 2021 The TestGrid Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package config
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	configpb "github.com/GoogleCloudPlatform/testgrid/pb/config"
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestCostEstimator(t *testing.T) {
+	now := time.Date(2021, 1, 2, 3, 4, 5, 0, time.UTC)
+	estimate := func(tg *configpb.TestGroup) time.Duration {
+		if tg.Name == "huge" {
+			return time.Hour
+		}
+		return time.Second
+	}
+	cases := []struct {
+		name      string
+		estimate  func(*configpb.TestGroup) time.Duration
+		pin       bool
+		timeout   time.Duration // of the Send context, if set
+		want      []string
+		wantSkips int
+	}{
+		{
+			name:    "no estimator",
+			timeout: time.Minute,
+			want:    []string{"huge", "small", "tiny"},
+		},
+		{
+			name:     "no deadline",
+			estimate: estimate,
+			want:     []string{"huge", "small", "tiny"},
+		},
+		{
+			name:     "plenty of time",
+			estimate: estimate,
+			timeout:  2 * time.Hour,
+			want:     []string{"huge", "small", "tiny"},
+		},
+		{
+			name:      "near deadline",
+			estimate:  estimate,
+			timeout:   time.Minute,
+			want:      []string{"small", "tiny"},
+			wantSkips: 2, // once ahead of each dispatch
+		},
+		{
+			name:     "pinned",
+			estimate: estimate,
+			pin:      true,
+			timeout:  time.Minute,
+			want:     []string{"huge", "small", "tiny"},
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			q := NewTestGroupQueue(WithClock(NewFakeClock(now)))
+			q.Init([]*configpb.TestGroup{{Name: "huge"}, {Name: "small"}, {Name: "tiny"}}, now)
+			q.SetCostEstimator(tc.estimate)
+			if tc.pin {
+				if err := q.Pin("huge"); err != nil {
+					t.Fatalf("Pin() got unexpected error: %v", err)
+				}
+			}
+			ctx, cancel := context.WithCancel(context.Background())
+			if tc.timeout > 0 {
+				ctx, cancel = context.WithTimeout(context.Background(), tc.timeout)
+			}
+			defer cancel()
+			var got []string
+			q.SendFunc(ctx, func(_ context.Context, tg *configpb.TestGroup) error {
+				got = append(got, tg.Name)
+				if len(got) == len(tc.want) {
+					cancel()
+				}
+				return nil
+			}, 0)
+			if diff := cmp.Diff(tc.want, got); diff != "" {
+				t.Errorf("SendFunc() got unexpected dispatches (-want +got):\n%s", diff)
+			}
+			if skips := q.SkipStats()[SkipCost]; skips != tc.wantSkips {
+				t.Errorf("SkipStats() got %d cost skips, want %d", skips, tc.wantSkips)
+			}
+			if tc.wantSkips > 0 {
+				if _, err := q.When("huge"); err != nil {
+					t.Errorf("When() got unexpected error for skipped group: %v", err)
+				}
+			}
+		})
+	}
+}
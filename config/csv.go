@@ -0,0 +1,204 @@
+/*
+Copyright 2021 The TestGrid Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package config
+
+import (
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+
+	multierror "github.com/hashicorp/go-multierror"
+)
+
+// Columns of the schedule WriteCSV writes.
+//
+// ApplyCSV only applies the name and next columns; the rest are for review.
+const (
+	CSVName         = "name"
+	CSVNext         = "next"          // RFC3339, in UTC.
+	CSVInterval     = "interval"      // Between dispatches, such as 10m0s, or empty when unknown.
+	CSVLastDispatch = "last_dispatch" // RFC3339, in UTC, or empty if never dispatched.
+	CSVFailures     = "failures"      // Recent failed Acks, see WithErrorBudget.
+)
+
+// CSVHeader is the header row WriteCSV writes.
+var CSVHeader = []string{CSVName, CSVNext, CSVInterval, CSVLastDispatch, CSVFailures}
+
+// WriteCSV writes the schedule of every group as CSV, in the order they are due.
+//
+// The interval is that of the active Send, or the adapted interval, see
+// WithAdaptiveFrequency.
+func (q *TestGroupQueue) WriteCSV(w io.Writer) error {
+	q.lock.RLock()
+	its := q.store().sorted()
+	cutoff := q.now().Add(-q.budgetWindow)
+	records := make([][]string, 0, len(its)+1)
+	records = append(records, CSVHeader)
+	for _, it := range its {
+		var interval, dispatched string
+		if d := q.intervalLocked(it, q.frequency); d > 0 {
+			interval = d.String()
+		}
+		if !it.dispatched.IsZero() {
+			dispatched = it.dispatched.UTC().Format(time.RFC3339)
+		}
+		var failures int
+		for _, when := range it.failures {
+			if when.After(cutoff) {
+				failures++
+			}
+		}
+		records = append(records, []string{
+			it.tg.Name,
+			it.when.UTC().Format(time.RFC3339),
+			interval,
+			dispatched,
+			strconv.Itoa(failures),
+		})
+	}
+	q.lock.RUnlock()
+
+	cw := csv.NewWriter(w)
+	return cw.WriteAll(records)
+}
+
+// ErrCSVHeader is wrapped by errors for a header ApplyCSV does not understand.
+var ErrCSVHeader = errors.New("invalid csv header")
+
+// ApplyCSV reschedules groups to the next column of a schedule from WriteCSV, see FixAll.
+//
+// The header must include the name and next columns, and may omit or
+// reorder the others. Rows with an empty next column are left unchanged.
+// Skips malformed rows, duplicate groups and groups not in the queue,
+// returning an error for each row after applying the others. Rows are
+// numbered from the header, as in a spreadsheet.
+//
+// Returns how many groups were applied, none if the queue rejects the fix,
+// such as when sealed, and how many rows were skipped.
+func (q *TestGroupQueue) ApplyCSV(r io.Reader) (applied, skipped int, err error) {
+	cr := csv.NewReader(r)
+	cr.FieldsPerRecord = -1 // checked per row
+	header, err := cr.Read()
+	if err == io.EOF {
+		return 0, 0, fmt.Errorf("%w: missing", ErrCSVHeader)
+	}
+	if err != nil {
+		return 0, 0, fmt.Errorf("%w: %v", ErrCSVHeader, err)
+	}
+	columns, err := csvColumns(header)
+	if err != nil {
+		return 0, 0, err
+	}
+
+	var mErr error
+	whens := map[string]time.Time{}
+	rows := map[string]int{}
+	row := 1 // the header
+	for {
+		record, err := cr.Read()
+		row++
+		if err == io.EOF {
+			break
+		}
+		var parseErr *csv.ParseError
+		if errors.As(err, &parseErr) {
+			skipped++
+			mErr = multierror.Append(mErr, err)
+			continue
+		}
+		if err != nil {
+			return 0, 0, err
+		}
+		if len(record) != len(header) {
+			skipped++
+			mErr = multierror.Append(mErr, fmt.Errorf("row %d: got %d columns, want %d", row, len(record), len(header)))
+			continue
+		}
+		name := record[columns[CSVName]]
+		next := strings.TrimSpace(record[columns[CSVNext]])
+		switch {
+		case name == "":
+			skipped++
+			mErr = multierror.Append(mErr, fmt.Errorf("row %d: missing name", row))
+			continue
+		case rows[name] > 0:
+			skipped++
+			mErr = multierror.Append(mErr, fmt.Errorf("row %d: %s duplicates row %d", row, name, rows[name]))
+			continue
+		}
+		rows[name] = row
+		if next == "" {
+			continue
+		}
+		when, err := time.Parse(time.RFC3339, next)
+		if err == nil && when.IsZero() {
+			err = errors.New("zero time") // would reject every row, see FixAll
+		}
+		if err != nil {
+			skipped++
+			mErr = multierror.Append(mErr, fmt.Errorf("row %d: %s: %w: %v", row, name, ErrInvalidTime, err))
+			continue
+		}
+		whens[name] = when
+	}
+
+	applied = len(whens)
+	var fixErr *FixAllError
+	if err := q.FixAll(whens); errors.As(err, &fixErr) {
+		for _, name := range fixErr.Missing {
+			applied--
+			skipped++
+			mErr = multierror.Append(mErr, fmt.Errorf("row %d: %s: %w", rows[name], name, ErrNotFound))
+		}
+	} else if err != nil { // applied none, such as to a sealed queue
+		applied = 0
+		mErr = multierror.Append(mErr, err)
+	}
+	return applied, skipped, mErr
+}
+
+// csvColumns returns the index of each column in the header.
+func csvColumns(header []string) (map[string]int, error) {
+	known := map[string]bool{}
+	for _, col := range CSVHeader {
+		known[col] = true
+	}
+	columns := make(map[string]int, len(header))
+	for i, col := range header {
+		if i == 0 {
+			col = strings.TrimPrefix(col, "\ufeff") // byte order mark from spreadsheets
+		}
+		col = strings.ToLower(strings.TrimSpace(col))
+		switch _, dup := columns[col]; {
+		case !known[col]:
+			return nil, fmt.Errorf("%w: unknown column %q", ErrCSVHeader, header[i])
+		case dup:
+			return nil, fmt.Errorf("%w: duplicate column %q", ErrCSVHeader, header[i])
+		}
+		columns[col] = i
+	}
+	for _, col := range []string{CSVName, CSVNext} {
+		if _, ok := columns[col]; !ok {
+			return nil, fmt.Errorf("%w: missing %s column", ErrCSVHeader, col)
+		}
+	}
+	return columns, nil
+}
@@ -0,0 +1,249 @@
+/*
+Copyright 2021 The TestGrid Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package config
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	configpb "github.com/GoogleCloudPlatform/testgrid/pb/config"
+	"github.com/google/go-cmp/cmp"
+	multierror "github.com/hashicorp/go-multierror"
+)
+
+func TestWriteCSV(t *testing.T) {
+	start := time.Date(2021, 1, 2, 3, 4, 5, 0, time.FixedZone("east", 9*60*60))
+	groups := []*configpb.TestGroup{{Name: "a,b"}, {Name: `say "hi"`}, {Name: "plain"}}
+	clock := NewFakeClock(start)
+	q := NewTestGroupQueue(WithClock(clock), WithErrorBudget(3, time.Hour))
+	q.Init(groups, start)
+	if err := q.Fix("plain", start.Add(time.Hour)); err != nil {
+		t.Fatalf("Fix() got unexpected error: %v", err)
+	}
+
+	var buf bytes.Buffer
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	err := q.SendFunc(ctx, func(_ context.Context, tg *configpb.TestGroup) error {
+		switch tg.Name {
+		case "a,b":
+			return q.Ack(tg.Name, errors.New("boom"))
+		case `say "hi"`:
+			defer cancel()
+			return q.WriteCSV(&buf)
+		}
+		return nil
+	}, 10*time.Minute)
+	if err != context.Canceled {
+		t.Fatalf("SendFunc() got %v, want %v", err, context.Canceled)
+	}
+
+	want := `name,next,interval,last_dispatch,failures
+"a,b",2021-01-01T18:14:05Z,10m0s,2021-01-01T18:04:05Z,1
+"say ""hi""",2021-01-01T18:14:05Z,10m0s,2021-01-01T18:04:05Z,0
+plain,2021-01-01T19:04:05Z,10m0s,,0
+`
+	if diff := cmp.Diff(want, buf.String()); diff != "" {
+		t.Fatalf("WriteCSV() got unexpected diff (-want +got):\n%s", diff)
+	}
+
+	var other TestGroupQueue
+	other.Init(groups, start.Add(-time.Hour))
+	applied, skipped, err := other.ApplyCSV(&buf)
+	if err != nil {
+		t.Fatalf("ApplyCSV() got unexpected error: %v", err)
+	}
+	if applied != 3 || skipped != 0 {
+		t.Errorf("ApplyCSV() got %d applied and %d skipped, want 3 and 0", applied, skipped)
+	}
+	wantItems := []QueueItem{
+		{Name: "a,b", When: start.Add(10 * time.Minute).UTC()},
+		{Name: `say "hi"`, When: start.Add(10 * time.Minute).UTC()},
+		{Name: "plain", When: start.Add(time.Hour).UTC()},
+	}
+	if diff := cmp.Diff(wantItems, other.Items()); diff != "" {
+		t.Errorf("Items() got unexpected diff (-want +got):\n%s", diff)
+	}
+}
+
+func TestApplyCSV(t *testing.T) {
+	start := time.Date(2021, 1, 2, 3, 4, 5, 0, time.UTC)
+	cases := []struct {
+		name   string
+		csv    string
+		header bool
+		sealed bool
+
+		applied int
+		skipped int
+		errs    []string
+		whens   map[string]time.Time
+	}{
+		{
+			name:   "empty",
+			header: true,
+		},
+		{
+			name:   "unknown column",
+			csv:    "name,next,owner\n",
+			header: true,
+		},
+		{
+			name:   "duplicate column",
+			csv:    "name,next,name\n",
+			header: true,
+		},
+		{
+			name:   "missing next column",
+			csv:    "name,interval\nhi,10m\n",
+			header: true,
+		},
+		{
+			name:   "malformed header",
+			csv:    "name,\"next\n",
+			header: true,
+		},
+		{
+			name: "header only",
+			csv:  "name,next,interval,last_dispatch,failures\n",
+		},
+		{
+			name: "spreadsheet header",
+			csv: "\ufeff Next ,NAME\r\n" +
+				"2021-01-02T04:00:00-01:00,hi\r\n",
+			applied: 1,
+			whens: map[string]time.Time{
+				"hi": time.Date(2021, 1, 2, 5, 0, 0, 0, time.UTC),
+			},
+		},
+		{
+			name: "review columns are ignored",
+			csv: "name,next,interval,last_dispatch,failures\n" +
+				"hi,2021-01-02T05:00:00Z,garbage,garbage,garbage\n",
+			applied: 1,
+			whens: map[string]time.Time{
+				"hi": time.Date(2021, 1, 2, 5, 0, 0, 0, time.UTC),
+			},
+		},
+		{
+			name: "empty next is unchanged",
+			csv: "name,next\n" +
+				"hi,\n" +
+				"there,2021-01-02T05:00:00Z\n",
+			applied: 1,
+			whens: map[string]time.Time{
+				"there": time.Date(2021, 1, 2, 5, 0, 0, 0, time.UTC),
+			},
+		},
+		{
+			name: "malformed rows",
+			csv: "name,next\n" +
+				"hi,2021-01-02T05:00:00Z,extra\n" +
+				"hi,tomorrow\n" +
+				",2021-01-02T05:00:00Z\n" +
+				"there,2021-01-02T06:00:00Z\n" +
+				"there,2021-01-02T07:00:00Z\n" +
+				"missing,2021-01-02T05:00:00Z\n" +
+				"b\"ad,2021-01-02T05:00:00Z\n" +
+				"\"a,b\",2021-01-02T08:00:00Z\n",
+			applied: 2,
+			skipped: 6,
+			errs: []string{
+				"row 2: got 3 columns, want 2",
+				`row 3: hi: invalid time: parsing time "tomorrow" as "2006-01-02T15:04:05Z07:00": cannot parse "tomorrow" as "2006"`,
+				"row 4: missing name",
+				"row 6: there duplicates row 5",
+				"parse error on line 8, column 2: bare \" in non-quoted-field",
+				"row 7: missing: not found",
+			},
+			whens: map[string]time.Time{
+				"there": time.Date(2021, 1, 2, 6, 0, 0, 0, time.UTC),
+				"a,b":   time.Date(2021, 1, 2, 8, 0, 0, 0, time.UTC),
+			},
+		},
+		{
+			name: "zero time",
+			csv: "name,next\n" +
+				"hi,0001-01-01T00:00:00Z\n" +
+				"there,2021-01-02T06:00:00Z\n",
+			applied: 1,
+			skipped: 1,
+			errs: []string{
+				"row 2: hi: invalid time: zero time",
+			},
+			whens: map[string]time.Time{
+				"there": time.Date(2021, 1, 2, 6, 0, 0, 0, time.UTC),
+			},
+		},
+		{
+			name: "sealed",
+			csv: "name,next\n" +
+				"hi,2021-01-02T05:00:00Z\n" +
+				"missing,2021-01-02T05:00:00Z\n",
+			sealed: true,
+			errs: []string{
+				"queue sealed",
+			},
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			var q TestGroupQueue
+			q.Init([]*configpb.TestGroup{{Name: "hi"}, {Name: "there"}, {Name: "a,b"}}, start)
+			if tc.sealed {
+				q.Seal()
+			}
+			applied, skipped, err := q.ApplyCSV(strings.NewReader(tc.csv))
+			if tc.header {
+				if !errors.Is(err, ErrCSVHeader) {
+					t.Errorf("ApplyCSV() got %v, want %v", err, ErrCSVHeader)
+				}
+			} else {
+				var errs []string
+				if err != nil {
+					var mErr *multierror.Error
+					if !errors.As(err, &mErr) {
+						t.Fatalf("ApplyCSV() got unexpected error: %v", err)
+					}
+					for _, e := range mErr.Errors {
+						errs = append(errs, e.Error())
+					}
+				}
+				if diff := cmp.Diff(tc.errs, errs); diff != "" {
+					t.Errorf("ApplyCSV() got unexpected errors (-want +got):\n%s", diff)
+				}
+			}
+			if applied != tc.applied || skipped != tc.skipped {
+				t.Errorf("ApplyCSV() got %d applied and %d skipped, want %d and %d", applied, skipped, tc.applied, tc.skipped)
+			}
+			for _, it := range q.Items() {
+				want, ok := tc.whens[it.Name]
+				if !ok {
+					want = start
+				}
+				if !it.When.Equal(want) {
+					t.Errorf("ApplyCSV() scheduled %s at %v, want %v", it.Name, it.When, want)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,65 @@
+/*
+Copyright 2021 The TestGrid Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package config
+
+import (
+	"context"
+	"time"
+)
+
+// WithHandlerDeadline limits how long SendFunc and SendFuncDelay handlers may take.
+//
+// Each handler receives a context whose deadline is fraction of the way
+// from dispatch to when the group is next due, so a slow update gives up
+// before the queue wants the group again. The default fraction is 1, the
+// next due time. Zero or negative fractions disable the deadline. Groups
+// that Send removes after dispatching them, such as with a zero frequency,
+// never get a deadline.
+func WithHandlerDeadline(fraction float64) QueueOption {
+	return func(q *TestGroupQueue) {
+		if fraction <= 0 {
+			fraction = -1
+		}
+		q.deadline = fraction
+	}
+}
+
+// nextWhen returns when a dispatched item is next due, or zero if Send popped it.
+//
+// Call while holding the lock.
+func nextWhen(it, popped *item) time.Time {
+	if popped != nil {
+		return time.Time{}
+	}
+	return it.when
+}
+
+// handlerContext returns the context for a handler dispatched at now and next due at next.
+func (q *TestGroupQueue) handlerContext(ctx context.Context, now, next time.Time) (context.Context, context.CancelFunc) {
+	q.lock.RLock()
+	fraction := q.deadline
+	q.lock.RUnlock()
+	if fraction == 0 {
+		fraction = 1
+	}
+	if fraction < 0 || next.IsZero() {
+		return context.WithCancel(ctx)
+	}
+	deadline := now.Add(time.Duration(fraction * float64(next.Sub(now))))
+	// Measure by the queue's clock, which may be fake, but time out in real time.
+	return context.WithTimeout(ctx, deadline.Sub(q.now()))
+}
@@ -0,0 +1,106 @@
+/*
+Copyright 2021 The TestGrid Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package config
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	configpb "github.com/GoogleCloudPlatform/testgrid/pb/config"
+)
+
+func TestHandlerDeadline(t *testing.T) {
+	now := time.Date(2021, 1, 2, 3, 4, 5, 0, time.UTC)
+	const frequency = 10 * time.Minute
+	cases := []struct {
+		name      string
+		opts      []QueueOption
+		frequency time.Duration
+		want      time.Duration // until the deadline, zero for none
+	}{
+		{
+			name:      "next when",
+			frequency: frequency,
+			want:      frequency,
+		},
+		{
+			name:      "fraction",
+			opts:      []QueueOption{WithHandlerDeadline(0.25)},
+			frequency: frequency,
+			want:      frequency / 4,
+		},
+		{
+			name:      "disabled",
+			opts:      []QueueOption{WithHandlerDeadline(0)},
+			frequency: frequency,
+		},
+		{
+			name: "popped",
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			q := NewTestGroupQueue(append(tc.opts, WithClock(NewFakeClock(now)))...)
+			q.Init([]*configpb.TestGroup{{Name: "hi"}}, now)
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+			var got time.Duration
+			var dispatched bool
+			q.SendFunc(ctx, func(hctx context.Context, _ *configpb.TestGroup) error {
+				dispatched = true
+				if deadline, ok := hctx.Deadline(); ok {
+					got = time.Until(deadline)
+				}
+				cancel()
+				return nil
+			}, tc.frequency)
+			if !dispatched {
+				t.Fatal("SendFunc() never called handler")
+			}
+			if tc.want == 0 {
+				if got != 0 {
+					t.Errorf("SendFunc() handler got deadline in %s, want none", got)
+				}
+				return
+			}
+			if got > tc.want || got < tc.want-time.Minute {
+				t.Errorf("SendFunc() handler got deadline in %s, want %s", got, tc.want)
+			}
+		})
+	}
+}
+
+func TestHandlerDeadlineDelay(t *testing.T) {
+	now := time.Date(2021, 1, 2, 3, 4, 5, 0, time.UTC)
+	q := NewTestGroupQueue(WithClock(NewFakeClock(now)), WithHandlerDeadline(0.5))
+	q.Init([]*configpb.TestGroup{{Name: "hi"}}, now)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	var got time.Duration
+	q.SendFuncDelay(ctx, func(hctx context.Context, _ *configpb.TestGroup) (time.Duration, error) {
+		if deadline, ok := hctx.Deadline(); ok {
+			got = time.Until(deadline)
+		}
+		cancel()
+		return 0, nil
+	}, time.Hour)
+	if want := 30 * time.Minute; got > want || got < want-time.Minute {
+		t.Errorf("SendFuncDelay() handler got deadline in %s, want %s", got, want)
+	}
+}
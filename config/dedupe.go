@@ -0,0 +1,90 @@
+/*
+Copyright 2021 The TestGrid Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package config
+
+import (
+	"sync/atomic"
+	"time"
+)
+
+// WithFixAllDedupe skips FixAll calls repeating the last map FixAll applied within window.
+//
+// Suits handlers of Pub/Sub notifications, whose redeliveries can call
+// FixAll with the same map several times a second. Skips a repeat only
+// while the queue is unchanged since the map was applied, when applying it
+// again would change nothing, checking under the read lock so a storm of
+// duplicates neither waits for nor blocks Send. Compares times to the
+// second, like Fingerprint. QueueStats.Duplicates counts the calls
+// skipped.
+func WithFixAllDedupe(window time.Duration) QueueOption {
+	return func(q *TestGroupQueue) {
+		q.dedupeWindow = window
+	}
+}
+
+// appliedFixAll identifies the last map FixAll applied, see WithFixAllDedupe.
+type appliedFixAll struct {
+	prefix string    // of the groups fixed, see Scoped
+	whens  uint64    // hash of the map
+	queue  uint64    // fingerprint of the queue after applying it
+	at     time.Time // when it was applied
+}
+
+// whensPrint hashes the groups in whens and when each is due, see groupPrint.
+func (q *TestGroupQueue) whensPrint(whens map[string]time.Time) uint64 {
+	var print uint64
+	for name, when := range whens {
+		print += groupPrint(name, q.truncate(when))
+	}
+	return print
+}
+
+// duplicateFixAll returns the hash of whens, and whether FixAll may skip it as a duplicate.
+//
+// Counts the duplicates it finds.
+func (q *TestGroupQueue) duplicateFixAll(whens map[string]time.Time, prefix string) (uint64, bool) {
+	if q.dedupeWindow <= 0 {
+		return 0, false
+	}
+	print := q.whensPrint(whens)
+	q.lock.RLock()
+	defer q.lock.RUnlock()
+	last := q.lastFixAll
+	switch {
+	case q.sealed, last.at.IsZero():
+		return print, false
+	case last.prefix != prefix, last.whens != print, last.queue != q.print:
+		return print, false
+	case q.now().Sub(last.at) >= q.dedupeWindow:
+		return print, false
+	}
+	atomic.AddInt64(&q.duplicates, 1)
+	return print, true
+}
+
+// appliedFixAllLocked remembers the map FixAll just applied, see duplicateFixAll.
+func (q *TestGroupQueue) appliedFixAllLocked(prefix string, print uint64) {
+	if q.dedupeWindow <= 0 {
+		return
+	}
+	q.lastFixAll = appliedFixAll{
+		prefix: prefix,
+		whens:  print,
+		queue:  q.print,
+		at:     q.now(),
+	}
+}
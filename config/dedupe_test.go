@@ -0,0 +1,171 @@
+/*
+Copyright 2021 The TestGrid Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package config
+
+import (
+	"testing"
+	"time"
+
+	configpb "github.com/GoogleCloudPlatform/testgrid/pb/config"
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestFixAllDedupe(t *testing.T) {
+	now := time.Date(2021, 1, 2, 3, 4, 5, 0, time.UTC)
+	first := map[string]time.Time{
+		"a": now.Add(time.Minute),
+		"b": now.Add(2 * time.Minute),
+	}
+	cases := []struct {
+		name    string
+		window  time.Duration
+		first   map[string]time.Time
+		between func(*TestGroupQueue, *FakeClock)
+		second  map[string]time.Time
+		err     bool
+		want    int64
+		whens   map[string]time.Time
+	}{
+		{
+			name:   "identical",
+			window: time.Minute,
+			second: map[string]time.Time{
+				"a": now.Add(time.Minute),
+				"b": now.Add(2 * time.Minute),
+			},
+			want: 1,
+		},
+		{
+			name:   "disabled",
+			second: first,
+		},
+		{
+			name:   "later time",
+			window: time.Minute,
+			second: map[string]time.Time{
+				"a": now.Add(time.Minute),
+				"b": now.Add(3 * time.Minute),
+			},
+			whens: map[string]time.Time{
+				"b": now.Add(3 * time.Minute),
+			},
+		},
+		{
+			name:   "other group",
+			window: time.Minute,
+			second: map[string]time.Time{
+				"a": now.Add(time.Minute),
+				"c": now.Add(2 * time.Minute),
+			},
+			whens: map[string]time.Time{
+				"c": now.Add(2 * time.Minute),
+			},
+		},
+		{
+			name:   "extra group",
+			window: time.Minute,
+			second: map[string]time.Time{
+				"a": now.Add(time.Minute),
+				"b": now.Add(2 * time.Minute),
+				"c": now.Add(3 * time.Minute),
+			},
+			whens: map[string]time.Time{
+				"c": now.Add(3 * time.Minute),
+			},
+		},
+		{
+			name:   "after window",
+			window: time.Minute,
+			between: func(_ *TestGroupQueue, clock *FakeClock) {
+				clock.Advance(time.Minute)
+			},
+			second: first,
+		},
+		{
+			name:   "queue changed",
+			window: time.Minute,
+			between: func(q *TestGroupQueue, _ *FakeClock) {
+				q.Fix("a", now.Add(time.Hour))
+			},
+			second: first,
+			whens: map[string]time.Time{
+				"a": now.Add(time.Minute),
+			},
+		},
+		{
+			name:   "sealed",
+			window: time.Minute,
+			between: func(q *TestGroupQueue, _ *FakeClock) {
+				q.Seal()
+			},
+			second: first,
+			err:    true,
+		},
+		{
+			name:   "first missing a group",
+			window: time.Minute,
+			first: map[string]time.Time{
+				"a":       now.Add(time.Minute),
+				"missing": now.Add(time.Minute),
+			},
+			second: map[string]time.Time{
+				"a":       now.Add(time.Minute),
+				"missing": now.Add(time.Minute),
+			},
+			err: true,
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			clock := NewFakeClock(now)
+			q := NewTestGroupQueue(WithClock(clock), WithFixAllDedupe(tc.window))
+			q.Init([]*configpb.TestGroup{{Name: "a"}, {Name: "b"}, {Name: "c"}}, now)
+			firstWhens := tc.first
+			if firstWhens == nil {
+				firstWhens = first
+			}
+			q.FixAll(firstWhens)
+			if tc.between != nil {
+				tc.between(q, clock)
+			}
+			before := q.Fingerprint()
+			err := q.FixAll(tc.second)
+			switch {
+			case err != nil && !tc.err:
+				t.Errorf("FixAll() got unexpected error: %v", err)
+			case err == nil && tc.err:
+				t.Error("FixAll() failed to return an error")
+			}
+			if got := q.Stats().Duplicates; got != tc.want {
+				t.Errorf("Stats() got %d duplicates, want %d", got, tc.want)
+			}
+			if tc.want > 0 && q.Fingerprint() != before {
+				t.Error("FixAll() changed the queue when skipping a duplicate")
+			}
+			for name, want := range tc.whens {
+				got, err := q.When(name)
+				if err != nil {
+					t.Fatalf("When(%q) got unexpected error: %v", name, err)
+				}
+				if diff := cmp.Diff(want, got); diff != "" {
+					t.Errorf("When(%q) got unexpected time (-want +got):\n%s", name, diff)
+				}
+			}
+		})
+	}
+}
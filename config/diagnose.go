@@ -0,0 +1,138 @@
+/*
+Copyright 2021 The TestGrid Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package config
+
+import (
+	"fmt"
+	"time"
+)
+
+// DiagnosisReason explains why the queue is or is not dispatching groups.
+type DiagnosisReason string
+
+// Reasons Diagnose reports, in the order it checks them.
+const (
+	DiagnosisInitializing DiagnosisReason = "initializing" // The queue is empty, waiting for LazyInit's provider.
+	DiagnosisEmpty        DiagnosisReason = "empty"        // The queue holds no groups.
+	DiagnosisNotSending   DiagnosisReason = "not-sending"  // No Send is active.
+	DiagnosisBlocked      DiagnosisReason = "blocked"      // Send is waiting for receivers to accept a group.
+	DiagnosisRateLimited  DiagnosisReason = "rate-limited" // Send is waiting for a token, see Coordinator.
+	DiagnosisNotDue       DiagnosisReason = "not-due"      // Send is waiting until the next group is due.
+	DiagnosisPaused       DiagnosisReason = "paused"       // Every due group is paused, see PauseMatching.
+	DiagnosisInFlight     DiagnosisReason = "in-flight"    // Every due group's bucket or class is full, see SetBucketLimits and SetClassLimits.
+	DiagnosisDispatching  DiagnosisReason = "dispatching"  // Send is free to dispatch a due group.
+)
+
+// Diagnosis explains why the queue is or is not dispatching groups, see Diagnose.
+type Diagnosis struct {
+	Reason DiagnosisReason
+	// Head is the next group in the queue, if any.
+	Head string `json:",omitempty"`
+	// Until is how long until Head is due, or negative when overdue.
+	Until time.Duration
+	// Due is how many groups are due.
+	Due int
+	// Stalled is how long Send has been blocked or rate limited.
+	Stalled time.Duration `json:",omitempty"`
+}
+
+func (d Diagnosis) String() string {
+	switch d.Reason {
+	case DiagnosisEmpty, DiagnosisInitializing:
+		return string(d.Reason)
+	case DiagnosisBlocked, DiagnosisRateLimited:
+		return fmt.Sprintf("%s for %s with %d due", d.Reason, d.Stalled.Round(time.Second), d.Due)
+	case DiagnosisNotDue:
+		return fmt.Sprintf("%s: %s due in %s", d.Reason, d.Head, d.Until.Round(time.Second))
+	}
+	return fmt.Sprintf("%s with %d due", d.Reason, d.Due)
+}
+
+// Diagnose explains why the queue is or is not dispatching groups.
+//
+// The reason is the first of the DiagnosisReasons that applies.
+func (q *TestGroupQueue) Diagnose() Diagnosis {
+	q.lock.RLock()
+	defer q.lock.RUnlock()
+	now := q.now()
+	head := q.store().peek()
+	switch {
+	case head == nil && q.lazy.running:
+		return Diagnosis{Reason: DiagnosisInitializing}
+	case head == nil:
+		return Diagnosis{Reason: DiagnosisEmpty}
+	}
+	d := Diagnosis{
+		Head:  head.tg.Name,
+		Until: head.when.Sub(now),
+	}
+	var paused, full int
+	for _, it := range q.store().all() {
+		if it.when.After(now) {
+			continue
+		}
+		d.Due++
+		switch {
+		case q.pausedLocked(it, now):
+			paused++
+		case q.limitedLocked(it):
+			full++
+		}
+	}
+	switch {
+	case q.senders == 0:
+		d.Reason = DiagnosisNotSending
+	case q.receiverStall.n > 0:
+		d.Reason = DiagnosisBlocked
+		d.Stalled = now.Sub(q.receiverStall.since)
+	case q.rateStall.n > 0:
+		d.Reason = DiagnosisRateLimited
+		d.Stalled = now.Sub(q.rateStall.since)
+	case d.Due == 0:
+		d.Reason = DiagnosisNotDue
+	case paused == d.Due:
+		d.Reason = DiagnosisPaused
+	case paused+full == d.Due:
+		d.Reason = DiagnosisInFlight
+	default:
+		d.Reason = DiagnosisDispatching
+	}
+	return d
+}
+
+// stall tracks the Sends waiting on something other than the schedule.
+type stall struct {
+	n     int       // waiting Sends
+	since time.Time // when the earliest began waiting
+}
+
+// stalled records that a Send is waiting on s until it calls unstalled.
+func (q *TestGroupQueue) stalled(s *stall) {
+	q.lock.Lock()
+	defer q.lock.Unlock()
+	if s.n == 0 {
+		s.since = q.now()
+	}
+	s.n++
+}
+
+// unstalled records that a Send stopped waiting on s.
+func (q *TestGroupQueue) unstalled(s *stall) {
+	q.lock.Lock()
+	defer q.lock.Unlock()
+	s.n--
+}
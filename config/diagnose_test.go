@@ -0,0 +1,180 @@
+/*
+Copyright 2021 The TestGrid Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package config
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	configpb "github.com/GoogleCloudPlatform/testgrid/pb/config"
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestDiagnose(t *testing.T) {
+	now := time.Date(2021, 1, 2, 3, 4, 5, 0, time.UTC)
+	cases := []struct {
+		name   string
+		groups []*configpb.TestGroup
+		setup  func(*TestGroupQueue)
+		want   Diagnosis
+	}{
+		{
+			name: "empty",
+			want: Diagnosis{Reason: DiagnosisEmpty},
+		},
+		{
+			name:   "not sending",
+			groups: []*configpb.TestGroup{{Name: "hi"}},
+			want: Diagnosis{
+				Reason: DiagnosisNotSending,
+				Head:   "hi",
+				Due:    1,
+			},
+		},
+		{
+			name:   "not due",
+			groups: []*configpb.TestGroup{{Name: "hi"}},
+			setup: func(q *TestGroupQueue) {
+				q.register(time.Minute)
+				q.Fix("hi", now.Add(3*time.Minute+12*time.Second))
+			},
+			want: Diagnosis{
+				Reason: DiagnosisNotDue,
+				Head:   "hi",
+				Until:  3*time.Minute + 12*time.Second,
+			},
+		},
+		{
+			name:   "paused",
+			groups: []*configpb.TestGroup{{Name: "hi"}, {Name: "there"}},
+			setup: func(q *TestGroupQueue) {
+				q.register(time.Minute)
+				q.PauseMatching(func(*configpb.TestGroup) bool { return true })
+			},
+			want: Diagnosis{
+				Reason: DiagnosisPaused,
+				Head:   "hi",
+				Due:    2,
+			},
+		},
+		{
+			name: "in flight",
+			groups: []*configpb.TestGroup{
+				{Name: "hi", GcsPrefix: "bucket/hi"},
+				{Name: "there", GcsPrefix: "bucket/there"},
+				{Name: "paused", GcsPrefix: "elsewhere/paused"},
+			},
+			setup: func(q *TestGroupQueue) {
+				q.register(time.Minute)
+				q.SetBucketLimits(map[string]int{"bucket": 1})
+				q.PauseMatching(func(tg *configpb.TestGroup) bool { return tg.Name == "paused" })
+				q.Fix("hi", now.Add(time.Minute))
+				q.lock.Lock()
+				q.launchLocked(q.items["hi"])
+				q.lock.Unlock()
+			},
+			want: Diagnosis{
+				Reason: DiagnosisInFlight,
+				Head:   "there",
+				Due:    2,
+			},
+		},
+		{
+			name:   "dispatching",
+			groups: []*configpb.TestGroup{{Name: "hi"}, {Name: "there"}},
+			setup: func(q *TestGroupQueue) {
+				q.register(time.Minute)
+				q.PauseMatching(func(tg *configpb.TestGroup) bool { return tg.Name == "hi" })
+				q.Fix("hi", now.Add(-time.Minute))
+			},
+			want: Diagnosis{
+				Reason: DiagnosisDispatching,
+				Head:   "hi",
+				Until:  -time.Minute,
+				Due:    2,
+			},
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			q := NewTestGroupQueue(WithClock(NewFakeClock(now)))
+			q.Init(tc.groups, now)
+			if tc.setup != nil {
+				tc.setup(q)
+			}
+			if diff := cmp.Diff(tc.want, q.Diagnose()); diff != "" {
+				t.Errorf("Diagnose() got unexpected diff (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestDiagnoseStalled(t *testing.T) {
+	now := time.Date(2021, 1, 2, 3, 4, 5, 0, time.UTC)
+	cases := []struct {
+		name  string
+		setup func(*TestGroupQueue)
+		want  DiagnosisReason
+	}{
+		{
+			name: "blocked",
+			want: DiagnosisBlocked,
+		},
+		{
+			name: "rate limited",
+			setup: func(q *TestGroupQueue) {
+				NewCoordinator(0.001, 1).Register(q)
+			},
+			want: DiagnosisRateLimited,
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			clock := NewFakeClock(now)
+			q := NewTestGroupQueue(WithClock(clock))
+			q.Init([]*configpb.TestGroup{{Name: "hi"}, {Name: "there"}}, now)
+			if tc.setup != nil {
+				tc.setup(q)
+			}
+			ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+			defer cancel()
+			errs := make(chan error, 1)
+			go func() {
+				errs <- q.Send(ctx, make(chan *configpb.TestGroup), time.Minute)
+			}()
+			for q.Diagnose().Reason != tc.want {
+				select {
+				case <-ctx.Done():
+					t.Fatalf("Diagnose() never reported %s, last got %s", tc.want, q.Diagnose())
+				case <-time.After(time.Millisecond):
+				}
+			}
+			clock.Advance(45 * time.Second)
+			if got, want := q.Diagnose().Stalled, 45*time.Second; got != want {
+				t.Errorf("Diagnose() got stalled for %s, want %s", got, want)
+			}
+			cancel()
+			<-errs
+			if got := q.Diagnose().Reason; got != DiagnosisNotSending {
+				t.Errorf("Diagnose() got %s after Send returned, want %s", got, DiagnosisNotSending)
+			}
+		})
+	}
+}
@@ -0,0 +1,121 @@
+/*
+Copyright 2021 The TestGrid Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package config
+
+import (
+	"sort"
+
+	"bitbucket.org/creachadair/stringset"
+	configpb "github.com/GoogleCloudPlatform/testgrid/pb/config"
+)
+
+// GroupsDiff describes how calling Init with a list of groups would change a queue.
+//
+// Each list is sorted by name.
+type GroupsDiff struct {
+	Added   []string
+	Removed []string
+	Changed []string // Groups whose configuration differs.
+
+	// Renamed maps the new name of each group renamed to a name that
+	// normalizes alike, see WithNameNormalization, to its old name. Renamed
+	// groups are neither added nor removed, and only changed when their
+	// configuration differs beyond the name.
+	Renamed map[string]string
+
+	// Stateful lists the removed groups whose state Init would discard,
+	// such as recent failures, an adapted interval, a pause or a pin.
+	Stateful []string
+}
+
+// Empty returns true when Init would not add, remove, change or rename any groups.
+func (d GroupsDiff) Empty() bool {
+	return len(d.Added) == 0 && len(d.Removed) == 0 && len(d.Changed) == 0 && len(d.Renamed) == 0
+}
+
+// DiffGroups compares the groups in the current queue against next, without modifying the queue.
+//
+// Skips invalid groups in next, which Init would reject, including nil groups.
+// When next contains duplicate names, the last one is compared, as Init keeps
+// the last one. A nil current queue is treated as empty. InitDiff applies next
+// and returns the same summary.
+func DiffGroups(current *TestGroupQueue, next []*configpb.TestGroup) GroupsDiff {
+	want := make(map[string]*configpb.TestGroup, len(next))
+	for _, tg := range next {
+		if validateGroup(tg) != nil {
+			continue
+		}
+		want[tg.Name] = tg
+	}
+
+	var diff GroupsDiff
+	seen := stringset.NewSize(len(want))
+	if current != nil {
+		current.lock.RLock()
+		renames := map[string]string{} // from the current name to the one in next
+		for name := range want {
+			if stored := current.lookupLocked(name); stored != name {
+				if _, ok := current.items[stored]; ok {
+					renames[stored] = name
+				}
+			}
+		}
+		for name, it := range current.items {
+			seen.Add(name)
+			tg, ok := want[name]
+			if to, renamed := renames[name]; renamed && !ok {
+				seen.Add(to)
+				tg, ok = want[to], true
+				diff.renamed(to, name)
+			}
+			switch {
+			case !ok:
+				diff.Removed = append(diff.Removed, name)
+				if it.stateful() {
+					diff.Stateful = append(diff.Stateful, name)
+				}
+			case !sameGroup(it.tg, tg):
+				diff.Changed = append(diff.Changed, tg.Name)
+			}
+		}
+		current.lock.RUnlock()
+	}
+	for name := range want {
+		if !seen.Contains(name) {
+			diff.Added = append(diff.Added, name)
+		}
+	}
+
+	sort.Strings(diff.Added)
+	sort.Strings(diff.Removed)
+	sort.Strings(diff.Changed)
+	sort.Strings(diff.Stateful)
+	return diff
+}
+
+// renamed records the group renamed from old to name.
+func (d *GroupsDiff) renamed(name, old string) {
+	if d.Renamed == nil {
+		d.Renamed = map[string]string{}
+	}
+	d.Renamed[name] = old
+}
+
+// stateful returns true when the item has state beyond its schedule.
+func (it *item) stateful() bool {
+	return len(it.failures) > 0 || it.interval > 0 || it.unchanged > 0 || it.paused || it.pinned || it.hot
+}
@@ -0,0 +1,267 @@
+/*
+Copyright 2021 The TestGrid Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package config
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	configpb "github.com/GoogleCloudPlatform/testgrid/pb/config"
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestDiffGroups(t *testing.T) {
+	now := time.Date(2021, 1, 2, 3, 4, 5, 0, time.UTC)
+	current := []*configpb.TestGroup{
+		{Name: "hello", DaysOfResults: 1},
+		{Name: "world", DaysOfResults: 2},
+		{Name: "failing"},
+	}
+	cases := []struct {
+		name    string
+		opts    []QueueOption
+		current []*configpb.TestGroup
+		nilQ    bool
+		next    []*configpb.TestGroup
+		want    GroupsDiff
+		empty   bool
+	}{
+		{
+			name:  "empty",
+			nilQ:  true,
+			empty: true,
+		},
+		{
+			name:    "no-op",
+			current: current,
+			next: []*configpb.TestGroup{
+				{Name: "world", DaysOfResults: 2},
+				{Name: "hello", DaysOfResults: 1},
+				{Name: "failing"},
+			},
+			empty: true,
+		},
+		{
+			name:    "adds",
+			current: current,
+			next: append([]*configpb.TestGroup{
+				{Name: "new"},
+				{Name: "another"},
+			}, current...),
+			want: GroupsDiff{
+				Added: []string{"another", "new"},
+			},
+		},
+		{
+			name:    "removals",
+			current: current,
+			next: []*configpb.TestGroup{
+				{Name: "world", DaysOfResults: 2},
+			},
+			want: GroupsDiff{
+				Removed:  []string{"failing", "hello"},
+				Stateful: []string{"failing"},
+			},
+		},
+		{
+			name:    "changes",
+			current: current,
+			next: []*configpb.TestGroup{
+				{Name: "hello", DaysOfResults: 3},
+				{Name: "world", DaysOfResults: 2},
+				{Name: "failing", GcsPrefix: "bucket/path"},
+			},
+			want: GroupsDiff{
+				Changed: []string{"failing", "hello"},
+			},
+		},
+		{
+			name:    "nil and invalid groups are skipped",
+			current: current,
+			next: []*configpb.TestGroup{
+				nil,
+				{Name: "hello", DaysOfResults: 1},
+				{},
+				{Name: "world", DaysOfResults: 2},
+				nil,
+			},
+			want: GroupsDiff{
+				Removed:  []string{"failing"},
+				Stateful: []string{"failing"},
+			},
+		},
+		{
+			name:    "only nil groups",
+			current: current,
+			next:    []*configpb.TestGroup{nil, nil},
+			want: GroupsDiff{
+				Removed:  []string{"failing", "hello", "world"},
+				Stateful: []string{"failing"},
+			},
+		},
+		{
+			name:    "last duplicate wins",
+			current: current,
+			next: append([]*configpb.TestGroup{
+				{Name: "hello", DaysOfResults: 5},
+			}, current...),
+			empty: true,
+		},
+		{
+			name:    "renames",
+			opts:    []QueueOption{WithNameNormalization(true)},
+			current: current,
+			next: []*configpb.TestGroup{
+				{Name: "HELLO", DaysOfResults: 1},
+				{Name: "world", DaysOfResults: 2},
+				{Name: "failing"},
+			},
+			want: GroupsDiff{
+				Renamed: map[string]string{"HELLO": "hello"},
+			},
+		},
+		{
+			name:    "renames and changes",
+			opts:    []QueueOption{WithNameNormalization(true)},
+			current: current,
+			next: []*configpb.TestGroup{
+				{Name: "Hello ", DaysOfResults: 3},
+				{Name: "world", DaysOfResults: 2},
+			},
+			want: GroupsDiff{
+				Removed:  []string{"failing"},
+				Changed:  []string{"Hello "},
+				Renamed:  map[string]string{"Hello ": "hello"},
+				Stateful: []string{"failing"},
+			},
+		},
+		{
+			name: "nil queue",
+			nilQ: true,
+			next: []*configpb.TestGroup{
+				{Name: "hello"},
+				nil,
+			},
+			want: GroupsDiff{
+				Added: []string{"hello"},
+			},
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			var q *TestGroupQueue
+			var before []QueueItem
+			if !tc.nilQ {
+				q = NewTestGroupQueue(append([]QueueOption{WithErrorBudget(1, time.Hour)}, tc.opts...)...)
+				if err := q.Init(tc.current, now); err != nil {
+					t.Fatalf("Init() got unexpected error: %v", err)
+				}
+				if err := q.Ack("failing", errors.New("boom")); err != nil {
+					t.Fatalf("Ack() got unexpected error: %v", err)
+				}
+				before = q.Items()
+			}
+
+			got := DiffGroups(q, tc.next)
+			if diff := cmp.Diff(tc.want, got); diff != "" {
+				t.Errorf("DiffGroups() got unexpected diff (-want +got):\n%s", diff)
+			}
+			if got.Empty() != tc.empty {
+				t.Errorf("Empty() got %t, want %t", got.Empty(), tc.empty)
+			}
+			if q != nil {
+				if diff := cmp.Diff(before, q.Items()); diff != "" {
+					t.Errorf("DiffGroups() modified the queue (-before +after):\n%s", diff)
+				}
+			} else {
+				q = &TestGroupQueue{}
+			}
+
+			got, err := q.InitDiff(tc.next, now)
+			var invalid *InvalidGroupsError
+			if err != nil && !errors.As(err, &invalid) {
+				t.Fatalf("InitDiff() got unexpected error: %v", err)
+			}
+			if diff := cmp.Diff(tc.want, got); diff != "" {
+				t.Errorf("InitDiff() got unexpected diff (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestInitRouses(t *testing.T) {
+	now := time.Date(2021, 1, 2, 3, 4, 5, 0, time.UTC)
+	groups := []*configpb.TestGroup{{Name: "hello"}, {Name: "world"}}
+	cases := []struct {
+		name  string
+		init  func(*TestGroupQueue) error
+		rouse bool
+	}{
+		{
+			name: "unchanged",
+			init: func(q *TestGroupQueue) error {
+				return q.Init([]*configpb.TestGroup{{Name: "world"}, {Name: "hello"}}, now)
+			},
+		},
+		{
+			name: "added",
+			init: func(q *TestGroupQueue) error {
+				return q.Init(append(groups, &configpb.TestGroup{Name: "new"}), now)
+			},
+			rouse: true,
+		},
+		{
+			name: "removed",
+			init: func(q *TestGroupQueue) error {
+				return q.Init(groups[:1], now)
+			},
+			rouse: true,
+		},
+		{
+			name: "changed",
+			init: func(q *TestGroupQueue) error {
+				return q.Init([]*configpb.TestGroup{{Name: "hello", DaysOfResults: 1}, {Name: "world"}}, now)
+			},
+			rouse: true,
+		},
+		{
+			name: "rescheduled",
+			init: func(q *TestGroupQueue) error {
+				return q.InitSchedule(groups, now, map[string]time.Time{"hello": now.Add(time.Hour)})
+			},
+			rouse: true,
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			var q TestGroupQueue
+			if err := q.Init(groups, now); err != nil {
+				t.Fatalf("Init() got unexpected error: %v", err)
+			}
+			gen := q.generation()
+			if err := tc.init(&q); err != nil {
+				t.Fatalf("Init() got unexpected error: %v", err)
+			}
+			if roused := q.generation() != gen; roused != tc.rouse {
+				t.Errorf("Init() roused Send %t, want %t", roused, tc.rouse)
+			}
+		})
+	}
+}
@@ -0,0 +1,127 @@
+/*
+Copyright 2021 The TestGrid Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package config
+
+import (
+	"context"
+	"time"
+
+	configpb "github.com/GoogleCloudPlatform/testgrid/pb/config"
+)
+
+// Dispatch annotates a group Send dispatched, see SendDispatch.
+type Dispatch struct {
+	Group   *configpb.TestGroup
+	When    time.Time // When the group was due.
+	Time    time.Time // When Send dispatched it.
+	Next    time.Time // When the group is due again, or zero if Send removed it.
+	Backlog Backlog   // Of the queue as Send dispatched the group.
+
+	// Ack releases the dispatch, keeping the group's schedule, like Ack
+	// without an error. Nack reports a failure and retries the group after
+	// the delay, which doubles after each consecutive Nack, up to
+	// MaxNackDelay or the delay if longer. Receivers should call one of them
+	// once, as later calls are ignored. Send releases a dispatch settled by
+	// neither before the ack timeout, see WithAckTimeout, keeping its
+	// schedule. Only set for SendDispatch receivers.
+	Ack  func()
+	Nack func(after time.Duration)
+}
+
+// Backlog hints how busy the queue is, so workers may adapt how much they parallelize.
+type Backlog struct {
+	Depth   int // Groups in the queue.
+	Overdue int // Groups due, not counting the dispatched group unless it is due again.
+}
+
+// SendDispatch sends each group to receivers annotated with its Dispatch until the context expires, see Send.
+//
+// The backlog is as of the moment Send dispatched each group, not when
+// SendDispatch started, so a worker sees the queue drain as it catches up.
+// Receivers settle each dispatch with its Ack or Nack.
+func (q *TestGroupQueue) SendDispatch(ctx context.Context, receivers chan<- Dispatch, frequency time.Duration) error {
+	return q.send(ctx, frequency, func(ctx context.Context, d Dispatch) error {
+		l := q.newLease(&d)
+		select {
+		case receivers <- d:
+			q.holdLease(l)
+			return nil
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	})
+}
+
+// backlogCache counts due groups without visiting them on every dispatch.
+//
+// The count holds until the queue's seq or depth changes, which every
+// schedule, add or removal does, or until another group falls due.
+type backlogCache struct {
+	due   int       // groups due at at
+	at    time.Time // when due was counted
+	until time.Time // when the next group falls due, zero if none will
+	seq   uint64    // of the queue when counted
+	depth int       // of the queue when counted
+}
+
+// freshLocked returns whether the count still holds at now.
+func (q *TestGroupQueue) freshLocked(now time.Time) bool {
+	c := &q.backlog
+	switch {
+	case c.at.IsZero(), c.seq != q.seq, c.depth != q.store().Len(), now.Before(c.at):
+		return false
+	case !c.until.IsZero() && !now.Before(c.until):
+		return false
+	}
+	return true
+}
+
+// backlogLocked returns the backlog at now, counting due groups only when the cache is stale.
+func (q *TestGroupQueue) backlogLocked(now time.Time) Backlog {
+	c := &q.backlog
+	if !q.freshLocked(now) {
+		c.due = q.store().countBefore(now.Add(time.Nanosecond)) // at or before now
+		c.until, _ = q.store().nextAfter(now)
+		c.at = now
+		c.seq = q.seq
+		c.depth = q.store().Len()
+	}
+	return Backlog{
+		Depth:   q.store().Len(),
+		Overdue: c.due,
+	}
+}
+
+// keepBacklogLocked adjusts a fresh count after dispatching an item, which was due if due.
+//
+// Saves counting again when Send only dispatched the item since counting.
+func (q *TestGroupQueue) keepBacklogLocked(it *item, now time.Time, due, popped bool) {
+	c := &q.backlog
+	if due {
+		c.due--
+	}
+	if !popped {
+		switch {
+		case !it.when.After(now): // due again
+			c.due++
+		case c.until.IsZero() || it.when.Before(c.until):
+			c.until = it.when
+		}
+	}
+	c.seq = q.seq
+	c.depth = q.store().Len()
+}
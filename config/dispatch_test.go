@@ -0,0 +1,152 @@
+/*
+Copyright 2021 The TestGrid Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package config
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	configpb "github.com/GoogleCloudPlatform/testgrid/pb/config"
+	"github.com/google/go-cmp/cmp"
+	"github.com/google/go-cmp/cmp/cmpopts"
+	"google.golang.org/protobuf/testing/protocmp"
+)
+
+func TestSendDispatch(t *testing.T) {
+	now := time.Date(2021, 1, 2, 3, 4, 5, 0, time.UTC)
+	q := NewTestGroupQueue(WithClock(NewFakeClock(now)))
+	q.Init([]*configpb.TestGroup{{Name: "a"}, {Name: "b"}, {Name: "c"}, {Name: "future"}}, now)
+	if err := q.Fix("future", now.Add(time.Hour)); err != nil {
+		t.Fatalf("Fix() got unexpected error: %v", err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	ch := make(chan Dispatch)
+	errs := make(chan error, 1)
+	go func() {
+		errs <- q.SendDispatch(ctx, ch, 0)
+	}()
+	var got []Dispatch
+	for len(got) < 3 {
+		got = append(got, <-ch)
+	}
+	cancel()
+	<-errs
+
+	want := []Dispatch{
+		{Group: &configpb.TestGroup{Name: "a"}, When: now, Time: now, Backlog: Backlog{Depth: 3, Overdue: 2}},
+		{Group: &configpb.TestGroup{Name: "b"}, When: now, Time: now, Backlog: Backlog{Depth: 2, Overdue: 1}},
+		{Group: &configpb.TestGroup{Name: "c"}, When: now, Time: now, Backlog: Backlog{Depth: 1, Overdue: 0}},
+	}
+	if diff := cmp.Diff(want, got, protocmp.Transform(), cmpopts.IgnoreFields(Dispatch{}, "Ack", "Nack")); diff != "" {
+		t.Errorf("SendDispatch() got unexpected dispatches (-want +got):\n%s", diff)
+	}
+}
+
+func TestBacklog(t *testing.T) {
+	now := time.Date(2021, 1, 2, 3, 4, 5, 0, time.UTC)
+	cases := []struct {
+		name      string
+		frequency time.Duration
+		after     func(*TestGroupQueue, *FakeClock) // the first dispatch
+		want      []Backlog
+	}{
+		{
+			name: "drained",
+			want: []Backlog{
+				{Depth: 3, Overdue: 2},
+				{Depth: 2, Overdue: 1},
+				{Depth: 1, Overdue: 0},
+			},
+		},
+		{
+			name:      "rescheduled",
+			frequency: time.Hour,
+			want: []Backlog{
+				{Depth: 4, Overdue: 2},
+				{Depth: 4, Overdue: 1},
+				{Depth: 4, Overdue: 0},
+			},
+		},
+		{
+			name: "added",
+			after: func(q *TestGroupQueue, _ *FakeClock) {
+				if err := q.Add(&configpb.TestGroup{Name: "d"}, now.Add(-time.Minute)); err != nil {
+					t.Fatalf("Add() got unexpected error: %v", err)
+				}
+			},
+			want: []Backlog{
+				{Depth: 3, Overdue: 2},
+				{Depth: 3, Overdue: 2}, // d
+				{Depth: 2, Overdue: 1},
+			},
+		},
+		{
+			name: "fixed",
+			after: func(q *TestGroupQueue, _ *FakeClock) {
+				if err := q.Fix("c", now.Add(2*time.Hour)); err != nil {
+					t.Fatalf("Fix() got unexpected error: %v", err)
+				}
+			},
+			want: []Backlog{
+				{Depth: 3, Overdue: 2},
+				{Depth: 2, Overdue: 0},
+			},
+		},
+		{
+			name: "fell due",
+			after: func(_ *TestGroupQueue, clock *FakeClock) {
+				clock.Advance(time.Hour)
+			},
+			want: []Backlog{
+				{Depth: 3, Overdue: 2},
+				{Depth: 2, Overdue: 2},
+				{Depth: 1, Overdue: 1},
+				{Depth: 0, Overdue: 0},
+			},
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			clock := NewFakeClock(now)
+			q := NewTestGroupQueue(WithClock(clock))
+			q.Init([]*configpb.TestGroup{{Name: "a"}, {Name: "b"}, {Name: "c"}, {Name: "future"}}, now)
+			if err := q.Fix("future", now.Add(time.Hour)); err != nil {
+				t.Fatalf("Fix() got unexpected error: %v", err)
+			}
+			ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+			defer cancel()
+			var got []Backlog
+			q.send(ctx, tc.frequency, func(_ context.Context, d Dispatch) error {
+				got = append(got, d.Backlog)
+				if len(got) == 1 && tc.after != nil {
+					tc.after(q, clock)
+				}
+				if len(got) == len(tc.want) {
+					cancel()
+				}
+				return nil
+			})
+			if diff := cmp.Diff(tc.want, got); diff != "" {
+				t.Errorf("send() got unexpected backlogs (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
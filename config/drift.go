@@ -0,0 +1,60 @@
+/*
+Copyright 2021 The TestGrid Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package config
+
+import (
+	"time"
+)
+
+// WithFixedRate reschedules each dispatched group relative to when it was due rather than when Send dispatched it.
+//
+// By default Send reschedules a group frequency after dispatching it, so
+// a group consistently dispatched late updates less often than frequency.
+// With a fixed rate the group keeps its period: Send reschedules it
+// frequency after it was due, or the adapted interval, see
+// WithAdaptiveFrequency. Groups so late that this is already past skip the
+// missed slots rather than catching up with a burst of dispatches.
+func WithFixedRate() QueueOption {
+	return func(q *TestGroupQueue) {
+		q.fixedRate = true
+	}
+}
+
+// driftWeight is how much each dispatch contributes to the average drift.
+const driftWeight = 0.1
+
+// nextLocked returns when to reschedule a group due at when and dispatched at now.
+func (q *TestGroupQueue) nextLocked(when, now time.Time, interval time.Duration) time.Time {
+	if !q.fixedRate || interval <= 0 {
+		return now.Add(interval)
+	}
+	next := when.Add(interval)
+	if next.After(now) {
+		return next
+	}
+	missed := now.Sub(when) / interval
+	return when.Add((missed + 1) * interval)
+}
+
+// driftLocked updates the average of how late Send dispatches groups, see QueueStats.
+func (q *TestGroupQueue) driftLocked(late time.Duration) {
+	if !q.drifted {
+		q.drift, q.drifted = late, true
+		return
+	}
+	q.drift += time.Duration(driftWeight * float64(late-q.drift))
+}
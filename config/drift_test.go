@@ -0,0 +1,142 @@
+/*
+Copyright 2021 The TestGrid Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package config
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	configpb "github.com/GoogleCloudPlatform/testgrid/pb/config"
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestFixedRate(t *testing.T) {
+	start := time.Date(2021, 1, 2, 3, 0, 0, 0, time.UTC)
+	const late = 90 * time.Second
+	cases := []struct {
+		name string
+		opts []QueueOption
+		want []time.Duration // after start of each dispatch
+	}{
+		{
+			name: "from dispatch",
+			want: []time.Duration{
+				0,
+				11*time.Minute + 30*time.Second,
+				23 * time.Minute,
+				34*time.Minute + 30*time.Second,
+				46 * time.Minute,
+			},
+		},
+		{
+			name: "fixed rate",
+			opts: []QueueOption{WithFixedRate()},
+			want: []time.Duration{
+				0,
+				11*time.Minute + 30*time.Second,
+				21*time.Minute + 30*time.Second,
+				31*time.Minute + 30*time.Second,
+				41*time.Minute + 30*time.Second,
+			},
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			clock := NewFakeClock(start)
+			q := NewTestGroupQueue(append(tc.opts, WithClock(clock))...)
+			q.Init([]*configpb.TestGroup{{Name: "hi"}}, start)
+			ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+			defer cancel()
+			go func() { // wakes Send late every time it sleeps
+				for clock.BlockUntil(ctx, 1) == nil {
+					wake, ok := q.SleepDeadline()
+					if !ok {
+						continue
+					}
+					clock.Advance(wake.Sub(clock.Now()) + late)
+				}
+			}()
+			var got []time.Duration
+			err := q.SendFunc(ctx, func(context.Context, *configpb.TestGroup) error {
+				got = append(got, clock.Now().Sub(start))
+				if len(got) == len(tc.want) {
+					cancel()
+				}
+				return nil
+			}, 10*time.Minute)
+			if err != context.Canceled {
+				t.Errorf("SendFunc() got %v, want %v", err, context.Canceled)
+			}
+			if diff := cmp.Diff(tc.want, got); diff != "" {
+				t.Errorf("SendFunc() got unexpected dispatches (-want +got):\n%s", diff)
+			}
+			if drift := q.Stats().Drift; drift <= 0 || drift > late {
+				t.Errorf("Stats() got drift %s, want (0, %s]", drift, late)
+			}
+		})
+	}
+}
+
+func TestFixedRateSkipsMissedSlots(t *testing.T) {
+	now := time.Date(2021, 1, 2, 3, 4, 5, 0, time.UTC)
+	cases := []struct {
+		name   string
+		behind time.Duration
+		want   time.Time
+	}{
+		{
+			name: "on time",
+			want: now.Add(10 * time.Minute),
+		},
+		{
+			name:   "late",
+			behind: 9 * time.Minute,
+			want:   now.Add(time.Minute),
+		},
+		{
+			name:   "exactly one slot",
+			behind: 10 * time.Minute,
+			want:   now.Add(10 * time.Minute),
+		},
+		{
+			name:   "hugely overdue",
+			behind: 65 * time.Minute,
+			want:   now.Add(5 * time.Minute),
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			q := NewTestGroupQueue(WithClock(NewFakeClock(now)), WithFixedRate())
+			q.Init([]*configpb.TestGroup{{Name: "hi"}}, now.Add(-tc.behind))
+			ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+			defer cancel()
+			q.SendFunc(ctx, func(context.Context, *configpb.TestGroup) error {
+				cancel()
+				return nil
+			}, 10*time.Minute)
+			if got, err := q.When("hi"); err != nil || !got.Equal(tc.want) {
+				t.Errorf("When() got %v, %v, want %v", got, err, tc.want)
+			}
+			if got := q.Stats().Drift; got != tc.behind {
+				t.Errorf("Stats() got drift %s, want %s", got, tc.behind)
+			}
+		})
+	}
+}
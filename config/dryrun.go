@@ -0,0 +1,194 @@
+/*
+Copyright 2021 The TestGrid Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package config
+
+import (
+	"context"
+	"time"
+
+	"bitbucket.org/creachadair/stringset"
+)
+
+// DryRunOption configures SendDryRun.
+type DryRunOption func(*dryRun)
+
+type dryRun struct {
+	horizon time.Duration
+}
+
+// DryRunHorizon skips sleeps by advancing a virtual clock,
+// returning after simulating d of the schedule.
+//
+// Otherwise SendDryRun sleeps in real time until the context expires.
+func DryRunHorizon(d time.Duration) DryRunOption {
+	return func(dr *dryRun) {
+		dr.horizon = d
+	}
+}
+
+// SendDryRun reports what Send would dispatch and when, without sending anything.
+//
+// Simulates Send against a copy of the queue, leaving the queue itself
+// unchanged. Calls sink with each group's name and the time Send would
+// dispatch it. Changes to the queue after SendDryRun starts are not reflected.
+func (q *TestGroupQueue) SendDryRun(ctx context.Context, sink func(name string, wouldSendAt time.Time), frequency time.Duration, opts ...DryRunOption) error {
+	var dr dryRun
+	for _, opt := range opts {
+		opt(&dr)
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	shadow := q.clone()
+	if dr.horizon > 0 {
+		clock := NewFakeClock(q.now())
+		shadow.clock = clock
+		shadow.warp = &warp{
+			clock:  clock,
+			until:  clock.Now().Add(dr.horizon),
+			cancel: cancel,
+		}
+	}
+
+	err := shadow.send(ctx, frequency, func(_ context.Context, d Dispatch) error {
+		sink(d.Group.Name, d.Time)
+		return nil
+	})
+	if shadow.warp != nil && shadow.warp.done {
+		return nil
+	}
+	return err
+}
+
+// clone returns a copy of the queue's schedule and everything deciding what Send dispatches.
+//
+// The copy shares TestGroup protos, and the functions, policies and
+// strategies deciding which groups Send dispatches, cloning a
+// PrefixFairness so as not to advance the queue's own. It shares neither
+// other callbacks nor a coordinator. Groups in flight stay in flight.
+func (q *TestGroupQueue) clone() *TestGroupQueue {
+	q.lock.RLock()
+	defer q.lock.RUnlock()
+	c := TestGroupQueue{
+		queue:          make(priorityQueue, 0, q.store().Len()),
+		items:          make(map[string]*item, len(q.items)),
+		clock:          q.clock,
+		seq:            q.seq,
+		granularity:    q.granularity,
+		minSpacing:     q.minSpacing,
+		fixedRate:      q.fixedRate,
+		fromCompletion: q.fromCompletion,
+		deadline:       q.deadline,
+		maxDelay:       q.maxDelay,
+		scanBelow:      q.scanBelow,
+		normalize:      q.normalize,
+		foldCase:       q.foldCase,
+		budgetFailures: q.budgetFailures,
+		budgetWindow:   q.budgetWindow,
+		adaptiveMin:    q.adaptiveMin,
+		adaptiveMax:    q.adaptiveMax,
+		slow:           q.slow,
+		historySize:    q.historySize,
+		allowNames:     q.allowNames,
+		denyNames:      q.denyNames,
+		shardIndex:     q.shardIndex,
+		shardTotal:     q.shardTotal,
+		maxSize:        q.maxSize,
+		policy:         q.policy,
+		strategy:       q.strategy,
+		cost:           q.cost,
+		buildThreshold: q.buildThreshold,
+		stale:          q.stale,
+		bucketLimits:   q.bucketLimits, // replaced rather than changed, see SetBucketLimits
+		bucketLoad:     copyCounts(q.bucketLoad),
+		inFlight:       copyNames(q.inFlight),
+		classify:       q.classify,
+		classLimits:    q.classLimits, // likewise
+		classLoad:      copyCounts(q.classLoad),
+		classFlight:    copyNames(q.classFlight),
+		cohorts:        q.cohorts, // likewise
+		cohortOf:       q.cohortOf,
+	}
+	if p, ok := q.policy.(*PrefixFairness); ok {
+		cp := *p
+		c.policy = &cp
+	}
+	if q.hot != nil {
+		c.hot = q.hot.Clone()
+	}
+	if q.pulled != nil {
+		c.pulled = make(map[string]stringset.Set, len(q.pulled))
+		for cohort, pending := range q.pulled {
+			c.pulled[cohort] = pending.Clone()
+		}
+	}
+	for _, it := range q.store().all() {
+		cp := *it
+		cp.failures = append([]time.Time(nil), it.failures...)
+		cp.history = append([]time.Time(nil), it.history...) // a ring buffer Send overwrites
+		c.queue.push(&cp)
+		c.items[it.tg.Name] = &cp
+	}
+	c.realiasLocked()
+	if len(q.overrides) > 0 {
+		c.overrides = make(map[string]GroupOverride, len(q.overrides))
+		for name, o := range q.overrides {
+			c.overrides[name] = o
+		}
+		c.overridesExpire = q.overridesExpire
+	}
+	return &c
+}
+
+func copyCounts(m map[string]int) map[string]int {
+	if m == nil {
+		return nil
+	}
+	out := make(map[string]int, len(m))
+	for k, v := range m {
+		out[k] = v
+	}
+	return out
+}
+
+func copyNames(m map[string]string) map[string]string {
+	if m == nil {
+		return nil
+	}
+	out := make(map[string]string, len(m))
+	for k, v := range m {
+		out[k] = v
+	}
+	return out
+}
+
+// warp advances a virtual clock instead of sleeping.
+type warp struct {
+	clock  *FakeClock
+	until  time.Time
+	cancel context.CancelFunc
+	done   bool
+}
+
+func (w *warp) sleep(d time.Duration) {
+	if !w.clock.Now().Add(d).Before(w.until) {
+		w.done = true
+		w.cancel()
+		return
+	}
+	w.clock.Advance(d)
+}
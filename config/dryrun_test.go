@@ -0,0 +1,203 @@
+/*
+Copyright 2021 The TestGrid Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package config
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	configpb "github.com/GoogleCloudPlatform/testgrid/pb/config"
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestSendDryRun(t *testing.T) {
+	start := time.Date(2021, 1, 2, 3, 4, 5, 0, time.UTC)
+	type dispatch struct {
+		Name string
+		When time.Time
+	}
+	cases := []struct {
+		name      string
+		frequency time.Duration
+		opts      []DryRunOption
+		timeout   time.Duration
+
+		want []dispatch
+		err  bool
+	}{
+		{
+			name:      "horizon",
+			frequency: 20 * time.Minute,
+			opts:      []DryRunOption{DryRunHorizon(time.Hour)},
+			want: []dispatch{
+				{"hi", start},
+				{"there", start.Add(10 * time.Minute)},
+				{"hi", start.Add(20 * time.Minute)},
+				{"there", start.Add(30 * time.Minute)},
+				{"hi", start.Add(40 * time.Minute)},
+				{"there", start.Add(50 * time.Minute)},
+			},
+		},
+		{
+			name: "drain",
+			opts: []DryRunOption{DryRunHorizon(time.Hour)},
+			want: []dispatch{
+				{"hi", start},
+				{"there", start.Add(10 * time.Minute)},
+			},
+		},
+		{
+			name:      "real time",
+			frequency: time.Hour,
+			timeout:   50 * time.Millisecond,
+			want: []dispatch{
+				{"hi", start},
+			},
+			err: true,
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			clock := NewFakeClock(start)
+			q := NewTestGroupQueue(WithClock(clock))
+			q.Init([]*configpb.TestGroup{
+				{
+					Name: "hi",
+				},
+				{
+					Name: "there",
+				},
+			}, start)
+			q.Fix("there", start.Add(10*time.Minute))
+			before := q.Stats()
+
+			ctx := context.Background()
+			if tc.timeout > 0 {
+				var cancel context.CancelFunc
+				ctx, cancel = context.WithTimeout(ctx, tc.timeout)
+				defer cancel()
+			}
+			var got []dispatch
+			err := q.SendDryRun(ctx, func(name string, when time.Time) {
+				got = append(got, dispatch{name, when})
+			}, tc.frequency, tc.opts...)
+			if (err != nil) != tc.err {
+				t.Errorf("SendDryRun() got unexpected error %v, wanted err=%t", err, tc.err)
+			}
+			if diff := cmp.Diff(tc.want, got); diff != "" {
+				t.Errorf("SendDryRun() got unexpected dispatches (-want +got):\n%s", diff)
+			}
+
+			if diff := cmp.Diff(before, q.Stats()); diff != "" {
+				t.Errorf("SendDryRun() changed queue stats (-before +after):\n%s", diff)
+			}
+			_, next, when := q.Status()
+			if next.GetName() != "hi" || !when.Equal(start) {
+				t.Errorf("SendDryRun() changed the queue: next %q at %v", next.GetName(), when)
+			}
+		})
+	}
+}
+
+func TestSendDryRunMatchesSend(t *testing.T) {
+	now := time.Date(2021, 1, 2, 3, 4, 5, 0, time.UTC)
+	cases := []struct {
+		name  string
+		opts  []QueueOption
+		setup func(*TestGroupQueue)
+	}{
+		{
+			name: "default",
+		},
+		{
+			name: "dispatch policy",
+			opts: []QueueOption{WithDispatchPolicy(NewPrefixFairness("a-", "b-"))},
+		},
+		{
+			name: "strategy",
+			opts: []QueueOption{WithStrategy(strategyFunc(func(view []ItemView, _ time.Time) (string, bool) {
+				return view[len(view)-1].Name, true
+			}))},
+		},
+		{
+			name: "hot",
+			setup: func(q *TestGroupQueue) {
+				q.SetHot("b-1")
+			},
+		},
+		{
+			name: "class limits",
+			setup: func(q *TestGroupQueue) {
+				q.SetClassLimits(func(tg *configpb.TestGroup) string {
+					return tg.Name[:1]
+				}, map[string]int{"a": 1})
+				q.lock.Lock()
+				q.launchLocked(q.items["a-2"]) // already in flight
+				q.lock.Unlock()
+			},
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			q := NewTestGroupQueue(append([]QueueOption{WithClock(NewFakeClock(now))}, tc.opts...)...)
+			groups := []*configpb.TestGroup{{Name: "a-1"}, {Name: "a-2"}, {Name: "a-3"}, {Name: "b-1"}, {Name: "b-2"}}
+			q.InitSchedule(groups, now, map[string]time.Time{
+				"a-1": now.Add(-4 * time.Minute),
+				"a-2": now.Add(-3 * time.Minute),
+				"a-3": now.Add(-2 * time.Minute),
+				"b-1": now.Add(-time.Minute),
+			})
+			if tc.setup != nil {
+				tc.setup(q)
+			}
+			ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+			defer cancel()
+
+			var dry []string
+			if err := q.SendDryRun(ctx, func(name string, _ time.Time) {
+				dry = append(dry, name)
+			}, 0, DryRunHorizon(time.Hour)); err != nil {
+				t.Fatalf("SendDryRun() got unexpected error: %v", err)
+			}
+
+			ch := make(chan *configpb.TestGroup, len(groups))
+			sendCtx, sendCancel := context.WithCancel(ctx)
+			defer sendCancel()
+			errs := make(chan error, 1)
+			go func() {
+				errs <- q.Send(sendCtx, ch, 0)
+			}()
+			var sent []string
+			for len(sent) < len(dry) {
+				select {
+				case tg := <-ch:
+					sent = append(sent, tg.Name)
+				case <-ctx.Done():
+					t.Fatalf("Send() only sent %v, SendDryRun() sent %v", sent, dry)
+				}
+			}
+			sendCancel()
+			<-errs
+			if diff := cmp.Diff(dry, sent); diff != "" {
+				t.Errorf("SendDryRun() got unexpected diff from Send() (-dry +sent):\n%s", diff)
+			}
+		})
+	}
+}
@@ -0,0 +1,122 @@
+/*
+Copyright 2021 The TestGrid Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package config
+
+import (
+	"sort"
+	"strings"
+	"time"
+)
+
+// DispatchPolicy chooses which due group Send dispatches next.
+//
+// Send calls Choose while holding the queue lock, so implementations
+// must not call back into the queue.
+type DispatchPolicy interface {
+	// Choose returns the index of the group to dispatch from due, which
+	// holds every due group with the most overdue first.
+	Choose(due []QueueItem) int
+}
+
+// WithDispatchPolicy replaces the default most-overdue-first dispatch order.
+//
+// Replaces any Strategy, see WithStrategy.
+func WithDispatchPolicy(p DispatchPolicy) QueueOption {
+	return func(q *TestGroupQueue) {
+		q.policy = p
+		q.strategy = nil
+	}
+}
+
+// PrefixFairness round-robins dispatches between name-prefix buckets.
+//
+// Each turn dispatches the most overdue group in the next bucket with
+// anything due, so a backlog in one bucket cannot starve the others.
+type PrefixFairness struct {
+	prefixes []string // longest first
+	last     int      // bucket of the last dispatch, or -1 before the first
+}
+
+// NewPrefixFairness returns a policy with a bucket for each prefix.
+//
+// Groups belong to the bucket of their longest matching prefix, while
+// groups matching no prefix share a final bucket.
+func NewPrefixFairness(prefixes ...string) *PrefixFairness {
+	sorted := append([]string(nil), prefixes...)
+	sort.SliceStable(sorted, func(i, j int) bool { return len(sorted[i]) > len(sorted[j]) })
+	return &PrefixFairness{
+		prefixes: sorted,
+		last:     -1,
+	}
+}
+
+func (p *PrefixFairness) bucket(name string) int {
+	for i, prefix := range p.prefixes {
+		if strings.HasPrefix(name, prefix) {
+			return i
+		}
+	}
+	return len(p.prefixes)
+}
+
+// Choose the most overdue group in the bucket after the last one served.
+//
+// Starts with the most overdue group.
+func (p *PrefixFairness) Choose(due []QueueItem) int {
+	if len(due) == 0 {
+		return 0
+	}
+	if p.last < 0 {
+		p.last = p.bucket(due[0].Name)
+		return 0
+	}
+	n := len(p.prefixes) + 1
+	first := make([]int, n) // most overdue index in each bucket, plus one
+	for i, it := range due {
+		if b := p.bucket(it.Name); first[b] == 0 {
+			first[b] = i + 1
+		}
+	}
+	for off := 1; off <= n; off++ {
+		b := (p.last + off) % n
+		if first[b] > 0 {
+			p.last = b
+			return first[b] - 1
+		}
+	}
+	return 0
+}
+
+// chooseLocked returns the due item the dispatch policy prefers over head.
+func (q *TestGroupQueue) chooseLocked(head *item, now time.Time) *item {
+	if q.strategy != nil {
+		return q.strategyLocked(head, now)
+	}
+	if q.policy == nil {
+		return head
+	}
+	due := q.store().due(now)
+	sort.Slice(due, func(i, j int) bool { return less(due[i], due[j]) })
+	items := make([]QueueItem, 0, len(due))
+	for _, it := range due {
+		items = append(items, QueueItem{Name: it.tg.Name, When: it.when})
+	}
+	if i := q.policy.Choose(items); i >= 0 && i < len(due) {
+		return due[i]
+	}
+	return head
+}
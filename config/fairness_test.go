@@ -0,0 +1,137 @@
+/*
+Copyright 2021 The TestGrid Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package config
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	configpb "github.com/GoogleCloudPlatform/testgrid/pb/config"
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestPrefixFairness(t *testing.T) {
+	start := time.Date(2021, 1, 2, 3, 4, 5, 0, time.UTC)
+	cases := []struct {
+		name     string
+		prefixes []string
+		whens    map[string]time.Duration
+
+		want []string
+	}{
+		{
+			name: "default policy",
+			whens: map[string]time.Duration{
+				"redhat-1":   -5 * time.Hour,
+				"redhat-2":   -4 * time.Hour,
+				"redhat-3":   -3 * time.Hour,
+				"sig-node-1": -2 * time.Hour,
+				"sig-node-2": -time.Hour,
+			},
+			want: []string{"redhat-1", "redhat-2", "redhat-3", "sig-node-1", "sig-node-2"},
+		},
+		{
+			name:     "interleave skewed backlogs",
+			prefixes: []string{"redhat-", "sig-node-"},
+			whens: map[string]time.Duration{
+				"redhat-1":   -6 * time.Hour,
+				"redhat-2":   -5 * time.Hour,
+				"redhat-3":   -4 * time.Hour,
+				"redhat-4":   -3 * time.Hour,
+				"redhat-5":   -2 * time.Hour,
+				"sig-node-1": -time.Hour,
+				"sig-node-2": -time.Minute,
+			},
+			want: []string{
+				"redhat-1", "sig-node-1",
+				"redhat-2", "sig-node-2",
+				"redhat-3", "redhat-4", "redhat-5",
+			},
+		},
+		{
+			name:     "unmatched groups share a bucket",
+			prefixes: []string{"redhat-"},
+			whens: map[string]time.Duration{
+				"redhat-1":   -4 * time.Hour,
+				"redhat-2":   -3 * time.Hour,
+				"sig-node-1": -2 * time.Hour,
+				"sig-apps-1": -time.Hour,
+			},
+			want: []string{"redhat-1", "sig-node-1", "redhat-2", "sig-apps-1"},
+		},
+		{
+			name:     "longest prefix wins",
+			prefixes: []string{"sig-", "sig-node-"},
+			whens: map[string]time.Duration{
+				"sig-apps-1": -4 * time.Hour,
+				"sig-apps-2": -3 * time.Hour,
+				"sig-node-1": -2 * time.Hour,
+				"sig-node-2": -time.Hour,
+			},
+			want: []string{"sig-apps-1", "sig-node-1", "sig-apps-2", "sig-node-2"},
+		},
+		{
+			name:     "skip buckets with nothing due",
+			prefixes: []string{"redhat-", "sig-node-"},
+			whens: map[string]time.Duration{
+				"redhat-1":   -3 * time.Hour,
+				"redhat-2":   -2 * time.Hour,
+				"redhat-3":   -time.Hour,
+				"sig-node-1": time.Hour,
+			},
+			want: []string{"redhat-1", "redhat-2", "redhat-3", "sig-node-1"},
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			clock := NewFakeClock(start)
+			opts := []QueueOption{WithClock(clock), WithOrderCheck()}
+			if tc.prefixes != nil {
+				opts = append(opts, WithDispatchPolicy(NewPrefixFairness(tc.prefixes...)))
+			}
+			q := NewTestGroupQueue(opts...)
+			for name, d := range tc.whens {
+				if err := q.Add(&configpb.TestGroup{Name: name}, start.Add(d)); err != nil {
+					t.Fatalf("Add() got unexpected error: %v", err)
+				}
+			}
+
+			var got []string
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+			err := q.SendFunc(ctx, func(_ context.Context, tg *configpb.TestGroup) error {
+				got = append(got, tg.Name)
+				if len(got) == len(tc.want) {
+					cancel()
+					return nil
+				}
+				if depth, _, when := q.Status(); depth > 0 && when.After(clock.Now()) {
+					clock.Advance(when.Sub(clock.Now()))
+				}
+				return nil
+			}, 0)
+			if err != nil && err != context.Canceled {
+				t.Errorf("SendFunc() got unexpected error: %v", err)
+			}
+			if diff := cmp.Diff(tc.want, got); diff != "" {
+				t.Errorf("SendFunc() got unexpected order (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
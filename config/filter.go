@@ -0,0 +1,84 @@
+/*
+Copyright 2021 The TestGrid Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package config
+
+import (
+	"errors"
+	"regexp"
+	"sort"
+
+	configpb "github.com/GoogleCloudPlatform/testgrid/pb/config"
+	"github.com/sirupsen/logrus"
+)
+
+// ErrFiltered is returned when adding a group the queue's name filter excludes, see WithNameFilter.
+var ErrFiltered = errors.New("group excluded by name filter")
+
+// maxExcludedLog is the most excluded names logged by each Init or Merge.
+const maxExcludedLog = 10
+
+// WithNameFilter excludes groups whose names do not match allow or do match deny.
+//
+// Either regexp may be nil to skip that check, and deny takes precedence
+// over allow. Patterns match anywhere in the name unless anchored.
+// Init and Merge skip excluded groups, counting and logging them once per
+// call, while Add, AddIfAbsent and AddBlocking reject them with ErrFiltered.
+func WithNameFilter(allow, deny *regexp.Regexp) QueueOption {
+	return func(q *TestGroupQueue) {
+		q.allowNames = allow
+		q.denyNames = deny
+	}
+}
+
+// SetNameFilter changes the name filter, see WithNameFilter.
+//
+// The filter applies to groups added from now on. Groups already in the
+// queue are not removed, even if the new filter excludes them, until the
+// next Init omits them.
+func (q *TestGroupQueue) SetNameFilter(allow, deny *regexp.Regexp) {
+	q.lock.Lock()
+	defer q.lock.Unlock()
+	q.allowNames = allow
+	q.denyNames = deny
+}
+
+// excludedLocked returns whether the name filter, or the shard, excludes the group.
+func (q *TestGroupQueue) excludedLocked(tg *configpb.TestGroup) bool {
+	if !q.inShardLocked(tg.Name) {
+		return true
+	}
+	if q.denyNames != nil && q.denyNames.MatchString(tg.Name) {
+		return true
+	}
+	return q.allowNames != nil && !q.allowNames.MatchString(tg.Name)
+}
+
+// logExcluded summarizes the groups the name filter excluded.
+func logExcluded(names []string) {
+	if len(names) == 0 {
+		return
+	}
+	sort.Strings(names)
+	examples := names
+	if len(examples) > maxExcludedLog {
+		examples = examples[:maxExcludedLog]
+	}
+	logrus.WithFields(logrus.Fields{
+		"excluded": len(names),
+		"examples": examples,
+	}).Info("Excluded groups by name filter")
+}
@@ -0,0 +1,125 @@
+/*
+Copyright 2021 The TestGrid Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package config
+
+import (
+	"regexp"
+	"sort"
+	"testing"
+	"time"
+
+	configpb "github.com/GoogleCloudPlatform/testgrid/pb/config"
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestNameFilter(t *testing.T) {
+	now := time.Now()
+	groups := []*configpb.TestGroup{
+		{Name: "ci-unit"},
+		{Name: "ci-kettle"},
+		{Name: "pr-unit"},
+		{Name: "pr-kettle"},
+	}
+	cases := []struct {
+		name  string
+		allow *regexp.Regexp
+		deny  *regexp.Regexp
+		want  []string
+	}{
+		{
+			name: "unfiltered",
+			want: []string{"ci-kettle", "ci-unit", "pr-kettle", "pr-unit"},
+		},
+		{
+			name:  "allow only",
+			allow: regexp.MustCompile("^ci-"),
+			want:  []string{"ci-kettle", "ci-unit"},
+		},
+		{
+			name: "deny only",
+			deny: regexp.MustCompile("kettle"),
+			want: []string{"ci-unit", "pr-unit"},
+		},
+		{
+			name:  "deny takes precedence",
+			allow: regexp.MustCompile("^ci-"),
+			deny:  regexp.MustCompile("kettle"),
+			want:  []string{"ci-unit"},
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			q := NewTestGroupQueue(WithNameFilter(tc.allow, tc.deny))
+			if err := q.Init(groups, now); err != nil {
+				t.Fatalf("Init() got unexpected error: %v", err)
+			}
+			var got []string
+			for _, it := range q.Items() {
+				got = append(got, it.Name)
+			}
+			sort.Strings(got)
+			if diff := cmp.Diff(tc.want, got); diff != "" {
+				t.Errorf("Init() got unexpected diff (-want +got):\n%s", diff)
+			}
+			if got, want := q.Stats().Excluded, len(groups)-len(tc.want); got != want {
+				t.Errorf("Stats() got %d excluded, want %d", got, want)
+			}
+
+			allowed := map[string]bool{}
+			for _, name := range tc.want {
+				allowed[name] = true
+			}
+			var fresh TestGroupQueue
+			fresh.SetNameFilter(tc.allow, tc.deny)
+			for _, tg := range groups {
+				err := fresh.Add(tg, now)
+				switch {
+				case allowed[tg.Name] && err != nil:
+					t.Errorf("Add(%s) got unexpected error: %v", tg.Name, err)
+				case !allowed[tg.Name] && err != ErrFiltered:
+					t.Errorf("Add(%s) got %v, want %v", tg.Name, err, ErrFiltered)
+				}
+				if got := fresh.AddIfAbsent(&configpb.TestGroup{Name: tg.Name}, now); got {
+					t.Errorf("AddIfAbsent(%s) added an existing or excluded group", tg.Name)
+				}
+			}
+		})
+	}
+}
+
+func TestSetNameFilter(t *testing.T) {
+	now := time.Now()
+	var q TestGroupQueue
+	groups := []*configpb.TestGroup{{Name: "small"}, {Name: "kettle"}}
+	q.Init(groups, now)
+	q.SetNameFilter(nil, regexp.MustCompile("kettle"))
+	if got, want := q.Len(), 2; got != want {
+		t.Errorf("SetNameFilter() left %d groups, want %d", got, want)
+	}
+	q.Merge(groups, now)
+	if got, want := q.Len(), 2; got != want {
+		t.Errorf("Merge() left %d groups, want %d", got, want)
+	}
+	q.Init(groups, now)
+	if _, err := q.When("kettle"); err != ErrNotFound {
+		t.Errorf("Init() kept excluded group: %v", err)
+	}
+	if got, want := q.Len(), 1; got != want {
+		t.Errorf("Init() left %d groups, want %d", got, want)
+	}
+}
@@ -0,0 +1,84 @@
+/*
+Copyright 2021 The TestGrid Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package config
+
+import (
+	"time"
+)
+
+// Fingerprint returns a hash of the groups in the queue and when each is due.
+//
+// Lets callers cheaply tell whether the queue's groups or schedule changed
+// since they last looked, such as to refresh a cached view. Identical
+// queues have identical fingerprints, however they were built, and any
+// added, removed or rescheduled group almost certainly changes it. Times
+// are truncated to the second, so rescheduling a group within the same
+// second, such as repeated sub-second Fixes, keeps the fingerprint.
+//
+// Maintained as the queue changes, so it costs nothing to call.
+func (q *TestGroupQueue) Fingerprint() uint64 {
+	q.lock.RLock()
+	defer q.lock.RUnlock()
+	return q.print
+}
+
+// printLocked adds the item to the fingerprint, see Fingerprint.
+func (q *TestGroupQueue) printLocked(it *item) {
+	q.print += groupPrint(it.tg.Name, it.when)
+}
+
+// unprintLocked removes the item from the fingerprint, before removing or rescheduling it.
+func (q *TestGroupQueue) unprintLocked(it *item) {
+	q.print -= groupPrint(it.tg.Name, it.when)
+}
+
+// reprintLocked recomputes the fingerprint from every item.
+func (q *TestGroupQueue) reprintLocked() {
+	q.print = 0
+	for _, it := range q.items {
+		q.printLocked(it)
+	}
+}
+
+// groupPrint hashes a group and when it is due to the second.
+//
+// Summing the hashes of every group makes the fingerprint independent of
+// their order, so the queue can update it as groups change.
+func groupPrint(name string, when time.Time) uint64 {
+	const (
+		offset = 14695981039346656037 // FNV-1a
+		prime  = 1099511628211
+	)
+	h := uint64(offset)
+	for i := 0; i < len(name); i++ {
+		h ^= uint64(name[i])
+		h *= prime
+	}
+	secs := uint64(when.Unix())
+	for i := 0; i < 8; i++ {
+		h ^= secs & 0xff
+		h *= prime
+		secs >>= 8
+	}
+	// finalize like splitmix64, so sums of similar hashes rarely collide
+	h ^= h >> 30
+	h *= 0xbf58476d1ce4e5b9
+	h ^= h >> 27
+	h *= 0x94d049bb133111eb
+	h ^= h >> 31
+	return h
+}
@@ -0,0 +1,156 @@
+/*
+Copyright 2021 The TestGrid Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package config
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	configpb "github.com/GoogleCloudPlatform/testgrid/pb/config"
+)
+
+func TestFingerprint(t *testing.T) {
+	now := time.Date(2021, 1, 2, 3, 4, 5, 0, time.UTC)
+	cases := []struct {
+		name    string
+		change  func(*TestGroupQueue)
+		changed bool
+	}{
+		{
+			name:   "nothing",
+			change: func(*TestGroupQueue) {},
+		},
+		{
+			name: "identical init",
+			change: func(q *TestGroupQueue) {
+				q.Init([]*configpb.TestGroup{{Name: "b"}, {Name: "a"}}, now)
+			},
+		},
+		{
+			name: "add",
+			change: func(q *TestGroupQueue) {
+				q.Add(&configpb.TestGroup{Name: "c"}, now)
+			},
+			changed: true,
+		},
+		{
+			name: "remove",
+			change: func(q *TestGroupQueue) {
+				q.Remove("a")
+			},
+			changed: true,
+		},
+		{
+			name: "fix",
+			change: func(q *TestGroupQueue) {
+				q.Fix("a", now.Add(time.Second))
+			},
+			changed: true,
+		},
+		{
+			name: "fix within the second",
+			change: func(q *TestGroupQueue) {
+				q.Fix("a", now.Add(500*time.Millisecond))
+			},
+		},
+		{
+			name: "swap",
+			change: func(q *TestGroupQueue) {
+				q.FixAll(map[string]time.Time{"a": now.Add(time.Minute), "b": now})
+			},
+			changed: true,
+		},
+		{
+			name: "prioritize",
+			change: func(q *TestGroupQueue) {
+				q.Prioritize("b")
+			},
+			changed: true,
+		},
+		{
+			name: "postpone",
+			change: func(q *TestGroupQueue) {
+				q.PostponeAll(time.Minute)
+			},
+			changed: true,
+		},
+		{
+			name: "dispatch",
+			change: func(q *TestGroupQueue) {
+				ctx, cancel := context.WithCancel(context.Background())
+				q.SendFunc(ctx, func(context.Context, *configpb.TestGroup) error {
+					cancel()
+					return nil
+				}, time.Hour)
+			},
+			changed: true,
+		},
+		{
+			name: "pop all",
+			change: func(q *TestGroupQueue) {
+				q.PopAll()
+			},
+			changed: true,
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			q := NewTestGroupQueue(WithClock(NewFakeClock(now)))
+			q.InitSchedule([]*configpb.TestGroup{{Name: "a"}, {Name: "b"}}, now, map[string]time.Time{
+				"b": now.Add(time.Minute),
+			})
+			before := q.Fingerprint()
+			tc.change(q)
+			if changed := q.Fingerprint() != before; changed != tc.changed {
+				t.Errorf("Fingerprint() changed %t, want %t", changed, tc.changed)
+			}
+			if err := q.Verify(); err != nil {
+				t.Errorf("Verify() got unexpected error: %v", err)
+			}
+		})
+	}
+}
+
+func TestFingerprintRebuild(t *testing.T) {
+	now := time.Date(2021, 1, 2, 3, 4, 5, 0, time.UTC)
+	var empty TestGroupQueue
+	if got := empty.Fingerprint(); got != 0 {
+		t.Errorf("Fingerprint() of an empty queue got %x, want 0", got)
+	}
+
+	var inited TestGroupQueue
+	inited.Init([]*configpb.TestGroup{{Name: "a"}, {Name: "b"}, {Name: "c"}}, now)
+	inited.Fix("b", now.Add(time.Hour))
+
+	var added TestGroupQueue
+	added.Add(&configpb.TestGroup{Name: "c"}, now)
+	added.Add(&configpb.TestGroup{Name: "b"}, now.Add(time.Hour))
+	added.Add(&configpb.TestGroup{Name: "a"}, now.Add(time.Millisecond))
+
+	if a, b := inited.Fingerprint(), added.Fingerprint(); a != b {
+		t.Errorf("Fingerprint() of identical queues got %x and %x", a, b)
+	}
+	if err := added.Remove("c"); err != nil {
+		t.Fatalf("Remove() got unexpected error: %v", err)
+	}
+	added.PopAll()
+	if got := added.Fingerprint(); got != 0 {
+		t.Errorf("Fingerprint() after emptying got %x, want 0", got)
+	}
+}
@@ -0,0 +1,147 @@
+/*
+Copyright 2021 The TestGrid Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package config
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+// ErrReentrant is returned by methods changing the schedule while a FixEach callback runs, see FixEach.
+var ErrReentrant = errors.New("schedule changed during FixEach callback")
+
+// FixEach fixes the groups fn chooses, reordering the queue once.
+//
+// Calls fn with each group's name and when it is due, fixing the group to
+// the returned time when fn also returns true. Unlike FixAll, callers
+// need not build a map of every group first, which matters for large
+// queues. Reorders the queue once, and only if any group changed.
+//
+// Calls fn without the lock held, so fn may read the queue, but methods
+// changing the schedule, such as Fix or FixAll, return ErrReentrant, rather
+// than deadlocking, until FixEach returns, including calls from other
+// goroutines. Leaves groups Send dispatches while fn runs where Send put
+// them. Rejects every group, fixing none, if fn fixes any to the zero time,
+// see Init. May spread groups fixed to be due at once, see WithFixSmoothing.
+func (q *TestGroupQueue) FixEach(fn func(name string, current time.Time) (time.Time, bool)) (err error) {
+	q.lock.Lock()
+	if err := q.frozenLocked(); err != nil {
+		q.lock.Unlock()
+		return err
+	}
+	all := q.store().all()
+	snapshot := make([]fixedItem, len(all))
+	for i, it := range all {
+		snapshot[i] = fixedItem{it, it.when}
+	}
+	q.fixing = true
+	q.lock.Unlock()
+
+	var zero []string
+	var changed []fixedItem
+	var seen []time.Time // when fn saw each changed group due
+	func() {
+		defer func() {
+			q.lock.Lock()
+			q.fixing = false
+			q.lock.Unlock()
+		}()
+		for _, s := range snapshot {
+			when, ok := fn(s.it.tg.Name, s.when)
+			switch {
+			case !ok:
+			case when.IsZero():
+				zero = append(zero, s.it.tg.Name)
+			default:
+				changed = append(changed, fixedItem{s.it, when})
+				seen = append(seen, s.when)
+			}
+		}
+	}()
+	if len(zero) > 0 {
+		sort.Strings(zero)
+		err := fmt.Errorf("fix: %w: zero time for %v", ErrInvalidTime, zero)
+		logrus.WithError(err).Error("Rejecting zero time, probably from an uninitialized variable")
+		return err
+	}
+
+	q.lock.Lock()
+	defer q.lock.Unlock()
+	defer func() {
+		if len(changed) > 0 {
+			q.rouse()
+		}
+	}()
+	defer q.recoverLocked(&err)
+
+	if err := q.frozenLocked(); err != nil { // sealed while fn ran
+		changed = nil
+		return err
+	}
+	// skip groups Send moved, or the queue dropped, while fn ran
+	keep := changed[:0]
+	for i, c := range changed {
+		if q.items[c.it.tg.Name] != c.it || !c.it.when.Equal(seen[i]) {
+			continue
+		}
+		if c.when = q.truncate(c.when); !c.when.Equal(c.it.when) {
+			keep = append(keep, c)
+		}
+	}
+	changed = keep
+	if len(changed) == 0 {
+		return nil
+	}
+
+	// groups fixed to the same time queue in name order, like FixAll
+	sort.Slice(changed, func(i, j int) bool {
+		return changed[i].it.tg.Name < changed[j].it.tg.Name
+	})
+	q.smoothLocked(changed)
+	for _, c := range changed {
+		if c.when.Equal(c.it.when) { // spread back to where it was
+			continue
+		}
+		q.fixedLocked(c.it, c.when, "")
+		q.scheduleLocked(c.it, c.when)
+	}
+	q.store().rebuild()
+	logrus.WithField("count", len(changed)).Info("Fixed groups")
+	return nil
+}
+
+// frozenLocked returns ErrReentrant while a FixEach callback runs, or
+// ErrSealed if the queue is sealed, see Seal.
+func (q *TestGroupQueue) frozenLocked() error {
+	switch {
+	case q.fixing:
+		return ErrReentrant
+	case q.sealed:
+		return ErrSealed
+	}
+	return nil
+}
+
+// fixedItem is a group FixEach fixes, and when to.
+type fixedItem struct {
+	it   *item
+	when time.Time
+}
@@ -0,0 +1,203 @@
+/*
+Copyright 2021 The TestGrid Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package config
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	configpb "github.com/GoogleCloudPlatform/testgrid/pb/config"
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestFixEach(t *testing.T) {
+	now := time.Date(2021, 1, 2, 3, 4, 5, 0, time.UTC)
+	cases := []struct {
+		name string
+		fn   func(name string, current time.Time) (time.Time, bool)
+		want []QueueItem
+		err  error
+	}{
+		{
+			name: "none",
+			fn: func(string, time.Time) (time.Time, bool) {
+				return time.Time{}, false
+			},
+			want: []QueueItem{
+				{Name: "a", When: now},
+				{Name: "b", When: now.Add(time.Minute)},
+				{Name: "c", When: now.Add(2 * time.Minute)},
+			},
+		},
+		{
+			name: "some",
+			fn: func(name string, current time.Time) (time.Time, bool) {
+				return current.Add(time.Hour), name != "b"
+			},
+			want: []QueueItem{
+				{Name: "b", When: now.Add(time.Minute)},
+				{Name: "a", When: now.Add(time.Hour)},
+				{Name: "c", When: now.Add(time.Hour + 2*time.Minute)},
+			},
+		},
+		{
+			name: "same time in name order",
+			fn: func(name string, _ time.Time) (time.Time, bool) {
+				return now.Add(time.Hour), name != "b"
+			},
+			want: []QueueItem{
+				{Name: "b", When: now.Add(time.Minute)},
+				{Name: "a", When: now.Add(time.Hour)},
+				{Name: "c", When: now.Add(time.Hour)},
+			},
+		},
+		{
+			name: "zero time rejects all",
+			fn: func(name string, current time.Time) (time.Time, bool) {
+				if name == "b" {
+					return time.Time{}, true
+				}
+				return current.Add(time.Hour), true
+			},
+			want: []QueueItem{
+				{Name: "a", When: now},
+				{Name: "b", When: now.Add(time.Minute)},
+				{Name: "c", When: now.Add(2 * time.Minute)},
+			},
+			err: ErrInvalidTime,
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			q := NewTestGroupQueue(WithClock(NewFakeClock(now)))
+			q.InitSchedule([]*configpb.TestGroup{{Name: "a"}, {Name: "b"}, {Name: "c"}}, now, map[string]time.Time{
+				"b": now.Add(time.Minute),
+				"c": now.Add(2 * time.Minute),
+			})
+			if err := q.FixEach(tc.fn); !errors.Is(err, tc.err) {
+				t.Errorf("FixEach() got error %v, want %v", err, tc.err)
+			}
+			var got []QueueItem
+			for _, it := range q.Items() {
+				got = append(got, QueueItem{Name: it.Name, When: it.When})
+			}
+			if diff := cmp.Diff(tc.want, got); diff != "" {
+				t.Errorf("FixEach() got unexpected diff (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestFixEachReentrant(t *testing.T) {
+	now := time.Date(2021, 1, 2, 3, 4, 5, 0, time.UTC)
+	cases := []struct {
+		name string
+		call func(*TestGroupQueue) error
+		err  error
+	}{
+		{
+			name: "Fix",
+			call: func(q *TestGroupQueue) error { return q.Fix("a", now.Add(time.Hour)) },
+			err:  ErrReentrant,
+		},
+		{
+			name: "FixAll",
+			call: func(q *TestGroupQueue) error { return q.FixAll(map[string]time.Time{"a": now.Add(time.Hour)}) },
+			err:  ErrReentrant,
+		},
+		{
+			name: "Remove",
+			call: func(q *TestGroupQueue) error { return q.Remove("a") },
+			err:  ErrReentrant,
+		},
+		{
+			name: "Add",
+			call: func(q *TestGroupQueue) error { return q.Add(&configpb.TestGroup{Name: "c"}, now) },
+			err:  ErrReentrant,
+		},
+		{
+			name: "FixEach",
+			call: func(q *TestGroupQueue) error {
+				return q.FixEach(func(string, time.Time) (time.Time, bool) { return time.Time{}, false })
+			},
+			err: ErrReentrant,
+		},
+		{
+			name: "When",
+			call: func(q *TestGroupQueue) error {
+				_, err := q.When("a")
+				return err
+			},
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			q := NewTestGroupQueue(WithClock(NewFakeClock(now)))
+			q.Init([]*configpb.TestGroup{{Name: "a"}, {Name: "b"}}, now)
+			err := q.FixEach(func(name string, current time.Time) (time.Time, bool) {
+				if name == "b" {
+					if err := tc.call(q); !errors.Is(err, tc.err) {
+						t.Errorf("%s() from the callback got error %v, want %v", tc.name, err, tc.err)
+					}
+				}
+				return current.Add(time.Minute), true
+			})
+			if err != nil {
+				t.Errorf("FixEach() got unexpected error: %v", err)
+			}
+			var got []QueueItem
+			for _, it := range q.Items() {
+				got = append(got, QueueItem{Name: it.Name, When: it.When})
+			}
+			want := []QueueItem{
+				{Name: "a", When: now.Add(time.Minute)},
+				{Name: "b", When: now.Add(time.Minute)},
+			}
+			if diff := cmp.Diff(want, got); diff != "" {
+				t.Errorf("FixEach() got unexpected diff (-want +got):\n%s", diff)
+			}
+			// usable afterwards
+			if err := q.Fix("a", now.Add(time.Hour)); err != nil {
+				t.Errorf("Fix() got unexpected error: %v", err)
+			}
+		})
+	}
+}
+
+func TestFixEachConcurrent(t *testing.T) {
+	now := time.Date(2021, 1, 2, 3, 4, 5, 0, time.UTC)
+	q := NewTestGroupQueue(WithClock(NewFakeClock(now)))
+	q.Init([]*configpb.TestGroup{{Name: "a"}}, now)
+	errs := make(chan error, 1)
+	err := q.FixEach(func(name string, current time.Time) (time.Time, bool) {
+		go func() {
+			_, err := q.When(name) // reads while the callback runs
+			errs <- err
+		}()
+		time.Sleep(10 * time.Millisecond)
+		return current.Add(time.Hour), true
+	})
+	if err != nil {
+		t.Errorf("FixEach() got unexpected error: %v", err)
+	}
+	if err := <-errs; err != nil {
+		t.Errorf("When() from another goroutine got unexpected error: %v", err)
+	}
+}
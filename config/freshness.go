@@ -0,0 +1,53 @@
+/*
+Copyright 2021 The TestGrid Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package config
+
+import (
+	"time"
+
+	configpb "github.com/GoogleCloudPlatform/testgrid/pb/config"
+)
+
+// WithLastResult schedules new groups by how stale their results are.
+//
+// Init, Merge and Add schedule each group new to the queue frequency after
+// lastResult returns, so groups without recent results are sent first.
+// Groups for which lastResult returns the zero time are scheduled at the
+// when passed to Init, Merge or Add, as are all groups without this option.
+// Existing groups retain their schedule, and Fix, FixAll and Prioritize
+// still override the computed time.
+//
+// The queue calls lastResult while holding its lock, so it must not call
+// the queue's methods.
+func WithLastResult(lastResult func(*configpb.TestGroup) time.Time, frequency time.Duration) QueueOption {
+	return func(q *TestGroupQueue) {
+		q.lastResult = lastResult
+		q.resultFrequency = frequency
+	}
+}
+
+// freshWhen returns when a new group is due based on its last result, defaulting to when.
+func (q *TestGroupQueue) freshWhen(tg *configpb.TestGroup, when time.Time) time.Time {
+	if q.lastResult == nil {
+		return when
+	}
+	last := q.lastResult(tg)
+	if last.IsZero() {
+		return when
+	}
+	return last.Add(q.resultFrequency)
+}
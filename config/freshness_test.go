@@ -0,0 +1,131 @@
+/*
+Copyright 2021 The TestGrid Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package config
+
+import (
+	"testing"
+	"time"
+
+	configpb "github.com/GoogleCloudPlatform/testgrid/pb/config"
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestLastResult(t *testing.T) {
+	now := time.Date(2021, 1, 2, 3, 4, 5, 0, time.UTC)
+	results := map[string]time.Time{
+		"stale":  now.Add(-24 * time.Hour),
+		"recent": now.Add(-time.Minute),
+		"fresh":  now,
+	}
+	lastResult := func(tg *configpb.TestGroup) time.Time {
+		return results[tg.Name]
+	}
+	groups := []*configpb.TestGroup{
+		{Name: "fresh"},
+		{Name: "recent"},
+		{Name: "missing"},
+		{Name: "stale"},
+	}
+
+	cases := []struct {
+		name   string
+		opts   []QueueOption
+		modify func(*TestGroupQueue) error
+		want   []QueueItem
+	}{
+		{
+			name: "disabled",
+			want: []QueueItem{
+				{Name: "fresh", When: now},
+				{Name: "recent", When: now},
+				{Name: "missing", When: now},
+				{Name: "stale", When: now},
+			},
+		},
+		{
+			name: "stale groups first",
+			opts: []QueueOption{WithLastResult(lastResult, time.Hour)},
+			want: []QueueItem{
+				{Name: "stale", When: now.Add(-23 * time.Hour)},
+				{Name: "missing", When: now},
+				{Name: "recent", When: now.Add(59 * time.Minute)},
+				{Name: "fresh", When: now.Add(time.Hour)},
+			},
+		},
+		{
+			name: "existing groups keep their schedule",
+			opts: []QueueOption{WithLastResult(lastResult, time.Hour)},
+			modify: func(q *TestGroupQueue) error {
+				results["fresh"] = now.Add(-48 * time.Hour)
+				defer func() { results["fresh"] = now }()
+				return q.Merge(groups, now)
+			},
+			want: []QueueItem{
+				{Name: "stale", When: now.Add(-23 * time.Hour)},
+				{Name: "missing", When: now},
+				{Name: "recent", When: now.Add(59 * time.Minute)},
+				{Name: "fresh", When: now.Add(time.Hour)},
+			},
+		},
+		{
+			name: "new groups",
+			opts: []QueueOption{WithLastResult(lastResult, time.Hour)},
+			modify: func(q *TestGroupQueue) error {
+				results["added"] = now.Add(-2 * time.Hour)
+				defer delete(results, "added")
+				return q.Add(&configpb.TestGroup{Name: "added"}, now)
+			},
+			want: []QueueItem{
+				{Name: "stale", When: now.Add(-23 * time.Hour)},
+				{Name: "added", When: now.Add(-time.Hour)},
+				{Name: "missing", When: now},
+				{Name: "recent", When: now.Add(59 * time.Minute)},
+				{Name: "fresh", When: now.Add(time.Hour)},
+			},
+		},
+		{
+			name: "fix overrides",
+			opts: []QueueOption{WithLastResult(lastResult, time.Hour)},
+			modify: func(q *TestGroupQueue) error {
+				return q.Fix("stale", now.Add(2*time.Hour))
+			},
+			want: []QueueItem{
+				{Name: "missing", When: now},
+				{Name: "recent", When: now.Add(59 * time.Minute)},
+				{Name: "fresh", When: now.Add(time.Hour)},
+				{Name: "stale", When: now.Add(2 * time.Hour)},
+			},
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			q := NewTestGroupQueue(tc.opts...)
+			if err := q.Init(groups, now); err != nil {
+				t.Fatalf("Init() got unexpected error: %v", err)
+			}
+			if tc.modify != nil {
+				if err := tc.modify(q); err != nil {
+					t.Fatalf("modify got unexpected error: %v", err)
+				}
+			}
+			if diff := cmp.Diff(tc.want, q.Items()); diff != "" {
+				t.Errorf("Items() got unexpected diff (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
@@ -0,0 +1,67 @@
+/*
+Copyright 2021 The TestGrid Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package config
+
+import (
+	"time"
+)
+
+// WithHistory remembers when Send last dispatched each group, up to n times per group.
+//
+// History reveals cadence problems that a group's current schedule hides,
+// such as oscillating backoff or repeated expedites.
+func WithHistory(n int) QueueOption {
+	return func(q *TestGroupQueue) {
+		q.historySize = n
+	}
+}
+
+// History returns when Send last dispatched the group, up to k times, oldest first.
+//
+// A k of zero or less returns every dispatch the queue remembers, see
+// WithHistory. Returns nil when the group is not in the queue.
+func (q *TestGroupQueue) History(name string, k int) []time.Time {
+	q.lock.RLock()
+	defer q.lock.RUnlock()
+	name = q.lookupLocked(name)
+	it, ok := q.items[name]
+	if !ok {
+		return nil
+	}
+	n := len(it.history)
+	if k <= 0 || k > n {
+		k = n
+	}
+	out := make([]time.Time, 0, k)
+	for i := n - k; i < n; i++ {
+		out = append(out, it.history[(it.historyNext+i)%n])
+	}
+	return out
+}
+
+// rememberLocked adds a dispatch at now to the item's history.
+func (q *TestGroupQueue) rememberLocked(it *item, now time.Time) {
+	if q.historySize <= 0 {
+		return
+	}
+	if len(it.history) < q.historySize {
+		it.history = append(it.history, now)
+		return
+	}
+	it.history[it.historyNext] = now
+	it.historyNext = (it.historyNext + 1) % len(it.history)
+}
@@ -0,0 +1,109 @@
+/*
+Copyright 2021 The TestGrid Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package config
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	configpb "github.com/GoogleCloudPlatform/testgrid/pb/config"
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestHistory(t *testing.T) {
+	start := time.Date(2021, 1, 2, 3, 0, 0, 0, time.UTC)
+	const frequency = 10 * time.Minute
+	at := func(dispatches ...int) []time.Time {
+		out := []time.Time{}
+		for _, i := range dispatches {
+			out = append(out, start.Add(time.Duration(i)*frequency))
+		}
+		return out
+	}
+	cases := []struct {
+		name  string
+		opts  []QueueOption
+		group string
+		k     int
+		want  []time.Time
+	}{
+		{
+			name:  "disabled",
+			group: "hi",
+			want:  at(),
+		},
+		{
+			name:  "all",
+			opts:  []QueueOption{WithHistory(10)},
+			group: "hi",
+			want:  at(0, 1, 2, 3, 4),
+		},
+		{
+			name:  "bounded",
+			opts:  []QueueOption{WithHistory(3)},
+			group: "hi",
+			want:  at(2, 3, 4),
+		},
+		{
+			name:  "last k",
+			opts:  []QueueOption{WithHistory(3)},
+			group: "hi",
+			k:     2,
+			want:  at(3, 4),
+		},
+		{
+			name:  "more than remembered",
+			opts:  []QueueOption{WithHistory(3)},
+			group: "hi",
+			k:     5,
+			want:  at(2, 3, 4),
+		},
+		{
+			name:  "missing",
+			opts:  []QueueOption{WithHistory(3)},
+			group: "missing",
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			clock := NewFakeClock(start)
+			q := NewTestGroupQueue(append(tc.opts, WithClock(clock))...)
+			q.Init([]*configpb.TestGroup{{Name: "hi"}}, start)
+			ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+			defer cancel()
+			go func() { // wakes Send when the group is due
+				for clock.BlockUntil(ctx, 1) == nil {
+					if wake, ok := q.SleepDeadline(); ok {
+						clock.Advance(wake.Sub(clock.Now()))
+					}
+				}
+			}()
+			var dispatches int
+			q.SendFunc(ctx, func(context.Context, *configpb.TestGroup) error {
+				if dispatches++; dispatches == 5 {
+					cancel()
+				}
+				return nil
+			}, frequency)
+			if diff := cmp.Diff(tc.want, q.History(tc.group, tc.k)); diff != "" {
+				t.Errorf("History() got unexpected diff (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
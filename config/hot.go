@@ -0,0 +1,108 @@
+/*
+Copyright 2021 The TestGrid Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package config
+
+import (
+	"time"
+
+	"bitbucket.org/creachadair/stringset"
+	"github.com/sirupsen/logrus"
+)
+
+// SetHot marks the groups Send dispatches ahead of other due groups.
+//
+// Whereas a group's schedule decides when it is due, hotness decides which
+// due group goes first, for example groups with active pull requests.
+// Among due groups Send dispatches the earliest hot group first, even
+// ahead of the choice of any DispatchPolicy or Strategy, though it skips hot
+// groups over their error budget or in a full bucket. Groups stay hot,
+// even when Init or Merge update them, until ClearHot. Groups not in the
+// queue are ignored.
+func (q *TestGroupQueue) SetHot(names ...string) {
+	q.setHot(names, true)
+}
+
+// ClearHot undoes SetHot for the groups, or every hot group when called without names.
+func (q *TestGroupQueue) ClearHot(names ...string) {
+	if len(names) == 0 {
+		q.lock.RLock()
+		names = q.hot.Elements()
+		q.lock.RUnlock()
+	}
+	q.setHot(names, false)
+}
+
+func (q *TestGroupQueue) setHot(names []string, hot bool) {
+	q.lock.Lock()
+	defer q.lock.Unlock()
+	for _, name := range names {
+		name = q.lookupLocked(name)
+		it, ok := q.items[name]
+		if !ok {
+			continue
+		}
+		if hot {
+			if q.hot == nil {
+				q.hot = stringset.New()
+			}
+			q.hot.Add(name)
+		} else {
+			q.hot.Discard(name)
+		}
+		if it.hot == hot {
+			continue
+		}
+		logrus.WithFields(logrus.Fields{
+			"group": name,
+			"hot":   hot,
+		}).Info("Changed group hotness")
+		it.hot = hot
+		q.reorderLocked(it) // breaks ties with equally due groups
+	}
+}
+
+// preferHotLocked returns the earliest hot due group, if any, otherwise chosen.
+//
+// Groups are hot when marked by SetHot or an override, see ApplyOverrides.
+func (q *TestGroupQueue) preferHotLocked(chosen *item, now time.Time) *item {
+	if chosen.hot || q.hot.Len() == 0 && len(q.overrides) == 0 {
+		return chosen
+	}
+	var best *item
+	consider := func(it *item) {
+		if !it.when.After(now) && (best == nil || less(it, best)) {
+			best = it
+		}
+	}
+	for name := range q.hot {
+		it, ok := q.items[name]
+		if !ok || !it.hot {
+			q.hot.Discard(name) // removed since marked hot
+			continue
+		}
+		consider(it)
+	}
+	for name, o := range q.overrides {
+		if it, ok := q.items[name]; ok && o.Hot && !o.expired(now) {
+			consider(it)
+		}
+	}
+	if best == nil {
+		return chosen
+	}
+	return best
+}
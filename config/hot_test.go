@@ -0,0 +1,143 @@
+/*
+Copyright 2021 The TestGrid Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package config
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	configpb "github.com/GoogleCloudPlatform/testgrid/pb/config"
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestHot(t *testing.T) {
+	now := time.Date(2021, 1, 2, 3, 4, 5, 0, time.UTC)
+	cases := []struct {
+		name  string
+		whens map[string]time.Time
+		setup func(*TestGroupQueue)
+		want  []string
+	}{
+		{
+			name: "none",
+			want: []string{"a", "b", "c"},
+		},
+		{
+			name: "equally due",
+			setup: func(q *TestGroupQueue) {
+				q.SetHot("c")
+			},
+			want: []string{"c", "a", "b"},
+		},
+		{
+			name: "less overdue",
+			whens: map[string]time.Time{
+				"a": now.Add(-2 * time.Minute),
+				"b": now.Add(-time.Minute),
+			},
+			setup: func(q *TestGroupQueue) {
+				q.SetHot("b", "c")
+			},
+			want: []string{"b", "c", "a"},
+		},
+		{
+			name: "not due",
+			whens: map[string]time.Time{
+				"a": now.Add(time.Hour),
+			},
+			setup: func(q *TestGroupQueue) {
+				q.SetHot("a")
+			},
+			want: []string{"b", "c"},
+		},
+		{
+			name: "cleared",
+			setup: func(q *TestGroupQueue) {
+				q.SetHot("b", "c")
+				q.ClearHot("b")
+			},
+			want: []string{"c", "a", "b"},
+		},
+		{
+			name: "all cleared",
+			setup: func(q *TestGroupQueue) {
+				q.SetHot("b", "c")
+				q.ClearHot()
+			},
+			want: []string{"a", "b", "c"},
+		},
+		{
+			name: "missing",
+			setup: func(q *TestGroupQueue) {
+				q.SetHot("missing")
+			},
+			want: []string{"a", "b", "c"},
+		},
+		{
+			name: "kept by init",
+			setup: func(q *TestGroupQueue) {
+				q.SetHot("c")
+				q.Init([]*configpb.TestGroup{{Name: "a"}, {Name: "b"}, {Name: "c"}}, now)
+			},
+			want: []string{"c", "a", "b"},
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			q := NewTestGroupQueue(WithClock(NewFakeClock(now)))
+			q.Init([]*configpb.TestGroup{{Name: "a"}, {Name: "b"}, {Name: "c"}}, now)
+			if err := q.FixAll(tc.whens); err != nil {
+				t.Fatalf("FixAll() got unexpected error: %v", err)
+			}
+			if tc.setup != nil {
+				tc.setup(q)
+			}
+			if err := q.Verify(); err != nil {
+				t.Fatalf("Verify() got unexpected error: %v", err)
+			}
+			ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+			defer cancel()
+			var got []string
+			q.SendFunc(ctx, func(_ context.Context, tg *configpb.TestGroup) error {
+				got = append(got, tg.Name)
+				if len(got) == len(tc.want) {
+					cancel()
+				}
+				return nil
+			}, 0)
+			if diff := cmp.Diff(tc.want, got); diff != "" {
+				t.Errorf("SendFunc() got unexpected dispatches (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestHotItems(t *testing.T) {
+	now := time.Date(2021, 1, 2, 3, 4, 5, 0, time.UTC)
+	q := NewTestGroupQueue(WithClock(NewFakeClock(now)))
+	q.Init([]*configpb.TestGroup{{Name: "a"}, {Name: "b"}}, now)
+	q.SetHot("b")
+	want := []QueueItem{
+		{Name: "b", When: now, Hot: true},
+		{Name: "a", When: now},
+	}
+	if diff := cmp.Diff(want, q.Items()); diff != "" {
+		t.Errorf("Items() got unexpected diff (-want +got):\n%s", diff)
+	}
+}
@@ -0,0 +1,48 @@
+/*
+Copyright 2021 The TestGrid Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package config
+
+import (
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+// WithOnIdle calls f once Send finds nothing due within threshold, such as to scale a batch job to zero.
+//
+// Send calls f when it would sleep longer than threshold for the next group
+// to become due, or while the queue is empty, at most once until it next
+// dispatches a group. Calls f without the lock held, so it may call the
+// queue, but it delays Send until it returns.
+func WithOnIdle(threshold time.Duration, f func()) QueueOption {
+	return func(q *TestGroupQueue) {
+		q.idleThreshold = threshold
+		q.onIdle = f
+	}
+}
+
+// idleLocked returns whether Send just became idle, waiting wait for the next group, see WithOnIdle.
+//
+// A negative wait means the queue is empty.
+func (q *TestGroupQueue) idleLocked(wait time.Duration) bool {
+	if q.onIdle == nil || q.idle || wait >= 0 && wait <= q.idleThreshold {
+		return false
+	}
+	q.idle = true
+	logrus.WithField("threshold", q.idleThreshold).Info("Queue idle")
+	return true
+}
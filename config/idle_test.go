@@ -0,0 +1,103 @@
+/*
+Copyright 2021 The TestGrid Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package config
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	configpb "github.com/GoogleCloudPlatform/testgrid/pb/config"
+)
+
+func TestOnIdle(t *testing.T) {
+	now := time.Date(2021, 1, 2, 3, 4, 5, 0, time.UTC)
+	clock := NewFakeClock(now)
+	idled := make(chan struct{}, 10)
+	q := NewTestGroupQueue(WithClock(clock), WithOnIdle(2*time.Hour, func() {
+		idled <- struct{}{}
+	}))
+	q.Init([]*configpb.TestGroup{{Name: "a"}}, now)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	ch := make(chan *configpb.TestGroup, 1)
+	sent := make(chan error, 1)
+	go func() {
+		sent <- q.Send(ctx, ch, time.Hour)
+	}()
+	receive := func() {
+		t.Helper()
+		select {
+		case <-ch:
+		case <-ctx.Done():
+			t.Fatal("Send() never dispatched the group")
+		}
+	}
+	wantIdle := func() {
+		t.Helper()
+		select {
+		case <-idled:
+		case <-ctx.Done():
+			t.Fatal("Send() never called OnIdle")
+		}
+	}
+	sleeping := func() {
+		t.Helper()
+		if err := clock.BlockUntil(ctx, 1); err != nil {
+			t.Fatalf("BlockUntil() got unexpected error: %v", err)
+		}
+	}
+
+	// busy: the group is due again within the threshold
+	receive()
+	sleeping()
+	clock.Advance(time.Hour)
+	receive()
+	sleeping()
+
+	// idle: nothing left to dispatch
+	if err := q.Remove("a"); err != nil {
+		t.Fatalf("Remove() got unexpected error: %v", err)
+	}
+	wantIdle()
+	for i := 0; i < 3; i++ {
+		sleeping()
+		clock.Advance(time.Second)
+	}
+	if err := q.Add(&configpb.TestGroup{Name: "b"}, clock.Now().Add(3*time.Hour)); err != nil {
+		t.Fatalf("Add() got unexpected error: %v", err)
+	}
+
+	// busy again
+	if err := q.Fix("b", clock.Now()); err != nil {
+		t.Fatalf("Fix() got unexpected error: %v", err)
+	}
+	receive()
+
+	// idle again: the group is next due beyond the threshold
+	if err := q.Fix("b", clock.Now().Add(3*time.Hour)); err != nil {
+		t.Fatalf("Fix() got unexpected error: %v", err)
+	}
+	wantIdle()
+
+	cancel()
+	<-sent
+	if n := len(idled); n > 0 {
+		t.Errorf("Send() called OnIdle %d extra times, want once per idle episode", n)
+	}
+}
@@ -0,0 +1,120 @@
+/*
+Copyright 2021 The TestGrid Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package config
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	configpb "github.com/GoogleCloudPlatform/testgrid/pb/config"
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	// LazyInitAttempts is how many times LazyInit calls its provider before giving up.
+	LazyInitAttempts = 10
+	// LazyInitBackoff is how long LazyInit waits after the first failure,
+	// doubling after each one up to MaxLazyInitBackoff.
+	LazyInitBackoff    = time.Second
+	MaxLazyInitBackoff = time.Minute
+)
+
+// lazyInit tracks the provider LazyInit calls in the background.
+type lazyInit struct {
+	running bool  // the provider has yet to succeed or give up
+	done    bool  // the provider succeeded
+	err     error // why the last LazyInit gave up, see InitErr
+}
+
+// LazyInit inits the queue in the background with the groups from provider.
+//
+// Lets binaries serve health checks and start Send at once rather than
+// blocking on the first config read: Send waits on the empty queue until
+// Init succeeds, which rouses it. Calls provider up to LazyInitAttempts
+// times, backing off after each failure, and retries when Init rejects the
+// time provider returns. Invalid groups do not retry, as Init adds the valid
+// ones. Like sync.Once, calls while the provider is still running or after
+// it succeeded do nothing, but a call after it gives up starts over.
+//
+// Diagnose reports DiagnosisInitializing rather than DiagnosisEmpty until the
+// provider succeeds, and InitErr reports why it gave up, if it did.
+func (q *TestGroupQueue) LazyInit(ctx context.Context, provider func(context.Context) ([]*configpb.TestGroup, time.Time, error)) {
+	q.lock.Lock()
+	defer q.lock.Unlock()
+	if q.lazy.running || q.lazy.done {
+		return
+	}
+	q.lazy = lazyInit{running: true}
+	go q.lazyInit(ctx, provider)
+}
+
+// InitErr returns why the last LazyInit gave up, or nil if it has not.
+func (q *TestGroupQueue) InitErr() error {
+	q.lock.RLock()
+	defer q.lock.RUnlock()
+	return q.lazy.err
+}
+
+// lazyInit calls provider until Init succeeds, see LazyInit.
+func (q *TestGroupQueue) lazyInit(ctx context.Context, provider func(context.Context) ([]*configpb.TestGroup, time.Time, error)) {
+	var err error
+	defer func() {
+		q.lock.Lock()
+		q.lazy = lazyInit{done: err == nil, err: err}
+		q.lock.Unlock()
+	}()
+	backoff := LazyInitBackoff
+	for attempt := 1; ; attempt++ {
+		err = q.lazyInitOnce(ctx, provider)
+		if err == nil {
+			return
+		}
+		log := logrus.WithError(err).WithField("attempt", attempt)
+		if attempt >= LazyInitAttempts {
+			log.Error("Giving up initializing queue")
+			return
+		}
+		log.WithField("backoff", backoff).Warning("Failed to initialize queue, retrying")
+		timer := q.clockTimer(backoff)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			err = ctx.Err()
+			return
+		case <-timer.C():
+		}
+		if backoff *= 2; backoff > MaxLazyInitBackoff {
+			backoff = MaxLazyInitBackoff
+		}
+	}
+}
+
+// lazyInitOnce calls provider and inits the queue with its groups.
+func (q *TestGroupQueue) lazyInitOnce(ctx context.Context, provider func(context.Context) ([]*configpb.TestGroup, time.Time, error)) error {
+	groups, when, err := provider(ctx)
+	if err != nil {
+		return err
+	}
+	err = q.Init(groups, when)
+	var invalid *InvalidGroupsError
+	if errors.As(err, &invalid) {
+		logrus.WithError(err).Warning("Initialized queue without invalid groups")
+		return nil
+	}
+	return err
+}
@@ -0,0 +1,170 @@
+/*
+Copyright 2021 The TestGrid Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package config
+
+import (
+	"context"
+	"errors"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	configpb "github.com/GoogleCloudPlatform/testgrid/pb/config"
+)
+
+// never is a sleep timer that only ends when the queue rouses Send.
+func never(time.Duration) <-chan time.Time { return nil }
+
+var errBoom = errors.New("boom")
+
+func TestLazyInit(t *testing.T) {
+	now := time.Date(2021, 1, 2, 3, 4, 5, 0, time.UTC)
+	clock := NewFakeClock(now)
+	q := NewTestGroupQueue(WithClock(clock), WithSleepTimer(never))
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	var calls int32
+	provider := func(context.Context) ([]*configpb.TestGroup, time.Time, error) {
+		if atomic.AddInt32(&calls, 1) <= 2 {
+			return nil, time.Time{}, errBoom
+		}
+		return []*configpb.TestGroup{{Name: "hello"}}, clock.Now(), nil
+	}
+
+	ch := make(chan *configpb.TestGroup)
+	errs := make(chan error, 1)
+	go func() {
+		errs <- q.Send(ctx, ch, time.Hour)
+	}()
+	q.LazyInit(ctx, provider)
+	q.LazyInit(ctx, provider) // ignored while the first is running
+	if got := q.Diagnose().Reason; got != DiagnosisInitializing {
+		t.Errorf("Diagnose() got %s while initializing, want %s", got, DiagnosisInitializing)
+	}
+
+	for _, backoff := range []time.Duration{LazyInitBackoff, 2 * LazyInitBackoff} {
+		if err := clock.BlockUntil(ctx, 1); err != nil {
+			t.Fatalf("BlockUntil() got unexpected error: %v", err)
+		}
+		clock.Advance(backoff)
+	}
+
+	select {
+	case tg := <-ch:
+		if tg.Name != "hello" {
+			t.Errorf("Send() got %q, want hello", tg.Name)
+		}
+	case <-ctx.Done():
+		t.Fatal("Send() sent nothing after LazyInit")
+	}
+	running := func() bool {
+		q.lock.RLock()
+		defer q.lock.RUnlock()
+		return q.lazy.running
+	}
+	for running() && ctx.Err() == nil {
+		time.Sleep(time.Millisecond)
+	}
+	q.LazyInit(ctx, provider) // ignored after the first succeeded
+	if running() {
+		t.Error("LazyInit() ran the provider again after it succeeded")
+	}
+	cancel()
+	<-errs
+
+	if got := atomic.LoadInt32(&calls); got != 3 {
+		t.Errorf("provider got %d calls, want 3", got)
+	}
+	if err := q.InitErr(); err != nil {
+		t.Errorf("InitErr() got unexpected error: %v", err)
+	}
+}
+
+func TestLazyInitGivesUp(t *testing.T) {
+	now := time.Date(2021, 1, 2, 3, 4, 5, 0, time.UTC)
+	cases := []struct {
+		name    string
+		cancel  bool
+		want    error
+		backoff []time.Duration // between attempts
+	}{
+		{
+			name: "attempts",
+			want: errBoom,
+			backoff: []time.Duration{
+				time.Second, 2 * time.Second, 4 * time.Second, 8 * time.Second, 16 * time.Second,
+				32 * time.Second, time.Minute, time.Minute, time.Minute,
+			},
+		},
+		{
+			name:   "canceled",
+			cancel: true,
+			want:   context.Canceled,
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			clock := NewFakeClock(now)
+			q := NewTestGroupQueue(WithClock(clock))
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+			var calls int32
+			q.LazyInit(ctx, func(context.Context) ([]*configpb.TestGroup, time.Time, error) {
+				atomic.AddInt32(&calls, 1)
+				return nil, time.Time{}, errBoom
+			})
+
+			wait, stop := context.WithTimeout(context.Background(), 5*time.Second)
+			defer stop()
+			for _, backoff := range tc.backoff {
+				if err := clock.BlockUntil(wait, 1); err != nil {
+					t.Fatalf("BlockUntil() got unexpected error: %v", err)
+				}
+				clock.Advance(backoff - time.Millisecond)
+				if n := clock.Timers(); n != 1 {
+					t.Fatalf("backoff ended before %s", backoff)
+				}
+				clock.Advance(time.Millisecond)
+			}
+			if tc.cancel {
+				if err := clock.BlockUntil(wait, 1); err != nil {
+					t.Fatalf("BlockUntil() got unexpected error: %v", err)
+				}
+				cancel()
+			}
+
+			err := q.InitErr()
+			for err == nil && wait.Err() == nil {
+				time.Sleep(time.Millisecond)
+				err = q.InitErr()
+			}
+			if !errors.Is(err, tc.want) {
+				t.Errorf("InitErr() got %v, want %v", err, tc.want)
+			}
+			if !tc.cancel {
+				if got := atomic.LoadInt32(&calls); got != LazyInitAttempts {
+					t.Errorf("provider got %d calls, want %d", got, LazyInitAttempts)
+				}
+			}
+			if got := q.Diagnose().Reason; got != DiagnosisEmpty {
+				t.Errorf("Diagnose() got %s after giving up, want %s", got, DiagnosisEmpty)
+			}
+		})
+	}
+}
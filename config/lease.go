@@ -0,0 +1,198 @@
+/*
+Copyright 2021 The TestGrid Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package config
+
+import (
+	"errors"
+	"time"
+
+	configpb "github.com/GoogleCloudPlatform/testgrid/pb/config"
+	"github.com/sirupsen/logrus"
+)
+
+// DefaultAckTimeout is how long a SendDispatch receiver has to Ack or Nack each dispatch, see WithAckTimeout.
+const DefaultAckTimeout = 10 * time.Minute
+
+// MaxNackDelay caps how long consecutive Nacks double the delay before a group is retried.
+const MaxNackDelay = time.Hour
+
+// errNacked counts a Nack against the group's error budget.
+var errNacked = errors.New("nacked")
+
+// WithAckTimeout sets how long SendDispatch receivers have to Ack or Nack each dispatch.
+//
+// Send releases dispatches neither acked nor nacked in time, keeping the
+// schedule it set when dispatching them. Defaults to DefaultAckTimeout.
+func WithAckTimeout(d time.Duration) QueueOption {
+	return func(q *TestGroupQueue) {
+		q.ackTimeout = d
+	}
+}
+
+// lease lets a receiver settle a dispatch once, see Dispatch.
+//
+// The queue's lock guards settled and deadline.
+type lease struct {
+	q        *TestGroupQueue
+	tg       *configpb.TestGroup
+	removed  bool // Send removed the group when dispatching it
+	settled  bool
+	deadline time.Time // when Send releases the dispatch unless settled, see WithAckTimeout
+}
+
+// newLease returns a lease for the dispatch, setting its Ack and Nack.
+func (q *TestGroupQueue) newLease(d *Dispatch) *lease {
+	l := &lease{
+		q:       q,
+		tg:      d.Group,
+		removed: d.Next.IsZero(),
+	}
+	d.Ack, d.Nack = l.ack, l.nack
+	return l
+}
+
+func (l *lease) ack() {
+	l.q.ackLease(l)
+}
+
+func (l *lease) nack(after time.Duration) {
+	l.q.nackLease(l, after)
+}
+
+// holdLease starts the ack timeout of a delivered dispatch, unless already settled.
+func (q *TestGroupQueue) holdLease(l *lease) {
+	q.lock.Lock()
+	defer q.lock.Unlock()
+	if l.settled {
+		return
+	}
+	timeout := q.ackTimeout
+	if timeout <= 0 {
+		timeout = DefaultAckTimeout
+	}
+	l.deadline = q.now().Add(timeout)
+	if q.leases == nil {
+		q.leases = map[*lease]bool{}
+	}
+	q.leases[l] = true
+	if q.leasesExpire.IsZero() || l.deadline.Before(q.leasesExpire) {
+		q.leasesExpire = l.deadline
+		q.rouse() // so a sleeping Send wakes to release it
+	}
+}
+
+// settleLocked marks the lease settled, returning false if it already was.
+func (q *TestGroupQueue) settleLocked(l *lease) bool {
+	if l.settled {
+		return false
+	}
+	l.settled = true
+	delete(q.leases, l)
+	return true
+}
+
+// expireLeasesLocked releases dispatches neither acked nor nacked by now, see WithAckTimeout.
+func (q *TestGroupQueue) expireLeasesLocked(now time.Time) {
+	if q.leasesExpire.IsZero() || now.Before(q.leasesExpire) {
+		return
+	}
+	q.leasesExpire = time.Time{}
+	for l := range q.leases {
+		if now.Before(l.deadline) {
+			if q.leasesExpire.IsZero() || l.deadline.Before(q.leasesExpire) {
+				q.leasesExpire = l.deadline
+			}
+			continue
+		}
+		q.settleLocked(l)
+		logrus.WithFields(logrus.Fields{
+			"group":    l.tg.Name,
+			"deadline": l.deadline,
+		}).Warning("Releasing dispatch neither acked nor nacked")
+		q.landLocked(l.tg.Name)
+	}
+}
+
+// ackLease releases an acked dispatch, keeping its schedule.
+func (q *TestGroupQueue) ackLease(l *lease) {
+	q.lock.Lock()
+	defer q.lock.Unlock()
+	if !q.settleLocked(l) {
+		return
+	}
+	name := q.lookupLocked(l.tg.Name)
+	if q.ackLocked(name, nil) != nil {
+		return // removed since dispatched
+	}
+	q.items[name].nacks = 0
+}
+
+// nackLease reschedules a nacked dispatch after its delay, backing off after consecutive Nacks.
+//
+// Adds the group back when Send removed it, but not when something else
+// did, nor when Add would not, such as to a sealed or full queue.
+func (q *TestGroupQueue) nackLease(l *lease, after time.Duration) {
+	defer q.transition()
+	q.lock.Lock()
+	defer q.lock.Unlock()
+	defer q.rouse()
+	defer q.recoverLocked(nil)
+
+	if !q.settleLocked(l) {
+		return
+	}
+	tg := l.tg
+	name := q.lookupLocked(tg.Name)
+	q.ackLocked(name, errNacked)
+	it, ok := q.items[name]
+	if !ok {
+		if !l.removed {
+			return
+		}
+		if err := q.admitLocked(tg); err != nil {
+			logrus.WithError(err).WithField("group", name).Warning("Dropping nacked group the queue no longer accepts")
+			return
+		}
+		q.initLocked(1)
+		q.addLocked(tg, q.now().Add(after))
+		it = q.items[name]
+	}
+	it.nacks++
+	delay := after
+	limit := MaxNackDelay
+	if after > limit {
+		limit = after
+	}
+	for i := 1; i < it.nacks && delay < limit; i++ {
+		delay *= 2
+	}
+	if delay > limit {
+		delay = limit
+	}
+	when := q.truncate(q.now().Add(delay))
+	logrus.WithFields(logrus.Fields{
+		"group": name,
+		"nacks": it.nacks,
+		"when":  when,
+	}).Info("Retrying nacked group")
+	if when.Equal(it.when) {
+		return
+	}
+	q.fixedLocked(it, when, "nack")
+	q.scheduleLocked(it, when)
+	q.reorderLocked(it)
+}
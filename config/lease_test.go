@@ -0,0 +1,279 @@
+/*
+Copyright 2021 The TestGrid Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package config
+
+import (
+	"context"
+	"regexp"
+	"testing"
+	"time"
+
+	configpb "github.com/GoogleCloudPlatform/testgrid/pb/config"
+	"github.com/google/go-cmp/cmp"
+)
+
+// dispatchOne returns the next dispatch SendDispatch sends after stopping it.
+func dispatchOne(t *testing.T, q *TestGroupQueue, frequency time.Duration) Dispatch {
+	t.Helper()
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	ch := make(chan Dispatch)
+	errs := make(chan error, 1)
+	go func() {
+		errs <- q.SendDispatch(ctx, ch, frequency)
+	}()
+	var d Dispatch
+	select {
+	case d = <-ch:
+	case <-ctx.Done():
+		t.Fatal("SendDispatch() sent nothing")
+	}
+	cancel()
+	<-errs
+	return d
+}
+
+func TestLease(t *testing.T) {
+	now := time.Date(2021, 1, 2, 3, 4, 5, 0, time.UTC)
+	ack := func(d Dispatch) { d.Ack() }
+	nack := func(after time.Duration) func(Dispatch) {
+		return func(d Dispatch) { d.Nack(after) }
+	}
+	cases := []struct {
+		name     string
+		settle   []func(Dispatch) // each dispatch in turn, advancing to the next
+		removed  bool             // by something else before settling
+		want     time.Duration    // after now
+		failures int
+		missing  bool
+	}{
+		{
+			name:   "ack keeps schedule",
+			settle: []func(Dispatch){ack},
+			want:   10 * time.Minute,
+		},
+		{
+			name:     "nack retries",
+			settle:   []func(Dispatch){nack(5 * time.Minute)},
+			want:     5 * time.Minute,
+			failures: 1,
+		},
+		{
+			name:     "consecutive nacks back off",
+			settle:   []func(Dispatch){nack(5 * time.Minute), nack(5 * time.Minute), nack(5 * time.Minute)},
+			want:     (5 + 10 + 20) * time.Minute,
+			failures: 3,
+		},
+		{
+			name:     "ack resets backoff",
+			settle:   []func(Dispatch){nack(5 * time.Minute), ack, nack(5 * time.Minute)},
+			want:     (5 + 10 + 5) * time.Minute,
+			failures: 2,
+		},
+		{
+			name:     "backoff capped",
+			settle:   []func(Dispatch){nack(40 * time.Minute), nack(40 * time.Minute)},
+			want:     (40 + 60) * time.Minute,
+			failures: 2,
+		},
+		{
+			name:     "long delay not capped",
+			settle:   []func(Dispatch){nack(2 * time.Hour), nack(2 * time.Hour)},
+			want:     4 * time.Hour,
+			failures: 2,
+		},
+		{
+			name: "settled once",
+			settle: []func(Dispatch){func(d Dispatch) {
+				d.Nack(5 * time.Minute)
+				d.Ack()
+				d.Nack(time.Hour)
+			}},
+			want:     5 * time.Minute,
+			failures: 1,
+		},
+		{
+			name:    "removed nack",
+			settle:  []func(Dispatch){nack(5 * time.Minute)},
+			removed: true,
+			missing: true,
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			clock := NewFakeClock(now)
+			q := NewTestGroupQueue(WithClock(clock), WithErrorBudget(10, 24*time.Hour))
+			q.Init([]*configpb.TestGroup{{Name: "hello"}}, now)
+			for _, settle := range tc.settle {
+				when, err := q.When("hello")
+				if err != nil {
+					t.Fatalf("When() got unexpected error: %v", err)
+				}
+				clock.Advance(when.Sub(clock.Now()))
+				d := dispatchOne(t, q, 10*time.Minute)
+				if tc.removed {
+					if err := q.Remove("hello"); err != nil {
+						t.Fatalf("Remove() got unexpected error: %v", err)
+					}
+				}
+				settle(d)
+			}
+
+			when, err := q.When("hello")
+			if tc.missing {
+				if err == nil {
+					t.Errorf("When() got %s, wanted an error", when)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("When() got unexpected error: %v", err)
+			}
+			if got := when.Sub(now); got != tc.want {
+				t.Errorf("When() got %s after now, want %s", got, tc.want)
+			}
+			if got := len(q.items["hello"].failures); got != tc.failures {
+				t.Errorf("got %d failures, want %d", got, tc.failures)
+			}
+		})
+	}
+}
+
+func TestLeaseNackRemoved(t *testing.T) {
+	now := time.Date(2021, 1, 2, 3, 4, 5, 0, time.UTC)
+	q := NewTestGroupQueue(WithClock(NewFakeClock(now)))
+	q.Init([]*configpb.TestGroup{{Name: "hello"}}, now)
+	d := dispatchOne(t, q, 0)
+	if !d.Next.IsZero() {
+		t.Fatalf("SendDispatch() got next %s, wanted the group removed", d.Next)
+	}
+	d.Nack(5 * time.Minute)
+	when, err := q.When("hello")
+	if err != nil {
+		t.Fatalf("When() got unexpected error: %v", err)
+	}
+	if want := now.Add(5 * time.Minute); !when.Equal(want) {
+		t.Errorf("When() got %s, want %s", when, want)
+	}
+}
+
+func TestLeaseNackRejected(t *testing.T) {
+	now := time.Date(2021, 1, 2, 3, 4, 5, 0, time.UTC)
+	cases := []struct {
+		name   string
+		reject func(*TestGroupQueue)
+	}{
+		{
+			name: "sealed",
+			reject: func(q *TestGroupQueue) {
+				q.Seal()
+			},
+		},
+		{
+			name: "full",
+			reject: func(q *TestGroupQueue) {
+				q.maxSize = 1
+				q.Add(&configpb.TestGroup{Name: "other"}, now)
+			},
+		},
+		{
+			name: "filtered",
+			reject: func(q *TestGroupQueue) {
+				q.denyNames = regexp.MustCompile("^hello$")
+			},
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			q := NewTestGroupQueue(WithClock(NewFakeClock(now)))
+			q.Init([]*configpb.TestGroup{{Name: "hello"}}, now)
+			d := dispatchOne(t, q, 0)
+			tc.reject(q)
+			d.Nack(5 * time.Minute)
+			if when, err := q.When("hello"); err == nil {
+				t.Errorf("When() got %s, wanted the nacked group dropped", when)
+			}
+			if err := q.Verify(); err != nil {
+				t.Errorf("Verify() got unexpected error: %v", err)
+			}
+		})
+	}
+}
+
+func TestLeaseTimeout(t *testing.T) {
+	now := time.Date(2021, 1, 2, 3, 4, 5, 0, time.UTC)
+	cases := []struct {
+		name    string
+		timeout time.Duration
+		advance time.Duration
+		want    map[string]int
+	}{
+		{
+			name:    "default",
+			advance: DefaultAckTimeout,
+			want:    map[string]int{},
+		},
+		{
+			name:    "before default",
+			advance: DefaultAckTimeout - time.Second,
+			want:    map[string]int{UnknownBucket: 1},
+		},
+		{
+			name:    "custom",
+			timeout: time.Minute,
+			advance: time.Minute,
+			want:    map[string]int{},
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			clock := NewFakeClock(now)
+			q := NewTestGroupQueue(WithClock(clock), WithAckTimeout(tc.timeout))
+			q.Init([]*configpb.TestGroup{{Name: "hello"}}, now)
+			q.SetBucketLimits(map[string]int{UnknownBucket: 1})
+
+			ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+			defer cancel()
+			ch := make(chan Dispatch, 1)
+			go q.SendDispatch(ctx, ch, time.Hour)
+			<-ch
+			// Send sleeps until the lease expires, long before the group is due again.
+			if err := clock.BlockUntil(ctx, 1); err != nil {
+				t.Fatalf("BlockUntil() got unexpected error: %v", err)
+			}
+			clock.Advance(tc.advance)
+			got := q.InFlight()
+			for len(got) != len(tc.want) && ctx.Err() == nil {
+				time.Sleep(time.Millisecond)
+				got = q.InFlight()
+			}
+			if diff := cmp.Diff(tc.want, got); diff != "" {
+				t.Errorf("InFlight() got unexpected diff (-want +got):\n%s", diff)
+			}
+			when, err := q.When("hello")
+			if err != nil {
+				t.Fatalf("When() got unexpected error: %v", err)
+			}
+			if want := now.Add(time.Hour); !when.Equal(want) {
+				t.Errorf("When() got %s, want %s", when, want)
+			}
+		})
+	}
+}
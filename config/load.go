@@ -0,0 +1,69 @@
+/*
+Copyright 2021 The TestGrid Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package config
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"time"
+
+	"github.com/GoogleCloudPlatform/testgrid/util/gcs"
+)
+
+// InitFromGCS reads the configuration at path and initializes q with its test groups.
+//
+// Returns the generation of the object read, so callers can skip reloading
+// a config whose generation has not changed since the last call. Rejects
+// objects opened without attributes, or whose contents do not match the size
+// in their attributes. As with Init, invalid groups are skipped and returned
+// as an InvalidGroupsError alongside the generation.
+//
+// Reads the object like ReadGCS, which does not report its attributes.
+func InitFromGCS(ctx context.Context, client gcs.Client, path gcs.Path, q *TestGroupQueue, when time.Time) (int64, error) {
+	r, attrs, err := client.Open(ctx, path)
+	if err != nil {
+		return 0, fmt.Errorf("open: %w", err)
+	}
+	defer r.Close()
+	if attrs == nil {
+		return 0, errors.New("open: missing attributes")
+	}
+	counted := countingReader{r: r}
+	cfg, err := Unmarshal(&counted)
+	if err != nil {
+		return 0, fmt.Errorf("generation %d: %w", attrs.Generation, err)
+	}
+	// Local files have no attributes to check against.
+	if attrs.Size > 0 && counted.n != attrs.Size {
+		return 0, fmt.Errorf("read %d bytes of %d at generation %d", counted.n, attrs.Size, attrs.Generation)
+	}
+	return attrs.Generation, q.Init(cfg.GetTestGroups(), when)
+}
+
+// countingReader counts the bytes read from r.
+type countingReader struct {
+	r io.Reader
+	n int64
+}
+
+func (c *countingReader) Read(p []byte) (int, error) {
+	n, err := c.r.Read(p)
+	c.n += int64(n)
+	return n, err
+}
@@ -0,0 +1,163 @@
+/*
+Copyright 2021 The TestGrid Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package config
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"cloud.google.com/go/storage"
+	configpb "github.com/GoogleCloudPlatform/testgrid/pb/config"
+	"github.com/GoogleCloudPlatform/testgrid/util/gcs"
+	"github.com/GoogleCloudPlatform/testgrid/util/gcs/fake"
+	"github.com/golang/protobuf/proto"
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestInitFromGCS(t *testing.T) {
+	now := time.Date(2021, 1, 2, 3, 4, 5, 0, time.UTC)
+	path, err := gcs.NewPath("gs://bucket/config")
+	if err != nil {
+		t.Fatalf("NewPath() got unexpected error: %v", err)
+	}
+	fixture := func(groups ...*configpb.TestGroup) string {
+		buf, err := proto.Marshal(&configpb.Configuration{TestGroups: groups})
+		if err != nil {
+			t.Fatalf("Marshal() got unexpected error: %v", err)
+		}
+		return string(buf)
+	}
+	good := fixture(&configpb.TestGroup{Name: "hello"}, &configpb.TestGroup{Name: "world"})
+
+	cases := []struct {
+		name    string
+		obj     *fake.Object
+		want    int64
+		items   []string
+		err     bool
+		invalid bool
+	}{
+		{
+			name: "missing",
+			err:  true,
+		},
+		{
+			name: "basically works",
+			obj: &fake.Object{
+				Data:  good,
+				Attrs: &storage.ReaderObjectAttrs{Size: int64(len(good)), Generation: 7},
+			},
+			want:  7,
+			items: []string{"hello", "world"},
+		},
+		{
+			name: "local file without size",
+			obj: &fake.Object{
+				Data:  good,
+				Attrs: &storage.ReaderObjectAttrs{},
+			},
+			items: []string{"hello", "world"},
+		},
+		{
+			name: "missing attributes",
+			obj: &fake.Object{
+				Data: good,
+			},
+			err: true,
+		},
+		{
+			name: "open error",
+			obj: &fake.Object{
+				OpenErr: errors.New("boom"),
+			},
+			err: true,
+		},
+		{
+			name: "read error",
+			obj: &fake.Object{
+				Data:    good,
+				Attrs:   &storage.ReaderObjectAttrs{Size: int64(len(good)), Generation: 7},
+				ReadErr: errors.New("boom"),
+			},
+			err: true,
+		},
+		{
+			name: "truncated",
+			obj: &fake.Object{
+				Data:  good[:len(good)-1],
+				Attrs: &storage.ReaderObjectAttrs{Size: int64(len(good)), Generation: 7},
+			},
+			err: true,
+		},
+		{
+			name: "corrupt",
+			obj: &fake.Object{
+				Data:  "\xff\xff\xff",
+				Attrs: &storage.ReaderObjectAttrs{Size: 3, Generation: 7},
+			},
+			err: true,
+		},
+		{
+			name: "invalid groups",
+			obj: func() *fake.Object {
+				data := fixture(&configpb.TestGroup{Name: "hello"}, &configpb.TestGroup{})
+				return &fake.Object{
+					Data:  data,
+					Attrs: &storage.ReaderObjectAttrs{Size: int64(len(data)), Generation: 8},
+				}
+			}(),
+			want:    8,
+			items:   []string{"hello"},
+			err:     true,
+			invalid: true,
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			opener := fake.Opener{}
+			if tc.obj != nil {
+				opener[*path] = *tc.obj
+			}
+			client := fake.UploadClient{Client: fake.Client{Opener: opener}}
+			var q TestGroupQueue
+			got, err := InitFromGCS(context.Background(), client, *path, &q, now)
+			switch {
+			case err != nil && !tc.err:
+				t.Fatalf("InitFromGCS() got unexpected error: %v", err)
+			case err == nil && tc.err:
+				t.Fatalf("InitFromGCS() failed to return an error")
+			}
+			var invalid *InvalidGroupsError
+			if tc.invalid && !errors.As(err, &invalid) {
+				t.Errorf("InitFromGCS() got error %v, want an InvalidGroupsError", err)
+			}
+			if got != tc.want {
+				t.Errorf("InitFromGCS() got generation %d, want %d", got, tc.want)
+			}
+			var items []string
+			for _, it := range q.Items() {
+				items = append(items, it.Name)
+			}
+			if diff := cmp.Diff(tc.items, items); diff != "" {
+				t.Errorf("InitFromGCS() got unexpected items (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
@@ -0,0 +1,55 @@
+/*
+Copyright 2021 The TestGrid Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package config
+
+import (
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+// WithMaxDelay schedules groups at most d after now.
+//
+// Bounds how long a bug, such as a bad Fix or a runaway delay from
+// SendFuncDelay, can keep a group from being sent. Every way of scheduling a
+// group, including Init, FixAll, PostponeAll and rescheduling after a
+// dispatch, clamps times later than now plus d to that limit, logging each
+// group it clamps.
+func WithMaxDelay(d time.Duration) QueueOption {
+	return func(q *TestGroupQueue) {
+		q.maxDelay = d
+	}
+}
+
+// clampLocked returns when, clamped to the latest time WithMaxDelay allows.
+func (q *TestGroupQueue) clampLocked(name string, when time.Time) time.Time {
+	if q.maxDelay <= 0 {
+		return when
+	}
+	limit := q.truncate(q.now().Add(q.maxDelay))
+	if !when.After(limit) {
+		return when
+	}
+	if !q.quiet {
+		logrus.WithFields(logrus.Fields{
+			"group": name,
+			"when":  when,
+			"limit": limit,
+		}).Warning("Clamped group scheduled beyond max delay")
+	}
+	return limit
+}
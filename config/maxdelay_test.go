@@ -0,0 +1,135 @@
+/*
+Copyright 2021 The TestGrid Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package config
+
+import (
+	"testing"
+	"time"
+
+	configpb "github.com/GoogleCloudPlatform/testgrid/pb/config"
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestMaxDelay(t *testing.T) {
+	now := time.Date(2021, 1, 2, 3, 4, 5, 0, time.UTC)
+	year := now.AddDate(1, 0, 0)
+	cases := []struct {
+		name     string
+		maxDelay time.Duration
+		change   func(*TestGroupQueue)
+		want     map[string]time.Time
+	}{
+		{
+			name:     "within",
+			maxDelay: 30 * time.Minute,
+			change: func(q *TestGroupQueue) {
+				q.Fix("a", now.Add(10*time.Minute))
+			},
+			want: map[string]time.Time{
+				"a": now.Add(10 * time.Minute),
+				"b": now,
+			},
+		},
+		{
+			name: "disabled",
+			change: func(q *TestGroupQueue) {
+				q.Fix("a", year)
+			},
+			want: map[string]time.Time{
+				"a": year,
+				"b": now,
+			},
+		},
+		{
+			name:     "fix",
+			maxDelay: 30 * time.Minute,
+			change: func(q *TestGroupQueue) {
+				q.Fix("a", year)
+			},
+			want: map[string]time.Time{
+				"a": now.Add(30 * time.Minute),
+				"b": now,
+			},
+		},
+		{
+			name:     "fix all",
+			maxDelay: 30 * time.Minute,
+			change: func(q *TestGroupQueue) {
+				q.FixAll(map[string]time.Time{
+					"a": now.Add(2 * time.Hour),
+					"b": now.Add(20 * time.Minute),
+				})
+			},
+			want: map[string]time.Time{
+				"a": now.Add(30 * time.Minute),
+				"b": now.Add(20 * time.Minute),
+			},
+		},
+		{
+			name:     "postpone",
+			maxDelay: 30 * time.Minute,
+			change: func(q *TestGroupQueue) {
+				q.PostponeAll(time.Hour)
+			},
+			want: map[string]time.Time{
+				"a": now.Add(30 * time.Minute),
+				"b": now.Add(30 * time.Minute),
+			},
+		},
+		{
+			name:     "add",
+			maxDelay: 30 * time.Minute,
+			change: func(q *TestGroupQueue) {
+				q.Add(&configpb.TestGroup{Name: "c"}, year)
+			},
+			want: map[string]time.Time{
+				"a": now,
+				"b": now,
+				"c": now.Add(30 * time.Minute),
+			},
+		},
+		{
+			name:     "reschedule",
+			maxDelay: 30 * time.Minute,
+			change: func(q *TestGroupQueue) {
+				drain(q, 1) // every hour
+			},
+			want: map[string]time.Time{
+				"a": now.Add(30 * time.Minute),
+				"b": now,
+			},
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			q := NewTestGroupQueue(WithClock(NewFakeClock(now)), WithSleepTimer(never), WithMaxDelay(tc.maxDelay))
+			q.Init([]*configpb.TestGroup{{Name: "a"}, {Name: "b"}}, now)
+			tc.change(q)
+			got := map[string]time.Time{}
+			for _, it := range q.Items() {
+				got[it.Name] = it.When
+			}
+			if diff := cmp.Diff(tc.want, got); diff != "" {
+				t.Errorf("WithMaxDelay() got unexpected schedule (-want +got):\n%s", diff)
+			}
+			if err := q.Verify(); err != nil {
+				t.Errorf("Verify() got unexpected error: %v", err)
+			}
+		})
+	}
+}
@@ -0,0 +1,154 @@
+/*
+Copyright 2021 The TestGrid Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package config
+
+import (
+	"fmt"
+	"strings"
+
+	configpb "github.com/GoogleCloudPlatform/testgrid/pb/config"
+	"github.com/golang/protobuf/proto"
+	"github.com/sirupsen/logrus"
+)
+
+// WithNameNormalization matches group names ignoring surrounding whitespace, and case when foldCase.
+//
+// Init, InitSchedule, InitDiff, Merge, Add, AddIfAbsent, Fix, FixAll,
+// Remove, When, Prioritize, Pin, Ack, ReportChange, SetMinSpacing,
+// NoteBuilds, History, WaitSent and SetHot all find a group by its
+// normalized name, so Fix("Foo ") reschedules the group Init added as
+// "Foo". Groups keep the name, and proto, they were added with, which Send
+// delivers and Items lists. Adding a group whose name normalizes to that of an existing group
+// updates the existing group, renaming it, see GroupsDiff.Renamed. Groups whose names normalize
+// alike within the same Init or Merge are invalid, but for the first.
+// Without this option names must match exactly.
+func WithNameNormalization(foldCase bool) QueueOption {
+	return func(q *TestGroupQueue) {
+		q.normalize = true
+		q.foldCase = foldCase
+	}
+}
+
+// nameKey returns the normalized name, see WithNameNormalization.
+func (q *TestGroupQueue) nameKey(name string) string {
+	name = strings.TrimSpace(name)
+	if q.foldCase {
+		name = strings.ToLower(name)
+	}
+	return name
+}
+
+// lookupLocked returns the name of the group in the queue name normalizes to, or name when none.
+func (q *TestGroupQueue) lookupLocked(name string) string {
+	if !q.normalize {
+		return name
+	}
+	if _, ok := q.items[name]; ok {
+		return name
+	}
+	if stored, ok := q.names[q.nameKey(name)]; ok {
+		return stored
+	}
+	return name
+}
+
+// aliasLocked lets lookupLocked find the group by its normalized name.
+func (q *TestGroupQueue) aliasLocked(name string) {
+	if !q.normalize {
+		return
+	}
+	if q.names == nil {
+		q.names = map[string]string{}
+	}
+	q.names[q.nameKey(name)] = name
+}
+
+// unaliasLocked forgets the normalized name of a group leaving the queue.
+func (q *TestGroupQueue) unaliasLocked(name string) {
+	if !q.normalize {
+		return
+	}
+	if key := q.nameKey(name); q.names[key] == name {
+		delete(q.names, key)
+	}
+}
+
+// realiasLocked recomputes the normalized names of every group, after replacing the items.
+func (q *TestGroupQueue) realiasLocked() {
+	if !q.normalize {
+		return
+	}
+	q.names = make(map[string]string, len(q.items))
+	for name := range q.items {
+		q.aliasLocked(name)
+	}
+}
+
+// renameLocked renames the group in the queue name normalizes to, returning whether there was one.
+func (q *TestGroupQueue) renameLocked(name string) bool {
+	stored := q.lookupLocked(name)
+	it, ok := q.items[stored]
+	if !ok || stored == name {
+		return ok
+	}
+	q.unprintLocked(it)
+	delete(q.items, stored)
+	it.tg = proto.Clone(it.tg).(*configpb.TestGroup)
+	it.tg.Name = name
+	q.items[name] = it
+	q.printLocked(it)
+	q.aliasLocked(name)
+	logrus.WithFields(logrus.Fields{
+		"group": name,
+		"was":   stored,
+	}).Info("Renaming group")
+	return true
+}
+
+// sameGroup returns whether tg configures the group old does, but perhaps renamed, see renameLocked.
+func sameGroup(old, tg *configpb.TestGroup) bool {
+	if old.Name != tg.Name {
+		old = proto.Clone(old).(*configpb.TestGroup)
+		old.Name = tg.Name
+	}
+	return proto.Equal(old, tg)
+}
+
+// collisions returns the groups whose names normalize like an earlier group's, see WithNameNormalization.
+func (q *TestGroupQueue) collisions(testGroups []*configpb.TestGroup) map[int]string {
+	if !q.normalize {
+		return nil
+	}
+	first := make(map[string]string, len(testGroups))
+	var out map[int]string
+	for i, tg := range testGroups {
+		if validateGroup(tg) != nil {
+			continue
+		}
+		key := q.nameKey(tg.Name)
+		prev, ok := first[key]
+		if !ok {
+			first[key] = tg.Name
+			continue
+		}
+		if out == nil {
+			out = map[int]string{}
+		}
+		out[i] = fmt.Sprintf("name collides with %q after normalization", prev)
+	}
+	return out
+}
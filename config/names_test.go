@@ -0,0 +1,320 @@
+/*
+Copyright 2021 The TestGrid Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package config
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	configpb "github.com/GoogleCloudPlatform/testgrid/pb/config"
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestNameNormalization(t *testing.T) {
+	now := time.Date(2021, 1, 2, 3, 4, 5, 0, time.UTC)
+	fix := func(name string) func(*TestGroupQueue) error {
+		return func(q *TestGroupQueue) error {
+			return q.Fix(name, now.Add(time.Hour))
+		}
+	}
+	cases := []struct {
+		name  string
+		opts  []QueueOption
+		op    func(*TestGroupQueue) error
+		err   error
+		names []string
+		when  time.Time
+	}{
+		{
+			name:  "exact by default",
+			op:    fix("Foo "),
+			names: []string{"Foo "},
+			when:  now.Add(time.Hour),
+		},
+		{
+			name:  "trimmed requires normalization",
+			op:    fix("Foo"),
+			err:   ErrNotFound,
+			names: []string{"Foo "},
+			when:  now,
+		},
+		{
+			name:  "fix trimmed",
+			opts:  []QueueOption{WithNameNormalization(false)},
+			op:    fix(" Foo"),
+			names: []string{"Foo "},
+			when:  now.Add(time.Hour),
+		},
+		{
+			name:  "case requires folding",
+			opts:  []QueueOption{WithNameNormalization(false)},
+			op:    fix("foo"),
+			err:   ErrNotFound,
+			names: []string{"Foo "},
+			when:  now,
+		},
+		{
+			name:  "fix folded",
+			opts:  []QueueOption{WithNameNormalization(true)},
+			op:    fix("FOO"),
+			names: []string{"Foo "},
+			when:  now.Add(time.Hour),
+		},
+		{
+			name: "fix all",
+			opts: []QueueOption{WithNameNormalization(true)},
+			op: func(q *TestGroupQueue) error {
+				return q.FixAll(map[string]time.Time{"foo": now.Add(time.Hour)})
+			},
+			names: []string{"Foo "},
+			when:  now.Add(time.Hour),
+		},
+		{
+			name: "prioritize",
+			opts: []QueueOption{WithNameNormalization(false)},
+			op: func(q *TestGroupQueue) error {
+				_, err := q.Prioritize("Foo")
+				return err
+			},
+			names: []string{"Foo "},
+			when:  now, // already first
+		},
+		{
+			name: "remove",
+			opts: []QueueOption{WithNameNormalization(false)},
+			op: func(q *TestGroupQueue) error {
+				return q.Remove("Foo")
+			},
+		},
+		{
+			name: "add renames",
+			opts: []QueueOption{WithNameNormalization(true)},
+			op: func(q *TestGroupQueue) error {
+				return q.Add(&configpb.TestGroup{Name: "foo"}, now.Add(time.Hour))
+			},
+			names: []string{"foo"},
+			when:  now,
+		},
+		{
+			name: "add if absent",
+			opts: []QueueOption{WithNameNormalization(false)},
+			op: func(q *TestGroupQueue) error {
+				if q.AddIfAbsent(&configpb.TestGroup{Name: "Foo"}, now.Add(time.Hour)) {
+					return errors.New("added")
+				}
+				return nil
+			},
+			names: []string{"Foo "},
+			when:  now,
+		},
+		{
+			name: "init renames",
+			opts: []QueueOption{WithNameNormalization(false)},
+			op: func(q *TestGroupQueue) error {
+				return q.Init([]*configpb.TestGroup{{Name: "Foo"}}, now.Add(time.Hour))
+			},
+			names: []string{"Foo"},
+			when:  now,
+		},
+		{
+			name: "pin",
+			opts: []QueueOption{WithNameNormalization(true)},
+			op: func(q *TestGroupQueue) error {
+				if err := q.Pin("foo"); err != nil {
+					return err
+				}
+				if !q.items["Foo "].pinned {
+					return errors.New("not pinned")
+				}
+				return q.Unpin("FOO")
+			},
+			names: []string{"Foo "},
+			when:  now,
+		},
+		{
+			name: "report change",
+			opts: []QueueOption{WithNameNormalization(true)},
+			op: func(q *TestGroupQueue) error {
+				return q.ReportChange("foo", true)
+			},
+			names: []string{"Foo "},
+			when:  now,
+		},
+		{
+			name: "min spacing",
+			opts: []QueueOption{WithNameNormalization(true)},
+			op: func(q *TestGroupQueue) error {
+				if err := q.SetMinSpacing("foo", time.Minute); err != nil {
+					return err
+				}
+				if q.items["Foo "].spacing != time.Minute {
+					return errors.New("spacing not set")
+				}
+				return nil
+			},
+			names: []string{"Foo "},
+			when:  now,
+		},
+		{
+			name: "note builds",
+			opts: []QueueOption{WithNameNormalization(true)},
+			op: func(q *TestGroupQueue) error {
+				return q.NoteBuilds(" FOO", 1)
+			},
+			names: []string{"Foo "},
+			when:  now,
+		},
+		{
+			name: "history",
+			opts: []QueueOption{WithNameNormalization(true), WithHistory(1)},
+			op: func(q *TestGroupQueue) error {
+				ctx, cancel := context.WithCancel(context.Background())
+				q.SendFunc(ctx, func(context.Context, *configpb.TestGroup) error {
+					cancel()
+					return nil
+				}, time.Hour)
+				if got := q.History("foo", 0); len(got) != 1 {
+					return fmt.Errorf("History() got %v, want one dispatch", got)
+				}
+				return nil
+			},
+			names: []string{"Foo "},
+			when:  now.Add(time.Hour),
+		},
+		{
+			name: "ack",
+			opts: []QueueOption{WithNameNormalization(true)},
+			op: func(q *TestGroupQueue) error {
+				if err := q.Ack("foo", nil); err != nil {
+					return err
+				}
+				return q.AckDuration("FOO", nil, time.Second)
+			},
+			names: []string{"Foo "},
+			when:  now,
+		},
+		{
+			name: "wait sent",
+			opts: []QueueOption{WithNameNormalization(true)},
+			op: func(q *TestGroupQueue) error {
+				ctx, cancel := context.WithCancel(context.Background())
+				cancel()
+				return q.WaitSent(ctx, "foo")
+			},
+			err:   context.Canceled, // rather than ErrNotFound
+			names: []string{"Foo "},
+			when:  now,
+		},
+		{
+			name: "set hot",
+			opts: []QueueOption{WithNameNormalization(true)},
+			op: func(q *TestGroupQueue) error {
+				q.SetHot("foo")
+				if !q.items["Foo "].hot {
+					return errors.New("not hot")
+				}
+				return nil
+			},
+			names: []string{"Foo "},
+			when:  now,
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			q := NewTestGroupQueue(append([]QueueOption{WithClock(NewFakeClock(now))}, tc.opts...)...)
+			q.Init([]*configpb.TestGroup{{Name: "Foo "}}, now)
+			if err := tc.op(q); !errors.Is(err, tc.err) {
+				t.Errorf("got error %v, want %v", err, tc.err)
+			}
+			var names []string
+			for _, it := range q.Items() {
+				names = append(names, it.Name)
+				if !it.When.Equal(tc.when) {
+					t.Errorf("%q got when %s, want %s", it.Name, it.When, tc.when)
+				}
+			}
+			if diff := cmp.Diff(tc.names, names); diff != "" {
+				t.Errorf("Items() got unexpected diff (-want +got):\n%s", diff)
+			}
+			if err := q.Verify(); err != nil {
+				t.Errorf("Verify() got unexpected error: %v", err)
+			}
+		})
+	}
+}
+
+func TestNameCollisions(t *testing.T) {
+	now := time.Date(2021, 1, 2, 3, 4, 5, 0, time.UTC)
+	groups := []*configpb.TestGroup{{Name: "Foo"}, {Name: "bar"}, {Name: " Foo"}, {Name: "foo"}, {Name: "BAR "}}
+	cases := []struct {
+		name    string
+		opts    []QueueOption
+		invalid []InvalidGroup
+		names   []string
+	}{
+		{
+			name:  "exact by default",
+			names: []string{"Foo", "bar", " Foo", "foo", "BAR "},
+		},
+		{
+			name: "trimmed",
+			opts: []QueueOption{WithNameNormalization(false)},
+			invalid: []InvalidGroup{
+				{Index: 2, Name: " Foo", Reason: `name collides with "Foo" after normalization`},
+			},
+			names: []string{"Foo", "bar", "foo", "BAR "},
+		},
+		{
+			name: "folded",
+			opts: []QueueOption{WithNameNormalization(true)},
+			invalid: []InvalidGroup{
+				{Index: 2, Name: " Foo", Reason: `name collides with "Foo" after normalization`},
+				{Index: 3, Name: "foo", Reason: `name collides with "Foo" after normalization`},
+				{Index: 4, Name: "BAR ", Reason: `name collides with "bar" after normalization`},
+			},
+			names: []string{"Foo", "bar"},
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			q := NewTestGroupQueue(append([]QueueOption{WithClock(NewFakeClock(now))}, tc.opts...)...)
+			err := q.Init(groups, now)
+			var invalid []InvalidGroup
+			var ige *InvalidGroupsError
+			if errors.As(err, &ige) {
+				invalid = ige.Groups
+			} else if err != nil {
+				t.Fatalf("Init() got unexpected error: %v", err)
+			}
+			if diff := cmp.Diff(tc.invalid, invalid); diff != "" {
+				t.Errorf("Init() got unexpected invalid groups (-want +got):\n%s", diff)
+			}
+			var names []string
+			for _, it := range q.Items() {
+				names = append(names, it.Name)
+			}
+			if diff := cmp.Diff(tc.names, names); diff != "" {
+				t.Errorf("Items() got unexpected diff (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
@@ -0,0 +1,157 @@
+/*
+Copyright 2021 The TestGrid Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package config
+
+import (
+	"context"
+	"sort"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	// OverdueTick is how often WatchOverdue checks for overdue groups.
+	OverdueTick = time.Minute
+	// OverdueNotifyLimit is the most notifications WatchOverdue sends each
+	// tick, deferring the rest to later ticks.
+	OverdueNotifyLimit = 10
+)
+
+// WithOnOverdue calls f after Send delivers a group overdue by more than its interval.
+//
+// A group delivered that late went over twice its interval since its
+// previous delivery, a sign Send is falling behind on that group in
+// particular, which the lag across the queue may hide. Passes the group's
+// name and how long after it was due Send delivered it. Never calls f for
+// groups Send pops rather than reschedules, which have no interval. Calls f
+// from Send without the lock held, so it may call the queue, but it delays
+// the next dispatch until it returns.
+func WithOnOverdue(f func(name string, overdueBy time.Duration)) QueueOption {
+	return func(q *TestGroupQueue) {
+		q.onOverdue = f
+	}
+}
+
+// overdueLocked returns how overdue the item is at now, or zero unless more than its interval, see WithOnOverdue.
+func (q *TestGroupQueue) overdueLocked(it *item, now time.Time, frequency time.Duration) time.Duration {
+	if q.onOverdue == nil || frequency <= 0 {
+		return 0
+	}
+	late := now.Sub(it.when)
+	if late <= q.intervalLocked(it, frequency) {
+		return 0
+	}
+	return late
+}
+
+// overdueGroup is a group WatchOverdue found overdue.
+type overdueGroup struct {
+	name       string
+	when       time.Time
+	dispatched time.Time
+}
+
+// WatchOverdue notifies about groups overdue by more than their threshold until ctx expires.
+//
+// Lets owners be paged about their own groups, which central metrics cannot
+// route. Checks every OverdueTick in a goroutine of its own, so slow notify
+// calls never hold up Send, calling notify at most once per group each time
+// it falls behind, until Send dispatches it again. Sends at most
+// OverdueNotifyLimit notifications each tick, most overdue first, deferring
+// the rest. Groups with a threshold of zero or less are never notified.
+// Calls threshold and notify without the lock held, so they may call the
+// queue.
+func (q *TestGroupQueue) WatchOverdue(ctx context.Context, threshold func(name string) time.Duration, notify func(ctx context.Context, name string, overdueBy time.Duration)) {
+	go q.watchOverdue(ctx, threshold, notify)
+}
+
+// watchOverdue checks for overdue groups each tick, see WatchOverdue.
+func (q *TestGroupQueue) watchOverdue(ctx context.Context, threshold func(name string) time.Duration, notify func(ctx context.Context, name string, overdueBy time.Duration)) {
+	notified := map[string]time.Time{} // when Send last dispatched each group notified
+	for {
+		timer := q.clockTimer(OverdueTick)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return
+		case <-timer.C():
+		}
+		q.notifyOverdue(ctx, notified, threshold, notify)
+	}
+}
+
+// notifyOverdue notifies about groups newly overdue beyond their threshold.
+//
+// Forgets groups no longer overdue, or dispatched since notified, so they
+// notify again when next overdue.
+func (q *TestGroupQueue) notifyOverdue(ctx context.Context, notified map[string]time.Time, threshold func(string) time.Duration, notify func(context.Context, string, time.Duration)) {
+	now, due := q.overdueGroups()
+	var pending []overdueGroup
+	overdue := make(map[string]bool, len(due))
+	for _, g := range due {
+		limit := threshold(g.name)
+		if limit <= 0 || now.Sub(g.when) <= limit {
+			continue
+		}
+		overdue[g.name] = true
+		if last, ok := notified[g.name]; ok && last.Equal(g.dispatched) {
+			continue
+		}
+		pending = append(pending, g)
+	}
+	for name := range notified {
+		if !overdue[name] {
+			delete(notified, name)
+		}
+	}
+
+	sort.Slice(pending, func(i, j int) bool {
+		if !pending[i].when.Equal(pending[j].when) {
+			return pending[i].when.Before(pending[j].when)
+		}
+		return pending[i].name < pending[j].name
+	})
+	if len(pending) > OverdueNotifyLimit {
+		logrus.WithField("deferred", len(pending)-OverdueNotifyLimit).Warning("Deferring overdue notifications")
+		pending = pending[:OverdueNotifyLimit]
+	}
+	for _, g := range pending {
+		if ctx.Err() != nil {
+			return
+		}
+		notified[g.name] = g.dispatched
+		notify(ctx, g.name, now.Sub(g.when))
+	}
+}
+
+// overdueGroups returns the time and the groups due at it.
+func (q *TestGroupQueue) overdueGroups() (time.Time, []overdueGroup) {
+	q.lock.RLock()
+	defer q.lock.RUnlock()
+	now := q.now()
+	due := q.store().due(now)
+	out := make([]overdueGroup, 0, len(due))
+	for _, it := range due {
+		out = append(out, overdueGroup{
+			name:       it.tg.Name,
+			when:       it.when,
+			dispatched: it.dispatched,
+		})
+	}
+	return now, out
+}
@@ -0,0 +1,210 @@
+/*
+Copyright 2021 The TestGrid Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package config
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	configpb "github.com/GoogleCloudPlatform/testgrid/pb/config"
+	"github.com/google/go-cmp/cmp"
+)
+
+// overdueRecorder records the notifications of WatchOverdue.
+type overdueRecorder struct {
+	lock  sync.Mutex
+	calls []string
+}
+
+func (r *overdueRecorder) notify(_ context.Context, name string, overdueBy time.Duration) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	r.calls = append(r.calls, fmt.Sprintf("%s %s", name, overdueBy))
+}
+
+// take returns and forgets the notifications so far.
+func (r *overdueRecorder) take() []string {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	calls := r.calls
+	r.calls = nil
+	return calls
+}
+
+// tickOverdue advances the clock a tick, returning once WatchOverdue handled it.
+func tickOverdue(ctx context.Context, t *testing.T, clock *FakeClock) {
+	t.Helper()
+	if err := clock.BlockUntil(ctx, 1); err != nil {
+		t.Fatalf("BlockUntil() got unexpected error: %v", err)
+	}
+	clock.Advance(OverdueTick)
+	if err := clock.BlockUntil(ctx, 1); err != nil {
+		t.Fatalf("BlockUntil() got unexpected error: %v", err)
+	}
+}
+
+func TestWatchOverdue(t *testing.T) {
+	now := time.Date(2021, 1, 2, 3, 4, 5, 0, time.UTC)
+	clock := NewFakeClock(now)
+	q := NewTestGroupQueue(WithClock(clock), WithSleepTimer(never))
+	q.Init([]*configpb.TestGroup{{Name: "a"}, {Name: "b"}, {Name: "c"}}, now)
+	q.Fix("b", now.Add(30*time.Minute))
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	var r overdueRecorder
+	q.WatchOverdue(ctx, func(name string) time.Duration {
+		if name == "c" {
+			return 0 // never notified
+		}
+		return 10 * time.Minute
+	}, r.notify)
+
+	ticks := func(n int) []string {
+		for i := 0; i < n; i++ {
+			tickOverdue(ctx, t, clock)
+		}
+		return r.take()
+	}
+
+	if diff := cmp.Diff([]string(nil), ticks(10)); diff != "" {
+		t.Errorf("notified before the threshold (-want +got):\n%s", diff)
+	}
+	if diff := cmp.Diff([]string{"a 11m0s"}, ticks(1)); diff != "" {
+		t.Errorf("notified wrong groups past the threshold (-want +got):\n%s", diff)
+	}
+	if diff := cmp.Diff([]string(nil), ticks(5)); diff != "" {
+		t.Errorf("notified again while still overdue (-want +got):\n%s", diff)
+	}
+
+	// dispatch a at 16m, due again 2m later, so overdue again after 28m
+	sendCtx, stop := context.WithCancel(ctx)
+	q.SendFunc(sendCtx, func(_ context.Context, tg *configpb.TestGroup) error {
+		if tg.Name != "a" {
+			t.Errorf("SendFunc() got %q, want a", tg.Name)
+		}
+		stop()
+		return nil
+	}, 2*time.Minute)
+
+	if diff := cmp.Diff([]string(nil), ticks(12)); diff != "" {
+		t.Errorf("notified before overdue again (-want +got):\n%s", diff)
+	}
+	if diff := cmp.Diff([]string{"a 11m0s"}, ticks(1)); diff != "" {
+		t.Errorf("did not notify again after dispatch (-want +got):\n%s", diff)
+	}
+	if diff := cmp.Diff([]string{"b 11m0s"}, ticks(12)); diff != "" {
+		t.Errorf("notified wrong groups later (-want +got):\n%s", diff)
+	}
+}
+
+func TestWatchOverdueLimit(t *testing.T) {
+	now := time.Date(2021, 1, 2, 3, 4, 5, 0, time.UTC)
+	clock := NewFakeClock(now)
+	q := NewTestGroupQueue(WithClock(clock))
+	var groups []*configpb.TestGroup
+	var want []string
+	for i := 0; i < OverdueNotifyLimit+5; i++ {
+		name := fmt.Sprintf("group-%02d", i)
+		groups = append(groups, &configpb.TestGroup{Name: name})
+		want = append(want, name+" 1m0s")
+	}
+	q.Init(groups, now)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	var r overdueRecorder
+	q.WatchOverdue(ctx, func(string) time.Duration { return time.Second }, r.notify)
+
+	tickOverdue(ctx, t, clock)
+	if diff := cmp.Diff(want[:OverdueNotifyLimit], r.take()); diff != "" {
+		t.Errorf("first tick got unexpected notifications (-want +got):\n%s", diff)
+	}
+	tickOverdue(ctx, t, clock)
+	var deferred []string
+	for _, call := range want[OverdueNotifyLimit:] {
+		deferred = append(deferred, call[:len("group-00")]+" 2m0s")
+	}
+	if diff := cmp.Diff(deferred, r.take()); diff != "" {
+		t.Errorf("second tick got unexpected notifications (-want +got):\n%s", diff)
+	}
+	tickOverdue(ctx, t, clock)
+	if diff := cmp.Diff([]string(nil), r.take()); diff != "" {
+		t.Errorf("third tick got unexpected notifications (-want +got):\n%s", diff)
+	}
+}
+
+func TestOnOverdue(t *testing.T) {
+	now := time.Date(2021, 1, 2, 3, 4, 5, 0, time.UTC)
+	cases := []struct {
+		name  string
+		whens map[string]time.Time
+		want  []string
+	}{
+		{
+			name: "on time",
+			whens: map[string]time.Time{
+				"a": now,
+				"b": now.Add(-time.Minute),
+			},
+		},
+		{
+			name: "late",
+			whens: map[string]time.Time{
+				"a": now.Add(-30 * time.Minute),
+				"b": now.Add(-time.Hour), // exactly its interval
+			},
+		},
+		{
+			name: "overdue",
+			whens: map[string]time.Time{
+				"a": now.Add(-3 * time.Hour),
+				"b": now.Add(-90 * time.Minute),
+			},
+			want: []string{"a 3h0m0s", "b 1h30m0s"},
+		},
+		{
+			name: "some overdue",
+			whens: map[string]time.Time{
+				"a": now.Add(-time.Minute),
+				"b": now.Add(-2 * time.Hour),
+			},
+			want: []string{"b 2h0m0s"},
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			var rec overdueRecorder
+			var q *TestGroupQueue
+			q = NewTestGroupQueue(WithClock(NewFakeClock(now)), WithSleepTimer(never), WithOnOverdue(func(name string, overdueBy time.Duration) {
+				if _, err := q.When(name); err != nil { // without the lock held
+					t.Errorf("When(%q) got unexpected error: %v", name, err)
+				}
+				rec.notify(context.Background(), name, overdueBy)
+			}))
+			q.InitSchedule([]*configpb.TestGroup{{Name: "a"}, {Name: "b"}}, now, tc.whens)
+			drain(q, 2) // every hour
+			if diff := cmp.Diff(tc.want, rec.take()); diff != "" {
+				t.Errorf("WithOnOverdue() got unexpected diff (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
@@ -0,0 +1,201 @@
+/*
+Copyright 2021 The TestGrid Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package config
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"sigs.k8s.io/yaml"
+)
+
+// Overrides temporarily change how the queue treats groups, see ApplyOverrides.
+type Overrides struct {
+	Groups map[string]GroupOverride `json:"groups"`
+}
+
+// GroupOverride temporarily changes how the queue treats a group.
+type GroupOverride struct {
+	// MinInterval between dispatches, when longer than the group's minimum
+	// spacing, see WithMinSpacing.
+	MinInterval Duration `json:"min_interval,omitempty"`
+	// Paused holds the group, see PauseMatching.
+	Paused bool `json:"paused,omitempty"`
+	// Hot dispatches the group ahead of other due groups, see SetHot.
+	Hot bool `json:"hot,omitempty"`
+	// Expires is when the override stops applying, or never when zero.
+	Expires time.Time `json:"expires,omitempty"`
+}
+
+func (o GroupOverride) expired(now time.Time) bool {
+	return !o.Expires.IsZero() && !now.Before(o.Expires)
+}
+
+// Duration is a time.Duration serialized as a string such as "1h30m".
+type Duration time.Duration
+
+// MarshalJSON encodes the duration as a string.
+func (d Duration) MarshalJSON() ([]byte, error) {
+	return json.Marshal(time.Duration(d).String())
+}
+
+// UnmarshalJSON decodes a non-negative duration string.
+func (d *Duration) UnmarshalJSON(b []byte) error {
+	var s string
+	if err := json.Unmarshal(b, &s); err != nil {
+		return fmt.Errorf("duration must be a string such as \"1h\": %w", err)
+	}
+	parsed, err := time.ParseDuration(s)
+	if err != nil {
+		return err
+	}
+	if parsed < 0 {
+		return fmt.Errorf("negative duration %q", s)
+	}
+	*d = Duration(parsed)
+	return nil
+}
+
+// LoadOverrides reads overrides from JSON or YAML, rejecting unknown fields.
+//
+// For example:
+//
+//	groups:
+//	  huge-group:
+//	    min_interval: 1h
+//	    expires: 2021-01-08T00:00:00Z
+func LoadOverrides(r io.Reader) (Overrides, error) {
+	var ov Overrides
+	b, err := ioutil.ReadAll(r)
+	if err != nil {
+		return ov, err
+	}
+	if err := yaml.UnmarshalStrict(b, &ov); err != nil {
+		return ov, fmt.Errorf("parse overrides: %w", err)
+	}
+	return ov, nil
+}
+
+// ApplyOverrides replaces the queue's overrides with ov, ignoring those already expired.
+//
+// Overrides belong to the queue rather than its groups: they survive Init
+// and take effect for groups added later, such as by a config change.
+// Groups an override paused become due immediately once the override is
+// replaced or expires, if Send held them meanwhile, unless PauseMatching
+// still holds them.
+func (q *TestGroupQueue) ApplyOverrides(ov Overrides) {
+	q.lock.Lock()
+	defer q.lock.Unlock()
+	defer q.rouse()
+	now := q.now()
+	old := q.overrides
+	q.overrides = make(map[string]GroupOverride, len(ov.Groups))
+	for name, o := range ov.Groups {
+		log := logrus.WithField("group", name)
+		if o.expired(now) {
+			log.WithField("expires", o.Expires).Info("Ignoring expired override")
+			continue
+		}
+		if _, ok := q.items[name]; !ok {
+			log.Info("Saving override for group not in queue")
+		}
+		q.overrides[name] = o
+	}
+	q.releaseLocked(old, now)
+	q.expiresLocked()
+	logrus.WithField("groups", len(q.overrides)).Info("Applied overrides")
+}
+
+// Overrides returns the overrides that still apply.
+func (q *TestGroupQueue) Overrides() Overrides {
+	q.lock.RLock()
+	defer q.lock.RUnlock()
+	now := q.now()
+	out := Overrides{Groups: map[string]GroupOverride{}}
+	for name, o := range q.overrides {
+		if !o.expired(now) {
+			out.Groups[name] = o
+		}
+	}
+	return out
+}
+
+// overrideLocked returns the override that applies to the group, if any.
+func (q *TestGroupQueue) overrideLocked(name string, now time.Time) (GroupOverride, bool) {
+	o, ok := q.overrides[name]
+	if !ok || o.expired(now) {
+		return GroupOverride{}, false
+	}
+	return o, true
+}
+
+// pausedLocked returns whether PauseMatching or an override holds the item.
+func (q *TestGroupQueue) pausedLocked(it *item, now time.Time) bool {
+	if it.paused {
+		return true
+	}
+	o, _ := q.overrideLocked(it.tg.Name, now)
+	return o.Paused
+}
+
+// expireOverridesLocked prunes expired overrides, if any.
+func (q *TestGroupQueue) expireOverridesLocked(now time.Time) {
+	if q.overridesExpire.IsZero() || now.Before(q.overridesExpire) {
+		return
+	}
+	expired := map[string]GroupOverride{}
+	for name, o := range q.overrides {
+		if o.expired(now) {
+			logrus.WithField("group", name).Info("Override expired")
+			expired[name] = o
+			delete(q.overrides, name)
+		}
+	}
+	q.releaseLocked(expired, now)
+	q.expiresLocked()
+}
+
+// expiresLocked records when the next override expires.
+func (q *TestGroupQueue) expiresLocked() {
+	q.overridesExpire = time.Time{}
+	for _, o := range q.overrides {
+		if !o.Expires.IsZero() && (q.overridesExpire.IsZero() || o.Expires.Before(q.overridesExpire)) {
+			q.overridesExpire = o.Expires
+		}
+	}
+}
+
+// releaseLocked makes groups held by a previous override due, like ResumeMatching.
+func (q *TestGroupQueue) releaseLocked(previous map[string]GroupOverride, now time.Time) {
+	when := q.truncate(now)
+	for name, o := range previous {
+		it, ok := q.items[name]
+		if !o.Paused || !ok || !it.held || q.pausedLocked(it, now) {
+			continue
+		}
+		it.held = false
+		if it.when.After(when) {
+			q.fixedLocked(it, when, "override")
+			q.scheduleLocked(it, when)
+			q.reorderLocked(it)
+		}
+	}
+}
@@ -0,0 +1,243 @@
+/*
+Copyright 2021 The TestGrid Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package config
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	configpb "github.com/GoogleCloudPlatform/testgrid/pb/config"
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestLoadOverrides(t *testing.T) {
+	expires := time.Date(2021, 1, 8, 0, 0, 0, 0, time.UTC)
+	cases := []struct {
+		name string
+		in   string
+		want Overrides
+		err  bool
+	}{
+		{
+			name: "yaml",
+			in: `
+groups:
+  huge:
+    min_interval: 1h
+    expires: 2021-01-08T00:00:00Z
+  noisy:
+    paused: true
+  urgent:
+    hot: true
+`,
+			want: Overrides{
+				Groups: map[string]GroupOverride{
+					"huge":   {MinInterval: Duration(time.Hour), Expires: expires},
+					"noisy":  {Paused: true},
+					"urgent": {Hot: true},
+				},
+			},
+		},
+		{
+			name: "json",
+			in:   `{"groups": {"huge": {"min_interval": "90m", "expires": "2021-01-08T00:00:00Z"}}}`,
+			want: Overrides{
+				Groups: map[string]GroupOverride{
+					"huge": {MinInterval: Duration(90 * time.Minute), Expires: expires},
+				},
+			},
+		},
+		{
+			name: "unknown field",
+			in:   "groups:\n  huge:\n    min_intreval: 1h\n",
+			err:  true,
+		},
+		{
+			name: "numeric duration",
+			in:   "groups:\n  huge:\n    min_interval: 3600\n",
+			err:  true,
+		},
+		{
+			name: "negative duration",
+			in:   "groups:\n  huge:\n    min_interval: -1h\n",
+			err:  true,
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			got, err := LoadOverrides(strings.NewReader(tc.in))
+			switch {
+			case err != nil:
+				if !tc.err {
+					t.Fatalf("LoadOverrides() got unexpected error: %v", err)
+				}
+			case tc.err:
+				t.Fatalf("LoadOverrides() got %v, wanted an error", got)
+			default:
+				if diff := cmp.Diff(tc.want, got); diff != "" {
+					t.Errorf("LoadOverrides() got unexpected diff (-want +got):\n%s", diff)
+				}
+			}
+		})
+	}
+}
+
+func TestApplyOverrides(t *testing.T) {
+	start := time.Date(2021, 1, 2, 3, 4, 5, 0, time.UTC)
+	paused := Overrides{
+		Groups: map[string]GroupOverride{
+			"hi": {Paused: true, Expires: start.Add(30 * time.Second)},
+		},
+	}
+	cases := []struct {
+		name  string
+		setup func(*TestGroupQueue)
+		want  []string
+		items []QueueItem // after dispatching
+	}{
+		{
+			name: "hot",
+			setup: func(q *TestGroupQueue) {
+				q.ApplyOverrides(Overrides{Groups: map[string]GroupOverride{"there": {Hot: true}}})
+			},
+			want: []string{"there", "hi"},
+		},
+		{
+			name: "expired",
+			setup: func(q *TestGroupQueue) {
+				q.ApplyOverrides(Overrides{
+					Groups: map[string]GroupOverride{
+						"there": {Hot: true, Expires: start},
+					},
+				})
+				if got := q.Overrides(); len(got.Groups) > 0 {
+					t.Errorf("Overrides() got %v, want none", got)
+				}
+			},
+			want: []string{"hi", "there"},
+		},
+		{
+			name: "paused until expiry",
+			setup: func(q *TestGroupQueue) {
+				q.ApplyOverrides(paused)
+			},
+			want: []string{"there", "hi"},
+			items: []QueueItem{
+				{Name: "there", When: start.Add(time.Hour)},
+				{Name: "hi", When: start.Add(30*time.Second + time.Hour)},
+			},
+		},
+		{
+			name: "survives init",
+			setup: func(q *TestGroupQueue) {
+				q.ApplyOverrides(paused)
+				q.Init([]*configpb.TestGroup{{Name: "hi"}, {Name: "there"}}, start)
+			},
+			want: []string{"there", "hi"},
+		},
+		{
+			name: "unknown group",
+			setup: func(q *TestGroupQueue) {
+				q.ApplyOverrides(Overrides{Groups: map[string]GroupOverride{"new": {Hot: true}}})
+				q.Add(&configpb.TestGroup{Name: "new"}, start)
+			},
+			want: []string{"new", "hi", "there"},
+		},
+		{
+			name: "min interval",
+			setup: func(q *TestGroupQueue) {
+				q.ApplyOverrides(Overrides{
+					Groups: map[string]GroupOverride{
+						"hi": {MinInterval: Duration(2 * time.Hour)},
+					},
+				})
+			},
+			want: []string{"hi", "there", "there"},
+			items: []QueueItem{
+				{
+					Name: "hi",
+					When: start.Add(2 * time.Hour), // spaced before there was dispatched again
+					Override: &GroupOverride{
+						MinInterval: Duration(2 * time.Hour),
+					},
+				},
+				{Name: "there", When: start.Add(2 * time.Hour)},
+			},
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			clock := NewFakeClock(start)
+			q := NewTestGroupQueue(WithClock(clock))
+			q.Init([]*configpb.TestGroup{{Name: "hi"}, {Name: "there"}}, start)
+			tc.setup(q)
+			ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+			defer cancel()
+			go func() { // wakes Send whenever it sleeps
+				for clock.BlockUntil(ctx, 1) == nil {
+					if wake, ok := q.SleepDeadline(); ok {
+						clock.Advance(wake.Sub(clock.Now()))
+					}
+				}
+			}()
+			var got []string
+			q.SendFunc(ctx, func(_ context.Context, tg *configpb.TestGroup) error {
+				got = append(got, tg.Name)
+				if len(got) == len(tc.want) {
+					cancel()
+				}
+				return nil
+			}, time.Hour)
+			if diff := cmp.Diff(tc.want, got); diff != "" {
+				t.Errorf("SendFunc() got unexpected dispatches (-want +got):\n%s", diff)
+			}
+			if tc.items == nil {
+				return
+			}
+			if diff := cmp.Diff(tc.items, q.Items()); diff != "" {
+				t.Errorf("Items() got unexpected diff (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestApplyOverridesReleases(t *testing.T) {
+	start := time.Date(2021, 1, 2, 3, 4, 5, 0, time.UTC)
+	q := NewTestGroupQueue(WithClock(NewFakeClock(start)))
+	q.Init([]*configpb.TestGroup{{Name: "hi"}, {Name: "there"}}, start)
+	q.ApplyOverrides(Overrides{Groups: map[string]GroupOverride{"hi": {Paused: true}}})
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	var got []string
+	q.SendFunc(ctx, func(_ context.Context, tg *configpb.TestGroup) error {
+		got = append(got, tg.Name)
+		switch len(got) {
+		case 1:
+			q.ApplyOverrides(Overrides{}) // hi was held while there dispatched
+		case 2:
+			cancel()
+		}
+		return nil
+	}, time.Hour)
+	if diff := cmp.Diff([]string{"there", "hi"}, got); diff != "" {
+		t.Errorf("SendFunc() got unexpected dispatches (-want +got):\n%s", diff)
+	}
+}
@@ -0,0 +1,106 @@
+/*
+Copyright 2021 The TestGrid Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package config
+
+import (
+	"sort"
+	"time"
+
+	configpb "github.com/GoogleCloudPlatform/testgrid/pb/config"
+	"github.com/sirupsen/logrus"
+)
+
+// PausedRetry is how long Send holds a paused group when sending each group once.
+const PausedRetry = time.Minute
+
+// PauseMatching holds the groups in the queue that match pred, returning how many matched.
+//
+// Send skips paused groups when they become due, counting them as filtered
+// and rescheduling them by its frequency, or PausedRetry when the frequency
+// is zero, while other groups keep flowing. Groups added later are not
+// paused, even if they match. See ResumeMatching.
+func (q *TestGroupQueue) PauseMatching(pred func(*configpb.TestGroup) bool) int {
+	q.lock.Lock()
+	defer q.lock.Unlock()
+	var n int
+	for _, it := range q.items {
+		if !pred(it.tg) {
+			continue
+		}
+		it.paused = true
+		n++
+	}
+	if n > 0 {
+		logrus.WithField("groups", n).Info("Paused groups")
+	}
+	return n
+}
+
+// ResumeMatching releases the paused groups that match pred, returning how many resumed.
+//
+// Groups Send skipped while paused become due immediately, others keep their schedule.
+func (q *TestGroupQueue) ResumeMatching(pred func(*configpb.TestGroup) bool) int {
+	q.lock.Lock()
+	defer q.lock.Unlock()
+	defer q.rouse()
+	var n int
+	var held []*item
+	for _, it := range q.items {
+		if !it.paused || !pred(it.tg) {
+			continue
+		}
+		it.paused = false
+		n++
+		if it.held {
+			it.held = false
+			held = append(held, it)
+		}
+	}
+	sort.Slice(held, func(i, j int) bool { return less(held[i], held[j]) })
+	now := q.truncate(q.now())
+	for _, it := range held { // in their current order
+		if it.when.After(now) {
+			q.fixedLocked(it, now, "resume")
+			q.scheduleLocked(it, now)
+			q.reorderLocked(it)
+		}
+	}
+	if n > 0 {
+		logrus.WithField("groups", n).Info("Resumed groups")
+	}
+	return n
+}
+
+// holdLocked reschedules the item rather than dispatching it while paused.
+//
+// Returns whether the item was held.
+func (q *TestGroupQueue) holdLocked(it *item, now time.Time, frequency time.Duration) bool {
+	if !q.pausedLocked(it, now) {
+		return false
+	}
+	delay := q.intervalLocked(it, frequency)
+	if delay <= 0 {
+		delay = PausedRetry
+	}
+	when := q.truncate(now.Add(delay))
+	it.held = true
+	q.skippedLocked(SkipPaused)
+	q.fixedLocked(it, when, "paused")
+	q.scheduleLocked(it, when)
+	q.reorderLocked(it)
+	return true
+}
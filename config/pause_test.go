@@ -0,0 +1,126 @@
+/*
+Copyright 2021 The TestGrid Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package config
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	configpb "github.com/GoogleCloudPlatform/testgrid/pb/config"
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestPauseMatching(t *testing.T) {
+	start := time.Date(2021, 1, 2, 3, 4, 5, 0, time.UTC)
+	clock := NewFakeClock(start)
+	q := NewTestGroupQueue(WithClock(clock))
+	q.Init([]*configpb.TestGroup{
+		{Name: "a-1"},
+		{Name: "a-2"},
+		{Name: "b-1"},
+		{Name: "a-later"},
+	}, start)
+	q.Fix("a-later", start.Add(time.Minute))
+	dashA := func(tg *configpb.TestGroup) bool { return strings.HasPrefix(tg.Name, "a-") }
+
+	if n := q.PauseMatching(dashA); n != 3 {
+		t.Errorf("PauseMatching() got %d, want 3", n)
+	}
+	if err := q.Add(&configpb.TestGroup{Name: "a-new"}, start.Add(time.Second)); err != nil {
+		t.Fatalf("Add() got unexpected error: %v", err)
+	}
+
+	var got []string
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	err := q.SendFunc(ctx, func(_ context.Context, tg *configpb.TestGroup) error {
+		got = append(got, tg.Name)
+		switch tg.Name {
+		case "b-1":
+			clock.Advance(time.Second) // a-new is due
+		case "a-new":
+			want := []QueueItem{
+				{Name: "a-later", When: start.Add(time.Minute), Paused: true},
+				{Name: "a-1", When: start.Add(time.Hour), Paused: true},
+				{Name: "a-2", When: start.Add(time.Hour), Paused: true},
+				{Name: "b-1", When: start.Add(time.Hour)},
+				{Name: "a-new", When: start.Add(time.Hour + time.Second)},
+			}
+			if diff := cmp.Diff(want, q.Items()); diff != "" {
+				t.Errorf("Items() while paused got unexpected diff (-want +got):\n%s", diff)
+			}
+			if filtered := q.Stats().Filtered; filtered != 2 {
+				t.Errorf("Stats() got %d filtered, want 2", filtered)
+			}
+			if n := q.ResumeMatching(dashA); n != 3 {
+				t.Errorf("ResumeMatching() got %d, want 3", n)
+			}
+		case "a-2":
+			cancel()
+		}
+		return nil
+	}, time.Hour)
+	if err != nil && err != context.Canceled {
+		t.Errorf("SendFunc() got unexpected error: %v", err)
+	}
+	if diff := cmp.Diff([]string{"b-1", "a-new", "a-1", "a-2"}, got); diff != "" {
+		t.Errorf("SendFunc() got unexpected order (-want +got):\n%s", diff)
+	}
+	if when, _ := q.When("a-later"); !when.Equal(start.Add(time.Minute)) {
+		t.Errorf("ResumeMatching() moved a group Send never held to %v", when)
+	}
+	if n := q.ResumeMatching(dashA); n != 0 {
+		t.Errorf("ResumeMatching() again got %d, want 0", n)
+	}
+}
+
+func TestPauseMatchingSendOnce(t *testing.T) {
+	start := time.Date(2021, 1, 2, 3, 4, 5, 0, time.UTC)
+	clock := NewFakeClock(start)
+	q := NewTestGroupQueue(WithClock(clock))
+	q.Init([]*configpb.TestGroup{{Name: "hi"}, {Name: "there"}}, start)
+	q.PauseMatching(func(tg *configpb.TestGroup) bool { return tg.Name == "hi" })
+
+	ch := make(chan *configpb.TestGroup)
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	errCh := make(chan error, 1)
+	go func() {
+		errCh <- q.Send(ctx, ch, 0)
+	}()
+	if tg := <-ch; tg.Name != "there" {
+		t.Errorf("Send() got %s, want there", tg.Name)
+	}
+	for {
+		if when, _ := q.When("hi"); when.Equal(start.Add(PausedRetry)) {
+			break
+		}
+		if ctx.Err() != nil {
+			t.Fatal("Send() did not hold the paused group")
+		}
+		time.Sleep(time.Millisecond)
+	}
+	q.ResumeMatching(func(*configpb.TestGroup) bool { return true })
+	if tg := <-ch; tg.Name != "hi" {
+		t.Errorf("Send() got %s, want hi", tg.Name)
+	}
+	if err := <-errCh; err != nil {
+		t.Errorf("Send() got unexpected error: %v", err)
+	}
+}
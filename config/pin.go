@@ -0,0 +1,57 @@
+/*
+Copyright 2021 The TestGrid Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package config
+
+import (
+	"github.com/sirupsen/logrus"
+)
+
+// Pin marks the group as one the queue must never drop on its own.
+//
+// Pinned groups are exempt from any skip or eviction the queue decides
+// itself, but not from removal by the caller: Init still removes a pinned
+// group missing from the config and SetShard one in another shard, logging
+// a warning, and Remove and PopAll still remove it. Pinning never evicts another group either, so a pinned
+// group counts towards the maximum size like any other, see WithMaxSize.
+//
+// Updating the group with Add, Init or Merge keeps the pin.
+func (q *TestGroupQueue) Pin(name string) error {
+	return q.setPinned(name, true)
+}
+
+// Unpin undoes Pin.
+func (q *TestGroupQueue) Unpin(name string) error {
+	return q.setPinned(name, false)
+}
+
+func (q *TestGroupQueue) setPinned(name string, pinned bool) error {
+	q.lock.Lock()
+	defer q.lock.Unlock()
+	name = q.lookupLocked(name)
+	it, ok := q.items[name]
+	if !ok {
+		return ErrNotFound
+	}
+	if it.pinned != pinned {
+		logrus.WithFields(logrus.Fields{
+			"group":  name,
+			"pinned": pinned,
+		}).Info("Changed group pin")
+	}
+	it.pinned = pinned
+	return nil
+}
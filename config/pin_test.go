@@ -0,0 +1,67 @@
+/*
+Copyright 2021 The TestGrid Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package config
+
+import (
+	"testing"
+	"time"
+
+	configpb "github.com/GoogleCloudPlatform/testgrid/pb/config"
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestPin(t *testing.T) {
+	now := time.Date(2021, 1, 2, 3, 4, 5, 0, time.UTC)
+	var q TestGroupQueue
+	q.Init([]*configpb.TestGroup{{Name: "critical"}, {Name: "other"}}, now)
+
+	if err := q.Pin("missing"); err != ErrNotFound {
+		t.Errorf("Pin(missing) got %v, want %v", err, ErrNotFound)
+	}
+	if err := q.Unpin("missing"); err != ErrNotFound {
+		t.Errorf("Unpin(missing) got %v, want %v", err, ErrNotFound)
+	}
+	if err := q.Pin("critical"); err != nil {
+		t.Fatalf("Pin(critical) got unexpected error: %v", err)
+	}
+	if err := q.Add(&configpb.TestGroup{Name: "critical", DaysOfResults: 7}, now); err != nil {
+		t.Fatalf("Add(critical) got unexpected error: %v", err)
+	}
+	want := []QueueItem{
+		{Name: "critical", When: now, Pinned: true},
+		{Name: "other", When: now},
+	}
+	if diff := cmp.Diff(want, q.Items()); diff != "" {
+		t.Errorf("Items() got unexpected diff (-want +got):\n%s", diff)
+	}
+	if diff := cmp.Diff([]string{"critical"}, DiffGroups(&q, nil).Stateful); diff != "" {
+		t.Errorf("DiffGroups() got unexpected stateful diff (-want +got):\n%s", diff)
+	}
+
+	if err := q.Unpin("critical"); err != nil {
+		t.Fatalf("Unpin(critical) got unexpected error: %v", err)
+	}
+	if items := q.Items(); items[0].Pinned {
+		t.Error("Unpin() left critical pinned")
+	}
+
+	q.Pin("critical")
+	q.Init([]*configpb.TestGroup{{Name: "other"}}, now)
+	if _, err := q.When("critical"); err != ErrNotFound {
+		t.Errorf("Init() kept a pinned group missing from the config: %v", err)
+	}
+}
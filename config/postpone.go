@@ -0,0 +1,91 @@
+/*
+Copyright 2021 The TestGrid Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package config
+
+import (
+	"fmt"
+	"regexp"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+// PostponeAll shifts the schedule of every group by d, returning how many moved.
+//
+// Unlike pausing, which releases every group at once when resumed, shifting
+// keeps groups spaced as they were, for example across a planned outage of
+// the storage they read. A negative d pulls the schedule forward instead.
+// Groups keep their exact relative order, since the queue neither truncates
+// the new times to its granularity nor requeues groups due at the same time.
+// Returns ErrSealed, moving nothing, if the queue is sealed, see Seal.
+func (q *TestGroupQueue) PostponeAll(d time.Duration) (n int, err error) {
+	q.lock.Lock()
+	defer q.lock.Unlock()
+	defer q.rouse()
+	defer q.recoverLocked(&err)
+	if err := q.frozenLocked(); err != nil {
+		return 0, err
+	}
+	return q.postponeLocked(nil, d), nil
+}
+
+// PostponeMatching shifts the schedule of groups whose name matches pattern by d, see PostponeAll.
+//
+// Returns how many groups moved, or an error if pattern is not a valid regular expression.
+func (q *TestGroupQueue) PostponeMatching(pattern string, d time.Duration) (n int, err error) {
+	re, err := regexp.Compile(pattern)
+	if err != nil {
+		return 0, fmt.Errorf("bad pattern: %w", err)
+	}
+	q.lock.Lock()
+	defer q.lock.Unlock()
+	defer q.rouse()
+	defer q.recoverLocked(&err)
+	if err := q.frozenLocked(); err != nil {
+		return 0, err
+	}
+	return q.postponeLocked(re, d), nil
+}
+
+// postponeLocked shifts the groups whose name matches re, or every group when nil, by d.
+func (q *TestGroupQueue) postponeLocked(re *regexp.Regexp, d time.Duration) int {
+	if d == 0 {
+		return 0
+	}
+	var n int
+	for _, it := range q.store().all() {
+		if re != nil && !re.MatchString(it.tg.Name) {
+			continue
+		}
+		when := q.clampLocked(it.tg.Name, it.when.Add(d))
+		q.fixedLocked(it, when, "postpone")
+		q.unprintLocked(it)
+		it.when = when // keeps its seq, unlike scheduleLocked
+		q.printLocked(it)
+		q.rescheduled(when)
+		n++
+	}
+	if n == 0 {
+		return 0
+	}
+	q.store().rebuild()
+	logrus.WithFields(logrus.Fields{
+		"groups": n,
+		"by":     d,
+	}).Info("Postponed groups")
+	return n
+}
@@ -0,0 +1,186 @@
+/*
+Copyright 2021 The TestGrid Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package config
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	configpb "github.com/GoogleCloudPlatform/testgrid/pb/config"
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestPostpone(t *testing.T) {
+	now := time.Date(2021, 1, 2, 3, 4, 5, 0, time.UTC)
+	cases := []struct {
+		name    string
+		pattern string // PostponeAll when empty
+		d       time.Duration
+		want    map[string]time.Duration // after now
+		wantN   int
+		err     bool
+	}{
+		{
+			name: "all",
+			d:    30 * time.Minute,
+			want: map[string]time.Duration{
+				"slow-a": 30 * time.Minute,
+				"fast-a": 30 * time.Minute,
+				"slow-b": 30 * time.Minute,
+				"fast-b": 31 * time.Minute,
+				"slow-c": 32 * time.Minute,
+			},
+			wantN: 5,
+		},
+		{
+			name: "forward",
+			d:    -time.Hour,
+			want: map[string]time.Duration{
+				"slow-a": -time.Hour,
+				"fast-a": -time.Hour,
+				"slow-b": -time.Hour,
+				"fast-b": -59 * time.Minute,
+				"slow-c": -58 * time.Minute,
+			},
+			wantN: 5,
+		},
+		{
+			name:    "matching",
+			pattern: "^slow-",
+			d:       time.Minute,
+			want: map[string]time.Duration{
+				"slow-a": time.Minute,
+				"fast-a": 0,
+				"slow-b": time.Minute,
+				"fast-b": time.Minute,
+				"slow-c": 3 * time.Minute,
+			},
+			wantN: 3,
+		},
+		{
+			name:    "none matching",
+			pattern: "^medium-",
+			d:       time.Minute,
+			want: map[string]time.Duration{
+				"slow-a": 0,
+				"fast-a": 0,
+				"slow-b": 0,
+				"fast-b": time.Minute,
+				"slow-c": 2 * time.Minute,
+			},
+		},
+		{
+			name:    "bad pattern",
+			pattern: "(",
+			d:       time.Minute,
+			want: map[string]time.Duration{
+				"slow-a": 0,
+				"fast-a": 0,
+				"slow-b": 0,
+				"fast-b": time.Minute,
+				"slow-c": 2 * time.Minute,
+			},
+			err: true,
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			q := NewTestGroupQueue(WithClock(NewFakeClock(now)))
+			q.Init([]*configpb.TestGroup{
+				{Name: "slow-a"},
+				{Name: "fast-a"},
+				{Name: "slow-b"},
+				{Name: "fast-b"},
+				{Name: "slow-c"},
+			}, now)
+			if err := q.FixAll(map[string]time.Time{
+				"fast-b": now.Add(time.Minute),
+				"slow-c": now.Add(2 * time.Minute),
+			}); err != nil {
+				t.Fatalf("FixAll() got unexpected error: %v", err)
+			}
+			before := q.Items()
+
+			var n int
+			var err error
+			if tc.pattern == "" {
+				n, err = q.PostponeAll(tc.d)
+			} else {
+				n, err = q.PostponeMatching(tc.pattern, tc.d)
+			}
+			switch {
+			case err != nil && !tc.err:
+				t.Fatalf("Postpone got unexpected error: %v", err)
+			case err == nil && tc.err:
+				t.Fatal("Postpone failed to return an error")
+			}
+			if n != tc.wantN {
+				t.Errorf("postponed %d groups, want %d", n, tc.wantN)
+			}
+			if err := q.Verify(); err != nil {
+				t.Fatalf("Verify() got unexpected error: %v", err)
+			}
+
+			got := map[string]time.Duration{}
+			after := q.Items()
+			for _, it := range after {
+				got[it.Name] = it.When.Sub(now)
+			}
+			if diff := cmp.Diff(tc.want, got); diff != "" {
+				t.Errorf("Items() got unexpected schedule (-want +got):\n%s", diff)
+			}
+			if tc.pattern != "" {
+				return
+			}
+			var wantOrder, gotOrder []string
+			for i := range before {
+				wantOrder = append(wantOrder, before[i].Name)
+				gotOrder = append(gotOrder, after[i].Name)
+			}
+			if diff := cmp.Diff(wantOrder, gotOrder); diff != "" {
+				t.Errorf("Items() got unexpected order (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestPostponeRouses(t *testing.T) {
+	now := time.Date(2021, 1, 2, 3, 4, 5, 0, time.UTC)
+	clock := NewFakeClock(now)
+	q := NewTestGroupQueue(WithClock(clock))
+	q.Init([]*configpb.TestGroup{{Name: "hi"}}, now.Add(time.Hour))
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	ch := make(chan *configpb.TestGroup, 1)
+	go q.Send(ctx, ch, 0)
+	if err := clock.BlockUntil(ctx, 1); err != nil { // Send is sleeping
+		t.Fatalf("BlockUntil() got unexpected error: %v", err)
+	}
+
+	q.PostponeAll(-time.Hour)
+	select {
+	case tg := <-ch:
+		if tg.Name != "hi" {
+			t.Errorf("Send() got %s, want hi", tg.Name)
+		}
+	case <-ctx.Done():
+		t.Fatal("Send() kept sleeping after PostponeAll() pulled the schedule forward")
+	}
+}
@@ -0,0 +1,60 @@
+/*
+Copyright 2021 The TestGrid Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package config
+
+import (
+	"time"
+
+	configpb "github.com/GoogleCloudPlatform/testgrid/pb/config"
+	"github.com/sirupsen/logrus"
+)
+
+// Prune removes every group pred accepts, returning how many it removed.
+//
+// Unlike listing the groups and calling Remove for each, Prune holds the
+// lock throughout, so pred sees a consistent queue and nothing changes
+// between deciding and removing, and reorders the queue once rather than
+// per group. Calls pred with the lock held, so it must not call the queue,
+// nor modify the group.
+func (q *TestGroupQueue) Prune(pred func(name string, tg *configpb.TestGroup, when time.Time) bool) int {
+	defer q.transition()
+	q.lock.Lock()
+	defer q.lock.Unlock()
+	defer q.rouse()
+	defer q.recoverLocked(nil)
+
+	if q.frozenLocked() != nil {
+		return 0
+	}
+	// Decide before removing anything, so a panicking pred leaves the queue intact.
+	drop := map[*item]bool{}
+	for _, it := range q.store().all() {
+		if pred(it.tg.Name, it.tg, it.when) {
+			drop[it] = true
+		}
+	}
+	if len(drop) == 0 {
+		return 0
+	}
+	removed := q.store().removeIf(func(it *item) bool { return drop[it] })
+	for _, it := range removed {
+		q.forgetLocked(it)
+	}
+	q.shrinkLocked()
+	logrus.WithField("count", len(removed)).Info("Pruned groups from queue")
+	return len(removed)
+}
@@ -0,0 +1,149 @@
+/*
+Copyright 2021 The TestGrid Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package config
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	configpb "github.com/GoogleCloudPlatform/testgrid/pb/config"
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestPrune(t *testing.T) {
+	now := time.Date(2021, 1, 2, 3, 4, 5, 0, time.UTC)
+	cases := []struct {
+		name  string
+		pred  func(string, *configpb.TestGroup, time.Time) bool
+		want  []string
+		wantN int
+	}{
+		{
+			name: "none",
+			pred: func(string, *configpb.TestGroup, time.Time) bool { return false },
+			want: []string{"overdue", "late", "slow-a", "fast", "slow-b", "future"},
+		},
+		{
+			name:  "all",
+			pred:  func(string, *configpb.TestGroup, time.Time) bool { return true },
+			wantN: 6,
+		},
+		{
+			name: "overdue by more than an hour",
+			pred: func(_ string, _ *configpb.TestGroup, when time.Time) bool {
+				return now.Sub(when) > time.Hour
+			},
+			want:  []string{"late", "slow-a", "fast", "slow-b", "future"},
+			wantN: 1,
+		},
+		{
+			name: "by name",
+			pred: func(name string, _ *configpb.TestGroup, _ time.Time) bool {
+				return strings.HasPrefix(name, "slow-")
+			},
+			want:  []string{"overdue", "late", "fast", "future"},
+			wantN: 2,
+		},
+		{
+			name: "by group",
+			pred: func(_ string, tg *configpb.TestGroup, _ time.Time) bool {
+				return tg.DaysOfResults > 0
+			},
+			want:  []string{"overdue", "late", "slow-a", "slow-b", "future"},
+			wantN: 1,
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			q := NewTestGroupQueue(WithClock(NewFakeClock(now)))
+			q.Init([]*configpb.TestGroup{
+				{Name: "overdue"},
+				{Name: "late"},
+				{Name: "slow-a"},
+				{Name: "fast", DaysOfResults: 1},
+				{Name: "slow-b"},
+				{Name: "future"},
+			}, now)
+			if err := q.FixAll(map[string]time.Time{
+				"overdue": now.Add(-2 * time.Hour),
+				"late":    now.Add(-time.Minute),
+				"future":  now.Add(time.Hour),
+			}); err != nil {
+				t.Fatalf("FixAll() got unexpected error: %v", err)
+			}
+
+			if n := q.Prune(tc.pred); n != tc.wantN {
+				t.Errorf("Prune() got %d, want %d", n, tc.wantN)
+			}
+			if err := q.Verify(); err != nil {
+				t.Fatalf("Verify() got unexpected error: %v", err)
+			}
+			var got []string
+			for _, it := range q.Items() {
+				got = append(got, it.Name)
+			}
+			if diff := cmp.Diff(tc.want, got); diff != "" {
+				t.Errorf("Prune() got unexpected items (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestPruneWaitSent(t *testing.T) {
+	now := time.Date(2021, 1, 2, 3, 4, 5, 0, time.UTC)
+	q := NewTestGroupQueue(WithClock(NewFakeClock(now)))
+	q.Init([]*configpb.TestGroup{{Name: "hi"}, {Name: "there"}}, now)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	errs := make(chan error, 1)
+	go func() {
+		errs <- q.WaitSent(ctx, "hi")
+	}()
+	for !q.waitingSent("hi") {
+		time.Sleep(time.Millisecond)
+	}
+
+	q.Prune(func(name string, _ *configpb.TestGroup, _ time.Time) bool { return name == "hi" })
+	if err := <-errs; !errors.Is(err, ErrNotFound) {
+		t.Errorf("WaitSent() got %v, want %v", err, ErrNotFound)
+	}
+}
+
+func TestPrunePanic(t *testing.T) {
+	now := time.Date(2021, 1, 2, 3, 4, 5, 0, time.UTC)
+	q := NewTestGroupQueue(WithClock(NewFakeClock(now)))
+	q.Init([]*configpb.TestGroup{{Name: "hi"}, {Name: "there"}}, now)
+	want := q.Items()
+
+	q.Prune(func(name string, _ *configpb.TestGroup, _ time.Time) bool {
+		if name == "there" {
+			panic("boom")
+		}
+		return true
+	})
+	if err := q.Verify(); err != nil {
+		t.Fatalf("Verify() got unexpected error: %v", err)
+	}
+	if diff := cmp.Diff(want, q.Items()); diff != "" {
+		t.Errorf("Prune() modified the queue after a panic (-want +got):\n%s", diff)
+	}
+}
@@ -17,245 +17,1991 @@ limitations under the License.
 package config
 
 import (
-	"container/heap"
 	"context"
 	"errors"
 	"fmt"
+	"regexp"
+	"sort"
+	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"bitbucket.org/creachadair/stringset"
 	configpb "github.com/GoogleCloudPlatform/testgrid/pb/config"
+	"github.com/golang/protobuf/proto"
+	multierror "github.com/hashicorp/go-multierror"
 	"github.com/sirupsen/logrus"
+	"google.golang.org/protobuf/types/known/timestamppb"
 )
 
 // TestGroupQueue can send test groups to receivers at a specific frequency.
 //
 // Also contains the ability to modify the next time to send groups.
-// First call must be to Init().
+// First call must be to Init() or LazyInit().
 // Exported methods are safe to call concurrently.
+//
+// Times are stored and reported in UTC, whatever zone callers pass.
 type TestGroupQueue struct {
-	queue  priorityQueue
-	items  map[string]*item
-	lock   sync.RWMutex
-	signal chan struct{}
+	waker // wakes Send early when the queue changes
+
+	queue priorityQueue // see store
+	items map[string]*item
+	lock  sync.RWMutex
+	clock Clock
+	seq   uint64 // incremented each time an item is scheduled
+	print uint64 // see Fingerprint
+
+	sleepTimer func(time.Duration) <-chan time.Time // see WithSleepTimer
+	scanBelow  int                                  // see WithLinearScan
+	sealed     bool                                 // see Seal
+	fixing     bool                                 // a FixEach callback is running, see FixEach
+
+	normalize bool              // see WithNameNormalization
+	foldCase  bool              // see WithNameNormalization
+	names     map[string]string // name of each group by its normalized name
+
+	granularity time.Duration
+	coordinator *Coordinator
+	warp        *warp // skips sleeps when simulating
+	metrics     QueueMetrics
+	tracer      Tracer
+
+	budgetFailures int
+	budgetWindow   time.Duration
+	adaptiveMin    time.Duration
+	adaptiveMax    time.Duration
+	slow           *SlowPolicy
+	minSpacing     time.Duration
+	fixedRate      bool
+	fromCompletion bool          // see WithCompletionSchedule
+	ackTimeout     time.Duration // see WithAckTimeout
+	blockWarn      time.Duration // see WithBlockWarn
+	historySize    int
+	deadline       float64 // of the interval SendFunc handlers may take, see WithHandlerDeadline
+	allowNames     *regexp.Regexp
+	denyNames      *regexp.Regexp
+	shardIndex     int // see WithShard
+	shardTotal     int
+	maxDelay       time.Duration // see WithMaxDelay
+	policy         DispatchPolicy
+	strategy       Strategy
+	hot            stringset.Set // groups marked hot, possibly since removed, see SetHot
+	auditLog       *AuditLog
+
+	smoothThreshold int // see WithFixSmoothing
+	smoothWindow    time.Duration
+
+	dedupeWindow time.Duration // see WithFixAllDedupe
+	lastFixAll   appliedFixAll
+	duplicates   int64 // FixAll calls skipped, updated atomically
+
+	overrides       map[string]GroupOverride // see ApplyOverrides
+	overridesExpire time.Time                // when the next override expires
+	leases          map[*lease]bool          // SendDispatch dispatches awaiting Ack or Nack
+	leasesExpire    time.Time                // when the next lease may expire, see WithAckTimeout
+
+	sent      map[string]*sentWait // see WaitSent
+	warm      warmup               // see WaitWarm
+	warmAdded bool                 // see WithWarmAddedGroups
+	lazy      lazyInit             // see LazyInit
+
+	backlog backlogCache // reported to SendDispatch receivers
+
+	lastResult      func(*configpb.TestGroup) time.Time
+	resultFrequency time.Duration
+	cost            func(*configpb.TestGroup) time.Duration              // see SetCostEstimator
+	buildThreshold  func(*configpb.TestGroup) int                        // see SetBuildThreshold
+	stale           func(*configpb.TestGroup, time.Time, time.Time) bool // see WithStalePredicate
+	onOverdue       func(string, time.Duration)                          // see WithOnOverdue
+	onIdle          func()                                               // see WithOnIdle
+	idleThreshold   time.Duration
+	idle            bool // whether Send called onIdle since it last dispatched
+
+	bucketLimits map[string]int    // most groups in flight from each bucket
+	inFlight     map[string]string // bucket of each group in flight
+	bucketLoad   map[string]int    // groups in flight from each bucket
+
+	classify    func(*configpb.TestGroup) string // see SetClassLimits
+	classLimits map[string]int                   // most groups in flight of each class
+	classFlight map[string]string                // class of each group in flight
+	classLoad   map[string]int                   // groups in flight of each class
+
+	senders      int           // active calls to Send
+	sleepers     int           // sleeping calls to Send
+	wakeAt       time.Time     // when the last sleeper will wake
+	frequency    time.Duration // of the active Send
+	maxSize      int           // most groups Add allows, see WithMaxSize
+	shrunk       chan struct{} // closed when the queue shrinks, see AddBlocking
+	retunes      int           // calls to SetFrequency
+	multiSenders bool
+	affinity     bool  // see WithAffinity
+	workers      []int // IDs of active calls to Send, oldest first, see join
+	workerSeq    int   // the last worker ID
+
+	receiverStall stall // Sends waiting for receivers, see Diagnose
+	rateStall     stall // Sends waiting for the coordinator, see Diagnose
+
+	orderCheck bool
+	lastWhen   time.Time // when of the last dispatched item
+
+	statusCopies bool
+
+	cohorts  map[string][]string      // members of each cohort
+	cohortOf map[string]string        // cohort of each member
+	pulled   map[string]stringset.Set // members awaiting dispatch after an earlier member
+
+	inits      []time.Time // recent calls to Init, oldest first
+	initWarned time.Time   // when the last Init storm warning was logged
+	quiet      bool        // suppresses per-group logs during an Init storm
+
+	rejected  int
+	excluded  int
+	delivered int64
+	requeued  int64
+	filtered  int64
+	corrupted int64
+	maxDepth  int            // most groups the queue held at once
+	initCount int64          // calls to Init, InitSchedule and InitDiff
+	fixes     int64          // groups rescheduled other than by dispatching them
+	reindexed int64          // stale indexes repaired, see reorderLocked
+	reloads   int64          // versions WatchFile failed to load
+	drift     time.Duration  // average lateness of dispatches
+	drifted   bool           // whether drift has a measurement
+	skips     map[string]int // due groups Send skipped, by reason
+
+	onFirstItem func()
+	onEmpty     func()
+	debounce    time.Duration
+	notifyLock  sync.Mutex
+	notified    bool // whether onFirstItem was the last transition reported
+	notifyTimer *time.Timer
 }
 
-// Init (or reinit) the queue with the specified groups, which should be updated at frequency.
-func (q *TestGroupQueue) Init(testGroups []*configpb.TestGroup, when time.Time) {
-	n := len(testGroups)
-	found := stringset.NewSize(n)
+// DefaultTransitionDebounce is how long NewTestGroupQueue waits for the
+// queue to settle before reporting an empty/non-empty transition.
+const DefaultTransitionDebounce = time.Second
 
-	q.lock.Lock()
-	defer q.lock.Unlock()
-	defer q.rouse()
+// QueueOption configures a TestGroupQueue created by NewTestGroupQueue.
+type QueueOption func(*TestGroupQueue)
+
+// WithOnFirstItem calls f when the queue transitions from empty to non-empty.
+func WithOnFirstItem(f func()) QueueOption {
+	return func(q *TestGroupQueue) {
+		q.onFirstItem = f
+	}
+}
 
-	if q.signal == nil {
-		q.signal = make(chan struct{})
+// WithOnEmpty calls f when the queue transitions from non-empty to empty.
+func WithOnEmpty(f func()) QueueOption {
+	return func(q *TestGroupQueue) {
+		q.onEmpty = f
 	}
+}
 
+// WithTransitionDebounce waits d for the queue to settle before calling the
+// OnFirstItem/OnEmpty callbacks, coalescing rapid transitions.
+//
+// A zero duration reports every transition immediately.
+func WithTransitionDebounce(d time.Duration) QueueOption {
+	return func(q *TestGroupQueue) {
+		q.debounce = d
+	}
+}
+
+// WithClock uses clock to tell time and sleep, rather than the system clock.
+//
+// Use a FakeClock along with Advance to simulate the schedule.
+func WithClock(clock Clock) QueueOption {
+	return func(q *TestGroupQueue) {
+		q.clock = clock
+	}
+}
+
+// WithOrderCheck panics if Send dispatches a group scheduled before the
+// previously dispatched group, which indicates a corrupt queue.
+//
+// Groups explicitly scheduled earlier by Add, Fix or FixAll are exempt.
+// Intended for tests and debugging.
+func WithOrderCheck() QueueOption {
+	return func(q *TestGroupQueue) {
+		q.orderCheck = true
+	}
+}
+
+// WithGranularity truncates when groups are scheduled to a multiple of d.
+//
+// Groups scheduled within the same window are dispatched in the order they
+// were scheduled, making the order reproducible despite small timing
+// differences. Fixing a group to another time in its current window leaves it
+// in place, which avoids reordering the heap under frequent fixes.
+//
+// Quantization trades precision for stability: a group may become due up to
+// d before its requested time, and may be delayed behind groups in the same
+// window that requested a time up to d later.
+func WithGranularity(d time.Duration) QueueOption {
+	return func(q *TestGroupQueue) {
+		q.granularity = d
+	}
+}
+
+// WithStatusCopies makes Status return a copy of the next group.
+//
+// Otherwise Status returns the queue's own proto, which callers must not modify.
+func WithStatusCopies() QueueOption {
+	return func(q *TestGroupQueue) {
+		q.statusCopies = true
+	}
+}
+
+// QueueMetrics receives measurements from the queue.
+type QueueMetrics interface {
+	// ObserveReceiverWait records how long Send waited for a receiver to accept a group.
+	ObserveReceiverWait(d time.Duration)
+}
+
+// WithMetrics reports measurements to m.
+func WithMetrics(m QueueMetrics) QueueOption {
+	return func(q *TestGroupQueue) {
+		q.metrics = m
+	}
+}
+
+// WithMultipleSenders allows concurrent calls to Send.
+//
+// Otherwise Send returns ErrAlreadySending while another Send is active.
+// Concurrent calls share the due groups, see WithAffinity to dispatch each
+// group from the same call.
+func WithMultipleSenders() QueueOption {
+	return func(q *TestGroupQueue) {
+		q.multiSenders = true
+	}
+}
+
+// ErrAlreadySending means another Send is active on the queue.
+var ErrAlreadySending = errors.New("queue is already sending")
+
+// ErrNotFound is returned for groups missing from the queue.
+var ErrNotFound = errors.New("not found")
+
+// NewTestGroupQueue returns a queue configured with the specified options.
+//
+// The zero value is also a usable queue without any options.
+func NewTestGroupQueue(opts ...QueueOption) *TestGroupQueue {
+	q := TestGroupQueue{
+		debounce: DefaultTransitionDebounce,
+	}
+	for _, opt := range opts {
+		opt(&q)
+	}
+	return &q
+}
+
+// MaxGroupNameLength is the longest test group name the queue accepts.
+const MaxGroupNameLength = 1024
+
+// InvalidGroup describes a test group the queue rejected.
+type InvalidGroup struct {
+	Index  int // Position in the slice passed to Init
+	Name   string
+	Reason string
+}
+
+// InvalidGroupsError reports the groups rejected by Init or Add.
+//
+// Any valid groups are still added to the queue.
+type InvalidGroupsError struct {
+	Groups   []InvalidGroup
+	Accepted int
+}
+
+func (e *InvalidGroupsError) Error() string {
+	reasons := make([]string, 0, len(e.Groups))
+	for _, g := range e.Groups {
+		reasons = append(reasons, fmt.Sprintf("%d %q: %s", g.Index, g.Name, g.Reason))
+	}
+	return fmt.Sprintf("rejected %d invalid groups (accepted %d): %s", len(e.Groups), e.Accepted, strings.Join(reasons, ", "))
+}
+
+func validateGroup(tg *configpb.TestGroup) error {
+	switch {
+	case tg == nil:
+		return errors.New("nil group")
+	case tg.Name == "":
+		return errors.New("empty name")
+	case len(tg.Name) > MaxGroupNameLength:
+		return fmt.Errorf("name exceeds %d characters", MaxGroupNameLength)
+	}
+	return nil
+}
+
+// QueueStats summarizes the queue.
+type QueueStats struct {
+	Depth    int
+	Rejected int // Invalid groups rejected by the last Init.
+	Excluded int // Groups the last Init excluded by name, see WithNameFilter.
+
+	Delivered int64 // Groups sent to a receiver.
+	Requeued  int64 // Groups dispatched but left in the queue without delivery.
+	Filtered  int64 // Groups skipped rather than dispatched.
+	Corrupted int64 // Times the queue recovered from corruption, see Verify.
+	Reindexed int64 // Times the queue repaired a group's stale position while rescheduling it.
+
+	ReloadErrors int64 // Versions of a watched file that failed to load, see WatchFile.
+
+	// Drift is a moving average of how late Send dispatches groups, weighted
+	// towards recent dispatches. A growing drift means Send cannot keep up.
+	Drift time.Duration
+	// Lag is how long the most overdue group has been due, see Overdue.
+	Lag time.Duration
+
+	MaxDepth int   // Most groups the queue held at once.
+	Inits    int64 // Calls to Init, InitSchedule and InitDiff.
+	Fixes    int64 // Groups rescheduled other than by dispatching them, such as by Fix.
+
+	Duplicates int64 // FixAll calls skipped as duplicates, see WithFixAllDedupe.
+
+	// Skipped counts the due groups Send skipped rather than dispatched, by
+	// reason, see SkipStats.
+	Skipped map[string]int
+}
+
+// Stats returns a summary of the queue.
+//
+// Complements WithMetrics with a single snapshot of the queue's counters
+// since it was created, for logging and dashboards. The stats are a copy.
+func (q *TestGroupQueue) Stats() QueueStats {
+	q.lock.RLock()
+	defer q.lock.RUnlock()
+	var lag time.Duration
+	if it := q.store().peek(); it != nil {
+		if now := q.now(); it.when.Before(now) {
+			lag = now.Sub(it.when)
+		}
+	}
+	return QueueStats{
+		Depth:        q.store().Len(),
+		Rejected:     q.rejected,
+		Excluded:     q.excluded,
+		Delivered:    q.delivered,
+		Requeued:     q.requeued,
+		Filtered:     q.filtered,
+		Corrupted:    q.corrupted,
+		Reindexed:    q.reindexed,
+		ReloadErrors: q.reloads,
+		Drift:        q.drift,
+		Lag:          lag,
+		MaxDepth:     q.maxDepth,
+		Inits:        q.initCount,
+		Fixes:        q.fixes,
+		Duplicates:   atomic.LoadInt64(&q.duplicates),
+		Skipped:      q.skipStatsLocked(),
+	}
+}
+
+// Reasons Send skips a due group rather than delivering it.
+const (
+	SkipPaused   = "paused"    // The group is paused, see PauseMatching.
+	SkipSpacing  = "spacing"   // The group was dispatched too recently, see WithMinSpacing.
+	SkipInFlight = "in-flight" // Every due group's bucket or class is full, see SetBucketLimits and SetClassLimits.
+	SkipCost     = "cost"      // The group would overrun the deadline, see SetCostEstimator.
+	SkipSlow     = "slow"      // The group is quarantined outside off-peak hours, see WithSlowPolicy.
+	SkipStale    = "stale"     // The group is stale, see WithStalePredicate.
+)
+
+// SkipStats returns how many times Send skipped a due group, by reason.
+//
+// Every reason is present, even if Send never skipped a group for it.
+func (q *TestGroupQueue) SkipStats() map[string]int {
+	q.lock.RLock()
+	defer q.lock.RUnlock()
+	return q.skipStatsLocked()
+}
+
+func (q *TestGroupQueue) skipStatsLocked() map[string]int {
+	out := map[string]int{
+		SkipPaused:   0,
+		SkipSpacing:  0,
+		SkipInFlight: 0,
+		SkipCost:     0,
+		SkipSlow:     0,
+		SkipStale:    0,
+	}
+	for reason, n := range q.skips {
+		out[reason] = n
+	}
+	return out
+}
+
+// skippedLocked counts a due group Send skipped rather than dispatched, by reason.
+func (q *TestGroupQueue) skippedLocked(reason string) {
+	if q.skips == nil {
+		q.skips = map[string]int{}
+	}
+	q.skips[reason]++
+	q.filtered++
+}
+
+// Overdue returns the number of groups scheduled before now,
+// as well as how far the most overdue group is behind schedule.
+//
+// Only visits the overdue groups.
+func (q *TestGroupQueue) Overdue(now time.Time) (int, time.Duration) {
+	q.lock.RLock()
+	defer q.lock.RUnlock()
+	it := q.store().peek()
+	if it == nil || !it.when.Before(now) {
+		return 0, 0
+	}
+	return q.store().countBefore(now), now.Sub(it.when)
+}
+
+func (q *TestGroupQueue) initLocked(n int) {
 	if q.items == nil {
 		q.items = make(map[string]*item, n)
 	}
 	if q.queue == nil {
 		q.queue = make(priorityQueue, 0, n)
 	}
-	items := q.items
-
-	for _, tg := range testGroups {
-		name := tg.Name
-		found.Add(name)
-		it, ok := items[name]
-		if !ok {
-			it = &item{
-				tg:    tg,
-				when:  when,
-				index: len(q.queue),
-			}
-			heap.Push(&q.queue, it)
-			items[name] = it
-			logrus.WithFields(logrus.Fields{
-				"when":  when,
-				"group": name,
-			}).Info("Adding group to queue")
-		} else {
-			it.tg = tg
+}
+
+// Init (or reinit) the queue with the specified groups, which should be updated at frequency.
+//
+// Removes any groups not in testGroups, see Merge to keep them.
+// New groups are first sent at when, see InitSchedule to stagger them.
+// Returns an *InvalidGroupsError after adding the valid groups if any groups are invalid.
+// Nil groups are invalid too, skipped with a warning counting them.
+// Rejects a zero when, likely an uninitialized variable, with an error
+// wrapping ErrInvalidTime rather than making every group overdue.
+// Only wakes a sleeping Send when the groups changed, see InitDiff.
+func (q *TestGroupQueue) Init(testGroups []*configpb.TestGroup, when time.Time) error {
+	return q.InitSchedule(testGroups, when, nil)
+}
+
+// InitSchedule (re)inits the queue like Init, but schedules groups in whens at the specified time.
+//
+// Other groups new to the queue are scheduled at when, and other existing
+// groups retain their schedule. Unlike calling Init and then FixAll, Send
+// never sees the groups at when. Ignores names in whens not in testGroups.
+func (q *TestGroupQueue) InitSchedule(testGroups []*configpb.TestGroup, when time.Time, whens map[string]time.Time) error {
+	_, err := q.initSchedule(testGroups, when, whens)
+	return err
+}
+
+// InitDiff (re)inits the queue like Init, returning how it changed the queue.
+//
+// Lets callers that reconcile the config repeatedly log or react only to
+// real changes, see DiffGroups to preview them instead. Like Init, only
+// wakes a sleeping Send when something changed.
+func (q *TestGroupQueue) InitDiff(testGroups []*configpb.TestGroup, when time.Time) (GroupsDiff, error) {
+	return q.initSchedule(testGroups, when, nil)
+}
+
+// initSchedule (re)inits the queue, see InitSchedule, returning how it changed the queue.
+func (q *TestGroupQueue) initSchedule(testGroups []*configpb.TestGroup, when time.Time, whens map[string]time.Time) (diff GroupsDiff, err error) {
+	if err := checkWhen("init", when); err != nil {
+		return diff, err
+	}
+	if err := checkWhens("init", whens); err != nil {
+		return diff, err
+	}
+	defer q.transition()
+	q.lock.Lock()
+	defer q.lock.Unlock()
+	defer func() {
+		if err != nil || len(whens) > 0 || !diff.Empty() {
+			q.rouse()
 		}
+	}()
+	defer q.recoverLocked(&err)
+
+	if err := q.frozenLocked(); err != nil {
+		return diff, err
 	}
+	q.initCount++
+	q.quiet = q.initStormLocked()
+	defer func() { q.quiet = false }()
 
-	for name, it := range items {
+	before := make(map[*item]*configpb.TestGroup, len(q.items)) // by item, which survives renames
+	for _, it := range q.items {
+		before[it] = it.tg
+	}
+	found, invalid, excluded := q.addAllLocked(testGroups, when, whens)
+
+	for name, it := range q.items {
 		if found.Contains(name) {
+			tg, ok := before[it]
+			if ok && tg.Name != name {
+				diff.renamed(name, tg.Name)
+			}
+			switch {
+			case !ok:
+				diff.Added = append(diff.Added, name)
+			case tg != it.tg && !sameGroup(tg, it.tg):
+				diff.Changed = append(diff.Changed, name)
+			}
+			continue
+		}
+		switch {
+		case it.pinned:
+			logrus.WithField("group", name).Warning("Removing pinned group from queue")
+		case !q.quiet:
+			logrus.WithField("group", name).Info("Removing group from queue")
+		}
+		diff.Removed = append(diff.Removed, name)
+		if it.stateful() {
+			diff.Stateful = append(diff.Stateful, name)
+		}
+		q.removeLocked(it)
+	}
+	sort.Strings(diff.Added)
+	sort.Strings(diff.Removed)
+	sort.Strings(diff.Changed)
+	sort.Strings(diff.Stateful)
+
+	q.rejected = 0
+	if invalid != nil {
+		q.rejected = len(invalid.Groups)
+	}
+	q.excluded = excluded
+	q.auditLog.record(AuditRecord{
+		Time:     q.now(),
+		Event:    AuditInit,
+		Groups:   q.store().Len(),
+		Rejected: q.rejected,
+		When:     timePtr(when.UTC()),
+	})
+	if invalid != nil {
+		return diff, invalid
+	}
+	return diff, nil
+}
+
+const (
+	// InitStormCalls to Init within InitStormWindow suppress per-group logging.
+	InitStormCalls  = 5
+	InitStormWindow = time.Minute
+)
+
+// initStormLocked records a call to Init, returning whether Init is called too often.
+//
+// Logs a warning at most once per window while the storm continues.
+func (q *TestGroupQueue) initStormLocked() bool {
+	now := q.now()
+	cutoff := now.Add(-InitStormWindow)
+	for len(q.inits) > 0 && !q.inits[0].After(cutoff) {
+		q.inits = q.inits[1:]
+	}
+	q.inits = append(q.inits, now)
+	n := len(q.inits)
+	if n <= InitStormCalls {
+		return false
+	}
+	if q.initWarned.IsZero() || !q.initWarned.After(cutoff) {
+		q.initWarned = now
+		logrus.WithField("calls", n).Warningf("Init called %d times in the last %s, suppressing per-group logs", n, InitStormWindow)
+	}
+	return true
+}
+
+// Merge adds new groups and updates existing groups without removing any.
+//
+// Whereas Init replaces the queue's groups, Merge is safe to call with a
+// subset of the groups, such as one shard of the config.
+// Returns an *InvalidGroupsError after adding the valid groups if any groups are invalid.
+// Nil groups are invalid too, skipped with a warning counting them.
+// Rejects a zero when like Init.
+func (q *TestGroupQueue) Merge(testGroups []*configpb.TestGroup, when time.Time) (err error) {
+	if err := checkWhen("merge", when); err != nil {
+		return err
+	}
+	defer q.transition()
+	q.lock.Lock()
+	defer q.lock.Unlock()
+	defer q.rouse()
+	defer q.recoverLocked(&err)
+
+	if err := q.frozenLocked(); err != nil {
+		return err
+	}
+	if _, invalid, _ := q.addAllLocked(testGroups, when, nil); invalid != nil {
+		return invalid
+	}
+	return nil
+}
+
+// addAllLocked adds or updates the valid groups, returning their names.
+//
+// Schedules groups in whens at the specified time, see InitSchedule.
+// Skips groups the name filter excludes, returning how many.
+func (q *TestGroupQueue) addAllLocked(testGroups []*configpb.TestGroup, when time.Time, whens map[string]time.Time) (stringset.Set, *InvalidGroupsError, int) {
+	n := len(testGroups)
+	found := stringset.NewSize(n)
+	q.initLocked(n)
+
+	var invalid []InvalidGroup
+	var excluded []string
+	var nils int
+	defer func() { logExcluded(excluded) }()
+	collisions := q.collisions(testGroups)
+	for i, tg := range testGroups {
+		if tg == nil {
+			nils++
+		}
+		if err := validateGroup(tg); err != nil {
+			invalid = append(invalid, InvalidGroup{
+				Index:  i,
+				Name:   tg.GetName(),
+				Reason: err.Error(),
+			})
+			continue
+		}
+		if reason, ok := collisions[i]; ok {
+			invalid = append(invalid, InvalidGroup{
+				Index:  i,
+				Name:   tg.Name,
+				Reason: reason,
+			})
+			continue
+		}
+		if q.excludedLocked(tg) {
+			excluded = append(excluded, tg.Name)
+			continue
+		}
+		found.Add(tg.Name)
+		if w, ok := whens[tg.Name]; ok {
+			q.addAtLocked(tg, w)
 			continue
 		}
-		logrus.WithField("group", name).Info("Removing group from queue")
-		heap.Remove(&q.queue, it.index)
-		delete(q.items, name)
+		q.addLocked(tg, when)
+	}
+	if nils > 0 {
+		logrus.WithField("count", nils).Warning("Skipping nil groups")
+	}
+	if len(invalid) == 0 {
+		return found, nil, len(excluded)
+	}
+	return found, &InvalidGroupsError{
+		Groups:   invalid,
+		Accepted: found.Len(),
+	}, len(excluded)
+}
+
+// Add a group to the queue, or update the configuration of an existing group.
+//
+// New groups are first sent at when, existing groups retain their schedule.
+// Returns an *InvalidGroupsError if the group is invalid, ErrFiltered if
+// the name filter excludes it, see WithNameFilter, or ErrFull if the queue
+// has no room for a new group, see WithMaxSize. Rejects a zero when like Init.
+// Returns ErrSealed from a sealed queue, see Seal.
+func (q *TestGroupQueue) Add(tg *configpb.TestGroup, when time.Time) error {
+	if err := validateGroup(tg); err != nil {
+		return invalidGroupError(tg, err)
+	}
+	_, err := q.add(tg, when)
+	return err
+}
+
+// add a valid group, or return ErrFull and a channel closed once there may be room.
+//
+// Returns ErrFiltered if the name filter excludes the group.
+func (q *TestGroupQueue) add(tg *configpb.TestGroup, when time.Time) (_ <-chan struct{}, err error) {
+	if err := checkWhen("add", when); err != nil {
+		return nil, err
+	}
+	defer q.transition()
+	q.lock.Lock()
+	defer q.lock.Unlock()
+	defer q.rouse()
+	defer q.recoverLocked(&err)
+
+	if err := q.admitLocked(tg); err != nil {
+		if errors.Is(err, ErrFull) {
+			return q.shrunkLocked(), err
+		}
+		return nil, err
+	}
+	q.initLocked(1)
+	q.addLocked(tg, when)
+	return nil, nil
+}
+
+// admitLocked returns ErrSealed, ErrReentrant, ErrFiltered or ErrFull if the queue rejects adding the group, see Add.
+func (q *TestGroupQueue) admitLocked(tg *configpb.TestGroup) error {
+	if err := q.frozenLocked(); err != nil {
+		return err
+	}
+	switch {
+	case q.excludedLocked(tg):
+		return ErrFiltered
+	case q.fullLocked(tg.Name):
+		return ErrFull
+	}
+	return nil
+}
+
+func invalidGroupError(tg *configpb.TestGroup, err error) *InvalidGroupsError {
+	return &InvalidGroupsError{
+		Groups: []InvalidGroup{{
+			Name:   tg.GetName(),
+			Reason: err.Error(),
+		}},
+	}
+}
+
+// AddIfAbsent adds the group unless the queue already has a group with
+// the same name, returning whether it was added.
+//
+// Unlike Add, leaves an existing group untouched. Never adds invalid groups,
+// excluded groups, see WithNameFilter, nor groups beyond the maximum size,
+// see WithMaxSize, nor groups at a zero when, see Init, nor to a sealed
+// queue, see Seal.
+func (q *TestGroupQueue) AddIfAbsent(tg *configpb.TestGroup, when time.Time) bool {
+	if validateGroup(tg) != nil || checkWhen("add", when) != nil {
+		return false
+	}
+
+	q.lock.Lock()
+	if _, ok := q.items[q.lookupLocked(tg.Name)]; ok || q.admitLocked(tg) != nil {
+		q.lock.Unlock()
+		return false
+	}
+	q.initLocked(1)
+	func() {
+		defer q.recoverLocked(nil)
+		q.addLocked(tg, when)
+	}()
+	q.rouse()
+	q.lock.Unlock()
+	q.transition()
+	return true
+}
+
+// truncate when to the queue's granularity, in UTC.
+func (q *TestGroupQueue) truncate(when time.Time) time.Time {
+	when = when.UTC()
+	if q.granularity <= 0 {
+		return when
+	}
+	return when.Truncate(q.granularity)
+}
+
+func (q *TestGroupQueue) addLocked(tg *configpb.TestGroup, when time.Time) {
+	name := tg.Name
+	q.renameLocked(name)
+	it, ok := q.items[name]
+	if ok {
+		if !proto.Equal(it.tg, tg) {
+			it.resetAdaptive()
+			it.bucket = groupBucket(tg)
+			it.class = q.classOf(tg)
+		}
+		it.tg = tg
+		return
 	}
+	q.pushLocked(tg, q.truncate(q.freshWhen(tg, when)))
+}
+
+// addAtLocked adds or updates the group, scheduling it at when even if it already exists.
+func (q *TestGroupQueue) addAtLocked(tg *configpb.TestGroup, when time.Time) {
+	q.renameLocked(tg.Name)
+	it, ok := q.items[tg.Name]
+	if !ok {
+		q.pushLocked(tg, q.truncate(when))
+		return
+	}
+	q.addLocked(tg, when)
+	when = q.truncate(when)
+	if when.Equal(it.when) {
+		return
+	}
+	if !q.quiet {
+		logrus.WithFields(logrus.Fields{
+			"group": tg.Name,
+			"when":  when,
+		}).Info("Fixed group")
+	}
+	q.fixedLocked(it, when, "")
+	q.scheduleLocked(it, when)
+	q.reorderLocked(it)
+}
+
+// pushLocked adds a new group to the queue at when.
+func (q *TestGroupQueue) pushLocked(tg *configpb.TestGroup, when time.Time) {
+	name := tg.Name
+	when = q.clampLocked(name, when)
+	q.seq++
+	it := &item{
+		tg:     tg,
+		when:   when,
+		index:  q.store().Len(),
+		seq:    q.seq,
+		bucket: groupBucket(tg),
+		class:  q.classOf(tg),
+	}
+	q.rescheduled(when)
+	q.pushStoreLocked(it)
+	q.items[name] = it
+	q.aliasLocked(name)
+	q.printLocked(it)
+	if n := q.store().Len(); n > q.maxDepth {
+		q.maxDepth = n
+	}
+	if q.warmAdded {
+		q.warm.add(name)
+	}
+	if q.quiet {
+		return
+	}
+	logrus.WithFields(logrus.Fields{
+		"when":  when,
+		"group": name,
+	}).Info("Adding group to queue")
+}
+
+// FixAllError reports the groups FixAll could not find.
+//
+// The other groups are still fixed.
+type FixAllError struct {
+	Missing []string // Groups not in the queue, sorted by name.
+	Changed []string // Groups rescheduled, sorted by name.
+}
+
+func (e *FixAllError) Error() string {
+	return fmt.Sprintf("%v: %v", ErrNotFound, e.Missing)
+}
+
+// Unwrap returns ErrNotFound.
+func (e *FixAllError) Unwrap() error {
+	return ErrNotFound
 }
 
 // FixAll will fix multiple groups inside a single critical section.
+//
+// Returns a *FixAllError after fixing the other groups if any are missing.
+// Rejects every group, fixing none, if any are fixed to the zero time, see Init.
+// May spread groups fixed to be due at once, see WithFixSmoothing.
 func (q *TestGroupQueue) FixAll(whens map[string]time.Time) error {
+	return q.fixAll(whens, "")
+}
+
+// fixAll fixes the groups named with prefix, treating any others as missing, see FixAll.
+func (q *TestGroupQueue) fixAll(whens map[string]time.Time, prefix string) (err error) {
+	if err := checkWhens("fix", whens); err != nil {
+		return err
+	}
+	print, duplicate := q.duplicateFixAll(whens, prefix)
+	if duplicate {
+		return nil
+	}
 	q.lock.Lock()
 	defer q.lock.Unlock()
-	var missing []string
+	var missing, changed []string
 	defer q.rouse()
+	defer q.recoverLocked(&err)
 
-	for name, when := range whens {
-		it, ok := q.items[name]
-		if !ok {
+	if err := q.frozenLocked(); err != nil {
+		return err
+	}
+
+	names := make([]string, 0, len(whens))
+	for name := range whens {
+		names = append(names, name)
+	}
+	sort.Strings(names) // groups fixed to the same time queue in name order
+
+	var fixes []fixedItem
+	for _, name := range names {
+		it, ok := q.items[q.lookupLocked(name)]
+		if !ok || !strings.HasPrefix(it.tg.Name, prefix) {
 			missing = append(missing, name)
 			continue
 		}
-		if !when.Equal(it.when) {
-			logrus.WithFields(logrus.Fields{
-				"group": name,
-				"when":  when,
-			}).Info("Fixing groups")
-			it.when = when
+		if when := q.truncate(whens[name]); !when.Equal(it.when) {
+			fixes = append(fixes, fixedItem{it, when})
+		}
+	}
+	smoothed := q.smoothLocked(fixes)
+	for _, f := range fixes {
+		if f.when.Equal(f.it.when) { // spread back to where it was
+			continue
+		}
+		name := f.it.tg.Name
+		logrus.WithFields(logrus.Fields{
+			"group": name,
+			"when":  f.when,
+		}).Info("Fixing groups")
+		q.fixedLocked(f.it, f.when, "")
+		q.scheduleLocked(f.it, f.when)
+		changed = append(changed, name)
+	}
+	if smoothed {
+		sort.Strings(changed)
+	}
+	if len(changed) > 0 {
+		q.store().rebuild()
+	}
+	if len(missing) > 0 {
+		return &FixAllError{
+			Missing: missing,
+			Changed: changed,
+		}
+	}
+	q.appliedFixAllLocked(prefix, print)
+	return nil
+}
+
+// MaxProtoDelay is the furthest in the future FixAllProto accepts.
+const MaxProtoDelay = 365 * 24 * time.Hour
+
+// FixAllProto fixes multiple groups to proto timestamps, see FixAll.
+//
+// Skips groups with a nil timestamp rather than treating it as the epoch.
+// Also skips and reports any invalid or implausible timestamp: those at or
+// before the epoch or more than MaxProtoDelay in the future.
+func (q *TestGroupQueue) FixAllProto(whens map[string]*timestamppb.Timestamp) error {
+	names := make([]string, 0, len(whens))
+	for name := range whens {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	now := q.now()
+	converted := make(map[string]time.Time, len(whens))
+	var mErr error
+	for _, name := range names {
+		ts := whens[name]
+		if ts == nil {
+			continue
+		}
+		when, err := protoWhen(ts, now)
+		if err != nil {
+			mErr = multierror.Append(mErr, fmt.Errorf("%s: %w", name, err))
+			continue
+		}
+		converted[name] = when
+	}
+	if err := q.FixAll(converted); err != nil {
+		mErr = multierror.Append(mErr, err)
+	}
+	return mErr
+}
+
+// ErrInvalidTime is wrapped by errors for timestamps FixAllProto and FixProto refuse,
+// and for zero times, see Init.
+var ErrInvalidTime = errors.New("invalid time")
+
+// checkWhen loudly rejects the zero time, which schedules groups at the start of the epoch.
+func checkWhen(op string, when time.Time) error {
+	if !when.IsZero() {
+		return nil
+	}
+	err := fmt.Errorf("%s: %w: zero time", op, ErrInvalidTime)
+	logrus.WithError(err).Error("Rejecting zero time, probably from an uninitialized variable")
+	return err
+}
+
+// checkWhens rejects whens if any are the zero time, see checkWhen.
+func checkWhens(op string, whens map[string]time.Time) error {
+	var zero []string
+	for name, when := range whens {
+		if when.IsZero() {
+			zero = append(zero, name)
+		}
+	}
+	if len(zero) == 0 {
+		return nil
+	}
+	sort.Strings(zero)
+	err := fmt.Errorf("%s: %w: zero time for %v", op, ErrInvalidTime, zero)
+	logrus.WithError(err).Error("Rejecting zero time, probably from an uninitialized variable")
+	return err
+}
+
+// protoWhen converts a plausible timestamp, see FixAllProto.
+func protoWhen(ts *timestamppb.Timestamp, now time.Time) (time.Time, error) {
+	if err := ts.CheckValid(); err != nil {
+		return time.Time{}, fmt.Errorf("%w: %v", ErrInvalidTime, err)
+	}
+	when := ts.AsTime()
+	switch {
+	case when.Unix() <= 0:
+		return time.Time{}, fmt.Errorf("%w: %v is not after the epoch", ErrInvalidTime, when)
+	case when.After(now.Add(MaxProtoDelay)):
+		return time.Time{}, fmt.Errorf("%w: %v is more than %s in the future", ErrInvalidTime, when, MaxProtoDelay)
+	}
+	return when, nil
+}
+
+// FixProto fixes the group to a proto timestamp, see Fix.
+//
+// Rejects the timestamps FixAllProto skips, including nil, with an error
+// wrapping ErrInvalidTime.
+func (q *TestGroupQueue) FixProto(name string, ts *timestamppb.Timestamp) error {
+	when, err := protoWhen(ts, q.now())
+	if err != nil {
+		return fmt.Errorf("%s: %w", name, err)
+	}
+	return q.Fix(name, when)
+}
+
+// Fix the next time to send the group to receivers.
+//
+// Rejects a zero when like Init.
+func (q *TestGroupQueue) Fix(name string, when time.Time) (err error) {
+	if err := checkWhen("fix "+name, when); err != nil {
+		return err
+	}
+	q.lock.Lock()
+	defer q.lock.Unlock()
+	defer q.rouse()
+	defer q.recoverLocked(&err)
+
+	if err := q.frozenLocked(); err != nil {
+		return err
+	}
+	name = q.lookupLocked(name)
+	it, ok := q.items[name]
+	if !ok {
+		return ErrNotFound
+	}
+	when = q.truncate(when)
+	if !when.Equal(it.when) {
+		logrus.WithFields(logrus.Fields{
+			"group": name,
+			"when":  when,
+		}).Info("Fixed group")
+		q.fixedLocked(it, when, "")
+		q.scheduleLocked(it, when)
+		q.reorderLocked(it)
+	}
+	return nil
+}
+
+// Remove the group from the queue.
+func (q *TestGroupQueue) Remove(name string) (err error) {
+	defer q.transition()
+	q.lock.Lock()
+	defer q.lock.Unlock()
+	defer q.rouse()
+	defer q.recoverLocked(&err)
+
+	if err := q.frozenLocked(); err != nil {
+		return err
+	}
+	name = q.lookupLocked(name)
+	it, ok := q.items[name]
+	if !ok {
+		return ErrNotFound
+	}
+	logrus.WithField("group", name).Info("Removing group from queue")
+	q.removeLocked(it)
+	return nil
+}
+
+// removeLocked drops the item from the queue and releases its group.
+//
+// Releasing the group allows large protos to be garbage collected even
+// while something, such as a copy of the heap, still references the item.
+func (q *TestGroupQueue) removeLocked(it *item) {
+	q.store().remove(it)
+	q.forgetLocked(it)
+	q.shrinkLocked()
+}
+
+// forgetLocked forgets an item already removed from the store.
+func (q *TestGroupQueue) forgetLocked(it *item) {
+	q.unprintLocked(it)
+	delete(q.items, it.tg.Name)
+	q.unaliasLocked(it.tg.Name)
+	q.sentLocked(it.tg.Name, ErrNotFound)
+	it.tg = nil
+	it.failures = nil
+}
+
+// Status of the queue: depth, next item and when the next item is ready.
+//
+// The next item is shared with the queue and must not be modified,
+// unless the queue uses WithStatusCopies. Prefer Len when only the
+// depth is needed.
+func (q *TestGroupQueue) Status() (int, *configpb.TestGroup, time.Time) {
+	q.lock.RLock()
+	defer q.lock.RUnlock()
+	var tg *configpb.TestGroup
+	var when time.Time
+	if it := q.store().peek(); it != nil {
+		tg = it.tg
+		when = it.when
+		if q.statusCopies {
+			tg = proto.Clone(tg).(*configpb.TestGroup)
+		}
+	}
+	return q.store().Len(), tg, when
+}
+
+// Len returns the number of groups in the queue.
+func (q *TestGroupQueue) Len() int {
+	q.lock.RLock()
+	defer q.lock.RUnlock()
+	return q.store().Len()
+}
+
+// Empty returns whether the queue has no groups.
+func (q *TestGroupQueue) Empty() bool {
+	return q.Len() == 0
+}
+
+// QueueItem describes when a group in the queue is next due.
+type QueueItem struct {
+	Name string
+	When time.Time
+
+	Interval  time.Duration // Between dispatches, when adaptive, see WithAdaptiveFrequency.
+	Unchanged int           // Consecutive reports without a change, see ReportChange.
+	Paused    bool          // See PauseMatching.
+	Pinned    bool          // See Pin.
+	Hot       bool          // See SetHot.
+	Took      time.Duration // Average processing time, see AckDuration.
+	Slow      bool          // Quarantined, see WithSlowPolicy.
+	Pending   int           // New builds since dispatched, see NoteBuilds.
+
+	Override *GroupOverride `json:",omitempty"` // See ApplyOverrides.
+}
+
+// Items returns every group in the queue, in the order they are due.
+func (q *TestGroupQueue) Items() []QueueItem {
+	q.lock.RLock()
+	now := q.now()
+	its := q.store().sorted()
+	out := make([]QueueItem, 0, len(its))
+	for _, it := range its {
+		qi := QueueItem{Name: it.tg.Name, When: it.when, Paused: it.paused, Pinned: it.pinned, Hot: it.hot, Took: it.took, Slow: it.slow, Pending: it.pending}
+		if o, ok := q.overrideLocked(it.tg.Name, now); ok {
+			qi.Override = &o
+		}
+		if q.adaptiveMax > 0 {
+			qi.Interval = q.intervalLocked(it, q.frequency)
+			qi.Unchanged = it.unchanged
 		}
+		out = append(out, qi)
 	}
-	heap.Init(&q.queue)
-	if len(missing) > 0 {
-		return fmt.Errorf("not found: %v", missing)
+	q.lock.RUnlock()
+	return out
+}
+
+// When returns when the group is next due.
+func (q *TestGroupQueue) When(name string) (time.Time, error) {
+	q.lock.RLock()
+	defer q.lock.RUnlock()
+	it, ok := q.items[q.lookupLocked(name)]
+	if !ok {
+		return time.Time{}, ErrNotFound
 	}
-	return nil
+	return it.when, nil
 }
 
-// Fix the next time to send the group to receivers.
-func (q *TestGroupQueue) Fix(name string, when time.Time) error {
+// Prioritize moves the group to the front of the queue, returning when it is due.
+//
+// The group becomes due now, or just before the current head if that is
+// earlier, ignoring any granularity. Its next dispatch also ignores any
+// minimum spacing, see WithMinSpacing.
+func (q *TestGroupQueue) Prioritize(name string) (_ time.Time, err error) {
 	q.lock.Lock()
 	defer q.lock.Unlock()
 	defer q.rouse()
+	defer q.recoverLocked(&err)
 
+	if err := q.frozenLocked(); err != nil {
+		return time.Time{}, err
+	}
+	name = q.lookupLocked(name)
 	it, ok := q.items[name]
 	if !ok {
-		return errors.New("not found")
+		return time.Time{}, ErrNotFound
 	}
-	if !when.Equal(it.when) {
+	it.urgent = true
+	when := q.now().UTC()
+	if head := q.store().peek(); head != it && !when.Before(head.when) {
+		when = head.when.Add(-time.Nanosecond)
+	}
+	if when.Before(it.when) {
 		logrus.WithFields(logrus.Fields{
 			"group": name,
 			"when":  when,
-		}).Info("Fixed group")
+		}).Info("Prioritized group")
+		q.fixedLocked(it, when, "prioritize")
+		q.unprintLocked(it)
 		it.when = when
-		heap.Fix(&q.queue, it.index)
+		q.printLocked(it)
+		q.rescheduled(when)
+		q.reorderLocked(it)
 	}
-	return nil
+	return it.when, nil
 }
 
-// Status of the queue: depth, next item and when the next item is ready.
-func (q *TestGroupQueue) Status() (int, *configpb.TestGroup, time.Time) {
+// transition schedules the OnFirstItem/OnEmpty callbacks after the queue
+// changes size.
+//
+// Must be called without holding the lock.
+func (q *TestGroupQueue) transition() {
+	if q.onFirstItem == nil && q.onEmpty == nil {
+		return
+	}
+	if q.debounce <= 0 {
+		q.notify()
+		return
+	}
+	q.notifyLock.Lock()
+	defer q.notifyLock.Unlock()
+	if q.notifyTimer != nil {
+		return // already scheduled
+	}
+	q.notifyTimer = time.AfterFunc(q.debounce, func() {
+		q.notifyLock.Lock()
+		q.notifyTimer = nil
+		q.notifyLock.Unlock()
+		q.notify()
+	})
+}
+
+// notify calls the appropriate callback if the queue's emptiness differs
+// from the last reported transition.
+func (q *TestGroupQueue) notify() {
 	q.lock.RLock()
-	defer q.lock.RUnlock()
-	var tg *configpb.TestGroup
-	var when time.Time
-	if it := q.queue.peek(); it != nil {
-		tg = it.tg
-		when = it.when
+	nonEmpty := q.store().Len() > 0
+	q.lock.RUnlock()
+
+	q.notifyLock.Lock()
+	if nonEmpty == q.notified {
+		q.notifyLock.Unlock()
+		return
+	}
+	q.notified = nonEmpty
+	q.notifyLock.Unlock()
+
+	if nonEmpty && q.onFirstItem != nil {
+		q.onFirstItem()
+	} else if !nonEmpty && q.onEmpty != nil {
+		q.onEmpty()
 	}
-	return len(q.queue), tg, when
 }
 
 func (q *TestGroupQueue) rouse() {
-	select {
-	case q.signal <- struct{}{}: // wake up early
-	default: // not sleeping
+	q.wake()
+}
+
+// Now returns the current time according to the queue's clock, see WithClock.
+func (q *TestGroupQueue) Now() time.Time {
+	return q.now()
+}
+
+func (q *TestGroupQueue) now() time.Time {
+	if q.clock == nil {
+		return time.Now()
 	}
+	return q.clock.Now()
 }
 
-func (q *TestGroupQueue) sleep(d time.Duration) {
-	log := logrus.WithFields(logrus.Fields{
-		"seconds": d.Round(100 * time.Millisecond).Seconds(),
-	})
+func (q *TestGroupQueue) newTimer(d time.Duration) Timer {
+	if q.sleepTimer != nil {
+		return afterTimer{q.sleepTimer(d)}
+	}
+	return q.clockTimer(d)
+}
+
+// clockTimer returns a timer from the queue's clock, ignoring WithSleepTimer.
+func (q *TestGroupQueue) clockTimer(d time.Duration) Timer {
+	if q.clock == nil {
+		return realClock{}.NewTimer(d)
+	}
+	return q.clock.NewTimer(d)
+}
+
+// Advance moves the queue's FakeClock forward by d.
+//
+// Wakes up Send if it is sleeping until a time the clock passes.
+// Returns an error if the queue does not use a FakeClock.
+func (q *TestGroupQueue) Advance(d time.Duration) error {
+	fc, ok := q.clock.(*FakeClock)
+	if !ok {
+		return errors.New("queue does not use a FakeClock")
+	}
+	fc.Advance(d)
+	return nil
+}
+
+// sleep until d elapses on the queue's clock, rouse wakes it early or the context expires.
+//
+// Rousing ends the sleep regardless of the clock, after which Send
+// reevaluates what is due at the current (possibly virtual) time.
+// Callers note the generation while holding the lock they used to choose
+// d, so a change after they release it still ends the sleep.
+func (q *TestGroupQueue) sleep(ctx context.Context, gen uint64, d time.Duration) {
+	if w := q.warp; w != nil {
+		w.sleep(d)
+		return
+	}
+	seconds := d.Round(100 * time.Millisecond).Seconds()
+	level := logrus.DebugLevel
 	if d > 5*time.Second {
-		log.Info("Sleeping...")
-	} else {
-		log.Debug("Sleeping...")
+		level = logrus.InfoLevel
 	}
-	sleep := time.NewTimer(d)
-	select {
-	case <-q.signal:
-		if !sleep.Stop() {
-			<-sleep.C
-		}
-		log.Info("Roused")
-	case <-sleep.C:
+	if logrus.IsLevelEnabled(level) { // avoid allocating the fields otherwise
+		logrus.WithField("seconds", seconds).Log(level, "Sleeping...")
+	}
+	q.lock.Lock()
+	q.sleepers++
+	q.wakeAt = q.now().Add(d).UTC()
+	q.lock.Unlock()
+	defer func() {
+		q.lock.Lock()
+		q.sleepers--
+		q.lock.Unlock()
+	}()
+	if q.wait(ctx, gen, q.newTimer(d)) {
+		logrus.WithField("seconds", seconds).Info("Roused")
 	}
 }
 
 // Send test groups to receivers until the context expires.
 //
+// Returns ErrAlreadySending if another Send is active, unless the queue
+// was created WithMultipleSenders.
+//
 // Pops items off the queue when frequency is zero.
 // Otherwise reschedules the item after the specified frequency has elapsed.
+//
+// A single Send dispatches groups in non-decreasing order of when they are
+// scheduled, breaking ties by the order groups were added to the queue.
 func (q *TestGroupQueue) Send(ctx context.Context, receivers chan<- *configpb.TestGroup, frequency time.Duration) error {
-	var next func() (*configpb.TestGroup, time.Time)
-	if frequency == 0 {
-		next = func() (*configpb.TestGroup, time.Time) {
-			if len(q.queue) == 0 {
-				return nil, time.Time{}
-			}
-			it := heap.Pop(&q.queue).(*item)
-			return it.tg, it.when
-		}
-	} else {
-		next = func() (*configpb.TestGroup, time.Time) {
-			it := q.queue.peek()
-			if it == nil {
-				return nil, time.Time{}
+	return q.send(ctx, frequency, func(ctx context.Context, d Dispatch) error {
+		tg := d.Group
+		start := q.now()
+		select {
+		case receivers <- tg:
+		default: // every receiver is busy
+			q.stalled(&q.receiverStall)
+			defer q.unstalled(&q.receiverStall)
+			watchdog := q.watchBlocked(tg.Name)
+			defer watchdog.stop()
+			for sent := false; !sent; {
+				select {
+				case receivers <- tg:
+					sent = true
+				case <-watchdog.c:
+					watchdog.warn()
+				case <-ctx.Done():
+					return ctx.Err()
+				}
 			}
-			when := it.when
-			it.when = time.Now().Add(frequency)
-			heap.Fix(&q.queue, it.index)
-			return it.tg, when
 		}
+		if q.metrics != nil {
+			q.metrics.ObserveReceiverWait(q.now().Sub(start))
+		}
+		return nil
+	})
+}
+
+// SendFunc calls handler with each group until the context expires, see Send.
+//
+// The handler runs outside the queue's lock, so it may safely call queue
+// methods such as Fix or Remove, for example to reschedule the group it
+// received based on the result of processing it.
+// Stops and returns the first error from handler.
+func (q *TestGroupQueue) SendFunc(ctx context.Context, handler func(context.Context, *configpb.TestGroup) error, frequency time.Duration) error {
+	return q.send(ctx, frequency, func(ctx context.Context, d Dispatch) error {
+		defer q.land(d.Group.Name)
+		ctx, cancel := q.handlerContext(ctx, d.Time, d.Next)
+		defer cancel()
+		return handler(ctx, d.Group)
+	})
+}
+
+// SendFuncDelay calls handler with each group until the context expires, see SendFunc.
+//
+// A positive delay returned by handler reschedules the group that long after
+// it was dispatched, in place of frequency or any adapted interval (see
+// WithAdaptiveFrequency), and of any Fix the handler made to the group. A
+// zero delay keeps the usual schedule. Error budgets still apply, so an over
+// budget group may be dispatched after its delay expires.
+// Groups no longer in the queue, such as after a zero frequency, ignore the delay.
+func (q *TestGroupQueue) SendFuncDelay(ctx context.Context, handler func(context.Context, *configpb.TestGroup) (time.Duration, error), frequency time.Duration) error {
+	return q.send(ctx, frequency, func(ctx context.Context, d Dispatch) error {
+		tg, now := d.Group, d.Time
+		hctx, cancel := q.handlerContext(ctx, now, d.Next)
+		delay, err := handler(hctx, tg)
+		cancel()
+		q.land(tg.Name)
+		if err != nil {
+			return err
+		}
+		if delay > 0 {
+			q.delay(tg.Name, now.Add(delay))
+		}
+		return nil
+	})
+}
+
+// delay reschedules a group at the delay its handler requested, if it is still in the queue.
+func (q *TestGroupQueue) delay(name string, when time.Time) {
+	q.lock.Lock()
+	defer q.lock.Unlock()
+	defer q.rouse()
+
+	it, ok := q.items[name]
+	if !ok {
+		return
+	}
+	when = q.truncate(when)
+	if when.Equal(it.when) {
+		return
+	}
+	q.fixedLocked(it, when, "delay")
+	q.scheduleLocked(it, when)
+	q.reorderLocked(it)
+}
+
+// deliverFunc hands a dispatched group to a receiver.
+type deliverFunc func(ctx context.Context, d Dispatch) error
+
+// send dispatches groups to deliver until the context expires, see Send.
+func (q *TestGroupQueue) send(ctx context.Context, frequency time.Duration, deliver deliverFunc) error {
+	q.lock.RLock()
+	retunes := q.retunes
+	q.lock.RUnlock()
+	if err := q.register(frequency); err != nil {
+		return err
 	}
+	defer q.unregister()
+	worker := q.join()
+	defer q.leave(worker)
 
 	for {
 		q.lock.Lock()
 		select {
 		case <-ctx.Done():
+			q.lock.Unlock()
 			return ctx.Err()
 		default:
 		}
-		tg, when := next()
-		q.lock.Unlock()
-
-		if tg == nil {
+		if q.retunes != retunes {
+			frequency, retunes = q.frequency, q.retunes
+		}
+		q.expireOverridesLocked(q.now())
+		q.expireLeasesLocked(q.now())
+		it := q.peekLocked()
+		if it == nil {
+			idle := frequency != 0 && q.idleLocked(-1)
+			gen := q.generation()
+			q.lock.Unlock()
 			if frequency == 0 {
 				return nil
 			}
-			q.sleep(time.Second)
+			if idle {
+				q.onIdle()
+			}
+			q.sleep(ctx, gen, time.Second)
+			continue
+		}
+		now := q.now()
+		if dur := it.when.Sub(now); dur > 0 {
+			if until := q.overridesExpire.Sub(now); !q.overridesExpire.IsZero() && until < dur {
+				dur = until // to release groups the override held
+			}
+			if until := q.leasesExpire.Sub(now); !q.leasesExpire.IsZero() && until < dur {
+				dur = until // to release dispatches neither acked nor nacked
+			}
+			idle := q.idleLocked(dur)
+			gen := q.generation()
+			q.lock.Unlock()
+			if idle {
+				q.onIdle()
+			}
+			q.sleep(ctx, gen, dur)
+			continue
+		}
+		if c := q.coordinator; c != nil {
+			q.lock.Unlock()
+			q.stalled(&q.rateStall)
+			err := c.acquire(ctx, q)
+			q.unstalled(&q.rateStall)
+			if err != nil {
+				return err
+			}
+			q.lock.Lock()
+			it = q.peekLocked()
+			now = q.now()
+			if it == nil || it.when.After(now) { // changed while waiting
+				q.lock.Unlock()
+				c.release()
+				continue
+			}
+		}
+		head := it
+		it = q.chooseLocked(it, now)
+		it = q.preferHotLocked(it, now)
+		it = q.preferHealthyLocked(it, now)
+		eligible := q.eligibleLocked(it, now, worker)
+		switch {
+		case eligible != nil:
+			eligible = q.affordableLocked(ctx, eligible, now)
+		case q.ownsLocked(worker, it): // every due group's bucket or class is full
+			q.skippedLocked(SkipInFlight)
+		}
+		if eligible == nil || q.holdLocked(eligible, now, frequency) || q.quarantineLocked(eligible, now) || q.spaceLocked(eligible, now) {
+			var wait time.Duration
+			if eligible == nil {
+				wait = time.Minute
+				if next, ok := q.store().nextAfter(now); ok {
+					wait = next.Sub(now)
+				}
+				if until := q.leasesExpire.Sub(now); !q.leasesExpire.IsZero() && until < wait {
+					wait = until // to release a slot held by a dispatch neither acked nor nacked
+				}
+			}
+			gen := q.generation()
+			q.lock.Unlock()
+			if c := q.coordinator; c != nil {
+				c.release()
+			}
+			if wait > 0 {
+				q.sleep(ctx, gen, wait)
+			}
+			continue
+		}
+		it = eligible
+		when := it.when
+		overdue := q.overdueLocked(it, now, frequency)
+		tg, popped := q.dispatchLocked(it, now, frequency)
+		q.launchLocked(it)
+		if it != head {
+			q.rescheduled(head.when) // dispatched ahead of head
+		}
+		d := Dispatch{
+			Group:   tg,
+			When:    when,
+			Time:    now,
+			Next:    nextWhen(it, popped),
+			Backlog: q.backlogLocked(now),
+		}
+		pinned := it.pinned
+		q.lock.Unlock()
+		if !pinned && q.skipStale(d, popped) {
+			continue
+		}
+		if err := q.deliver(ctx, popped, d, deliver); err != nil {
+			q.land(tg.Name)
+			return err
+		}
+		if overdue > 0 {
+			q.onOverdue(tg.Name, overdue)
+		}
+	}
+}
+
+// dispatchLocked pops the item when frequency is zero, otherwise reschedules it.
+//
+// Returns the popped item, if any, so deliver can restore it.
+func (q *TestGroupQueue) dispatchLocked(it *item, now time.Time, frequency time.Duration) (*configpb.TestGroup, *item) {
+	tg := it.tg
+	if q.orderCheck {
+		if err := q.checkOrder(tg.Name, it.when); err != nil {
+			q.lock.Unlock()
+			panic(err)
+		}
+	}
+	if q.auditLog != nil { // avoid allocating the record's When otherwise
+		q.auditLog.record(AuditRecord{
+			Time:            now,
+			Event:           AuditDispatch,
+			Group:           tg.Name,
+			When:            timePtr(it.when),
+			LatenessSeconds: now.Sub(it.when).Seconds(),
+		})
+	}
+	q.pullCohortLocked(tg.Name, now)
+	q.driftLocked(now.Sub(it.when))
+	it.dispatched = now
+	q.idle = false
+	it.urgent = false
+	it.pending = 0
+	q.rememberLocked(it, now)
+	keep, due := q.freshLocked(now), !it.when.After(now)
+	if frequency == 0 {
+		q.store().remove(it)
+		q.unprintLocked(it)
+		delete(q.items, tg.Name)
+		q.unaliasLocked(tg.Name)
+		q.shrinkLocked()
+		if keep {
+			q.keepBacklogLocked(it, now, due, true)
+		}
+		return tg, it
+	}
+	q.scheduleLocked(it, q.truncate(q.nextLocked(it.when, now, q.intervalLocked(it, frequency))))
+	q.reorderLocked(it)
+	if keep {
+		q.keepBacklogLocked(it, now, due, false)
+	}
+	return tg, nil
+}
+
+// scheduleLocked moves the item to the back of the groups due at when.
+//
+// The caller must fix the item in the queue.
+func (q *TestGroupQueue) scheduleLocked(it *item, when time.Time) {
+	q.seq++
+	it.seq = q.seq
+	when = q.clampLocked(it.tg.Name, when)
+	q.unprintLocked(it)
+	it.when = when
+	q.printLocked(it)
+	q.rescheduled(when)
+}
+
+// deliver a dispatched group without holding the lock.
+//
+// Restores a popped group when canceled before delivery.
+func (q *TestGroupQueue) deliver(ctx context.Context, popped *item, d Dispatch, deliver deliverFunc) error {
+	if popped != nil {
+		q.transition()
+	}
+	tg := d.Group
+	sctx, span := q.startSpan(ctx, tg.Name, d.When, d.Time)
+	err := deliver(sctx, d)
+	if span != nil {
+		span.End(err)
+	}
+	if err != nil {
+		switch {
+		case popped == nil:
+			q.lock.Lock()
+			q.requeuedLocked(tg.Name, err.Error())
+			q.lock.Unlock()
+		case ctx.Err() != nil:
+			q.restore(popped)
+		}
+		return err
+	}
+	q.lock.Lock()
+	q.delivered++
+	q.sentLocked(tg.Name, nil)
+	if q.fromCompletion && popped == nil {
+		q.completedLocked(d)
+	}
+	q.lock.Unlock()
+	return nil
+}
+
+// restore pushes a popped item back onto the queue, unless the group was added again.
+func (q *TestGroupQueue) restore(it *item) {
+	defer q.transition()
+	q.lock.Lock()
+	defer q.lock.Unlock()
+	defer q.rouse()
+
+	name := it.tg.Name
+	if _, ok := q.items[name]; ok {
+		return
+	}
+	logrus.WithFields(logrus.Fields{
+		"group": name,
+		"when":  it.when,
+	}).Info("Restoring undelivered group")
+	if q.items == nil {
+		q.items = map[string]*item{}
+	}
+	q.items[name] = it
+	q.aliasLocked(name)
+	q.pushStoreLocked(it)
+	q.printLocked(it)
+	q.rescheduled(it.when)
+	q.requeuedLocked(name, "canceled")
+}
+
+// fixedLocked records moving the item to when.
+func (q *TestGroupQueue) fixedLocked(it *item, when time.Time, reason string) {
+	q.fixes++
+	q.auditLog.record(AuditRecord{
+		Time:   q.now(),
+		Event:  AuditFix,
+		Group:  it.tg.Name,
+		Old:    timePtr(it.when),
+		New:    timePtr(when),
+		Reason: reason,
+	})
+}
+
+// requeuedLocked counts and records a dispatched group left in the queue.
+func (q *TestGroupQueue) requeuedLocked(name, reason string) {
+	q.requeued++
+	r := AuditRecord{
+		Time:   q.now(),
+		Event:  AuditRequeue,
+		Group:  name,
+		Reason: reason,
+	}
+	if it, ok := q.items[name]; ok {
+		r.When = timePtr(it.when)
+	}
+	q.auditLog.record(r)
+}
+
+// PopAll empties the queue, returning every group in the order Send would dispatch them.
+//
+// Intended for tests and one-shot tools that want the queue's contents
+// without running Send. Holds the lock throughout, so a concurrent Send
+// finds the queue empty afterwards. Groups Send dispatched earlier are also
+// returned when Send rescheduled them, but not when a zero frequency
+// removed them.
+func (q *TestGroupQueue) PopAll() []*configpb.TestGroup {
+	defer q.transition()
+	q.lock.Lock()
+	defer q.lock.Unlock()
+	defer q.rouse()
+	defer q.recoverLocked(nil)
+
+	out := make([]*configpb.TestGroup, 0, q.store().Len())
+	for q.store().Len() > 0 {
+		it := q.store().pop()
+		q.unprintLocked(it)
+		delete(q.items, it.tg.Name)
+		q.unaliasLocked(it.tg.Name)
+		q.sentLocked(it.tg.Name, ErrNotFound)
+		out = append(out, it.tg)
+	}
+	q.shrinkLocked()
+	return out
+}
+
+// Flush delivers every group currently due to receivers, without sleeping.
+//
+// Reschedules groups using the frequency of the active Send, if any,
+// otherwise removes them from the queue.
+// Returns the number of groups delivered.
+func (q *TestGroupQueue) Flush(ctx context.Context, receivers chan<- *configpb.TestGroup) (int, error) {
+	deliver := func(ctx context.Context, d Dispatch) error {
+		select {
+		case receivers <- d.Group:
+			return nil
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+	now := q.now()
+	flushed := stringset.New()
+	var n int
+	for {
+		q.lock.Lock()
+		it := q.peekLocked()
+		if it == nil || it.when.After(now) || flushed.Contains(it.tg.Name) {
+			q.lock.Unlock()
+			return n, nil
+		}
+		when := it.when
+		tg, popped := q.dispatchLocked(it, now, q.frequency)
+		d := Dispatch{
+			Group:   tg,
+			When:    when,
+			Time:    now,
+			Next:    nextWhen(it, popped),
+			Backlog: q.backlogLocked(now),
+		}
+		q.lock.Unlock()
+		flushed.Add(tg.Name)
+		if err := q.deliver(ctx, popped, d, deliver); err != nil {
+			return n, err
+		}
+		n++
+	}
+}
+
+// SendWindowed delivers groups in batches at each multiple of window.
+//
+// Sleeps until the next window boundary, aligned to the clock, then sends
+// every group due by the boundary to receivers as a single batch, ordered by
+// when. Groups in the batch are rescheduled to the following boundary.
+// Skips empty batches and, after falling behind, any missed boundaries.
+// Returns when the context is canceled.
+func (q *TestGroupQueue) SendWindowed(ctx context.Context, receivers chan<- []*configpb.TestGroup, window time.Duration) error {
+	if window <= 0 {
+		return fmt.Errorf("non-positive window: %s", window)
+	}
+	if err := q.register(window); err != nil {
+		return err
+	}
+	defer q.unregister()
+
+	boundary := q.now().Truncate(window).Add(window)
+	for {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		now := q.now()
+		if dur := boundary.Sub(now); dur > 0 {
+			q.sleep(ctx, q.generation(), dur)
 			continue
 		}
 
-		if dur := when.Sub(time.Now()); dur > 0 {
-			q.sleep(dur)
+		q.lock.Lock()
+		var batch []*configpb.TestGroup
+		for it := q.peekLocked(); it != nil && !it.when.After(boundary); it = q.peekLocked() {
+			tg, _ := q.dispatchLocked(it, boundary, window)
+			batch = append(batch, tg)
+		}
+		q.lock.Unlock()
+		boundary = now.Truncate(window).Add(window)
+		if len(batch) == 0 {
+			continue
 		}
+
 		select {
-		case receivers <- tg:
+		case receivers <- batch:
+			q.lock.Lock()
+			q.delivered += int64(len(batch))
+			for _, tg := range batch {
+				q.sentLocked(tg.Name, nil)
+			}
+			q.lock.Unlock()
 		case <-ctx.Done():
+			q.lock.Lock()
+			for _, tg := range batch {
+				q.requeuedLocked(tg.Name, "canceled")
+			}
+			q.lock.Unlock()
 			return ctx.Err()
 		}
 	}
 }
 
+// IsSleeping returns whether Send is sleeping until a group is due.
+func (q *TestGroupQueue) IsSleeping() bool {
+	q.lock.RLock()
+	defer q.lock.RUnlock()
+	return q.sleepers > 0
+}
+
+// SleepDeadline returns when Send will wake up, if it is sleeping.
+//
+// Send may wake earlier when the queue changes.
+func (q *TestGroupQueue) SleepDeadline() (time.Time, bool) {
+	q.lock.RLock()
+	defer q.lock.RUnlock()
+	if q.sleepers == 0 {
+		return time.Time{}, false
+	}
+	return q.wakeAt, true
+}
+
+// Sending returns whether Send is active.
+func (q *TestGroupQueue) Sending() bool {
+	q.lock.RLock()
+	defer q.lock.RUnlock()
+	return q.senders > 0
+}
+
+func (q *TestGroupQueue) register(frequency time.Duration) error {
+	q.lock.Lock()
+	defer q.lock.Unlock()
+	if q.senders > 0 && !q.multiSenders {
+		return ErrAlreadySending
+	}
+	q.senders++
+	q.frequency = frequency
+	q.coolLocked()
+	return nil
+}
+
+// SetFrequency changes the frequency of every active Send without restarting it.
+//
+// Each Send picks up the change before dispatching its next group.
+// Groups keep their current schedule; the new frequency applies as each
+// is next dispatched. Changing to zero switches Send to draining the queue,
+// returning once it is empty, while changing from zero resumes rescheduling
+// the groups that remain.
+//
+// A later call to Send uses its own frequency.
+func (q *TestGroupQueue) SetFrequency(d time.Duration) {
+	q.lock.Lock()
+	defer q.lock.Unlock()
+	defer q.rouse()
+	q.frequency = d
+	q.retunes++
+}
+
+func (q *TestGroupQueue) unregister() {
+	q.lock.Lock()
+	defer q.lock.Unlock()
+	q.senders--
+	if q.senders == 0 {
+		q.frequency = 0
+	}
+}
+
+// lateness returns how long the next group is overdue.
+func (q *TestGroupQueue) lateness() time.Duration {
+	q.lock.RLock()
+	defer q.lock.RUnlock()
+	it := q.store().peek()
+	if it == nil {
+		return 0
+	}
+	return q.now().Sub(it.when)
+}
+
+// rescheduled exempts a group explicitly scheduled at when from the order check.
+func (q *TestGroupQueue) rescheduled(when time.Time) {
+	if when.Before(q.lastWhen) {
+		q.lastWhen = when
+	}
+}
+
+func (q *TestGroupQueue) checkOrder(name string, when time.Time) error {
+	if when.Before(q.lastWhen) {
+		return fmt.Errorf("dispatched %q scheduled at %v before previous dispatch at %v", name, when, q.lastWhen)
+	}
+	q.lastWhen = when
+	return nil
+}
+
+func (q *TestGroupQueue) count(counter *int64) {
+	q.lock.Lock()
+	*counter++
+	q.lock.Unlock()
+}
+
 type priorityQueue []*item
 
 func (pq priorityQueue) Len() int { return len(pq) }
 func (pq priorityQueue) Less(i, j int) bool {
-	return pq[i].when.Before(pq[j].when)
+	return less(pq[i], pq[j])
 }
+
 func (pq priorityQueue) Swap(i, j int) {
 	pq[i], pq[j] = pq[j], pq[i]
 	pq[i].index = i
 	pq[j].index = j
 }
 
+// Push appends the item, ignoring an item already in the queue.
+//
+// Pushing an item twice would corrupt the heap, so a duplicate push
+// is logged and otherwise has no effect.
 func (pq *priorityQueue) Push(something interface{}) {
 	it := something.(*item)
+	if pq.contains(it) {
+		logrus.WithField("group", it.tg.GetName()).Error("Ignoring duplicate push to queue")
+		return
+	}
 	it.index = len(*pq)
 	*pq = append(*pq, it)
 }
 
+// contains returns true when the item is at its index in the queue.
+func (pq priorityQueue) contains(it *item) bool {
+	return it.index >= 0 && it.index < len(pq) && pq[it.index] == it
+}
+
 func (pq *priorityQueue) Pop() interface{} {
 	old := *pq
 	n := len(old)
@@ -278,4 +2024,31 @@ type item struct {
 	tg    *configpb.TestGroup
 	when  time.Time
 	index int
+	seq   uint64 // order scheduled, to break ties
+
+	failures []time.Time // recent failed Acks, oldest first
+
+	interval  time.Duration // adapted by ReportChange, zero until reported
+	unchanged int           // consecutive reports without a change
+
+	dispatched time.Time     // when Send last dispatched the item
+	pending    int           // new builds since dispatched, see NoteBuilds
+	nacks      int           // consecutive Nacks, see Dispatch
+	spacing    time.Duration // overrides the queue's minimum spacing
+	urgent     bool          // bypasses spacing until dispatched
+
+	paused bool // held rather than dispatched, see PauseMatching
+	held   bool // skipped by Send while paused
+
+	took     time.Duration // average processing time, see AckDuration
+	slow     bool          // quarantined, see WithSlowPolicy
+	slowHeld bool          // skipped by Send outside off-peak hours
+
+	bucket string // of the group's gcs_prefix, see SetBucketLimits
+	class  string // of the group, see SetClassLimits
+	pinned bool   // never dropped by the queue, see Pin
+	hot    bool   // dispatched ahead of other due groups, see SetHot
+
+	history     []time.Time // ring buffer of recent dispatches, see WithHistory
+	historyNext int         // index of the oldest dispatch once history is full
 }
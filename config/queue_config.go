@@ -0,0 +1,362 @@
+/*
+Copyright 2021 The TestGrid Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package config
+
+import (
+	"errors"
+	"regexp"
+	"time"
+
+	configpb "github.com/GoogleCloudPlatform/testgrid/pb/config"
+	multierror "github.com/hashicorp/go-multierror"
+)
+
+// QueueConfig configures a TestGroupQueue in a single struct.
+//
+// It is an alternative to passing QueueOptions to NewTestGroupQueue.
+// The zero value matches NewTestGroupQueue without any options.
+type QueueConfig struct {
+	// Clock tells time, defaulting to the system clock.
+	Clock Clock
+	// Metrics receives measurements, if set.
+	Metrics QueueMetrics
+	// Tracer traces each dispatch, if set, see WithTracer.
+	Tracer Tracer
+	// SleepTimer ends the sleeps of Send, if set, see WithSleepTimer.
+	SleepTimer func(time.Duration) <-chan time.Time
+
+	// OnFirstItem is called when the queue becomes non-empty.
+	OnFirstItem func()
+	// OnEmpty is called when the queue becomes empty.
+	OnEmpty func()
+	// TransitionDebounce waits for the queue to settle before calling
+	// OnFirstItem or OnEmpty. Zero uses DefaultTransitionDebounce,
+	// negative values report transitions immediately.
+	TransitionDebounce time.Duration
+
+	// Granularity truncates when groups are scheduled, see WithGranularity.
+	Granularity time.Duration
+	// OrderCheck panics if groups are dispatched out of order, see WithOrderCheck.
+	OrderCheck bool
+	// MultipleSenders allows concurrent calls to Send.
+	MultipleSenders bool
+	// Affinity dispatches each group from the same concurrent Send, see WithAffinity.
+	Affinity bool
+	// StatusCopies makes Status return a copy of the next group, see WithStatusCopies.
+	StatusCopies bool
+	// WarmAddedGroups makes WaitWarm wait for groups added after Send
+	// started, see WithWarmAddedGroups.
+	WarmAddedGroups bool
+
+	// ErrorBudgetFailures within ErrorBudgetWindow deprioritize a group,
+	// see WithErrorBudget.
+	ErrorBudgetFailures int
+	ErrorBudgetWindow   time.Duration
+
+	// AdaptiveMinFrequency and AdaptiveMaxFrequency bound each group's
+	// interval when set, see WithAdaptiveFrequency.
+	AdaptiveMinFrequency time.Duration
+	AdaptiveMaxFrequency time.Duration
+
+	// MinSpacing between dispatches of each group, see WithMinSpacing.
+	MinSpacing time.Duration
+	// AllowNames and DenyNames exclude groups by name when set, see WithNameFilter.
+	AllowNames *regexp.Regexp
+	DenyNames  *regexp.Regexp
+	// ShardIndex and ShardTotal keep only the groups of one shard when
+	// ShardTotal is positive, see WithShard.
+	ShardIndex int
+	ShardTotal int
+	// FixedRate reschedules groups relative to when they were due, see WithFixedRate.
+	FixedRate bool
+	// CompletionSchedule reschedules groups relative to when their delivery
+	// completed, see WithCompletionSchedule.
+	CompletionSchedule bool
+	// AckTimeout releases SendDispatch dispatches neither acked nor nacked
+	// in time, see WithAckTimeout.
+	AckTimeout time.Duration
+	// SmoothingThreshold and SmoothingWindow spread groups a single
+	// FixAll or FixEach makes due at once, see WithFixSmoothing.
+	SmoothingThreshold int
+	SmoothingWindow    time.Duration
+	// FixAllDedupeWindow skips FixAll calls repeating the last map it
+	// applied this recently, see WithFixAllDedupe.
+	FixAllDedupeWindow time.Duration
+	// BlockWarn logs the group Send is blocked delivering for this long,
+	// see WithBlockWarn.
+	BlockWarn time.Duration
+	// MaxSize limits the groups Add allows when set, see WithMaxSize.
+	MaxSize int
+	// MaxDelay limits how far after now groups are scheduled when set,
+	// see WithMaxDelay.
+	MaxDelay time.Duration
+	// LinearScanBelow scans for the next group instead of keeping a heap
+	// while the queue holds fewer groups, see WithLinearScan.
+	LinearScanBelow int
+	// NormalizeNames matches group names ignoring surrounding whitespace,
+	// and case when FoldNameCase, see WithNameNormalization.
+	NormalizeNames bool
+	FoldNameCase   bool
+	// HandlerDeadline is the fraction of the interval SendFunc handlers may
+	// take, see WithHandlerDeadline. Zero waits until the group is next due,
+	// negative values disable the deadline.
+	HandlerDeadline float64
+	// History remembers up to this many dispatches per group, see WithHistory.
+	History int
+
+	// LastResult schedules new groups LastResultFrequency after their
+	// last result, see WithLastResult.
+	LastResult          func(*configpb.TestGroup) time.Time
+	LastResultFrequency time.Duration
+
+	// DispatchPolicy chooses between due groups, see WithDispatchPolicy.
+	DispatchPolicy DispatchPolicy
+	// Strategy picks the next group, instead of a DispatchPolicy, see WithStrategy.
+	Strategy Strategy
+	// AuditLog records the queue's decisions, if set.
+	AuditLog *AuditLog
+	// SlowPolicy quarantines slow groups, if set, see WithSlowPolicy.
+	SlowPolicy *SlowPolicy
+	// StalePredicate skips delivering the groups it reports as stale, if set,
+	// see WithStalePredicate.
+	StalePredicate func(tg *configpb.TestGroup, scheduled, now time.Time) bool
+	// OnOverdue is called after Send delivers a group overdue by more than
+	// its interval, if set, see WithOnOverdue.
+	OnOverdue func(name string, overdueBy time.Duration)
+	// OnIdle is called once Send finds nothing due within IdleThreshold,
+	// if set, see WithOnIdle.
+	OnIdle        func()
+	IdleThreshold time.Duration
+}
+
+// Validate returns an error describing any invalid settings.
+func (c QueueConfig) Validate() error {
+	var mErr error
+	if c.Granularity < 0 {
+		mErr = multierror.Append(mErr, errors.New("negative granularity"))
+	}
+	if c.TransitionDebounce > 0 && c.OnFirstItem == nil && c.OnEmpty == nil {
+		mErr = multierror.Append(mErr, errors.New("transition debounce without OnFirstItem or OnEmpty"))
+	}
+	if c.IdleThreshold < 0 {
+		mErr = multierror.Append(mErr, errors.New("negative idle threshold"))
+	}
+	if c.IdleThreshold > 0 && c.OnIdle == nil {
+		mErr = multierror.Append(mErr, errors.New("idle threshold without OnIdle"))
+	}
+	if c.ErrorBudgetFailures < 0 {
+		mErr = multierror.Append(mErr, errors.New("negative error budget"))
+	}
+	if c.ErrorBudgetFailures > 0 && c.ErrorBudgetWindow <= 0 {
+		mErr = multierror.Append(mErr, errors.New("error budget requires a positive window"))
+	}
+	if c.AdaptiveMinFrequency < 0 {
+		mErr = multierror.Append(mErr, errors.New("negative adaptive min frequency"))
+	}
+	if c.AdaptiveMinFrequency > 0 && c.AdaptiveMaxFrequency <= 0 {
+		mErr = multierror.Append(mErr, errors.New("adaptive min frequency requires a positive max"))
+	}
+	if c.AdaptiveMaxFrequency > 0 && c.AdaptiveMinFrequency > c.AdaptiveMaxFrequency {
+		mErr = multierror.Append(mErr, errors.New("adaptive min frequency exceeds max"))
+	}
+	if c.MinSpacing < 0 {
+		mErr = multierror.Append(mErr, errors.New("negative min spacing"))
+	}
+	if c.SmoothingThreshold < 0 {
+		mErr = multierror.Append(mErr, errors.New("negative fix smoothing threshold"))
+	}
+	if c.SmoothingThreshold > 0 && c.SmoothingWindow <= 0 {
+		mErr = multierror.Append(mErr, errors.New("fix smoothing requires a positive window"))
+	}
+	if c.FixAllDedupeWindow < 0 {
+		mErr = multierror.Append(mErr, errors.New("negative fix dedupe window"))
+	}
+	if c.AckTimeout < 0 {
+		mErr = multierror.Append(mErr, errors.New("negative ack timeout"))
+	}
+	if c.BlockWarn < 0 {
+		mErr = multierror.Append(mErr, errors.New("negative block warning"))
+	}
+	if c.MaxSize < 0 {
+		mErr = multierror.Append(mErr, errors.New("negative max size"))
+	}
+	if c.Affinity && !c.MultipleSenders {
+		mErr = multierror.Append(mErr, errors.New("affinity without multiple senders"))
+	}
+	if c.MaxDelay < 0 {
+		mErr = multierror.Append(mErr, errors.New("negative max delay"))
+	}
+	if c.LinearScanBelow < 0 {
+		mErr = multierror.Append(mErr, errors.New("negative linear scan size"))
+	}
+	if c.ShardTotal < 0 {
+		mErr = multierror.Append(mErr, errors.New("negative shard total"))
+	}
+	if c.ShardIndex < 0 || c.ShardIndex > 0 && c.ShardIndex >= c.ShardTotal {
+		mErr = multierror.Append(mErr, errors.New("shard index not below shard total"))
+	}
+	if c.FoldNameCase && !c.NormalizeNames {
+		mErr = multierror.Append(mErr, errors.New("name case folding without normalization"))
+	}
+	if c.History < 0 {
+		mErr = multierror.Append(mErr, errors.New("negative history"))
+	}
+	if c.LastResultFrequency < 0 {
+		mErr = multierror.Append(mErr, errors.New("negative last result frequency"))
+	}
+	if c.LastResultFrequency != 0 && c.LastResult == nil {
+		mErr = multierror.Append(mErr, errors.New("last result frequency without LastResult"))
+	}
+	if c.DispatchPolicy != nil && c.Strategy != nil {
+		mErr = multierror.Append(mErr, errors.New("both dispatch policy and strategy"))
+	}
+	if c.SlowPolicy != nil {
+		if err := c.SlowPolicy.Validate(); err != nil {
+			mErr = multierror.Append(mErr, err)
+		}
+	}
+	return mErr
+}
+
+// Options returns the equivalent QueueOptions.
+func (c QueueConfig) Options() []QueueOption {
+	var opts []QueueOption
+	if c.Clock != nil {
+		opts = append(opts, WithClock(c.Clock))
+	}
+	if c.Metrics != nil {
+		opts = append(opts, WithMetrics(c.Metrics))
+	}
+	if c.Tracer != nil {
+		opts = append(opts, WithTracer(c.Tracer))
+	}
+	if c.SleepTimer != nil {
+		opts = append(opts, WithSleepTimer(c.SleepTimer))
+	}
+	if c.OnFirstItem != nil {
+		opts = append(opts, WithOnFirstItem(c.OnFirstItem))
+	}
+	if c.OnEmpty != nil {
+		opts = append(opts, WithOnEmpty(c.OnEmpty))
+	}
+	if c.TransitionDebounce != 0 {
+		opts = append(opts, WithTransitionDebounce(c.TransitionDebounce))
+	}
+	if c.Granularity > 0 {
+		opts = append(opts, WithGranularity(c.Granularity))
+	}
+	if c.OrderCheck {
+		opts = append(opts, WithOrderCheck())
+	}
+	if c.MultipleSenders {
+		opts = append(opts, WithMultipleSenders())
+	}
+	if c.Affinity {
+		opts = append(opts, WithAffinity(true))
+	}
+	if c.StatusCopies {
+		opts = append(opts, WithStatusCopies())
+	}
+	if c.WarmAddedGroups {
+		opts = append(opts, WithWarmAddedGroups())
+	}
+	if c.ErrorBudgetFailures > 0 {
+		opts = append(opts, WithErrorBudget(c.ErrorBudgetFailures, c.ErrorBudgetWindow))
+	}
+	if c.AdaptiveMaxFrequency > 0 {
+		opts = append(opts, WithAdaptiveFrequency(c.AdaptiveMinFrequency, c.AdaptiveMaxFrequency))
+	}
+	if c.MinSpacing > 0 {
+		opts = append(opts, WithMinSpacing(c.MinSpacing))
+	}
+	if c.AllowNames != nil || c.DenyNames != nil {
+		opts = append(opts, WithNameFilter(c.AllowNames, c.DenyNames))
+	}
+	if c.ShardTotal > 0 {
+		opts = append(opts, WithShard(c.ShardIndex, c.ShardTotal))
+	}
+	if c.FixedRate {
+		opts = append(opts, WithFixedRate())
+	}
+	if c.CompletionSchedule {
+		opts = append(opts, WithCompletionSchedule())
+	}
+	if c.SmoothingThreshold > 0 {
+		opts = append(opts, WithFixSmoothing(c.SmoothingThreshold, c.SmoothingWindow))
+	}
+	if c.FixAllDedupeWindow > 0 {
+		opts = append(opts, WithFixAllDedupe(c.FixAllDedupeWindow))
+	}
+	if c.AckTimeout > 0 {
+		opts = append(opts, WithAckTimeout(c.AckTimeout))
+	}
+	if c.BlockWarn > 0 {
+		opts = append(opts, WithBlockWarn(c.BlockWarn))
+	}
+	if c.MaxSize > 0 {
+		opts = append(opts, WithMaxSize(c.MaxSize))
+	}
+	if c.MaxDelay > 0 {
+		opts = append(opts, WithMaxDelay(c.MaxDelay))
+	}
+	if c.LinearScanBelow > 0 {
+		opts = append(opts, WithLinearScan(c.LinearScanBelow))
+	}
+	if c.NormalizeNames {
+		opts = append(opts, WithNameNormalization(c.FoldNameCase))
+	}
+	if c.HandlerDeadline != 0 {
+		opts = append(opts, WithHandlerDeadline(c.HandlerDeadline))
+	}
+	if c.History > 0 {
+		opts = append(opts, WithHistory(c.History))
+	}
+	if c.LastResult != nil {
+		opts = append(opts, WithLastResult(c.LastResult, c.LastResultFrequency))
+	}
+	if c.DispatchPolicy != nil {
+		opts = append(opts, WithDispatchPolicy(c.DispatchPolicy))
+	}
+	if c.Strategy != nil {
+		opts = append(opts, WithStrategy(c.Strategy))
+	}
+	if c.AuditLog != nil {
+		opts = append(opts, WithAuditLog(c.AuditLog))
+	}
+	if c.SlowPolicy != nil {
+		opts = append(opts, WithSlowPolicy(*c.SlowPolicy))
+	}
+	if c.StalePredicate != nil {
+		opts = append(opts, WithStalePredicate(c.StalePredicate))
+	}
+	if c.OnOverdue != nil {
+		opts = append(opts, WithOnOverdue(c.OnOverdue))
+	}
+	if c.OnIdle != nil {
+		opts = append(opts, WithOnIdle(c.IdleThreshold, c.OnIdle))
+	}
+	return opts
+}
+
+// NewTestGroupQueueFromConfig returns a queue configured by cfg,
+// or an error if cfg is invalid.
+func NewTestGroupQueueFromConfig(cfg QueueConfig) (*TestGroupQueue, error) {
+	if err := cfg.Validate(); err != nil {
+		return nil, err
+	}
+	return NewTestGroupQueue(cfg.Options()...), nil
+}
@@ -0,0 +1,309 @@
+/*
+Copyright 2021 The TestGrid Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package config
+
+import (
+	"regexp"
+	"testing"
+	"time"
+
+	configpb "github.com/GoogleCloudPlatform/testgrid/pb/config"
+)
+
+func TestNewTestGroupQueueFromConfig(t *testing.T) {
+	clock := NewFakeClock(time.Now())
+	noop := func() {}
+	cases := []struct {
+		name  string
+		cfg   QueueConfig
+		check func(*testing.T, *TestGroupQueue)
+		err   bool
+	}{
+		{
+			name: "zero",
+			check: func(t *testing.T, q *TestGroupQueue) {
+				if q.debounce != DefaultTransitionDebounce {
+					t.Errorf("debounce wanted %s, got %s", DefaultTransitionDebounce, q.debounce)
+				}
+			},
+		},
+		{
+			name: "everything",
+			cfg: QueueConfig{
+				Clock:                clock,
+				Metrics:              &fakeMetrics{},
+				Tracer:               &fakeTracer{},
+				SleepTimer:           time.After,
+				OnFirstItem:          noop,
+				OnEmpty:              noop,
+				TransitionDebounce:   -1,
+				Granularity:          time.Second,
+				OrderCheck:           true,
+				MultipleSenders:      true,
+				Affinity:             true,
+				StatusCopies:         true,
+				WarmAddedGroups:      true,
+				ErrorBudgetFailures:  3,
+				ErrorBudgetWindow:    time.Hour,
+				AdaptiveMinFrequency: time.Minute,
+				AdaptiveMaxFrequency: time.Hour,
+				MinSpacing:           time.Minute,
+				AllowNames:           regexp.MustCompile("^a-"),
+				DenyNames:            regexp.MustCompile("-kettle$"),
+				ShardIndex:           1,
+				ShardTotal:           3,
+				FixedRate:            true,
+				CompletionSchedule:   true,
+				AckTimeout:           time.Minute,
+				SmoothingThreshold:   100,
+				SmoothingWindow:      time.Hour,
+				FixAllDedupeWindow:   time.Second,
+				BlockWarn:            time.Minute,
+				MaxSize:              10,
+				MaxDelay:             time.Hour,
+				LinearScanBelow:      8,
+				NormalizeNames:       true,
+				FoldNameCase:         true,
+				HandlerDeadline:      0.5,
+				History:              5,
+				LastResult:           func(*configpb.TestGroup) time.Time { return time.Time{} },
+				LastResultFrequency:  time.Minute,
+				DispatchPolicy:       NewPrefixFairness("a-"),
+				AuditLog:             &AuditLog{},
+				SlowPolicy:           &SlowPolicy{SLO: time.Minute},
+				StalePredicate:       func(*configpb.TestGroup, time.Time, time.Time) bool { return false },
+				OnOverdue:            func(string, time.Duration) {},
+				OnIdle:               noop,
+				IdleThreshold:        time.Hour,
+			},
+			check: func(t *testing.T, q *TestGroupQueue) {
+				switch {
+				case q.clock != clock:
+					t.Error("clock not set")
+				case q.metrics == nil:
+					t.Error("metrics not set")
+				case q.tracer == nil:
+					t.Error("tracer not set")
+				case q.sleepTimer == nil:
+					t.Error("sleep timer not set")
+				case q.onFirstItem == nil, q.onEmpty == nil:
+					t.Error("callbacks not set")
+				case q.debounce >= 0:
+					t.Errorf("debounce wanted negative, got %s", q.debounce)
+				case q.granularity != time.Second:
+					t.Errorf("granularity wanted 1s, got %s", q.granularity)
+				case !q.orderCheck:
+					t.Error("order check not set")
+				case !q.multiSenders:
+					t.Error("multiple senders not set")
+				case !q.affinity:
+					t.Error("affinity not set")
+				case !q.statusCopies:
+					t.Error("status copies not set")
+				case !q.warmAdded:
+					t.Error("warm added groups not set")
+				case q.budgetFailures != 3 || q.budgetWindow != time.Hour:
+					t.Errorf("error budget wanted 3 per hour, got %d per %s", q.budgetFailures, q.budgetWindow)
+				case q.adaptiveMin != time.Minute || q.adaptiveMax != time.Hour:
+					t.Errorf("adaptive frequency wanted [1m, 1h], got [%s, %s]", q.adaptiveMin, q.adaptiveMax)
+				case q.minSpacing != time.Minute:
+					t.Errorf("min spacing wanted 1m, got %s", q.minSpacing)
+				case q.allowNames == nil || q.denyNames == nil:
+					t.Error("name filter not set")
+				case !q.fixedRate:
+					t.Error("fixed rate not set")
+				case !q.fromCompletion:
+					t.Error("completion schedule not set")
+				case q.smoothThreshold != 100 || q.smoothWindow != time.Hour:
+					t.Errorf("fix smoothing wanted 100 over 1h, got %d over %s", q.smoothThreshold, q.smoothWindow)
+				case q.dedupeWindow != time.Second:
+					t.Errorf("fix dedupe window wanted 1s, got %s", q.dedupeWindow)
+				case q.ackTimeout != time.Minute:
+					t.Errorf("ack timeout wanted 1m, got %s", q.ackTimeout)
+				case q.blockWarn != time.Minute:
+					t.Errorf("block warning wanted 1m, got %s", q.blockWarn)
+				case q.maxSize != 10:
+					t.Errorf("max size wanted 10, got %d", q.maxSize)
+				case q.maxDelay != time.Hour:
+					t.Errorf("max delay wanted 1h, got %s", q.maxDelay)
+				case q.scanBelow != 8:
+					t.Errorf("linear scan wanted below 8, got %d", q.scanBelow)
+				case q.shardIndex != 1 || q.shardTotal != 3:
+					t.Errorf("shard wanted 1 of 3, got %d of %d", q.shardIndex, q.shardTotal)
+				case !q.normalize || !q.foldCase:
+					t.Error("name normalization not set")
+				case q.deadline != 0.5:
+					t.Errorf("handler deadline wanted 0.5, got %v", q.deadline)
+				case q.historySize != 5:
+					t.Errorf("history wanted 5, got %d", q.historySize)
+				case q.lastResult == nil || q.resultFrequency != time.Minute:
+					t.Errorf("last result wanted 1m, got %s", q.resultFrequency)
+				case q.policy == nil:
+					t.Error("dispatch policy not set")
+				case q.auditLog == nil:
+					t.Error("audit log not set")
+				case q.slow == nil || q.slow.Weight != DefaultSlowWeight:
+					t.Error("slow policy not set")
+				case q.stale == nil:
+					t.Error("stale predicate not set")
+				case q.onOverdue == nil:
+					t.Error("overdue callback not set")
+				case q.onIdle == nil || q.idleThreshold != time.Hour:
+					t.Errorf("idle callback wanted after 1h, got %s", q.idleThreshold)
+				}
+			},
+		},
+		{
+			name: "affinity without multiple senders",
+			cfg: QueueConfig{
+				Affinity: true,
+			},
+			err: true,
+		},
+		{
+			name: "shard beyond total",
+			cfg: QueueConfig{
+				ShardIndex: 3,
+				ShardTotal: 3,
+			},
+			err: true,
+		},
+		{
+			name: "fold case without normalization",
+			cfg: QueueConfig{
+				FoldNameCase: true,
+			},
+			err: true,
+		},
+		{
+			name: "strategy",
+			cfg: QueueConfig{
+				Strategy: EarliestFirst{},
+			},
+			check: func(t *testing.T, q *TestGroupQueue) {
+				if q.strategy == nil {
+					t.Error("strategy not set")
+				}
+			},
+		},
+		{
+			name: "dispatch policy and strategy",
+			cfg: QueueConfig{
+				DispatchPolicy: NewPrefixFairness("a-"),
+				Strategy:       EarliestFirst{},
+			},
+			err: true,
+		},
+		{
+			name: "idle threshold without callback",
+			cfg: QueueConfig{
+				IdleThreshold: time.Hour,
+			},
+			err: true,
+		},
+		{
+			name: "smoothing without window",
+			cfg: QueueConfig{
+				SmoothingThreshold: 100,
+			},
+			err: true,
+		},
+		{
+			name: "slow policy without SLO",
+			cfg: QueueConfig{
+				SlowPolicy: &SlowPolicy{OffPeakStart: 22, OffPeakEnd: 6},
+			},
+			err: true,
+		},
+		{
+			name: "negative granularity",
+			cfg: QueueConfig{
+				Granularity: -time.Second,
+			},
+			err: true,
+		},
+		{
+			name: "error budget without window",
+			cfg: QueueConfig{
+				ErrorBudgetFailures: 1,
+			},
+			err: true,
+		},
+		{
+			name: "adaptive min without max",
+			cfg: QueueConfig{
+				AdaptiveMinFrequency: time.Minute,
+			},
+			err: true,
+		},
+		{
+			name: "adaptive min exceeds max",
+			cfg: QueueConfig{
+				AdaptiveMinFrequency: time.Hour,
+				AdaptiveMaxFrequency: time.Minute,
+			},
+			err: true,
+		},
+		{
+			name: "negative min spacing",
+			cfg: QueueConfig{
+				MinSpacing: -time.Minute,
+			},
+			err: true,
+		},
+		{
+			name: "negative max size",
+			cfg: QueueConfig{
+				MaxSize: -1,
+			},
+			err: true,
+		},
+		{
+			name: "negative history",
+			cfg: QueueConfig{
+				History: -1,
+			},
+			err: true,
+		},
+		{
+			name: "last result frequency without last result",
+			cfg: QueueConfig{
+				LastResultFrequency: time.Minute,
+			},
+			err: true,
+		},
+		{
+			name: "debounce without callbacks",
+			cfg: QueueConfig{
+				TransitionDebounce: time.Second,
+			},
+			err: true,
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			q, err := NewTestGroupQueueFromConfig(tc.cfg)
+			if (err != nil) != tc.err {
+				t.Fatalf("NewTestGroupQueueFromConfig() got unexpected error %v, wanted err=%t", err, tc.err)
+			}
+			if tc.check != nil {
+				tc.check(t, q)
+			}
+		})
+	}
+}
@@ -19,13 +19,21 @@ package config
 import (
 	"container/heap"
 	"context"
+	"errors"
+	"fmt"
+	"math/rand"
+	"sort"
+	"strings"
 	"sync"
 	"testing"
 	"time"
 
 	configpb "github.com/GoogleCloudPlatform/testgrid/pb/config"
 	"github.com/google/go-cmp/cmp"
+	multierror "github.com/hashicorp/go-multierror"
+	logtest "github.com/sirupsen/logrus/hooks/test"
 	"google.golang.org/protobuf/testing/protocmp"
+	"google.golang.org/protobuf/types/known/timestamppb"
 )
 
 func TestInit(t *testing.T) {
@@ -104,6 +112,82 @@ func TestInit(t *testing.T) {
 	}
 }
 
+func TestInitSchedule(t *testing.T) {
+	now := time.Date(2021, 1, 2, 3, 4, 5, 0, time.UTC)
+	cases := []struct {
+		name   string
+		q      func() *TestGroupQueue
+		groups []*configpb.TestGroup
+		whens  map[string]time.Time
+
+		want []QueueItem
+	}{
+		{
+			name: "empty",
+			q: func() *TestGroupQueue {
+				return &TestGroupQueue{}
+			},
+			groups: []*configpb.TestGroup{{Name: "early"}, {Name: "default"}, {Name: "late"}},
+			whens: map[string]time.Time{
+				"early":   now.Add(-time.Minute),
+				"late":    now.Add(time.Hour),
+				"missing": now.Add(-time.Hour),
+			},
+			want: []QueueItem{
+				{Name: "early", When: now.Add(-time.Minute)},
+				{Name: "default", When: now},
+				{Name: "late", When: now.Add(time.Hour)},
+			},
+		},
+		{
+			name: "existing",
+			q: func() *TestGroupQueue {
+				var q TestGroupQueue
+				q.Init([]*configpb.TestGroup{{Name: "drop"}, {Name: "fixed"}, {Name: "kept"}}, now.Add(-time.Hour))
+				return &q
+			},
+			groups: []*configpb.TestGroup{{Name: "fixed"}, {Name: "kept"}, {Name: "new"}},
+			whens: map[string]time.Time{
+				"fixed": now.Add(time.Minute),
+				"drop":  now,
+			},
+			want: []QueueItem{
+				{Name: "kept", When: now.Add(-time.Hour)},
+				{Name: "new", When: now},
+				{Name: "fixed", When: now.Add(time.Minute)},
+			},
+		},
+		{
+			name: "overrides last result",
+			q: func() *TestGroupQueue {
+				return NewTestGroupQueue(WithLastResult(func(*configpb.TestGroup) time.Time {
+					return now.Add(-time.Hour)
+				}, 10*time.Minute))
+			},
+			groups: []*configpb.TestGroup{{Name: "fresh"}, {Name: "scheduled"}},
+			whens: map[string]time.Time{
+				"scheduled": now.Add(time.Hour),
+			},
+			want: []QueueItem{
+				{Name: "fresh", When: now.Add(-50 * time.Minute)},
+				{Name: "scheduled", When: now.Add(time.Hour)},
+			},
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			q := tc.q()
+			if err := q.InitSchedule(tc.groups, now, tc.whens); err != nil {
+				t.Fatalf("InitSchedule() got unexpected error: %v", err)
+			}
+			if diff := cmp.Diff(tc.want, q.Items()); diff != "" {
+				t.Errorf("InitSchedule() got unexpected diff (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
+
 func TestFixAll(t *testing.T) {
 	now := time.Now()
 	cases := []struct {
@@ -184,6 +268,45 @@ func TestFixAll(t *testing.T) {
 	}
 }
 
+func TestFixAllError(t *testing.T) {
+	now := time.Now()
+	var q TestGroupQueue
+	q.Init([]*configpb.TestGroup{
+		{Name: "moved"},
+		{Name: "same"},
+	}, now)
+	err := q.FixAll(map[string]time.Time{
+		"moved":   now.Add(time.Minute),
+		"same":    now,
+		"missing": now,
+		"gone":    now,
+	})
+	var fe *FixAllError
+	if !errors.As(err, &fe) {
+		t.Fatalf("FixAll() got %v, want a *FixAllError", err)
+	}
+	want := &FixAllError{
+		Missing: []string{"gone", "missing"},
+		Changed: []string{"moved"},
+	}
+	if diff := cmp.Diff(want, fe); diff != "" {
+		t.Errorf("FixAll() got unexpected diff (-want +got):\n%s", diff)
+	}
+	if !errors.Is(err, ErrNotFound) {
+		t.Errorf("FixAll() got %v, want ErrNotFound", err)
+	}
+	if got, want := err.Error(), "not found: [gone missing]"; got != want {
+		t.Errorf("Error() got %q, want %q", got, want)
+	}
+	if when, _ := q.When("moved"); !when.Equal(now.Add(time.Minute)) {
+		t.Errorf("FixAll() did not fix moved, got %v", when)
+	}
+
+	if err := q.FixAll(map[string]time.Time{"moved": now}); err != nil {
+		t.Errorf("FixAll() got unexpected error: %v", err)
+	}
+}
+
 func TestFix(t *testing.T) {
 	now := time.Now()
 	cases := []struct {
@@ -669,6 +792,40 @@ func TestPriorityQueue(t *testing.T) {
 				},
 			},
 		},
+		{
+			name: "ties",
+			items: []*item{
+				{
+					tg: &configpb.TestGroup{
+						Name: "second",
+					},
+					seq: 2,
+				},
+				{
+					tg: &configpb.TestGroup{
+						Name: "third",
+					},
+					seq: 3,
+				},
+				{
+					tg: &configpb.TestGroup{
+						Name: "first",
+					},
+					seq: 1,
+				},
+			},
+			want: []*configpb.TestGroup{
+				{
+					Name: "first",
+				},
+				{
+					Name: "second",
+				},
+				{
+					Name: "third",
+				},
+			},
+		},
 	}
 
 	for _, tc := range cases {
@@ -689,3 +846,2338 @@ func TestPriorityQueue(t *testing.T) {
 		})
 	}
 }
+
+func TestTransitionCallbacks(t *testing.T) {
+	groups := []*configpb.TestGroup{
+		{
+			Name: "hi",
+		},
+		{
+			Name: "there",
+		},
+	}
+	cases := []struct {
+		name     string
+		debounce time.Duration
+		ops      func(*TestGroupQueue)
+		want     []string
+	}{
+		{
+			name: "basic",
+			ops: func(q *TestGroupQueue) {
+				q.Init(groups, time.Now())
+				q.Init(groups, time.Now())
+				q.Init(nil, time.Now())
+			},
+			want: []string{"first", "empty"},
+		},
+		{
+			name: "send drains",
+			ops: func(q *TestGroupQueue) {
+				q.Init(groups, time.Now())
+				ch := make(chan *configpb.TestGroup, len(groups))
+				if err := q.Send(context.Background(), ch, 0); err != nil {
+					t.Fatalf("Send() got unexpected error: %v", err)
+				}
+			},
+			want: []string{"first", "empty"},
+		},
+		{
+			name: "no change",
+			ops: func(q *TestGroupQueue) {
+				q.Init(nil, time.Now())
+			},
+		},
+		{
+			name:     "debounce",
+			debounce: 10 * time.Millisecond,
+			ops: func(q *TestGroupQueue) {
+				q.Init(groups, time.Now())
+				q.Init(nil, time.Now())
+				q.Init(groups, time.Now())
+				time.Sleep(50 * time.Millisecond)
+			},
+			want: []string{"first"},
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			var lock sync.Mutex
+			var got []string
+			record := func(s string) func() {
+				return func() {
+					lock.Lock()
+					defer lock.Unlock()
+					got = append(got, s)
+				}
+			}
+			q := NewTestGroupQueue(
+				WithOnFirstItem(record("first")),
+				WithOnEmpty(record("empty")),
+				WithTransitionDebounce(tc.debounce),
+			)
+			tc.ops(q)
+			lock.Lock()
+			defer lock.Unlock()
+			if diff := cmp.Diff(tc.want, got); diff != "" {
+				t.Errorf("callbacks got unexpected diff (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestInitInvalid(t *testing.T) {
+	now := time.Now()
+	long := strings.Repeat("x", MaxGroupNameLength+1)
+	cases := []struct {
+		name   string
+		groups []*configpb.TestGroup
+
+		names    []string
+		err      *InvalidGroupsError
+		rejected int
+	}{
+		{
+			name: "valid",
+			groups: []*configpb.TestGroup{
+				{
+					Name: "hi",
+				},
+			},
+			names: []string{"hi"},
+		},
+		{
+			name: "mixed",
+			groups: []*configpb.TestGroup{
+				{
+					Name: "hi",
+				},
+				nil,
+				{},
+				{
+					Name: long,
+				},
+				{
+					Name: "there",
+				},
+			},
+			names: []string{"hi", "there"},
+			err: &InvalidGroupsError{
+				Groups: []InvalidGroup{
+					{
+						Index:  1,
+						Reason: "nil group",
+					},
+					{
+						Index:  2,
+						Reason: "empty name",
+					},
+					{
+						Index:  3,
+						Name:   long,
+						Reason: fmt.Sprintf("name exceeds %d characters", MaxGroupNameLength),
+					},
+				},
+				Accepted: 2,
+			},
+			rejected: 3,
+		},
+		{
+			name: "nil entries",
+			groups: []*configpb.TestGroup{
+				nil,
+				{
+					Name: "hi",
+				},
+				nil,
+			},
+			names: []string{"hi"},
+			err: &InvalidGroupsError{
+				Groups: []InvalidGroup{
+					{
+						Index:  0,
+						Reason: "nil group",
+					},
+					{
+						Index:  2,
+						Reason: "nil group",
+					},
+				},
+				Accepted: 1,
+			},
+			rejected: 2,
+		},
+		{
+			name: "all invalid",
+			groups: []*configpb.TestGroup{
+				{},
+			},
+			err: &InvalidGroupsError{
+				Groups: []InvalidGroup{
+					{
+						Reason: "empty name",
+					},
+				},
+			},
+			rejected: 1,
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			var q TestGroupQueue
+			err := q.Init(tc.groups, now)
+			switch {
+			case tc.err == nil && err != nil:
+				t.Errorf("Init() got unexpected error: %v", err)
+			case tc.err != nil:
+				var got *InvalidGroupsError
+				if !errors.As(err, &got) {
+					t.Fatalf("Init() wanted an *InvalidGroupsError, got %v", err)
+				}
+				if diff := cmp.Diff(tc.err, got); diff != "" {
+					t.Errorf("Init() got unexpected error diff (-want +got):\n%s", diff)
+				}
+			}
+			var names []string
+			for q.queue.Len() > 0 {
+				names = append(names, heap.Pop(&q.queue).(*item).tg.Name)
+			}
+			sort.Strings(names)
+			if diff := cmp.Diff(tc.names, names); diff != "" {
+				t.Errorf("Init() got unexpected queue diff (-want +got):\n%s", diff)
+			}
+			if want, got := tc.rejected, q.Stats().Rejected; want != got {
+				t.Errorf("Stats() wanted %d rejected, got %d", want, got)
+			}
+		})
+	}
+}
+
+func TestAdd(t *testing.T) {
+	now := time.Now()
+	cases := []struct {
+		name string
+		q    *TestGroupQueue
+		tg   *configpb.TestGroup
+		when time.Time
+
+		next []*configpb.TestGroup
+		err  bool
+	}{
+		{
+			name: "add",
+			q:    &TestGroupQueue{},
+			tg: &configpb.TestGroup{
+				Name: "hi",
+			},
+			when: now,
+			next: []*configpb.TestGroup{
+				{
+					Name: "hi",
+				},
+			},
+		},
+		{
+			name: "update keeps schedule",
+			q: func() *TestGroupQueue {
+				var q TestGroupQueue
+				q.Init([]*configpb.TestGroup{
+					{
+						Name: "hi",
+					},
+					{
+						Name: "there",
+					},
+				}, now)
+				q.Fix("there", now.Add(-time.Minute))
+				return &q
+			}(),
+			tg: &configpb.TestGroup{
+				Name:             "hi",
+				DaysOfResults:    7,
+				GcsPrefix:        "new",
+				NumColumnsRecent: 3,
+			},
+			when: now.Add(-time.Hour),
+			next: []*configpb.TestGroup{
+				{
+					Name: "there",
+				},
+				{
+					Name:             "hi",
+					DaysOfResults:    7,
+					GcsPrefix:        "new",
+					NumColumnsRecent: 3,
+				},
+			},
+		},
+		{
+			name: "invalid",
+			q:    &TestGroupQueue{},
+			tg:   &configpb.TestGroup{},
+			err:  true,
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			if err := tc.q.Add(tc.tg, tc.when); (err != nil) != tc.err {
+				t.Errorf("Add() got unexpected error %v, wanted err=%t", err, tc.err)
+			}
+			var got []*configpb.TestGroup
+			for tc.q.queue.Len() > 0 {
+				got = append(got, heap.Pop(&tc.q.queue).(*item).tg)
+			}
+			if diff := cmp.Diff(tc.next, got, protocmp.Transform()); diff != "" {
+				t.Errorf("Add() got unexpected diff (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestAddIfAbsent(t *testing.T) {
+	now := time.Now()
+	cases := []struct {
+		name string
+		q    *TestGroupQueue
+		tg   *configpb.TestGroup
+		when time.Time
+
+		added bool
+		next  []*configpb.TestGroup
+	}{
+		{
+			name: "add",
+			q:    &TestGroupQueue{},
+			tg: &configpb.TestGroup{
+				Name: "hi",
+			},
+			when:  now,
+			added: true,
+			next: []*configpb.TestGroup{
+				{
+					Name: "hi",
+				},
+			},
+		},
+		{
+			name: "existing group untouched",
+			q: func() *TestGroupQueue {
+				var q TestGroupQueue
+				q.Init([]*configpb.TestGroup{
+					{
+						Name: "hi",
+					},
+					{
+						Name: "there",
+					},
+				}, now)
+				q.Fix("there", now.Add(-time.Minute))
+				return &q
+			}(),
+			tg: &configpb.TestGroup{
+				Name:          "hi",
+				DaysOfResults: 7,
+			},
+			when: now.Add(-time.Hour),
+			next: []*configpb.TestGroup{
+				{
+					Name: "there",
+				},
+				{
+					Name: "hi",
+				},
+			},
+		},
+		{
+			name: "invalid",
+			q:    &TestGroupQueue{},
+			tg:   &configpb.TestGroup{},
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			if added := tc.q.AddIfAbsent(tc.tg, tc.when); added != tc.added {
+				t.Errorf("AddIfAbsent() got %t, want %t", added, tc.added)
+			}
+			var got []*configpb.TestGroup
+			for tc.q.queue.Len() > 0 {
+				got = append(got, heap.Pop(&tc.q.queue).(*item).tg)
+			}
+			if diff := cmp.Diff(tc.next, got, protocmp.Transform()); diff != "" {
+				t.Errorf("AddIfAbsent() got unexpected diff (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestOverdue(t *testing.T) {
+	now := time.Now()
+	cases := []struct {
+		name  string
+		whens []time.Duration
+
+		count  int
+		behind time.Duration
+	}{
+		{
+			name: "empty",
+		},
+		{
+			name:  "none overdue",
+			whens: []time.Duration{time.Minute, 0, time.Hour},
+		},
+		{
+			name:   "some overdue",
+			whens:  []time.Duration{time.Minute, -time.Second, time.Hour, -time.Hour, -time.Minute},
+			count:  3,
+			behind: time.Hour,
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			var q TestGroupQueue
+			for i, d := range tc.whens {
+				q.Add(&configpb.TestGroup{Name: fmt.Sprintf("group-%d", i)}, now.Add(d))
+			}
+			count, behind := q.Overdue(now)
+			if count != tc.count {
+				t.Errorf("Overdue() wanted count %d, got %d", tc.count, count)
+			}
+			if behind != tc.behind {
+				t.Errorf("Overdue() wanted behind %s, got %s", tc.behind, behind)
+			}
+		})
+	}
+}
+
+func TestSendStats(t *testing.T) {
+	var q TestGroupQueue
+	q.Init([]*configpb.TestGroup{
+		{
+			Name: "hi",
+		},
+		{
+			Name: "there",
+		},
+	}, time.Now())
+	ch := make(chan *configpb.TestGroup, 2)
+	if err := q.Send(context.Background(), ch, 0); err != nil {
+		t.Fatalf("Send() got unexpected error: %v", err)
+	}
+	if want, got := int64(2), q.Stats().Delivered; want != got {
+		t.Errorf("Stats() wanted %d delivered, got %d", want, got)
+	}
+
+	q.Init([]*configpb.TestGroup{
+		{
+			Name: "hi",
+		},
+	}, time.Now())
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	blocked := make(chan *configpb.TestGroup)
+	q.Send(ctx, blocked, time.Hour)
+	if stats := q.Stats(); stats.Depth != 1 {
+		t.Errorf("Stats() wanted depth 1, got %d", stats.Depth)
+	}
+}
+
+func TestStatsCounters(t *testing.T) {
+	now := time.Date(2021, 1, 2, 3, 4, 5, 0, time.UTC)
+	clock := NewFakeClock(now)
+	q := NewTestGroupQueue(WithClock(clock))
+	q.Init([]*configpb.TestGroup{{Name: "a"}, {Name: "b"}, {Name: "c"}}, now)
+	q.Init([]*configpb.TestGroup{{Name: "a"}}, now)
+	q.Fix("a", now.Add(time.Minute))
+	q.Fix("a", now.Add(time.Minute)) // unchanged
+	q.FixAll(map[string]time.Time{"a": now.Add(-time.Minute)})
+	clock.Advance(time.Minute)
+
+	stats := q.Stats()
+	want := QueueStats{
+		Depth:    1,
+		Lag:      2 * time.Minute,
+		MaxDepth: 3,
+		Inits:    2,
+		Fixes:    2,
+		Skipped:  q.SkipStats(),
+	}
+	if diff := cmp.Diff(want, stats); diff != "" {
+		t.Errorf("Stats() got unexpected diff (-want +got):\n%s", diff)
+	}
+
+	stats.Skipped[SkipPaused]++
+	if got := q.SkipStats()[SkipPaused]; got != 0 {
+		t.Errorf("Stats() shares skips with the queue, got %d paused", got)
+	}
+}
+
+func TestSkipStats(t *testing.T) {
+	start := time.Date(2021, 1, 2, 3, 4, 5, 0, time.UTC)
+	cases := []struct {
+		name      string
+		groups    []*configpb.TestGroup
+		setup     func(*TestGroupQueue)
+		frequency time.Duration
+		advance   time.Duration // after each delivery
+		unacked   bool          // deliver through Send without acking
+		sleeps    bool
+		want      map[string]int
+	}{
+		{
+			name:   "none",
+			groups: []*configpb.TestGroup{{Name: "hi"}},
+			want: map[string]int{
+				SkipPaused:   0,
+				SkipSpacing:  0,
+				SkipInFlight: 0,
+				SkipCost:     0,
+				SkipSlow:     0,
+				SkipStale:    0,
+			},
+		},
+		{
+			name:   "paused",
+			groups: []*configpb.TestGroup{{Name: "hi"}, {Name: "there"}},
+			setup: func(q *TestGroupQueue) {
+				q.PauseMatching(func(tg *configpb.TestGroup) bool { return tg.Name == "hi" })
+			},
+			sleeps: true,
+			want: map[string]int{
+				SkipPaused:   1,
+				SkipSpacing:  0,
+				SkipInFlight: 0,
+				SkipCost:     0,
+				SkipSlow:     0,
+				SkipStale:    0,
+			},
+		},
+		{
+			name:   "spacing",
+			groups: []*configpb.TestGroup{{Name: "hi"}},
+			setup: func(q *TestGroupQueue) {
+				q.SetMinSpacing("hi", time.Hour)
+			},
+			frequency: time.Minute,
+			advance:   time.Minute,
+			sleeps:    true,
+			want: map[string]int{
+				SkipPaused:   0,
+				SkipSpacing:  1,
+				SkipInFlight: 0,
+				SkipCost:     0,
+				SkipSlow:     0,
+				SkipStale:    0,
+			},
+		},
+		{
+			name: "in-flight",
+			groups: []*configpb.TestGroup{
+				{Name: "hi", GcsPrefix: "bucket/hi"},
+				{Name: "there", GcsPrefix: "bucket/there"},
+			},
+			setup: func(q *TestGroupQueue) {
+				q.SetBucketLimits(map[string]int{"bucket": 1})
+			},
+			unacked: true,
+			sleeps:  true,
+			want: map[string]int{
+				SkipPaused:   0,
+				SkipSpacing:  0,
+				SkipInFlight: 1,
+				SkipCost:     0,
+				SkipSlow:     0,
+				SkipStale:    0,
+			},
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			clock := NewFakeClock(start)
+			q := NewTestGroupQueue(WithClock(clock))
+			q.Init(tc.groups, start)
+			if tc.setup != nil {
+				tc.setup(q)
+			}
+			ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+			defer cancel()
+			errCh := make(chan error, 1)
+			go func() {
+				if tc.unacked {
+					errCh <- q.Send(ctx, make(chan *configpb.TestGroup, len(tc.groups)), tc.frequency)
+					return
+				}
+				errCh <- q.SendFunc(ctx, func(context.Context, *configpb.TestGroup) error {
+					clock.Advance(tc.advance)
+					return nil
+				}, tc.frequency)
+			}()
+			if tc.sleeps {
+				if err := clock.BlockUntil(ctx, 1); err != nil {
+					t.Fatalf("Send() never slept: %v", err)
+				}
+				cancel()
+			}
+			if err := <-errCh; err != nil && err != context.Canceled {
+				t.Errorf("Send() got unexpected error: %v", err)
+			}
+			if diff := cmp.Diff(tc.want, q.SkipStats()); diff != "" {
+				t.Errorf("SkipStats() got unexpected diff (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestSendVirtualTime(t *testing.T) {
+	clock := NewFakeClock(time.Date(2021, 1, 2, 3, 4, 5, 0, time.UTC))
+	q := NewTestGroupQueue(WithClock(clock))
+	q.Init([]*configpb.TestGroup{
+		{
+			Name: "hi",
+		},
+		{
+			Name: "there",
+		},
+	}, clock.Now())
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	ch := make(chan *configpb.TestGroup, 100)
+	errs := make(chan error)
+	go func() {
+		errs <- q.Send(ctx, ch, 10*time.Minute)
+	}()
+
+	const steps = 6 // simulate an hour
+	for i := 0; i < steps; i++ {
+		if err := clock.BlockUntil(ctx, 1); err != nil {
+			t.Fatalf("BlockUntil() got unexpected error: %v", err)
+		}
+		if err := q.Advance(10 * time.Minute); err != nil {
+			t.Fatalf("Advance() got unexpected error: %v", err)
+		}
+	}
+	if err := clock.BlockUntil(ctx, 1); err != nil {
+		t.Fatalf("BlockUntil() got unexpected error: %v", err)
+	}
+	cancel()
+	q.rouse()
+	if err := <-errs; err != context.Canceled {
+		t.Errorf("Send() got unexpected error: %v", err)
+	}
+
+	counts := map[string]int{}
+	for len(ch) > 0 {
+		counts[(<-ch).Name]++
+	}
+	want := map[string]int{
+		"hi":    steps + 1,
+		"there": steps + 1,
+	}
+	if diff := cmp.Diff(want, counts); diff != "" {
+		t.Errorf("Send() got unexpected deliveries (-want +got):\n%s", diff)
+	}
+
+	if err := (&TestGroupQueue{}).Advance(time.Second); err == nil {
+		t.Error("Advance() wanted an error without a FakeClock")
+	}
+}
+
+func TestSendOrder(t *testing.T) {
+	start := time.Date(2021, 1, 2, 3, 4, 5, 0, time.UTC)
+	r := rand.New(rand.NewSource(1))
+	for trial := 0; trial < 100; trial++ {
+		clock := NewFakeClock(start.Add(time.Hour))
+		q := NewTestGroupQueue(WithClock(clock), WithOrderCheck())
+		n := 1 + r.Intn(50)
+		type sched struct {
+			name string
+			when time.Time
+		}
+		var want []sched
+		for i := 0; i < n; i++ {
+			s := sched{
+				name: fmt.Sprintf("group-%d", i),
+				when: start.Add(time.Duration(r.Intn(10)) * time.Minute), // plenty of ties
+			}
+			if err := q.Add(&configpb.TestGroup{Name: s.name}, s.when); err != nil {
+				t.Fatalf("Add() got unexpected error: %v", err)
+			}
+			want = append(want, s)
+		}
+		sort.SliceStable(want, func(i, j int) bool {
+			return want[i].when.Before(want[j].when)
+		})
+
+		ch := make(chan *configpb.TestGroup, n)
+		if err := q.Send(context.Background(), ch, 0); err != nil {
+			t.Fatalf("Send() got unexpected error: %v", err)
+		}
+		close(ch)
+		var got []string
+		for tg := range ch {
+			got = append(got, tg.Name)
+		}
+		var wantNames []string
+		for _, s := range want {
+			wantNames = append(wantNames, s.name)
+		}
+		if diff := cmp.Diff(wantNames, got); diff != "" {
+			t.Fatalf("trial %d: Send() got unexpected order (-want +got):\n%s", trial, diff)
+		}
+	}
+}
+
+func TestOrderCheck(t *testing.T) {
+	now := time.Now()
+	q := NewTestGroupQueue(WithOrderCheck())
+	q.Init([]*configpb.TestGroup{
+		{
+			Name: "hi",
+		},
+		{
+			Name: "there",
+		},
+	}, now.Add(-time.Minute))
+
+	// Fixing a group earlier is allowed.
+	if err := q.Fix("there", now.Add(-time.Hour)); err != nil {
+		t.Fatalf("Fix() got unexpected error: %v", err)
+	}
+	ch := make(chan *configpb.TestGroup, 2)
+	if err := q.Send(context.Background(), ch, 0); err != nil {
+		t.Fatalf("Send() got unexpected error: %v", err)
+	}
+
+	// Corrupt the queue by changing when without fixing the heap.
+	q.Init([]*configpb.TestGroup{
+		{
+			Name: "hi",
+		},
+		{
+			Name: "there",
+		},
+	}, now)
+	q.items["there"].when = now.Add(-time.Hour)
+	defer func() {
+		if r := recover(); r == nil {
+			t.Error("Send() wanted a panic when dispatching out of order")
+		}
+	}()
+	ch = make(chan *configpb.TestGroup, 2)
+	q.Send(context.Background(), ch, 0)
+}
+
+func TestGranularity(t *testing.T) {
+	start := time.Date(2021, 1, 2, 3, 4, 5, 0, time.UTC)
+	names := []string{"a", "b", "c", "d"}
+	cases := []struct {
+		name        string
+		granularity time.Duration
+		same        bool
+	}{
+		{
+			name: "exact",
+		},
+		{
+			name:        "seconds",
+			granularity: time.Second,
+			same:        true,
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			dispatch := func(jitter []time.Duration) []string {
+				clock := NewFakeClock(start)
+				q := NewTestGroupQueue(WithClock(clock), WithGranularity(tc.granularity))
+				for i, name := range names {
+					if err := q.Add(&configpb.TestGroup{Name: name}, start.Add(jitter[i])); err != nil {
+						t.Fatalf("Add() got unexpected error: %v", err)
+					}
+				}
+				clock.Advance(time.Minute)
+				ch := make(chan *configpb.TestGroup, len(names))
+				if err := q.Send(context.Background(), ch, 0); err != nil {
+					t.Fatalf("Send() got unexpected error: %v", err)
+				}
+				close(ch)
+				var got []string
+				for tg := range ch {
+					got = append(got, tg.Name)
+				}
+				return got
+			}
+
+			// Each machine reads the time with slightly different delays.
+			first := dispatch([]time.Duration{5, 2, 9, 1})
+			second := dispatch([]time.Duration{1, 7, 3, 8})
+			if diff := cmp.Diff(first, second); (diff == "") != tc.same {
+				t.Errorf("Send() wanted same=%t, got diff (-first +second):\n%s", tc.same, diff)
+			}
+			if tc.same {
+				if diff := cmp.Diff(names, first); diff != "" {
+					t.Errorf("Send() wanted groups in the order added (-want +got):\n%s", diff)
+				}
+			}
+		})
+	}
+}
+
+func TestGranularityFix(t *testing.T) {
+	start := time.Date(2021, 1, 2, 3, 4, 5, 0, time.UTC)
+	cases := []struct {
+		name        string
+		granularity time.Duration
+		want        []string
+	}{
+		{
+			name: "exact",
+			want: []string{"b", "a", "c"},
+		},
+		{
+			name:        "fixes within a window keep fifo order",
+			granularity: time.Second,
+			want:        []string{"a", "b", "c"},
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			clock := NewFakeClock(start)
+			q := NewTestGroupQueue(WithClock(clock), WithGranularity(tc.granularity))
+			q.Init([]*configpb.TestGroup{
+				{
+					Name: "c",
+				},
+				{
+					Name: "b",
+				},
+				{
+					Name: "a",
+				},
+			}, start)
+			for _, fix := range []struct {
+				name string
+				when time.Duration
+			}{
+				{"a", 1500 * time.Millisecond},
+				{"b", 1100 * time.Millisecond},
+				{"c", 1900 * time.Millisecond},
+				{"a", 1200 * time.Millisecond},
+			} {
+				if err := q.Fix(fix.name, start.Add(fix.when)); err != nil {
+					t.Fatalf("Fix(%s) got unexpected error: %v", fix.name, err)
+				}
+			}
+			clock.Advance(time.Minute)
+			ch := make(chan *configpb.TestGroup, 3)
+			if err := q.Send(context.Background(), ch, 0); err != nil {
+				t.Fatalf("Send() got unexpected error: %v", err)
+			}
+			close(ch)
+			var got []string
+			for tg := range ch {
+				got = append(got, tg.Name)
+			}
+			if diff := cmp.Diff(tc.want, got); diff != "" {
+				t.Errorf("Send() got unexpected order (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestMerge(t *testing.T) {
+	now := time.Now()
+	cases := []struct {
+		name   string
+		q      *TestGroupQueue
+		groups []*configpb.TestGroup
+		when   time.Time
+
+		next []*configpb.TestGroup
+		err  bool
+	}{
+		{
+			name: "empty",
+			q:    &TestGroupQueue{},
+			groups: []*configpb.TestGroup{
+				{
+					Name: "hi",
+				},
+			},
+			when: now,
+			next: []*configpb.TestGroup{
+				{
+					Name: "hi",
+				},
+			},
+		},
+		{
+			name: "keep others",
+			q: func() *TestGroupQueue {
+				var q TestGroupQueue
+				q.Init([]*configpb.TestGroup{
+					{
+						Name: "keep",
+					},
+					{
+						Name: "update",
+					},
+				}, now)
+				return &q
+			}(),
+			groups: []*configpb.TestGroup{
+				{
+					Name:      "update",
+					GcsPrefix: "new",
+				},
+				{
+					Name: "add",
+				},
+			},
+			when: now.Add(-time.Minute),
+			next: []*configpb.TestGroup{
+				{
+					Name: "add",
+				},
+				{
+					Name: "keep",
+				},
+				{
+					Name:      "update",
+					GcsPrefix: "new",
+				},
+			},
+		},
+		{
+			name: "invalid",
+			q:    &TestGroupQueue{},
+			groups: []*configpb.TestGroup{
+				{},
+				{
+					Name: "valid",
+				},
+			},
+			when: now,
+			next: []*configpb.TestGroup{
+				{
+					Name: "valid",
+				},
+			},
+			err: true,
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			if err := tc.q.Merge(tc.groups, tc.when); (err != nil) != tc.err {
+				t.Errorf("Merge() got unexpected error %v, wanted err=%t", err, tc.err)
+			}
+			var got []*configpb.TestGroup
+			for tc.q.queue.Len() > 0 {
+				got = append(got, heap.Pop(&tc.q.queue).(*item).tg)
+			}
+			if diff := cmp.Diff(tc.next, got, protocmp.Transform()); diff != "" {
+				t.Errorf("Merge() got unexpected diff (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
+
+type fakeMetrics struct {
+	lock  sync.Mutex
+	waits []time.Duration
+}
+
+func (m *fakeMetrics) ObserveReceiverWait(d time.Duration) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	m.waits = append(m.waits, d)
+}
+
+func TestReceiverWait(t *testing.T) {
+	var m fakeMetrics
+	q := NewTestGroupQueue(WithMetrics(&m))
+	q.Init([]*configpb.TestGroup{
+		{
+			Name: "hi",
+		},
+		{
+			Name: "there",
+		},
+	}, time.Now())
+
+	const delay = 20 * time.Millisecond
+	ch := make(chan *configpb.TestGroup)
+	go func() {
+		for range ch {
+			time.Sleep(delay) // slow receiver
+		}
+	}()
+	err := q.Send(context.Background(), ch, 0)
+	close(ch)
+	if err != nil {
+		t.Fatalf("Send() got unexpected error: %v", err)
+	}
+
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	if len(m.waits) != 2 {
+		t.Fatalf("ObserveReceiverWait() wanted 2 observations, got %v", m.waits)
+	}
+	if m.waits[1] < delay/2 {
+		t.Errorf("ObserveReceiverWait() wanted the second wait to reflect the slow receiver, got %s", m.waits[1])
+	}
+}
+
+func TestReceiverWaitClock(t *testing.T) {
+	now := time.Date(2021, 1, 2, 3, 4, 5, 0, time.UTC)
+	var m fakeMetrics
+	q := NewTestGroupQueue(WithMetrics(&m), WithClock(NewFakeClock(now)))
+	q.Init([]*configpb.TestGroup{
+		{
+			Name: "hi",
+		},
+		{
+			Name: "there",
+		},
+	}, now)
+
+	ch := make(chan *configpb.TestGroup, 2)
+	if err := q.Send(context.Background(), ch, 0); err != nil {
+		t.Fatalf("Send() got unexpected error: %v", err)
+	}
+
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	if diff := cmp.Diff([]time.Duration{0, 0}, m.waits); diff != "" {
+		t.Errorf("ObserveReceiverWait() got unexpected waits on a stopped clock (-want +got):\n%s", diff)
+	}
+}
+
+func TestSending(t *testing.T) {
+	cases := []struct {
+		name string
+		opts []QueueOption
+		err  error
+	}{
+		{
+			name: "reject second sender",
+			err:  ErrAlreadySending,
+		},
+		{
+			name: "allow multiple senders",
+			opts: []QueueOption{WithMultipleSenders()},
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			q := NewTestGroupQueue(tc.opts...)
+			q.Init([]*configpb.TestGroup{
+				{
+					Name: "hi",
+				},
+			}, time.Now().Add(time.Hour))
+			if q.Sending() {
+				t.Fatal("Sending() wanted false before Send")
+			}
+
+			ctx, cancel := context.WithCancel(context.Background())
+			ch := make(chan *configpb.TestGroup)
+			errs := make(chan error)
+			go func() {
+				errs <- q.Send(ctx, ch, time.Minute)
+			}()
+			for !q.Sending() {
+				time.Sleep(time.Millisecond)
+			}
+
+			second, secondCancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+			defer secondCancel()
+			err := q.Send(second, ch, time.Minute)
+			switch {
+			case tc.err != nil && err != tc.err:
+				t.Errorf("Send() wanted error %v, got %v", tc.err, err)
+			case tc.err == nil && err != second.Err():
+				t.Errorf("Send() wanted error %v, got %v", second.Err(), err)
+			}
+
+			cancel()
+			if err := <-errs; err != context.Canceled {
+				t.Errorf("Send() got unexpected error: %v", err)
+			}
+			if q.Sending() {
+				t.Error("Sending() wanted false after canceling Send")
+			}
+		})
+	}
+}
+
+func TestRemove(t *testing.T) {
+	var q TestGroupQueue
+	q.Init([]*configpb.TestGroup{
+		{
+			Name: "hi",
+		},
+		{
+			Name: "there",
+		},
+	}, time.Now())
+	if err := q.Remove("hi"); err != nil {
+		t.Errorf("Remove() got unexpected error: %v", err)
+	}
+	if err := q.Remove("hi"); err == nil {
+		t.Error("Remove() wanted an error for a missing group")
+	}
+	if depth, next, _ := q.Status(); depth != 1 || next.GetName() != "there" {
+		t.Errorf("Status() wanted only there, got depth %d and next %v", depth, next)
+	}
+}
+
+func TestSendFuncDelay(t *testing.T) {
+	start := time.Date(2021, 1, 2, 3, 4, 5, 0, time.UTC)
+	cases := []struct {
+		name      string
+		frequency time.Duration
+		handler   func(*TestGroupQueue) (time.Duration, error)
+
+		want    time.Time
+		missing bool
+		err     bool
+	}{
+		{
+			name:      "zero uses frequency",
+			frequency: 10 * time.Minute,
+			handler: func(*TestGroupQueue) (time.Duration, error) {
+				return 0, nil
+			},
+			want: start.Add(10 * time.Minute),
+		},
+		{
+			name:      "negative uses frequency",
+			frequency: 10 * time.Minute,
+			handler: func(*TestGroupQueue) (time.Duration, error) {
+				return -time.Hour, nil
+			},
+			want: start.Add(10 * time.Minute),
+		},
+		{
+			name:      "delay overrides frequency",
+			frequency: 10 * time.Minute,
+			handler: func(*TestGroupQueue) (time.Duration, error) {
+				return time.Hour, nil
+			},
+			want: start.Add(time.Hour),
+		},
+		{
+			name:      "delay overrides fix",
+			frequency: 10 * time.Minute,
+			handler: func(q *TestGroupQueue) (time.Duration, error) {
+				return time.Hour, q.Fix("hi", start.Add(5*time.Minute))
+			},
+			want: start.Add(time.Hour),
+		},
+		{
+			name:      "zero delay keeps fix",
+			frequency: 10 * time.Minute,
+			handler: func(q *TestGroupQueue) (time.Duration, error) {
+				return 0, q.Fix("hi", start.Add(5*time.Minute))
+			},
+			want: start.Add(5 * time.Minute),
+		},
+		{
+			name:      "error ignores delay",
+			frequency: 10 * time.Minute,
+			handler: func(*TestGroupQueue) (time.Duration, error) {
+				return time.Hour, errors.New("boom")
+			},
+			want: start.Add(10 * time.Minute),
+			err:  true,
+		},
+		{
+			name: "removed groups ignore delay",
+			handler: func(*TestGroupQueue) (time.Duration, error) {
+				return time.Hour, nil
+			},
+			missing: true,
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			clock := NewFakeClock(start)
+			q := NewTestGroupQueue(WithClock(clock))
+			q.Init([]*configpb.TestGroup{{Name: "hi"}, {Name: "there"}}, start)
+			ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+			defer cancel()
+			err := q.SendFuncDelay(ctx, func(_ context.Context, tg *configpb.TestGroup) (time.Duration, error) {
+				if tg.Name == "hi" {
+					return tc.handler(q)
+				}
+				cancel()
+				return 0, nil
+			}, tc.frequency)
+			switch {
+			case tc.err && err == nil:
+				t.Error("SendFuncDelay() wanted an error")
+			case !tc.err && err != nil && err != context.Canceled:
+				t.Errorf("SendFuncDelay() got unexpected error: %v", err)
+			}
+			got, err := q.When("hi")
+			switch {
+			case tc.missing:
+				if err == nil {
+					t.Errorf("When() got %v, wanted an error", got)
+				}
+			case err != nil:
+				t.Errorf("When() got unexpected error: %v", err)
+			case !got.Equal(tc.want):
+				t.Errorf("When() got %v, want %v", got, tc.want)
+			}
+		})
+	}
+}
+
+func TestSetFrequency(t *testing.T) {
+	start := time.Date(2021, 1, 2, 3, 4, 5, 0, time.UTC)
+	cases := []struct {
+		name      string
+		frequency time.Duration
+		handler   func(*TestGroupQueue, *FakeClock, string, int) bool // false to cancel
+
+		want     []string
+		whens    map[string]time.Time
+		canceled bool
+	}{
+		{
+			name:      "recur to drain",
+			frequency: time.Hour,
+			handler: func(q *TestGroupQueue, clock *FakeClock, name string, n int) bool {
+				switch n {
+				case 0:
+					q.SetFrequency(0)
+				case 1:
+					clock.Advance(time.Hour)
+				}
+				return true
+			},
+			want:  []string{"hi", "there", "hi"},
+			whens: map[string]time.Time{},
+		},
+		{
+			name: "drain to recur",
+			handler: func(q *TestGroupQueue, _ *FakeClock, name string, n int) bool {
+				if n == 0 {
+					q.SetFrequency(time.Hour)
+				}
+				return n == 0
+			},
+			want: []string{"hi", "there"},
+			whens: map[string]time.Time{
+				"there": start.Add(time.Hour),
+			},
+			canceled: true,
+		},
+		{
+			name:      "retune",
+			frequency: time.Hour,
+			handler: func(q *TestGroupQueue, _ *FakeClock, name string, n int) bool {
+				if n == 0 {
+					q.SetFrequency(10 * time.Minute)
+				}
+				return n == 0
+			},
+			want: []string{"hi", "there"},
+			whens: map[string]time.Time{
+				"hi":    start.Add(time.Hour),
+				"there": start.Add(10 * time.Minute),
+			},
+			canceled: true,
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			clock := NewFakeClock(start)
+			q := NewTestGroupQueue(WithClock(clock))
+			q.Init([]*configpb.TestGroup{{Name: "hi"}, {Name: "there"}}, start)
+			ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+			defer cancel()
+			var got []string
+			err := q.SendFunc(ctx, func(_ context.Context, tg *configpb.TestGroup) error {
+				if !tc.handler(q, clock, tg.Name, len(got)) {
+					cancel()
+				}
+				got = append(got, tg.Name)
+				return nil
+			}, tc.frequency)
+			switch {
+			case tc.canceled && err != context.Canceled:
+				t.Errorf("SendFunc() got %v, want %v", err, context.Canceled)
+			case !tc.canceled && err != nil:
+				t.Errorf("SendFunc() got unexpected error: %v", err)
+			}
+			if diff := cmp.Diff(tc.want, got); diff != "" {
+				t.Errorf("SendFunc() got unexpected diff (-want +got):\n%s", diff)
+			}
+			whens := map[string]time.Time{}
+			for _, it := range q.Items() {
+				whens[it.Name] = it.When
+			}
+			if diff := cmp.Diff(tc.whens, whens); diff != "" {
+				t.Errorf("Items() got unexpected diff (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestPopAll(t *testing.T) {
+	now := time.Date(2021, 1, 2, 3, 4, 5, 0, time.UTC)
+	cases := []struct {
+		name  string
+		whens []QueueItem
+		want  []string
+	}{
+		{
+			name: "empty",
+			want: []string{},
+		},
+		{
+			name: "mixed",
+			whens: []QueueItem{
+				{Name: "future", When: now.Add(time.Hour)},
+				{Name: "now", When: now},
+				{Name: "past", When: now.Add(-time.Hour)},
+				{Name: "soon", When: now.Add(time.Minute)},
+				{Name: "recent", When: now.Add(-time.Minute)},
+			},
+			want: []string{"past", "recent", "now", "soon", "future"},
+		},
+		{
+			name: "ties keep the order added",
+			whens: []QueueItem{
+				{Name: "b", When: now},
+				{Name: "later", When: now.Add(time.Second)},
+				{Name: "c", When: now},
+				{Name: "a", When: now},
+			},
+			want: []string{"b", "c", "a", "later"},
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			var q TestGroupQueue
+			for _, w := range tc.whens {
+				if err := q.Add(&configpb.TestGroup{Name: w.Name}, w.When); err != nil {
+					t.Fatalf("Add() got unexpected error: %v", err)
+				}
+			}
+			got := []string{}
+			for _, tg := range q.PopAll() {
+				got = append(got, tg.Name)
+			}
+			if diff := cmp.Diff(tc.want, got); diff != "" {
+				t.Errorf("PopAll() got unexpected diff (-want +got):\n%s", diff)
+			}
+			if !q.Empty() {
+				t.Errorf("PopAll() left %d groups", q.Len())
+			}
+		})
+	}
+}
+
+func TestPopAllWhileSending(t *testing.T) {
+	var q TestGroupQueue
+	var tgs []*configpb.TestGroup
+	for i := 0; i < 100; i++ {
+		tgs = append(tgs, &configpb.TestGroup{Name: fmt.Sprintf("group-%d", i)})
+	}
+	q.Init(tgs, time.Now())
+
+	ch := make(chan *configpb.TestGroup)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	errCh := make(chan error, 1)
+	go func() {
+		errCh <- q.Send(ctx, ch, 0)
+	}()
+	seen := map[string]int{}
+	for i := 0; i < 10; i++ {
+		seen[(<-ch).Name]++
+	}
+	for _, tg := range q.PopAll() {
+		seen[tg.Name]++
+	}
+	select {
+	case tg := <-ch: // Send may have dispatched one more before PopAll
+		seen[tg.Name]++
+	case <-time.After(100 * time.Millisecond):
+	}
+	cancel()
+	if err := <-errCh; err != nil && err != context.Canceled {
+		t.Errorf("Send() got unexpected error: %v", err)
+	}
+
+	if len(seen) != len(tgs) {
+		t.Errorf("got %d groups, want %d", len(seen), len(tgs))
+	}
+	for name, n := range seen {
+		if n != 1 {
+			t.Errorf("got %s %d times, want once", name, n)
+		}
+	}
+}
+
+func TestDuplicatePush(t *testing.T) {
+	now := time.Date(2021, 1, 2, 3, 4, 5, 0, time.UTC)
+	var q TestGroupQueue
+	q.Init([]*configpb.TestGroup{
+		{Name: "hi"},
+		{Name: "there"},
+		{Name: "world"},
+	}, now)
+	q.Fix("world", now.Add(-time.Minute))
+	q.Fix("hi", now.Add(time.Minute))
+
+	for _, it := range append(priorityQueue(nil), q.queue...) {
+		heap.Push(&q.queue, it)
+	}
+	if err := q.Add(&configpb.TestGroup{Name: "there"}, now.Add(-time.Hour)); err != nil {
+		t.Fatalf("Add() got unexpected error: %v", err)
+	}
+
+	if n := len(q.queue); n != 3 {
+		t.Errorf("queue got %d items after duplicate pushes, want 3", n)
+	}
+	for i, it := range q.queue {
+		if it.index != i {
+			t.Errorf("queue[%d] got index %d", i, it.index)
+		}
+		if i > 0 && less(it, q.queue[(i-1)/2]) {
+			t.Errorf("queue[%d] %s precedes its parent", i, it.tg.Name)
+		}
+	}
+	var got []string
+	for _, tg := range q.PopAll() {
+		got = append(got, tg.Name)
+	}
+	if diff := cmp.Diff([]string{"world", "there", "hi"}, got); diff != "" {
+		t.Errorf("PopAll() got unexpected diff (-want +got):\n%s", diff)
+	}
+}
+
+func TestRemoveReleasesGroups(t *testing.T) {
+	cases := []struct {
+		name   string
+		remove func(*TestGroupQueue) error
+		gone   []string
+	}{
+		{
+			name: "remove",
+			remove: func(q *TestGroupQueue) error {
+				return q.Remove("there")
+			},
+			gone: []string{"there"},
+		},
+		{
+			name: "init shrink",
+			remove: func(q *TestGroupQueue) error {
+				return q.Init([]*configpb.TestGroup{{Name: "world"}}, time.Now())
+			},
+			gone: []string{"hi", "there"},
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			var q TestGroupQueue
+			q.Init([]*configpb.TestGroup{
+				{Name: "hi"},
+				{Name: "there"},
+				{Name: "world"},
+			}, time.Now())
+			retained := map[string]*item{}
+			for _, it := range q.queue {
+				retained[it.tg.Name] = it
+			}
+
+			if err := tc.remove(&q); err != nil {
+				t.Fatalf("remove got unexpected error: %v", err)
+			}
+
+			for _, name := range tc.gone {
+				if _, ok := q.items[name]; ok {
+					t.Errorf("items still contains %q", name)
+				}
+				if tg := retained[name].tg; tg != nil {
+					t.Errorf("removed item still references %v", tg)
+				}
+			}
+			for i, it := range q.queue[:cap(q.queue)] {
+				if i >= len(q.queue) && it != nil {
+					t.Errorf("queue slot %d beyond length still references %q", i, it.tg.GetName())
+				}
+			}
+			if tg := retained["world"].tg; tg.GetName() != "world" {
+				t.Errorf("remaining item references %v, want world", tg)
+			}
+		})
+	}
+}
+
+func TestSendFunc(t *testing.T) {
+	start := time.Date(2021, 1, 2, 3, 4, 5, 0, time.UTC)
+	cases := []struct {
+		name    string
+		handler func(*TestGroupQueue, *configpb.TestGroup) error
+
+		want  []string
+		depth int
+		err   bool
+	}{
+		{
+			name: "basic",
+			handler: func(*TestGroupQueue, *configpb.TestGroup) error {
+				return nil
+			},
+			want: []string{"hi", "there"},
+		},
+		{
+			name: "requeue current group",
+			handler: func() func(*TestGroupQueue, *configpb.TestGroup) error {
+				var requeued bool
+				return func(q *TestGroupQueue, tg *configpb.TestGroup) error {
+					if tg.Name == "hi" && !requeued {
+						requeued = true
+						return q.Add(tg, start)
+					}
+					return nil
+				}
+			}(),
+			want: []string{"hi", "there", "hi"},
+		},
+		{
+			name: "remove other group",
+			handler: func(q *TestGroupQueue, tg *configpb.TestGroup) error {
+				return q.Remove("there")
+			},
+			want: []string{"hi"},
+		},
+		{
+			name: "error",
+			handler: func(q *TestGroupQueue, tg *configpb.TestGroup) error {
+				q.Status()
+				return errors.New("boom")
+			},
+			want:  []string{"hi"},
+			depth: 1,
+			err:   true,
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			clock := NewFakeClock(start)
+			q := NewTestGroupQueue(WithClock(clock))
+			q.Init([]*configpb.TestGroup{
+				{
+					Name: "hi",
+				},
+				{
+					Name: "there",
+				},
+			}, start)
+			ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+			defer cancel()
+			var got []string
+			err := q.SendFunc(ctx, func(_ context.Context, tg *configpb.TestGroup) error {
+				got = append(got, tg.Name)
+				return tc.handler(q, tg)
+			}, 0)
+			if (err != nil) != tc.err {
+				t.Errorf("SendFunc() got unexpected error %v, wanted err=%t", err, tc.err)
+			}
+			if diff := cmp.Diff(tc.want, got); diff != "" {
+				t.Errorf("SendFunc() got unexpected diff (-want +got):\n%s", diff)
+			}
+			if depth := q.Len(); depth != tc.depth {
+				t.Errorf("Len() wanted %d, got %d", tc.depth, depth)
+			}
+		})
+	}
+}
+
+func TestFlush(t *testing.T) {
+	start := time.Date(2021, 1, 2, 3, 4, 5, 0, time.UTC)
+	groups := []*configpb.TestGroup{
+		{
+			Name: "hi",
+		},
+		{
+			Name: "there",
+		},
+		{
+			Name: "later",
+		},
+	}
+	cases := []struct {
+		name      string
+		frequency time.Duration
+
+		want  []string
+		depth int
+	}{
+		{
+			name:  "pop",
+			want:  []string{"hi", "there"},
+			depth: 1,
+		},
+		{
+			name:      "reschedule",
+			frequency: time.Hour,
+			want:      []string{"hi", "there"},
+			depth:     3,
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			clock := NewFakeClock(start)
+			q := NewTestGroupQueue(WithClock(clock))
+			q.Init(groups, start)
+			q.Fix("later", start.Add(time.Minute))
+
+			ctx := context.Background()
+			if tc.frequency > 0 { // Pretend Send is active
+				if err := q.register(tc.frequency); err != nil {
+					t.Fatalf("register() got unexpected error: %v", err)
+				}
+				defer q.unregister()
+			}
+
+			ch := make(chan *configpb.TestGroup, len(groups))
+			n, err := q.Flush(ctx, ch)
+			if err != nil {
+				t.Fatalf("Flush() got unexpected error: %v", err)
+			}
+			close(ch)
+			var got []string
+			for tg := range ch {
+				got = append(got, tg.Name)
+			}
+			if n != len(got) {
+				t.Errorf("Flush() returned %d, but delivered %d", n, len(got))
+			}
+			if diff := cmp.Diff(tc.want, got); diff != "" {
+				t.Errorf("Flush() got unexpected diff (-want +got):\n%s", diff)
+			}
+			if depth := q.Len(); depth != tc.depth {
+				t.Errorf("Len() wanted %d, got %d", tc.depth, depth)
+			}
+		})
+	}
+}
+
+func TestFixAllProto(t *testing.T) {
+	start := time.Date(2021, 1, 2, 3, 4, 5, 0, time.UTC)
+	cases := []struct {
+		name  string
+		whens map[string]*timestamppb.Timestamp
+
+		next []string
+		errs int
+	}{
+		{
+			name: "empty",
+			next: []string{"first", "second", "third"},
+		},
+		{
+			name: "valid",
+			whens: map[string]*timestamppb.Timestamp{
+				"first": timestamppb.New(start.Add(time.Hour)),
+				"third": timestamppb.New(start.Add(-time.Hour)),
+			},
+			next: []string{"third", "second", "first"},
+		},
+		{
+			name: "nil skipped",
+			whens: map[string]*timestamppb.Timestamp{
+				"first":  nil,
+				"second": timestamppb.New(start.Add(time.Hour)),
+			},
+			next: []string{"first", "third", "second"},
+		},
+		{
+			name: "invalid",
+			whens: map[string]*timestamppb.Timestamp{
+				"first":  {Seconds: start.Unix(), Nanos: -1},
+				"second": {},
+				"third":  timestamppb.New(start.Add(2 * MaxProtoDelay)),
+				"valid":  timestamppb.New(start.Add(-time.Hour)),
+			},
+			next: []string{"first", "second", "third"},
+			errs: 4, // 3 invalid + 1 missing
+		},
+		{
+			name: "missing",
+			whens: map[string]*timestamppb.Timestamp{
+				"second":  timestamppb.New(start.Add(-time.Hour)),
+				"missing": timestamppb.New(start),
+			},
+			next: []string{"second", "first", "third"},
+			errs: 1,
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			q := NewTestGroupQueue(WithClock(NewFakeClock(start)))
+			q.Init([]*configpb.TestGroup{
+				{
+					Name: "first",
+				},
+				{
+					Name: "second",
+				},
+				{
+					Name: "third",
+				},
+			}, start)
+			var errs int
+			if err := q.FixAllProto(tc.whens); err != nil {
+				errs = len(err.(*multierror.Error).Errors)
+			}
+			if errs != tc.errs {
+				t.Errorf("FixAllProto() wanted %d errors, got %d", tc.errs, errs)
+			}
+			var got []string
+			for q.queue.Len() > 0 {
+				got = append(got, heap.Pop(&q.queue).(*item).tg.Name)
+			}
+			if diff := cmp.Diff(tc.next, got); diff != "" {
+				t.Errorf("FixAllProto() got unexpected diff (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestSleepDeadline(t *testing.T) {
+	start := time.Date(2021, 1, 2, 3, 4, 5, 0, time.UTC)
+	clock := NewFakeClock(start)
+	q := NewTestGroupQueue(WithClock(clock))
+	q.Init([]*configpb.TestGroup{
+		{
+			Name: "hi",
+		},
+	}, start.Add(time.Hour))
+	if q.IsSleeping() {
+		t.Error("IsSleeping() wanted false before Send")
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	errs := make(chan error)
+	go func() {
+		errs <- q.Send(ctx, make(chan *configpb.TestGroup, 1), time.Hour)
+	}()
+	if err := clock.BlockUntil(ctx, 1); err != nil {
+		t.Fatalf("BlockUntil() got unexpected error: %v", err)
+	}
+	for !q.IsSleeping() {
+		time.Sleep(time.Millisecond)
+	}
+	when, ok := q.SleepDeadline()
+	if !ok || !when.Equal(start.Add(time.Hour)) {
+		t.Errorf("SleepDeadline() wanted %v, true, got %v, %t", start.Add(time.Hour), when, ok)
+	}
+
+	cancel()
+	<-errs
+	if q.IsSleeping() {
+		t.Error("IsSleeping() wanted false after Send returns")
+	}
+	if _, ok := q.SleepDeadline(); ok {
+		t.Error("SleepDeadline() wanted false after Send returns")
+	}
+}
+
+func TestItems(t *testing.T) {
+	now := time.Date(2021, 1, 2, 3, 4, 5, 0, time.UTC)
+	q := NewTestGroupQueue(WithClock(NewFakeClock(now)))
+	q.Init([]*configpb.TestGroup{
+		{
+			Name: "hi",
+		},
+		{
+			Name: "there",
+		},
+		{
+			Name: "world",
+		},
+	}, now)
+	if err := q.Fix("hi", now.Add(time.Hour)); err != nil {
+		t.Fatalf("Fix() got unexpected error: %v", err)
+	}
+	want := []QueueItem{
+		{Name: "there", When: now},
+		{Name: "world", When: now},
+		{Name: "hi", When: now.Add(time.Hour)},
+	}
+	if diff := cmp.Diff(want, q.Items()); diff != "" {
+		t.Errorf("Items() got unexpected diff (-want +got):\n%s", diff)
+	}
+	if when, err := q.When("hi"); err != nil || !when.Equal(now.Add(time.Hour)) {
+		t.Errorf("When() got %v, %v, want %v", when, err, now.Add(time.Hour))
+	}
+	if _, err := q.When("missing"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("When() got %v, want ErrNotFound", err)
+	}
+}
+
+func TestPrioritize(t *testing.T) {
+	now := time.Date(2021, 1, 2, 3, 4, 5, 0, time.UTC)
+	cases := []struct {
+		name  string
+		whens map[string]time.Time
+		group string
+		want  time.Time
+		err   error
+	}{
+		{
+			name: "future group becomes due",
+			whens: map[string]time.Time{
+				"hi":    now.Add(time.Hour),
+				"there": now.Add(2 * time.Hour),
+			},
+			group: "there",
+			want:  now,
+		},
+		{
+			name: "jump ahead of overdue groups",
+			whens: map[string]time.Time{
+				"hi":    now.Add(-time.Hour),
+				"there": now,
+			},
+			group: "there",
+			want:  now.Add(-time.Hour - time.Nanosecond),
+		},
+		{
+			name: "jump ahead of a tie",
+			whens: map[string]time.Time{
+				"hi":    now,
+				"there": now,
+			},
+			group: "there",
+			want:  now.Add(-time.Nanosecond),
+		},
+		{
+			name: "already first",
+			whens: map[string]time.Time{
+				"hi":    now.Add(-time.Hour),
+				"there": now,
+			},
+			group: "hi",
+			want:  now.Add(-time.Hour),
+		},
+		{
+			name: "missing",
+			whens: map[string]time.Time{
+				"hi": now,
+			},
+			group: "missing",
+			err:   ErrNotFound,
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			q := NewTestGroupQueue(WithClock(NewFakeClock(now)))
+			q.Init([]*configpb.TestGroup{
+				{
+					Name: "hi",
+				},
+				{
+					Name: "there",
+				},
+			}, now)
+			if err := q.FixAll(tc.whens); err != nil {
+				t.Fatalf("FixAll() got unexpected error: %v", err)
+			}
+			got, err := q.Prioritize(tc.group)
+			if !errors.Is(err, tc.err) {
+				t.Fatalf("Prioritize() got error %v, want %v", err, tc.err)
+			}
+			if err != nil {
+				return
+			}
+			if !got.Equal(tc.want) {
+				t.Errorf("Prioritize() got %v, want %v", got, tc.want)
+			}
+			if _, next, _ := q.Status(); next.Name != tc.group {
+				t.Errorf("Status() got next %s, want %s", next.Name, tc.group)
+			}
+		})
+	}
+}
+
+func TestFixProto(t *testing.T) {
+	now := time.Date(2021, 1, 2, 3, 4, 5, 0, time.UTC)
+	cases := []struct {
+		name  string
+		group string
+		when  *timestamppb.Timestamp
+		want  time.Time
+		err   error
+	}{
+		{
+			name:  "basic",
+			group: "hi",
+			when:  timestamppb.New(now.Add(time.Hour)),
+			want:  now.Add(time.Hour),
+		},
+		{
+			name:  "missing group",
+			group: "there",
+			when:  timestamppb.New(now.Add(time.Hour)),
+			err:   ErrNotFound,
+		},
+		{
+			name:  "nil",
+			group: "hi",
+			err:   ErrInvalidTime,
+		},
+		{
+			name:  "epoch",
+			group: "hi",
+			when:  &timestamppb.Timestamp{},
+			err:   ErrInvalidTime,
+		},
+		{
+			name:  "far future",
+			group: "hi",
+			when:  timestamppb.New(now.Add(2 * MaxProtoDelay)),
+			err:   ErrInvalidTime,
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			q := NewTestGroupQueue(WithClock(NewFakeClock(now)))
+			q.Init([]*configpb.TestGroup{
+				{
+					Name: "hi",
+				},
+			}, now)
+			err := q.FixProto(tc.group, tc.when)
+			if !errors.Is(err, tc.err) {
+				t.Fatalf("FixProto() got error %v, want %v", err, tc.err)
+			}
+			if err != nil {
+				return
+			}
+			if got, _ := q.When(tc.group); !got.Equal(tc.want) {
+				t.Errorf("FixProto() got %v, want %v", got, tc.want)
+			}
+		})
+	}
+}
+
+func TestSendCancelDrain(t *testing.T) {
+	now := time.Now()
+	var q TestGroupQueue
+	q.Init([]*configpb.TestGroup{
+		{
+			Name: "hi",
+		},
+		{
+			Name: "there",
+		},
+	}, now)
+	if err := q.Fix("there", now.Add(time.Second)); err != nil {
+		t.Fatalf("Fix() got unexpected error: %v", err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	receivers := make(chan *configpb.TestGroup)
+	sent := make(chan error)
+	go func() {
+		sent <- q.Send(ctx, receivers, 0)
+	}()
+	for {
+		if q.Len() == 1 {
+			break // hi is popped and waiting for a receiver
+		}
+		time.Sleep(time.Millisecond)
+	}
+	cancel()
+	if err := <-sent; err != context.Canceled {
+		t.Fatalf("Send() got %v, want %v", err, context.Canceled)
+	}
+
+	if depth, next, when := q.Status(); depth != 2 || next.GetName() != "hi" || !when.Equal(now) {
+		t.Errorf("Status() got depth %d, next %v at %v, want hi at %v first of 2", depth, next, when, now)
+	}
+	if got := q.Stats().Requeued; got != 1 {
+		t.Errorf("Stats() got %d requeued, want 1", got)
+	}
+
+	ctx, cancel = context.WithCancel(context.Background())
+	defer cancel()
+	go func() {
+		sent <- q.Send(ctx, receivers, 0)
+	}()
+	var got []string
+	for i := 0; i < 2; i++ {
+		got = append(got, (<-receivers).Name)
+	}
+	if err := <-sent; err != nil {
+		t.Errorf("Send() got unexpected error: %v", err)
+	}
+	if diff := cmp.Diff([]string{"hi", "there"}, got); diff != "" {
+		t.Errorf("Send() got unexpected diff (-want +got):\n%s", diff)
+	}
+}
+
+func TestLen(t *testing.T) {
+	var q TestGroupQueue
+	if n, empty := q.Len(), q.Empty(); n != 0 || !empty {
+		t.Errorf("Len() and Empty() got %d and %t for a zero queue, want 0 and true", n, empty)
+	}
+	q.Init([]*configpb.TestGroup{
+		{
+			Name: "hi",
+		},
+		{
+			Name: "there",
+		},
+	}, time.Now())
+	if n, empty := q.Len(), q.Empty(); n != 2 || empty {
+		t.Errorf("Len() and Empty() got %d and %t, want 2 and false", n, empty)
+	}
+}
+
+func TestStatusCopies(t *testing.T) {
+	cases := []struct {
+		name   string
+		opts   []QueueOption
+		shared bool
+	}{
+		{
+			name:   "default shares the group",
+			shared: true,
+		},
+		{
+			name: "copies",
+			opts: []QueueOption{WithStatusCopies()},
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			tg := &configpb.TestGroup{
+				Name:          "hi",
+				DaysOfResults: 7,
+			}
+			q := NewTestGroupQueue(tc.opts...)
+			q.Init([]*configpb.TestGroup{tg}, time.Now())
+
+			_, next, _ := q.Status()
+			if diff := cmp.Diff(tg, next, protocmp.Transform()); diff != "" {
+				t.Fatalf("Status() got unexpected diff (-want +got):\n%s", diff)
+			}
+			next.DaysOfResults = 1
+			_, again, _ := q.Status()
+			if shared := again.DaysOfResults == 1; shared != tc.shared {
+				t.Errorf("Status() wanted shared=%t, got %t", tc.shared, shared)
+			}
+			if !tc.shared && tg.DaysOfResults != 7 {
+				t.Errorf("Status() allowed modifying the queued group: %v", tg)
+			}
+		})
+	}
+}
+
+func TestInitStorm(t *testing.T) {
+	start := time.Date(2021, 1, 2, 3, 4, 5, 0, time.UTC)
+	clock := NewFakeClock(start)
+	q := NewTestGroupQueue(WithClock(clock))
+	hook := logtest.NewGlobal()
+	defer hook.Reset()
+
+	count := func() (groups, warnings int) {
+		for _, e := range hook.AllEntries() {
+			switch {
+			case strings.HasPrefix(e.Message, "Init called"):
+				warnings++
+			case e.Message == "Adding group to queue", e.Message == "Removing group from queue":
+				groups++
+			}
+		}
+		hook.Reset()
+		return groups, warnings
+	}
+
+	reload := func(i int) {
+		q.Init([]*configpb.TestGroup{
+			{
+				Name: fmt.Sprintf("storm-%d", i),
+			},
+		}, start)
+	}
+
+	for i := 0; i < InitStormCalls; i++ {
+		reload(i)
+		clock.Advance(time.Second)
+	}
+	if groups, warnings := count(); groups != 2*InitStormCalls-1 || warnings != 0 {
+		t.Errorf("Init() got %d group logs and %d warnings before a storm, want %d and 0", groups, warnings, 2*InitStormCalls-1)
+	}
+
+	for i := InitStormCalls; i < 3*InitStormCalls; i++ {
+		reload(i)
+		clock.Advance(time.Second)
+	}
+	if groups, warnings := count(); groups != 0 || warnings != 1 {
+		t.Errorf("Init() got %d group logs and %d warnings during a storm, want 0 and 1", groups, warnings)
+	}
+
+	clock.Advance(InitStormWindow)
+	reload(-1)
+	if groups, warnings := count(); groups != 2 || warnings != 0 {
+		t.Errorf("Init() got %d group logs and %d warnings after a storm, want 2 and 0", groups, warnings)
+	}
+}
+
+func TestSendWindowed(t *testing.T) {
+	start := time.Date(2021, 1, 2, 3, 4, 5, 0, time.UTC)
+	clock := NewFakeClock(start)
+	q := NewTestGroupQueue(WithClock(clock))
+	whens := []struct {
+		name string
+		when time.Duration
+	}{
+		{"a", 5 * time.Second},
+		{"b", 45 * time.Second},
+		{"c", 85 * time.Second},
+		{"d", 175 * time.Second},
+	}
+	for _, w := range whens {
+		if err := q.Add(&configpb.TestGroup{Name: w.name}, start.Add(w.when)); err != nil {
+			t.Fatalf("Add() got unexpected error: %v", err)
+		}
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	receivers := make(chan []*configpb.TestGroup)
+	sent := make(chan error)
+	go func() {
+		sent <- q.SendWindowed(ctx, receivers, time.Minute)
+	}()
+
+	want := []struct {
+		boundary time.Time
+		names    []string
+	}{
+		{
+			boundary: start.Truncate(time.Minute).Add(time.Minute),
+			names:    []string{"a", "b"},
+		},
+		{
+			boundary: start.Truncate(time.Minute).Add(2 * time.Minute),
+			names:    []string{"c", "a", "b"},
+		},
+		{
+			boundary: start.Truncate(time.Minute).Add(3 * time.Minute),
+			names:    []string{"d", "c", "a", "b"},
+		},
+	}
+	for i, w := range want {
+		if err := clock.BlockUntil(ctx, 1); err != nil {
+			t.Fatalf("BlockUntil() got unexpected error: %v", err)
+		}
+		clock.Advance(w.boundary.Sub(clock.Now()))
+		var got []string
+		for _, tg := range <-receivers {
+			got = append(got, tg.Name)
+		}
+		if diff := cmp.Diff(w.names, got); diff != "" {
+			t.Errorf("SendWindowed() batch %d got unexpected diff (-want +got):\n%s", i, diff)
+		}
+	}
+
+	cancel()
+	if err := <-sent; err != context.Canceled {
+		t.Errorf("SendWindowed() got %v, want %v", err, context.Canceled)
+	}
+	if got := q.Stats().Delivered; got != 9 {
+		t.Errorf("Stats() got %d delivered, want 9", got)
+	}
+	if err := q.SendWindowed(context.Background(), receivers, 0); err == nil {
+		t.Error("SendWindowed() wanted an error for a zero window")
+	}
+}
+
+func TestZeroTime(t *testing.T) {
+	now := time.Date(2021, 1, 2, 3, 4, 5, 0, time.UTC)
+	var zero time.Time
+	cases := []struct {
+		name string
+		call func(*TestGroupQueue) error
+	}{
+		{
+			name: "init",
+			call: func(q *TestGroupQueue) error {
+				return q.Init([]*configpb.TestGroup{{Name: "new"}}, zero)
+			},
+		},
+		{
+			name: "init schedule",
+			call: func(q *TestGroupQueue) error {
+				return q.InitSchedule([]*configpb.TestGroup{{Name: "hi"}}, now, map[string]time.Time{"hi": zero})
+			},
+		},
+		{
+			name: "merge",
+			call: func(q *TestGroupQueue) error {
+				return q.Merge([]*configpb.TestGroup{{Name: "new"}}, zero)
+			},
+		},
+		{
+			name: "add",
+			call: func(q *TestGroupQueue) error {
+				return q.Add(&configpb.TestGroup{Name: "new"}, zero)
+			},
+		},
+		{
+			name: "add blocking",
+			call: func(q *TestGroupQueue) error {
+				return q.AddBlocking(context.Background(), &configpb.TestGroup{Name: "new"}, zero)
+			},
+		},
+		{
+			name: "add if absent",
+			call: func(q *TestGroupQueue) error {
+				if q.AddIfAbsent(&configpb.TestGroup{Name: "new"}, zero) {
+					return nil
+				}
+				return ErrInvalidTime
+			},
+		},
+		{
+			name: "fix",
+			call: func(q *TestGroupQueue) error {
+				return q.Fix("hi", zero)
+			},
+		},
+		{
+			name: "fix all",
+			call: func(q *TestGroupQueue) error {
+				return q.FixAll(map[string]time.Time{"hi": now.Add(time.Hour), "there": zero})
+			},
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			q := NewTestGroupQueue(WithClock(NewFakeClock(now)))
+			q.Init([]*configpb.TestGroup{{Name: "hi"}, {Name: "there"}}, now)
+			want := q.Items()
+			if err := tc.call(q); !errors.Is(err, ErrInvalidTime) {
+				t.Errorf("got %v, want %v", err, ErrInvalidTime)
+			}
+			if diff := cmp.Diff(want, q.Items()); diff != "" {
+				t.Errorf("Items() got unexpected diff after rejecting zero time (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestNilGroup(t *testing.T) {
+	now := time.Date(2021, 1, 2, 3, 4, 5, 0, time.UTC)
+	cases := []struct {
+		name string
+		call func(*TestGroupQueue) error
+	}{
+		{
+			name: "merge",
+			call: func(q *TestGroupQueue) error {
+				return q.Merge([]*configpb.TestGroup{nil, {Name: "hi"}}, now)
+			},
+		},
+		{
+			name: "add",
+			call: func(q *TestGroupQueue) error {
+				return q.Add(nil, now)
+			},
+		},
+		{
+			name: "add blocking",
+			call: func(q *TestGroupQueue) error {
+				return q.AddBlocking(context.Background(), nil, now)
+			},
+		},
+		{
+			name: "add if absent",
+			call: func(q *TestGroupQueue) error {
+				if q.AddIfAbsent(nil, now) {
+					return nil
+				}
+				return invalidGroupError(nil, errors.New("nil group"))
+			},
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			q := NewTestGroupQueue(WithClock(NewFakeClock(now)))
+			q.Init([]*configpb.TestGroup{{Name: "hi"}, {Name: "there"}}, now)
+			want := q.Items()
+			var invalid *InvalidGroupsError
+			if err := tc.call(q); !errors.As(err, &invalid) {
+				t.Fatalf("got %v, want an *InvalidGroupsError", err)
+			}
+			if got := invalid.Groups[0].Reason; got != "nil group" {
+				t.Errorf("got reason %q, want %q", got, "nil group")
+			}
+			if diff := cmp.Diff(want, q.Items()); diff != "" {
+				t.Errorf("Items() got unexpected diff after rejecting nil group (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestSendNilGroup(t *testing.T) {
+	now := time.Date(2021, 1, 2, 3, 4, 5, 0, time.UTC)
+	q := NewTestGroupQueue(WithClock(NewFakeClock(now)))
+	q.Init([]*configpb.TestGroup{{Name: "hi"}, {Name: "there"}}, now)
+	q.queue.peek().tg = nil // corrupt the queue
+
+	ch := make(chan *configpb.TestGroup, 2)
+	if err := q.Send(context.Background(), ch, 0); err != nil {
+		t.Fatalf("Send() got unexpected error: %v", err)
+	}
+	close(ch)
+	var got []string
+	for tg := range ch {
+		if tg == nil {
+			t.Fatal("Send() delivered a nil group")
+		}
+		got = append(got, tg.Name)
+	}
+	if diff := cmp.Diff([]string{"there"}, got); diff != "" {
+		t.Errorf("Send() got unexpected groups (-want +got):\n%s", diff)
+	}
+	if err := q.Verify(); err != nil {
+		t.Errorf("Verify() got unexpected error: %v", err)
+	}
+}
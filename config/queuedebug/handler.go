@@ -0,0 +1,222 @@
+/*
+Copyright 2021 The TestGrid Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package queuedebug serves a TestGroupQueue's schedule to operators over HTTP.
+package queuedebug
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"text/tabwriter"
+	"time"
+
+	"github.com/GoogleCloudPlatform/testgrid/config"
+)
+
+const (
+	// DefaultForecastWindow is how far ahead the forecast view looks when unspecified.
+	DefaultForecastWindow = 30 * time.Minute
+	// MaxForecastWindow is the furthest ahead the forecast view looks.
+	MaxForecastWindow = 24 * time.Hour
+	// MaxForecastRows is the most dispatches the forecast view renders.
+	MaxForecastRows = 1000
+)
+
+// Handler serves the queue's schedule.
+//
+// The default view lists the groups in the queue as JSON. The forecast view,
+// selected by ?view=forecast&window=30m, renders a table of the dispatches
+// predicted over the window. The diagnosis view, selected by ?view=diagnosis,
+// explains as JSON why the queue is or is not dispatching, see Diagnose.
+// The overrides view, selected by ?view=overrides, lists the overrides that
+// still apply as JSON, see ApplyOverrides.
+//
+// Authorization is left to the caller, typically via middleware.
+type Handler struct {
+	queue     *config.TestGroupQueue
+	frequency time.Duration
+	maxRows   int
+
+	started   time.Time // when dispatch rate observations began
+	delivered int64     // groups delivered before started
+}
+
+// NewHandler returns a handler for the queue, which Send dispatches at frequency.
+//
+// The forecast observes the queue's dispatch rate from now on.
+func NewHandler(q *config.TestGroupQueue, frequency time.Duration) *Handler {
+	return &Handler{
+		queue:     q,
+		frequency: frequency,
+		maxRows:   MaxForecastRows,
+		started:   q.Now(),
+		delivered: q.Stats().Delivered,
+	}
+}
+
+// ServeHTTP renders the view the request selects.
+func (h *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	switch view := r.URL.Query().Get("view"); view {
+	case "", "items":
+		serveJSON(w, h.queue.Items())
+	case "forecast":
+		window, ok := forecastWindow(w, r)
+		if !ok {
+			return
+		}
+		h.serveForecast(r.Context(), w, window)
+	case "diagnosis":
+		serveJSON(w, h.queue.Diagnose())
+	case "overrides":
+		serveJSON(w, h.queue.Overrides())
+	default:
+		http.Error(w, fmt.Sprintf("Unknown view %q", view), http.StatusBadRequest)
+	}
+}
+
+// forecastWindow parses the window the request selects, replying with an error if it is invalid.
+func forecastWindow(w http.ResponseWriter, r *http.Request) (time.Duration, bool) {
+	s := r.URL.Query().Get("window")
+	if s == "" {
+		return DefaultForecastWindow, true
+	}
+	d, err := time.ParseDuration(s)
+	if err != nil || d <= 0 || d > MaxForecastWindow {
+		http.Error(w, fmt.Sprintf("Window must be a duration up to %s: %q", MaxForecastWindow, s), http.StatusBadRequest)
+		return 0, false
+	}
+	return d, true
+}
+
+func serveJSON(w http.ResponseWriter, v interface{}) {
+	resp, err := json.Marshal(v)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(resp)
+}
+
+// Dispatch is a predicted dispatch of a group.
+type Dispatch struct {
+	Name string
+	When time.Time     // Predicted dispatch time.
+	Late time.Duration // Behind schedule at the observed dispatch rate.
+}
+
+// Forecast predicts the dispatches over a window.
+type Forecast struct {
+	Start      time.Time
+	Window     time.Duration
+	Frequency  time.Duration
+	Dispatches []Dispatch // The first dispatches, up to a limit, see Total.
+
+	// Total is the number of dispatches predicted, including any beyond Dispatches.
+	Total int
+	// Backlog is the number of dispatches predicted to slip past the window.
+	Backlog int
+	// Rate is the observed dispatches per minute, or zero when unknown.
+	Rate float64
+}
+
+// DueRate returns the dispatches per minute the schedule calls for.
+func (f Forecast) DueRate() float64 {
+	return float64(f.Total) / f.Window.Minutes()
+}
+
+// forecast simulates Send over the window, spacing out the dispatches at the observed rate.
+//
+// Keeps the first maxRows dispatches, only counting the rest.
+func (h *Handler) forecast(ctx context.Context, window time.Duration, maxRows int) (*Forecast, error) {
+	now := h.queue.Now()
+	f := Forecast{
+		Start:     now,
+		Window:    window,
+		Frequency: h.frequency,
+	}
+	if elapsed := now.Sub(h.started); elapsed > 0 {
+		f.Rate = float64(h.queue.Stats().Delivered-h.delivered) / elapsed.Minutes()
+	}
+	var interval time.Duration
+	if f.Rate > 0 {
+		interval = time.Duration(float64(time.Minute) / f.Rate)
+	}
+	next := now
+	end := now.Add(window)
+	err := h.queue.SendDryRun(ctx, func(name string, when time.Time) {
+		d := Dispatch{Name: name, When: when}
+		if interval > 0 {
+			if next.After(when) {
+				d.When = next
+				d.Late = next.Sub(when)
+			}
+			next = d.When.Add(interval)
+		}
+		if d.When.After(end) {
+			f.Backlog++
+		}
+		if f.Total < maxRows {
+			f.Dispatches = append(f.Dispatches, d)
+		}
+		f.Total++
+	}, h.frequency, config.DryRunHorizon(window))
+	if err != nil {
+		return nil, err
+	}
+	return &f, nil
+}
+
+func (h *Handler) serveForecast(ctx context.Context, w http.ResponseWriter, window time.Duration) {
+	f, err := h.forecast(ctx, window, h.maxRows)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	renderForecast(w, f)
+}
+
+// renderForecast writes the forecast as a table, noting how many dispatches it leaves out.
+func renderForecast(w io.Writer, f *Forecast) {
+	fmt.Fprintf(w, "Forecast for %s from %s at frequency %s\n", f.Window, f.Start.UTC().Format(time.RFC3339), f.Frequency)
+	rate := "unknown"
+	if f.Rate > 0 {
+		rate = fmt.Sprintf("%.2f/min", f.Rate)
+	}
+	fmt.Fprintf(w, "Due: %d dispatches (%.2f/min), observed rate: %s\n", f.Total, f.DueRate(), rate)
+	if f.Rate > 0 && f.Rate < f.DueRate() {
+		fmt.Fprintf(w, "WARNING: backlog grows over the window, dispatches predicted after %s: %d\n", f.Start.Add(f.Window).UTC().Format(time.RFC3339), f.Backlog)
+	}
+	fmt.Fprintln(w)
+
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "WHEN\tIN\tLATE\tGROUP")
+	for _, d := range f.Dispatches {
+		late := "-"
+		if d.Late > 0 {
+			late = d.Late.Round(time.Second).String()
+		}
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%s\n", d.When.UTC().Format(time.RFC3339), d.When.Sub(f.Start).Round(time.Second), late, d.Name)
+	}
+	tw.Flush()
+	if n := f.Total - len(f.Dispatches); n > 0 {
+		fmt.Fprintf(w, "... and %d more\n", n)
+	}
+}
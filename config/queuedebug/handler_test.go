@@ -0,0 +1,244 @@
+/*
+Copyright 2021 The TestGrid Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package queuedebug
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/GoogleCloudPlatform/testgrid/config"
+	configpb "github.com/GoogleCloudPlatform/testgrid/pb/config"
+	"github.com/google/go-cmp/cmp"
+)
+
+// scenario returns a handler for a queue that has delivered two groups since start-observed.
+func scenario(t *testing.T, start time.Time, observed time.Duration) *Handler {
+	clock := config.NewFakeClock(start)
+	q := config.NewTestGroupQueue(config.WithClock(clock))
+	q.Init([]*configpb.TestGroup{{Name: "done-1"}, {Name: "done-2"}}, start)
+	h := NewHandler(q, 30*time.Minute)
+	ch := make(chan *configpb.TestGroup, 2)
+	if _, err := q.Flush(context.Background(), ch); err != nil {
+		t.Fatalf("Flush() got unexpected error: %v", err)
+	}
+	h.started = start.Add(-observed)
+	if observed == 0 {
+		h.delivered = q.Stats().Delivered
+	}
+
+	q.Init([]*configpb.TestGroup{
+		{Name: "overdue"},
+		{Name: "now"},
+		{Name: "soon"},
+		{Name: "later"},
+	}, start)
+	q.FixAll(map[string]time.Time{
+		"overdue": start.Add(-5 * time.Minute),
+		"soon":    start.Add(10 * time.Minute),
+		"later":   start.Add(40 * time.Minute),
+	})
+	return h
+}
+
+func TestForecast(t *testing.T) {
+	start := time.Date(2021, 1, 2, 3, 4, 5, 0, time.UTC)
+	cases := []struct {
+		name     string
+		observed time.Duration
+		maxRows  int
+		url      string
+		want     string
+	}{
+		{
+			name: "unknown rate",
+			url:  "/?view=forecast",
+			want: `Forecast for 30m0s from 2021-01-02T03:04:05Z at frequency 30m0s
+Due: 3 dispatches (0.10/min), observed rate: unknown
+
+WHEN                  IN     LATE  GROUP
+2021-01-02T03:04:05Z  0s     -     overdue
+2021-01-02T03:04:05Z  0s     -     now
+2021-01-02T03:14:05Z  10m0s  -     soon
+`,
+		},
+		{
+			name:     "keeping up",
+			observed: 10 * time.Minute,
+			url:      "/?view=forecast&window=30m",
+			want: `Forecast for 30m0s from 2021-01-02T03:04:05Z at frequency 30m0s
+Due: 3 dispatches (0.10/min), observed rate: 0.20/min
+
+WHEN                  IN     LATE  GROUP
+2021-01-02T03:04:05Z  0s     -     overdue
+2021-01-02T03:09:05Z  5m0s   5m0s  now
+2021-01-02T03:14:05Z  10m0s  -     soon
+`,
+		},
+		{
+			name:     "falling behind",
+			observed: 40 * time.Minute,
+			maxRows:  2,
+			url:      "/?view=forecast&window=30m",
+			want: `Forecast for 30m0s from 2021-01-02T03:04:05Z at frequency 30m0s
+Due: 3 dispatches (0.10/min), observed rate: 0.05/min
+WARNING: backlog grows over the window, dispatches predicted after 2021-01-02T03:34:05Z: 1
+
+WHEN                  IN     LATE   GROUP
+2021-01-02T03:04:05Z  0s     -      overdue
+2021-01-02T03:24:05Z  20m0s  20m0s  now
+... and 1 more
+`,
+		},
+		{
+			name: "longer window",
+			url:  "/?view=forecast&window=1h",
+			want: `Forecast for 1h0m0s from 2021-01-02T03:04:05Z at frequency 30m0s
+Due: 7 dispatches (0.12/min), observed rate: unknown
+
+WHEN                  IN     LATE  GROUP
+2021-01-02T03:04:05Z  0s     -     overdue
+2021-01-02T03:04:05Z  0s     -     now
+2021-01-02T03:14:05Z  10m0s  -     soon
+2021-01-02T03:34:05Z  30m0s  -     overdue
+2021-01-02T03:34:05Z  30m0s  -     now
+2021-01-02T03:44:05Z  40m0s  -     later
+2021-01-02T03:44:05Z  40m0s  -     soon
+`,
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			h := scenario(t, start, tc.observed)
+			if tc.maxRows > 0 {
+				h.maxRows = tc.maxRows
+			}
+			rec := httptest.NewRecorder()
+			h.ServeHTTP(rec, httptest.NewRequest("GET", tc.url, nil))
+			if rec.Code != http.StatusOK {
+				t.Fatalf("ServeHTTP() got status %d: %s", rec.Code, rec.Body)
+			}
+			if diff := cmp.Diff(tc.want, rec.Body.String()); diff != "" {
+				t.Errorf("ServeHTTP() got unexpected diff (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestForecastKeepsMaxRows(t *testing.T) {
+	start := time.Date(2021, 1, 2, 3, 4, 5, 0, time.UTC)
+	h := scenario(t, start, 0)
+	f, err := h.forecast(context.Background(), time.Hour, 2)
+	if err != nil {
+		t.Fatalf("forecast() got unexpected error: %v", err)
+	}
+	want := []Dispatch{
+		{Name: "overdue", When: start},
+		{Name: "now", When: start},
+	}
+	if diff := cmp.Diff(want, f.Dispatches); diff != "" {
+		t.Errorf("forecast() got unexpected dispatches (-want +got):\n%s", diff)
+	}
+	if f.Total != 7 {
+		t.Errorf("forecast() got total %d, want 7", f.Total)
+	}
+}
+
+func TestItems(t *testing.T) {
+	start := time.Date(2021, 1, 2, 3, 4, 5, 0, time.UTC)
+	h := scenario(t, start, 0)
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest("GET", "/", nil))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("ServeHTTP() got status %d: %s", rec.Code, rec.Body)
+	}
+	var got []config.QueueItem
+	if err := json.Unmarshal(rec.Body.Bytes(), &got); err != nil {
+		t.Fatalf("Unmarshal() got unexpected error: %v", err)
+	}
+	if diff := cmp.Diff(h.queue.Items(), got); diff != "" {
+		t.Errorf("ServeHTTP() got unexpected diff (-want +got):\n%s", diff)
+	}
+}
+
+func TestDiagnosis(t *testing.T) {
+	start := time.Date(2021, 1, 2, 3, 4, 5, 0, time.UTC)
+	h := scenario(t, start, 0)
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest("GET", "/?view=diagnosis", nil))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("ServeHTTP() got status %d: %s", rec.Code, rec.Body)
+	}
+	var got config.Diagnosis
+	if err := json.Unmarshal(rec.Body.Bytes(), &got); err != nil {
+		t.Fatalf("Unmarshal() got unexpected error: %v", err)
+	}
+	want := config.Diagnosis{
+		Reason: config.DiagnosisNotSending,
+		Head:   "overdue",
+		Until:  -5 * time.Minute,
+		Due:    2,
+	}
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Errorf("ServeHTTP() got unexpected diff (-want +got):\n%s", diff)
+	}
+}
+
+func TestOverrides(t *testing.T) {
+	start := time.Date(2021, 1, 2, 3, 4, 5, 0, time.UTC)
+	h := scenario(t, start, 0)
+	want := config.Overrides{
+		Groups: map[string]config.GroupOverride{
+			"soon":    {MinInterval: config.Duration(time.Hour), Expires: start.Add(time.Hour)},
+			"missing": {Paused: true},
+		},
+	}
+	h.queue.ApplyOverrides(want)
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest("GET", "/?view=overrides", nil))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("ServeHTTP() got status %d: %s", rec.Code, rec.Body)
+	}
+	var got config.Overrides
+	if err := json.Unmarshal(rec.Body.Bytes(), &got); err != nil {
+		t.Fatalf("Unmarshal() got unexpected error: %v", err)
+	}
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Errorf("ServeHTTP() got unexpected diff (-want +got):\n%s", diff)
+	}
+}
+
+func TestBadRequests(t *testing.T) {
+	h := NewHandler(&config.TestGroupQueue{}, time.Minute)
+	for _, url := range []string{
+		"/?view=unknown",
+		"/?view=forecast&window=soon",
+		"/?view=forecast&window=-1m",
+		"/?view=forecast&window=0s",
+		"/?view=forecast&window=48h",
+	} {
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, httptest.NewRequest("GET", url, nil))
+		if rec.Code != http.StatusBadRequest {
+			t.Errorf("ServeHTTP(%q) got status %d, want %d", url, rec.Code, http.StatusBadRequest)
+		}
+	}
+}
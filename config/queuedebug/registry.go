@@ -0,0 +1,144 @@
+/*
+Copyright 2021 The TestGrid Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package queuedebug
+
+import (
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/GoogleCloudPlatform/testgrid/config"
+)
+
+// RegistryHandler serves the schedule of every queue in a registry.
+//
+// Selecting a queue with ?queue=name serves it like Handler. Otherwise the
+// default view lists the groups in each queue as a JSON object keyed by
+// queue name, the forecast view renders each queue's forecast in turn and
+// the diagnosis and overrides views serve each queue's view in a JSON
+// object keyed by queue name.
+type RegistryHandler struct {
+	registry  *config.QueueRegistry
+	frequency func(string) time.Duration
+
+	lock     sync.Mutex
+	handlers map[string]*Handler // observing each queue's dispatch rate
+}
+
+// NewRegistryHandler returns a handler for the registry, which sends each queue at the frequency for its name.
+func NewRegistryHandler(r *config.QueueRegistry, frequency func(name string) time.Duration) *RegistryHandler {
+	return &RegistryHandler{
+		registry:  r,
+		frequency: frequency,
+		handlers:  map[string]*Handler{},
+	}
+}
+
+// handler returns the handler for the named queue, if it is registered.
+func (h *RegistryHandler) handler(name string) (*Handler, bool) {
+	q, ok := h.registry.Queue(name)
+	h.lock.Lock()
+	defer h.lock.Unlock()
+	if !ok {
+		delete(h.handlers, name)
+		return nil, false
+	}
+	if qh, ok := h.handlers[name]; ok && qh.queue == q {
+		return qh, true
+	}
+	qh := NewHandler(q, h.frequency(name))
+	h.handlers[name] = qh
+	return qh, true
+}
+
+// ServeHTTP renders the view the request selects.
+func (h *RegistryHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if name := r.URL.Query().Get("queue"); name != "" {
+		qh, ok := h.handler(name)
+		if !ok {
+			http.Error(w, fmt.Sprintf("Unknown queue %q", name), http.StatusNotFound)
+			return
+		}
+		qh.ServeHTTP(w, r)
+		return
+	}
+	switch view := r.URL.Query().Get("view"); view {
+	case "", "items":
+		h.serveItems(w)
+	case "forecast":
+		window, ok := forecastWindow(w, r)
+		if !ok {
+			return
+		}
+		h.serveForecasts(w, r, window)
+	case "diagnosis":
+		diagnoses := map[string]config.Diagnosis{}
+		for _, name := range h.registry.Names() {
+			if q, ok := h.registry.Queue(name); ok {
+				diagnoses[name] = q.Diagnose()
+			}
+		}
+		serveJSON(w, diagnoses)
+	case "overrides":
+		overrides := map[string]config.Overrides{}
+		for _, name := range h.registry.Names() {
+			if q, ok := h.registry.Queue(name); ok {
+				overrides[name] = q.Overrides()
+			}
+		}
+		serveJSON(w, overrides)
+	default:
+		http.Error(w, fmt.Sprintf("Unknown view %q", view), http.StatusBadRequest)
+	}
+}
+
+func (h *RegistryHandler) serveItems(w http.ResponseWriter) {
+	items := map[string][]config.QueueItem{}
+	for _, name := range h.registry.Names() {
+		if qh, ok := h.handler(name); ok {
+			items[name] = qh.queue.Items()
+		}
+	}
+	serveJSON(w, items)
+}
+
+func (h *RegistryHandler) serveForecasts(w http.ResponseWriter, r *http.Request, window time.Duration) {
+	var names []string
+	var forecasts []*Forecast
+	for _, name := range h.registry.Names() {
+		qh, ok := h.handler(name)
+		if !ok {
+			continue // deregistered since listing
+		}
+		f, err := qh.forecast(r.Context(), window, qh.maxRows)
+		if err != nil {
+			http.Error(w, fmt.Sprintf("%s: %v", name, err), http.StatusInternalServerError)
+			return
+		}
+		names = append(names, name)
+		forecasts = append(forecasts, f)
+	}
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	for i, f := range forecasts {
+		if i > 0 {
+			fmt.Fprintln(w)
+		}
+		fmt.Fprintf(w, "== %s ==\n", names[i])
+		renderForecast(w, f)
+	}
+}
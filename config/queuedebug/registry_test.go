@@ -0,0 +1,123 @@
+/*
+Copyright 2021 The TestGrid Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package queuedebug
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/GoogleCloudPlatform/testgrid/config"
+	configpb "github.com/GoogleCloudPlatform/testgrid/pb/config"
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestRegistryHandler(t *testing.T) {
+	start := time.Date(2021, 1, 2, 3, 4, 5, 0, time.UTC)
+	clock := config.NewFakeClock(start)
+	var r config.QueueRegistry
+	fast := config.NewTestGroupQueue(config.WithClock(clock))
+	fast.Init([]*configpb.TestGroup{{Name: "f1"}, {Name: "f2"}}, start)
+	slow := config.NewTestGroupQueue(config.WithClock(clock))
+	slow.Init([]*configpb.TestGroup{{Name: "s1"}}, start.Add(time.Hour))
+	r.Register("fast", fast)
+	r.Register("slow", slow)
+	frequencies := map[string]time.Duration{"fast": time.Minute, "slow": time.Hour}
+	h := NewRegistryHandler(&r, func(name string) time.Duration { return frequencies[name] })
+	for _, name := range r.Names() {
+		qh, _ := h.handler(name)
+		qh.started = start
+	}
+
+	serve := func(url string, wantCode int) string {
+		t.Helper()
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, httptest.NewRequest("GET", url, nil))
+		if rec.Code != wantCode {
+			t.Fatalf("ServeHTTP(%q) got status %d, want %d: %s", url, rec.Code, wantCode, rec.Body)
+		}
+		return rec.Body.String()
+	}
+
+	var items map[string][]config.QueueItem
+	if err := json.Unmarshal([]byte(serve("/", http.StatusOK)), &items); err != nil {
+		t.Fatalf("Unmarshal() got unexpected error: %v", err)
+	}
+	wantItems := map[string][]config.QueueItem{
+		"fast": fast.Items(),
+		"slow": slow.Items(),
+	}
+	if diff := cmp.Diff(wantItems, items); diff != "" {
+		t.Errorf("ServeHTTP() got unexpected items (-want +got):\n%s", diff)
+	}
+
+	var one []config.QueueItem
+	if err := json.Unmarshal([]byte(serve("/?queue=slow", http.StatusOK)), &one); err != nil {
+		t.Fatalf("Unmarshal() got unexpected error: %v", err)
+	}
+	if diff := cmp.Diff(slow.Items(), one); diff != "" {
+		t.Errorf("ServeHTTP(queue=slow) got unexpected items (-want +got):\n%s", diff)
+	}
+
+	want := `== fast ==
+Forecast for 2m0s from 2021-01-02T03:04:05Z at frequency 1m0s
+Due: 4 dispatches (2.00/min), observed rate: unknown
+
+WHEN                  IN    LATE  GROUP
+2021-01-02T03:04:05Z  0s    -     f1
+2021-01-02T03:04:05Z  0s    -     f2
+2021-01-02T03:05:05Z  1m0s  -     f1
+2021-01-02T03:05:05Z  1m0s  -     f2
+
+== slow ==
+Forecast for 2m0s from 2021-01-02T03:04:05Z at frequency 1h0m0s
+Due: 0 dispatches (0.00/min), observed rate: unknown
+
+WHEN  IN  LATE  GROUP
+`
+	if diff := cmp.Diff(want, serve("/?view=forecast&window=2m", http.StatusOK)); diff != "" {
+		t.Errorf("ServeHTTP(forecast) got unexpected diff (-want +got):\n%s", diff)
+	}
+
+	var diagnoses map[string]config.Diagnosis
+	if err := json.Unmarshal([]byte(serve("/?view=diagnosis", http.StatusOK)), &diagnoses); err != nil {
+		t.Fatalf("Unmarshal() got unexpected error: %v", err)
+	}
+	wantDiagnoses := map[string]config.Diagnosis{
+		"fast": {Reason: config.DiagnosisNotSending, Head: "f1", Due: 2},
+		"slow": {Reason: config.DiagnosisNotSending, Head: "s1", Until: time.Hour},
+	}
+	if diff := cmp.Diff(wantDiagnoses, diagnoses); diff != "" {
+		t.Errorf("ServeHTTP(diagnosis) got unexpected diff (-want +got):\n%s", diff)
+	}
+
+	serve("/?queue=missing", http.StatusNotFound)
+	serve("/?view=unknown", http.StatusBadRequest)
+	serve("/?view=forecast&window=48h", http.StatusBadRequest)
+
+	r.Deregister("fast")
+	items = nil
+	if err := json.Unmarshal([]byte(serve("/", http.StatusOK)), &items); err != nil {
+		t.Fatalf("Unmarshal() got unexpected error: %v", err)
+	}
+	if _, ok := items["fast"]; ok || len(items) != 1 {
+		t.Errorf("ServeHTTP() after Deregister() got queues %v, want only slow", items)
+	}
+	serve("/?queue=fast", http.StatusNotFound)
+}
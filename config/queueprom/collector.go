@@ -0,0 +1,83 @@
+/*
+Copyright 2021 The TestGrid Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package queueprom exports TestGroupQueue metrics to Prometheus.
+package queueprom
+
+import (
+	"github.com/GoogleCloudPlatform/testgrid/config"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// Collector reports the status of a TestGroupQueue when scraped.
+type Collector struct {
+	queue *config.TestGroupQueue
+
+	depth      *prometheus.Desc
+	overdue    *prometheus.Desc
+	behind     *prometheus.Desc
+	dispatches *prometheus.Desc
+}
+
+// NewCollector returns a collector for the queue, with metrics prefixed by namespace.
+func NewCollector(q *config.TestGroupQueue, namespace string) *Collector {
+	name := func(n string) string {
+		return prometheus.BuildFQName(namespace, "queue", n)
+	}
+	return &Collector{
+		queue: q,
+		depth: prometheus.NewDesc(
+			name("depth"),
+			"Number of test groups in the queue.",
+			nil, nil,
+		),
+		overdue: prometheus.NewDesc(
+			name("overdue_groups"),
+			"Number of test groups scheduled in the past.",
+			nil, nil,
+		),
+		behind: prometheus.NewDesc(
+			name("behind_seconds"),
+			"Seconds the most overdue test group is behind schedule.",
+			nil, nil,
+		),
+		dispatches: prometheus.NewDesc(
+			name("dispatches_total"),
+			"Number of test groups dispatched, by outcome.",
+			[]string{"outcome"}, nil,
+		),
+	}
+}
+
+// Describe implements prometheus.Collector.
+func (c *Collector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- c.depth
+	ch <- c.overdue
+	ch <- c.behind
+	ch <- c.dispatches
+}
+
+// Collect implements prometheus.Collector.
+func (c *Collector) Collect(ch chan<- prometheus.Metric) {
+	stats := c.queue.Stats()
+	overdue, behind := c.queue.Overdue(c.queue.Now())
+	ch <- prometheus.MustNewConstMetric(c.depth, prometheus.GaugeValue, float64(stats.Depth))
+	ch <- prometheus.MustNewConstMetric(c.overdue, prometheus.GaugeValue, float64(overdue))
+	ch <- prometheus.MustNewConstMetric(c.behind, prometheus.GaugeValue, behind.Seconds())
+	ch <- prometheus.MustNewConstMetric(c.dispatches, prometheus.CounterValue, float64(stats.Delivered), "delivered")
+	ch <- prometheus.MustNewConstMetric(c.dispatches, prometheus.CounterValue, float64(stats.Requeued), "requeued")
+	ch <- prometheus.MustNewConstMetric(c.dispatches, prometheus.CounterValue, float64(stats.Filtered), "filtered")
+}
@@ -0,0 +1,172 @@
+/*
+Copyright 2021 The TestGrid Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package queueprom
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/GoogleCloudPlatform/testgrid/config"
+	configpb "github.com/GoogleCloudPlatform/testgrid/pb/config"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+func TestLint(t *testing.T) {
+	c := NewCollector(&config.TestGroupQueue{}, "testgrid")
+	problems, err := testutil.CollectAndLint(c)
+	if err != nil {
+		t.Fatalf("CollectAndLint() got unexpected error: %v", err)
+	}
+	for _, p := range problems {
+		t.Errorf("CollectAndLint() found problem with %s: %s", p.Metric, p.Text)
+	}
+}
+
+func TestCollect(t *testing.T) {
+	now := time.Date(2021, 1, 2, 3, 4, 5, 0, time.UTC)
+	cases := []struct {
+		name  string
+		queue func() *config.TestGroupQueue
+		want  string
+	}{
+		{
+			name: "empty",
+			queue: func() *config.TestGroupQueue {
+				return &config.TestGroupQueue{}
+			},
+			want: `
+# HELP testgrid_queue_behind_seconds Seconds the most overdue test group is behind schedule.
+# TYPE testgrid_queue_behind_seconds gauge
+testgrid_queue_behind_seconds 0
+# HELP testgrid_queue_depth Number of test groups in the queue.
+# TYPE testgrid_queue_depth gauge
+testgrid_queue_depth 0
+# HELP testgrid_queue_dispatches_total Number of test groups dispatched, by outcome.
+# TYPE testgrid_queue_dispatches_total counter
+testgrid_queue_dispatches_total{outcome="delivered"} 0
+testgrid_queue_dispatches_total{outcome="filtered"} 0
+testgrid_queue_dispatches_total{outcome="requeued"} 0
+# HELP testgrid_queue_overdue_groups Number of test groups scheduled in the past.
+# TYPE testgrid_queue_overdue_groups gauge
+testgrid_queue_overdue_groups 0
+`,
+		},
+		{
+			name: "overdue",
+			queue: func() *config.TestGroupQueue {
+				q := config.NewTestGroupQueue(config.WithClock(config.NewFakeClock(now)))
+				q.Init([]*configpb.TestGroup{
+					{
+						Name: "hi",
+					},
+					{
+						Name: "there",
+					},
+					{
+						Name: "future",
+					},
+				}, now)
+				q.Fix("hi", now.Add(-time.Minute))
+				q.Fix("there", now.Add(-time.Second))
+				q.Fix("future", now.Add(time.Hour))
+				return q
+			},
+			want: `
+# HELP testgrid_queue_behind_seconds Seconds the most overdue test group is behind schedule.
+# TYPE testgrid_queue_behind_seconds gauge
+testgrid_queue_behind_seconds 60
+# HELP testgrid_queue_depth Number of test groups in the queue.
+# TYPE testgrid_queue_depth gauge
+testgrid_queue_depth 3
+# HELP testgrid_queue_overdue_groups Number of test groups scheduled in the past.
+# TYPE testgrid_queue_overdue_groups gauge
+testgrid_queue_overdue_groups 2
+`,
+		},
+		{
+			name: "delivered",
+			queue: func() *config.TestGroupQueue {
+				var q config.TestGroupQueue
+				q.Init([]*configpb.TestGroup{
+					{
+						Name: "hi",
+					},
+					{
+						Name: "there",
+					},
+				}, now)
+				ch := make(chan *configpb.TestGroup, 2)
+				if err := q.Send(context.Background(), ch, 0); err != nil {
+					t.Fatalf("Send() got unexpected error: %v", err)
+				}
+				return &q
+			},
+			want: `
+# HELP testgrid_queue_dispatches_total Number of test groups dispatched, by outcome.
+# TYPE testgrid_queue_dispatches_total counter
+testgrid_queue_dispatches_total{outcome="delivered"} 2
+testgrid_queue_dispatches_total{outcome="filtered"} 0
+testgrid_queue_dispatches_total{outcome="requeued"} 0
+`,
+		},
+		{
+			name: "filtered",
+			queue: func() *config.TestGroupQueue {
+				q := config.NewTestGroupQueue(config.WithStalePredicate(func(*configpb.TestGroup, time.Time, time.Time) bool {
+					return true
+				}))
+				q.Init([]*configpb.TestGroup{
+					{
+						Name: "hi",
+					},
+					{
+						Name: "there",
+					},
+				}, now)
+				ch := make(chan *configpb.TestGroup, 2)
+				if err := q.Send(context.Background(), ch, 0); err != nil {
+					t.Fatalf("Send() got unexpected error: %v", err)
+				}
+				return q
+			},
+			want: `
+# HELP testgrid_queue_dispatches_total Number of test groups dispatched, by outcome.
+# TYPE testgrid_queue_dispatches_total counter
+testgrid_queue_dispatches_total{outcome="delivered"} 0
+testgrid_queue_dispatches_total{outcome="filtered"} 2
+testgrid_queue_dispatches_total{outcome="requeued"} 0
+`,
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			c := NewCollector(tc.queue(), "testgrid")
+			var names []string
+			for _, line := range strings.Split(tc.want, "\n") {
+				if strings.HasPrefix(line, "# TYPE ") {
+					names = append(names, strings.Fields(line)[2])
+				}
+			}
+			if err := testutil.CollectAndCompare(c, strings.NewReader(tc.want), names...); err != nil {
+				t.Errorf("CollectAndCompare() got unexpected difference: %v", err)
+			}
+		})
+	}
+}
@@ -0,0 +1,189 @@
+/*
+Copyright 2021 The TestGrid Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package queueservice exposes a TestGroupQueue over gRPC.
+package queueservice
+
+import (
+	"context"
+	"encoding/base64"
+	"errors"
+	"sort"
+	"time"
+	"unicode/utf8"
+
+	"github.com/GoogleCloudPlatform/testgrid/config"
+	queuepb "github.com/GoogleCloudPlatform/testgrid/pb/queue"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+const (
+	// DefaultPageSize is the number of items ListItems returns when unspecified.
+	DefaultPageSize = 100
+	// MaxPageSize is the most items ListItems returns in a single page.
+	MaxPageSize = 1000
+)
+
+// Server implements the Queue service against a TestGroupQueue.
+//
+// Authorization is left to the caller, typically via interceptors.
+type Server struct {
+	queue *config.TestGroupQueue
+}
+
+var _ queuepb.QueueServer = (*Server)(nil)
+
+// NewServer returns a server for the queue.
+func NewServer(q *config.TestGroupQueue) *Server {
+	return &Server{
+		queue: q,
+	}
+}
+
+// ListItems returns a page of groups, ordered by name.
+//
+// Page tokens encode the last name returned, so paging remains consistent
+// while the queue dispatches and reschedules groups. Groups added behind
+// the token are not returned.
+func (s *Server) ListItems(ctx context.Context, req *queuepb.ListItemsRequest) (*queuepb.ListItemsResponse, error) {
+	size := int(req.GetPageSize())
+	switch {
+	case size < 0:
+		return nil, status.Errorf(codes.InvalidArgument, "negative page size: %d", size)
+	case size == 0:
+		size = DefaultPageSize
+	case size > MaxPageSize:
+		size = MaxPageSize
+	}
+	after, err := decodeToken(req.GetPageToken())
+	if err != nil {
+		return nil, status.Errorf(codes.InvalidArgument, "bad page token: %v", err)
+	}
+
+	items := s.queue.Items()
+	sort.Slice(items, func(i, j int) bool { return items[i].Name < items[j].Name })
+	start := sort.Search(len(items), func(i int) bool { return items[i].Name > after })
+	items = items[start:]
+
+	var resp queuepb.ListItemsResponse
+	if len(items) > size {
+		items = items[:size]
+		resp.NextPageToken = encodeToken(items[size-1].Name)
+	}
+	for _, it := range items {
+		resp.Items = append(resp.Items, item(it.Name, it.When))
+	}
+	return &resp, nil
+}
+
+// GetItem returns when a group is next due.
+func (s *Server) GetItem(ctx context.Context, req *queuepb.GetItemRequest) (*queuepb.Item, error) {
+	if req.GetName() == "" {
+		return nil, status.Error(codes.InvalidArgument, "empty name")
+	}
+	when, err := s.queue.When(req.GetName())
+	if err != nil {
+		return nil, queueError(req.GetName(), err)
+	}
+	return item(req.GetName(), when), nil
+}
+
+// Fix changes when a group is next due.
+func (s *Server) Fix(ctx context.Context, req *queuepb.FixRequest) (*queuepb.Item, error) {
+	if req.GetName() == "" {
+		return nil, status.Error(codes.InvalidArgument, "empty name")
+	}
+	if err := s.queue.FixProto(req.GetName(), req.GetWhen()); err != nil {
+		return nil, queueError(req.GetName(), err)
+	}
+	return s.GetItem(ctx, &queuepb.GetItemRequest{Name: req.GetName()})
+}
+
+// Prioritize moves a group to the front of the queue.
+func (s *Server) Prioritize(ctx context.Context, req *queuepb.PrioritizeRequest) (*queuepb.Item, error) {
+	if req.GetName() == "" {
+		return nil, status.Error(codes.InvalidArgument, "empty name")
+	}
+	when, err := s.queue.Prioritize(req.GetName())
+	if err != nil {
+		return nil, queueError(req.GetName(), err)
+	}
+	return item(req.GetName(), when), nil
+}
+
+// Status summarizes the queue.
+func (s *Server) Status(ctx context.Context, req *queuepb.StatusRequest) (*queuepb.StatusResponse, error) {
+	_, next, when := s.queue.Status()
+	stats := s.queue.Stats()
+	overdue, behind := s.queue.Overdue(s.queue.Now())
+	resp := queuepb.StatusResponse{
+		Depth:         int32(stats.Depth),
+		Overdue:       int32(overdue),
+		BehindSeconds: behind.Seconds(),
+		Sending:       s.queue.Sending(),
+		Rejected:      int64(stats.Rejected),
+		Delivered:     stats.Delivered,
+		Requeued:      stats.Requeued,
+		Filtered:      stats.Filtered,
+	}
+	if next != nil {
+		resp.Next = item(next.Name, when)
+	}
+	if deadline, ok := s.queue.SleepDeadline(); ok {
+		resp.Sleeping = true
+		resp.SleepDeadline = timestamppb.New(deadline)
+	}
+	return &resp, nil
+}
+
+func item(name string, when time.Time) *queuepb.Item {
+	return &queuepb.Item{
+		Name: name,
+		When: timestamppb.New(when),
+	}
+}
+
+// queueError converts a queue error into a status error.
+func queueError(name string, err error) error {
+	switch {
+	case errors.Is(err, config.ErrNotFound):
+		return status.Errorf(codes.NotFound, "group %q not found", name)
+	case errors.Is(err, config.ErrInvalidTime):
+		return status.Error(codes.InvalidArgument, err.Error())
+	case errors.Is(err, config.ErrSealed):
+		return status.Error(codes.FailedPrecondition, err.Error())
+	case errors.Is(err, config.ErrReentrant):
+		return status.Error(codes.Unavailable, err.Error())
+	}
+	return status.Error(codes.Internal, err.Error())
+}
+
+func encodeToken(name string) string {
+	return base64.RawURLEncoding.EncodeToString([]byte(name))
+}
+
+func decodeToken(token string) (string, error) {
+	b, err := base64.RawURLEncoding.DecodeString(token)
+	if err != nil {
+		return "", err
+	}
+	if len(b) > config.MaxGroupNameLength || !utf8.Valid(b) {
+		return "", errors.New("not a group name")
+	}
+	return string(b), nil
+}
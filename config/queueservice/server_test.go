@@ -0,0 +1,459 @@
+/*
+Copyright 2021 The TestGrid Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package queueservice
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/GoogleCloudPlatform/testgrid/config"
+	configpb "github.com/GoogleCloudPlatform/testgrid/pb/config"
+	queuepb "github.com/GoogleCloudPlatform/testgrid/pb/queue"
+	"github.com/google/go-cmp/cmp"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/grpc/test/bufconn"
+	"google.golang.org/protobuf/testing/protocmp"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+// live serves a queue of the named groups, due at when, while Send runs.
+func live(t *testing.T, when time.Time, names ...string) (queuepb.QueueClient, *config.TestGroupQueue, <-chan *configpb.TestGroup) {
+	t.Helper()
+	var groups []*configpb.TestGroup
+	for _, name := range names {
+		groups = append(groups, &configpb.TestGroup{Name: name})
+	}
+	var q config.TestGroupQueue
+	if err := q.Init(groups, when); err != nil {
+		t.Fatalf("Init() got unexpected error: %v", err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	receivers := make(chan *configpb.TestGroup, len(names))
+	sent := make(chan error)
+	go func() {
+		sent <- q.Send(ctx, receivers, time.Hour)
+	}()
+	t.Cleanup(func() {
+		cancel()
+		<-sent
+	})
+
+	lis := bufconn.Listen(1 << 20)
+	srv := grpc.NewServer()
+	queuepb.RegisterQueueServer(srv, NewServer(&q))
+	go srv.Serve(lis)
+	t.Cleanup(srv.Stop)
+
+	conn, err := grpc.DialContext(ctx, "bufnet",
+		grpc.WithContextDialer(func(context.Context, string) (net.Conn, error) {
+			return lis.Dial()
+		}),
+		grpc.WithInsecure(),
+	)
+	if err != nil {
+		t.Fatalf("DialContext() got unexpected error: %v", err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	return queuepb.NewQueueClient(conn), &q, receivers
+}
+
+func TestListItems(t *testing.T) {
+	when := time.Now().Add(time.Hour).Round(time.Second)
+	names := []string{"delta", "alpha", "echo", "charlie", "bravo"}
+	cases := []struct {
+		name string
+		req  *queuepb.ListItemsRequest
+		want *queuepb.ListItemsResponse
+		code codes.Code
+	}{
+		{
+			name: "all",
+			req:  &queuepb.ListItemsRequest{},
+			want: &queuepb.ListItemsResponse{
+				Items: []*queuepb.Item{
+					{Name: "alpha", When: timestamppb.New(when)},
+					{Name: "bravo", When: timestamppb.New(when)},
+					{Name: "charlie", When: timestamppb.New(when)},
+					{Name: "delta", When: timestamppb.New(when)},
+					{Name: "echo", When: timestamppb.New(when)},
+				},
+			},
+		},
+		{
+			name: "first page",
+			req: &queuepb.ListItemsRequest{
+				PageSize: 2,
+			},
+			want: &queuepb.ListItemsResponse{
+				Items: []*queuepb.Item{
+					{Name: "alpha", When: timestamppb.New(when)},
+					{Name: "bravo", When: timestamppb.New(when)},
+				},
+				NextPageToken: encodeToken("bravo"),
+			},
+		},
+		{
+			name: "middle page",
+			req: &queuepb.ListItemsRequest{
+				PageSize:  2,
+				PageToken: encodeToken("bravo"),
+			},
+			want: &queuepb.ListItemsResponse{
+				Items: []*queuepb.Item{
+					{Name: "charlie", When: timestamppb.New(when)},
+					{Name: "delta", When: timestamppb.New(when)},
+				},
+				NextPageToken: encodeToken("delta"),
+			},
+		},
+		{
+			name: "last page",
+			req: &queuepb.ListItemsRequest{
+				PageSize:  2,
+				PageToken: encodeToken("delta"),
+			},
+			want: &queuepb.ListItemsResponse{
+				Items: []*queuepb.Item{
+					{Name: "echo", When: timestamppb.New(when)},
+				},
+			},
+		},
+		{
+			name: "token for removed group",
+			req: &queuepb.ListItemsRequest{
+				PageToken: encodeToken("bz"),
+			},
+			want: &queuepb.ListItemsResponse{
+				Items: []*queuepb.Item{
+					{Name: "charlie", When: timestamppb.New(when)},
+					{Name: "delta", When: timestamppb.New(when)},
+					{Name: "echo", When: timestamppb.New(when)},
+				},
+			},
+		},
+		{
+			name: "exact page",
+			req: &queuepb.ListItemsRequest{
+				PageSize: 5,
+			},
+			want: &queuepb.ListItemsResponse{
+				Items: []*queuepb.Item{
+					{Name: "alpha", When: timestamppb.New(when)},
+					{Name: "bravo", When: timestamppb.New(when)},
+					{Name: "charlie", When: timestamppb.New(when)},
+					{Name: "delta", When: timestamppb.New(when)},
+					{Name: "echo", When: timestamppb.New(when)},
+				},
+			},
+		},
+		{
+			name: "negative page size",
+			req: &queuepb.ListItemsRequest{
+				PageSize: -1,
+			},
+			code: codes.InvalidArgument,
+		},
+		{
+			name: "malformed token",
+			req: &queuepb.ListItemsRequest{
+				PageToken: "!!!",
+			},
+			code: codes.InvalidArgument,
+		},
+		{
+			name: "token is not a name",
+			req: &queuepb.ListItemsRequest{
+				PageToken: encodeToken("\xff"),
+			},
+			code: codes.InvalidArgument,
+		},
+	}
+
+	client, _, _ := live(t, when, names...)
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			got, err := client.ListItems(context.Background(), tc.req)
+			if code := status.Code(err); code != tc.code {
+				t.Fatalf("ListItems() got code %s, want %s: %v", code, tc.code, err)
+			}
+			if diff := cmp.Diff(tc.want, got, protocmp.Transform()); diff != "" {
+				t.Errorf("ListItems() got unexpected diff (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestListItemsWhileSending(t *testing.T) {
+	now := time.Now()
+	var names []string
+	for i := 0; i < 50; i++ {
+		names = append(names, fmt.Sprintf("group-%02d", i))
+	}
+	client, q, receivers := live(t, now.Add(time.Hour), names...)
+
+	seen := map[string]int{}
+	var token string
+	for i := 0; ; i++ {
+		// Shuffle the schedule between pages.
+		if _, err := q.Prioritize(names[len(names)-1-i]); err != nil {
+			t.Fatalf("Prioritize() got unexpected error: %v", err)
+		}
+		<-receivers
+		resp, err := client.ListItems(context.Background(), &queuepb.ListItemsRequest{
+			PageSize:  7,
+			PageToken: token,
+		})
+		if err != nil {
+			t.Fatalf("ListItems() got unexpected error: %v", err)
+		}
+		for _, it := range resp.Items {
+			seen[it.Name]++
+		}
+		if token = resp.NextPageToken; token == "" {
+			break
+		}
+	}
+	for _, name := range names {
+		if seen[name] != 1 {
+			t.Errorf("ListItems() returned %s %d times, wanted once", name, seen[name])
+		}
+	}
+}
+
+func TestGetItem(t *testing.T) {
+	when := time.Now().Add(time.Hour).Round(time.Second)
+	cases := []struct {
+		name string
+		req  *queuepb.GetItemRequest
+		want *queuepb.Item
+		code codes.Code
+	}{
+		{
+			name: "basic",
+			req:  &queuepb.GetItemRequest{Name: "hello"},
+			want: &queuepb.Item{Name: "hello", When: timestamppb.New(when)},
+		},
+		{
+			name: "unknown",
+			req:  &queuepb.GetItemRequest{Name: "missing"},
+			code: codes.NotFound,
+		},
+		{
+			name: "empty",
+			req:  &queuepb.GetItemRequest{},
+			code: codes.InvalidArgument,
+		},
+	}
+
+	client, _, _ := live(t, when, "hello", "world")
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			got, err := client.GetItem(context.Background(), tc.req)
+			if code := status.Code(err); code != tc.code {
+				t.Fatalf("GetItem() got code %s, want %s: %v", code, tc.code, err)
+			}
+			if diff := cmp.Diff(tc.want, got, protocmp.Transform()); diff != "" {
+				t.Errorf("GetItem() got unexpected diff (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestFix(t *testing.T) {
+	now := time.Now().Round(time.Second)
+	cases := []struct {
+		name   string
+		sealed bool
+		req    *queuepb.FixRequest
+		want   *queuepb.Item
+		code   codes.Code
+	}{
+		{
+			name: "basic",
+			req: &queuepb.FixRequest{
+				Name: "hello",
+				When: timestamppb.New(now.Add(2 * time.Hour)),
+			},
+			want: &queuepb.Item{Name: "hello", When: timestamppb.New(now.Add(2 * time.Hour))},
+		},
+		{
+			name: "unknown",
+			req: &queuepb.FixRequest{
+				Name: "missing",
+				When: timestamppb.New(now.Add(2 * time.Hour)),
+			},
+			code: codes.NotFound,
+		},
+		{
+			name: "empty name",
+			req: &queuepb.FixRequest{
+				When: timestamppb.New(now.Add(2 * time.Hour)),
+			},
+			code: codes.InvalidArgument,
+		},
+		{
+			name: "missing when",
+			req: &queuepb.FixRequest{
+				Name: "hello",
+			},
+			code: codes.InvalidArgument,
+		},
+		{
+			name: "epoch",
+			req: &queuepb.FixRequest{
+				Name: "hello",
+				When: &timestamppb.Timestamp{},
+			},
+			code: codes.InvalidArgument,
+		},
+		{
+			name: "invalid",
+			req: &queuepb.FixRequest{
+				Name: "hello",
+				When: &timestamppb.Timestamp{Seconds: now.Unix(), Nanos: -1},
+			},
+			code: codes.InvalidArgument,
+		},
+		{
+			name: "far future",
+			req: &queuepb.FixRequest{
+				Name: "hello",
+				When: timestamppb.New(now.Add(2 * config.MaxProtoDelay)),
+			},
+			code: codes.InvalidArgument,
+		},
+		{
+			name:   "sealed",
+			sealed: true,
+			req: &queuepb.FixRequest{
+				Name: "hello",
+				When: timestamppb.New(now.Add(2 * time.Hour)),
+			},
+			code: codes.FailedPrecondition,
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			client, q, _ := live(t, now.Add(time.Hour), "hello", "world")
+			if tc.sealed {
+				q.Seal()
+			}
+			got, err := client.Fix(context.Background(), tc.req)
+			if code := status.Code(err); code != tc.code {
+				t.Fatalf("Fix() got code %s, want %s: %v", code, tc.code, err)
+			}
+			if diff := cmp.Diff(tc.want, got, protocmp.Transform()); diff != "" {
+				t.Errorf("Fix() got unexpected diff (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestPrioritize(t *testing.T) {
+	cases := []struct {
+		name string
+		req  *queuepb.PrioritizeRequest
+		code codes.Code
+	}{
+		{
+			name: "basic",
+			req:  &queuepb.PrioritizeRequest{Name: "world"},
+		},
+		{
+			name: "unknown",
+			req:  &queuepb.PrioritizeRequest{Name: "missing"},
+			code: codes.NotFound,
+		},
+		{
+			name: "empty",
+			req:  &queuepb.PrioritizeRequest{},
+			code: codes.InvalidArgument,
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			client, _, receivers := live(t, time.Now().Add(time.Hour), "hello", "world")
+			got, err := client.Prioritize(context.Background(), tc.req)
+			if code := status.Code(err); code != tc.code {
+				t.Fatalf("Prioritize() got code %s, want %s: %v", code, tc.code, err)
+			}
+			if err != nil {
+				return
+			}
+			if got.Name != tc.req.Name {
+				t.Errorf("Prioritize() got name %q, want %q", got.Name, tc.req.Name)
+			}
+			select {
+			case tg := <-receivers:
+				if tg.Name != tc.req.Name {
+					t.Errorf("Send() delivered %q, want %q", tg.Name, tc.req.Name)
+				}
+			case <-time.After(10 * time.Second):
+				t.Errorf("Send() did not deliver %q", tc.req.Name)
+			}
+		})
+	}
+}
+
+func TestStatus(t *testing.T) {
+	when := time.Now().Add(time.Hour).Round(time.Second)
+	client, q, _ := live(t, when, "hello", "world")
+
+	for !q.IsSleeping() {
+		time.Sleep(time.Millisecond)
+	}
+	got, err := client.Status(context.Background(), &queuepb.StatusRequest{})
+	if err != nil {
+		t.Fatalf("Status() got unexpected error: %v", err)
+	}
+	if deadline := got.SleepDeadline.AsTime(); deadline.Sub(when).Round(time.Second) != 0 {
+		t.Errorf("Status() got sleep deadline %v, want %v", deadline, when)
+	}
+	got.SleepDeadline = nil
+	want := &queuepb.StatusResponse{
+		Depth:    2,
+		Next:     &queuepb.Item{Name: "hello", When: timestamppb.New(when)},
+		Sending:  true,
+		Sleeping: true,
+	}
+	if diff := cmp.Diff(want, got, protocmp.Transform()); diff != "" {
+		t.Errorf("Status() got unexpected diff (-want +got):\n%s", diff)
+	}
+}
+
+func TestStatusClock(t *testing.T) {
+	now := time.Date(2100, 1, 2, 3, 4, 5, 0, time.UTC) // after the real clock
+	q := config.NewTestGroupQueue(config.WithClock(config.NewFakeClock(now)))
+	q.Init([]*configpb.TestGroup{{Name: "hello"}, {Name: "world"}}, now.Add(-time.Minute))
+	q.Fix("world", now.Add(time.Minute))
+
+	got, err := NewServer(q).Status(context.Background(), &queuepb.StatusRequest{})
+	if err != nil {
+		t.Fatalf("Status() got unexpected error: %v", err)
+	}
+	if got.Overdue != 1 || got.BehindSeconds != 60 {
+		t.Errorf("Status() got %d overdue, %vs behind, want 1 overdue, 60s behind", got.Overdue, got.BehindSeconds)
+	}
+}
@@ -0,0 +1,81 @@
+/*
+Copyright 2021 The TestGrid Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package queuesignal lets operators inspect and kick a running TestGroupQueue with signals.
+package queuesignal
+
+import (
+	"time"
+
+	"github.com/GoogleCloudPlatform/testgrid/config"
+	"github.com/sirupsen/logrus"
+)
+
+// TopOverdue is the most overdue groups Dump logs individually.
+const TopOverdue = 20
+
+// Dump logs a summary of the queue and its TopOverdue most overdue groups.
+func Dump(log logrus.FieldLogger, q *config.TestGroupQueue, now time.Time) {
+	stats := q.Stats()
+	overdue, behind := q.Overdue(now)
+	log.WithFields(logrus.Fields{
+		"depth":     stats.Depth,
+		"overdue":   overdue,
+		"behind":    behind,
+		"delivered": stats.Delivered,
+		"requeued":  stats.Requeued,
+		"filtered":  stats.Filtered,
+		"skips":     q.SkipStats(),
+	}).Info("Queue summary")
+	if overdue == 0 {
+		return
+	}
+	for i, it := range q.Items() {
+		if i == TopOverdue || !it.When.Before(now) {
+			break
+		}
+		log.WithFields(logrus.Fields{
+			"rank":   i + 1,
+			"group":  it.Name,
+			"when":   it.When,
+			"behind": now.Sub(it.When),
+			"paused": it.Paused,
+		}).Info("Overdue group")
+	}
+}
+
+// Kick prioritizes every overdue group, returning how many it prioritized.
+//
+// Overdue groups keep their relative order, and skip any minimum spacing
+// on their next dispatch, see config.WithMinSpacing.
+func Kick(log logrus.FieldLogger, q *config.TestGroupQueue, now time.Time) int {
+	var overdue []string
+	for _, it := range q.Items() {
+		if !it.When.Before(now) {
+			break
+		}
+		overdue = append(overdue, it.Name)
+	}
+	var n int
+	for i := len(overdue) - 1; i >= 0; i-- { // each moves ahead of the last
+		if _, err := q.Prioritize(overdue[i]); err != nil {
+			continue // removed since listing
+		}
+		n++
+	}
+	log.WithField("groups", n).Info("Kicked overdue groups")
+	return n
+}
@@ -0,0 +1,142 @@
+/*
+Copyright 2021 The TestGrid Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package queuesignal
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/GoogleCloudPlatform/testgrid/config"
+	configpb "github.com/GoogleCloudPlatform/testgrid/pb/config"
+	"github.com/google/go-cmp/cmp"
+	logtest "github.com/sirupsen/logrus/hooks/test"
+)
+
+func TestDump(t *testing.T) {
+	now := time.Date(2021, 1, 2, 3, 4, 5, 0, time.UTC)
+	cases := []struct {
+		name    string
+		overdue int
+		future  int
+		want    []string
+	}{
+		{
+			name: "empty",
+			want: []string{"Queue summary"},
+		},
+		{
+			name:   "none overdue",
+			future: 3,
+			want:   []string{"Queue summary"},
+		},
+		{
+			name:    "some overdue",
+			overdue: 2,
+			future:  1,
+			want:    []string{"Queue summary", "Overdue group", "Overdue group"},
+		},
+		{
+			name:    "top overdue",
+			overdue: TopOverdue + 5,
+			want: func() []string {
+				want := []string{"Queue summary"}
+				for i := 0; i < TopOverdue; i++ {
+					want = append(want, "Overdue group")
+				}
+				return want
+			}(),
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			var q config.TestGroupQueue
+			var groups []*configpb.TestGroup
+			whens := map[string]time.Time{}
+			for i := 0; i < tc.overdue; i++ {
+				name := fmt.Sprintf("overdue-%02d", i)
+				groups = append(groups, &configpb.TestGroup{Name: name})
+				whens[name] = now.Add(-time.Duration(tc.overdue-i) * time.Minute)
+			}
+			for i := 0; i < tc.future; i++ {
+				name := fmt.Sprintf("future-%02d", i)
+				groups = append(groups, &configpb.TestGroup{Name: name})
+				whens[name] = now.Add(time.Duration(i+1) * time.Minute)
+			}
+			q.InitSchedule(groups, now, whens)
+
+			log, hook := logtest.NewNullLogger()
+			Dump(log, &q, now)
+			var got []string
+			for _, entry := range hook.AllEntries() {
+				got = append(got, entry.Message)
+			}
+			if diff := cmp.Diff(tc.want, got); diff != "" {
+				t.Errorf("Dump() got unexpected diff (-want +got):\n%s", diff)
+			}
+			summary := hook.AllEntries()[0].Data
+			if got, want := summary["depth"], tc.overdue+tc.future; got != want {
+				t.Errorf("Dump() got depth %v, want %d", got, want)
+			}
+			if got := summary["overdue"]; got != tc.overdue {
+				t.Errorf("Dump() got %v overdue, want %d", got, tc.overdue)
+			}
+			if tc.overdue > 0 {
+				first := hook.AllEntries()[1].Data
+				if got, want := first["group"], "overdue-00"; got != want {
+					t.Errorf("Dump() got most overdue %v, want %s", got, want)
+				}
+				if got, want := first["behind"], time.Duration(tc.overdue)*time.Minute; got != want {
+					t.Errorf("Dump() got most overdue behind %v, want %s", got, want)
+				}
+			}
+		})
+	}
+}
+
+func TestKick(t *testing.T) {
+	now := time.Date(2021, 1, 2, 3, 4, 5, 0, time.UTC)
+	var q config.TestGroupQueue
+	q.InitSchedule([]*configpb.TestGroup{
+		{Name: "future"},
+		{Name: "late"},
+		{Name: "later"},
+		{Name: "latest"},
+	}, now, map[string]time.Time{
+		"future": now.Add(time.Minute),
+		"late":   now.Add(-time.Minute),
+		"later":  now.Add(-time.Hour),
+		"latest": now.Add(-24 * time.Hour),
+	})
+
+	log, _ := logtest.NewNullLogger()
+	if got, want := Kick(log, &q, now), 3; got != want {
+		t.Errorf("Kick() got %d, want %d", got, want)
+	}
+	var got []string
+	for _, it := range q.Items() {
+		got = append(got, it.Name)
+	}
+	want := []string{"latest", "later", "late", "future"}
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Errorf("Kick() got unexpected order (-want +got):\n%s", diff)
+	}
+	if when, err := q.When("future"); err != nil || !when.Equal(now.Add(time.Minute)) {
+		t.Errorf("Kick() moved future group to %v, %v", when, err)
+	}
+}
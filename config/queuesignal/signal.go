@@ -0,0 +1,57 @@
+//go:build !windows
+// +build !windows
+
+/*
+Copyright 2021 The TestGrid Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package queuesignal
+
+import (
+	"context"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"github.com/GoogleCloudPlatform/testgrid/config"
+	"github.com/sirupsen/logrus"
+)
+
+// HandleSignals dumps the queue on SIGUSR1 and kicks it on SIGUSR2 until ctx is canceled.
+//
+// Opt-in for quick intervention on a running pod, see Dump and Kick.
+// Handles signals in its own goroutine, so delivery never waits on the queue.
+func HandleSignals(ctx context.Context, q *config.TestGroupQueue) {
+	ch := make(chan os.Signal, 1)
+	signal.Notify(ch, syscall.SIGUSR1, syscall.SIGUSR2)
+	go func() {
+		defer signal.Stop(ch)
+		log := logrus.WithField("queue", "signal")
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case sig := <-ch:
+				switch sig {
+				case syscall.SIGUSR1:
+					Dump(log, q, time.Now())
+				case syscall.SIGUSR2:
+					Kick(log, q, time.Now())
+				}
+			}
+		}
+	}()
+}
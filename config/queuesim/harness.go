@@ -0,0 +1,220 @@
+/*
+Copyright 2021 The TestGrid Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package queuesim simulates an updater draining a TestGroupQueue in virtual time.
+package queuesim
+
+import (
+	"context"
+	"errors"
+	"sort"
+	"time"
+
+	"github.com/GoogleCloudPlatform/testgrid/config"
+	configpb "github.com/GoogleCloudPlatform/testgrid/pb/config"
+)
+
+// Worker processes a group, returning how long it took and whether it failed.
+type Worker func(name string) (time.Duration, error)
+
+// Dispatch records a group Send dispatched and how the worker processed it.
+type Dispatch struct {
+	Group string
+	// Time a worker started processing the group, after any wait for a free worker.
+	Time time.Time
+	// Done is when the worker finished, or zero if still processing when Run returned.
+	Done time.Time
+	Took time.Duration
+	Err  error
+}
+
+// Harness runs the queue's Send against a pool of simulated workers in virtual time.
+//
+// Everything runs on the goroutine calling Run: Send sleeps by advancing
+// the virtual clock, finishing any work due before it wakes, so runs are
+// deterministic. Workers Ack each group when they finish, see
+// config.TestGroupQueue.AckDuration. Use the queue only between runs, or
+// from Worker and Backoff.
+type Harness struct {
+	// Queue the harness sends from, initialized with the harness's clock.
+	Queue *config.TestGroupQueue
+	// Worker processes each group Send dispatches.
+	Worker Worker
+	// Workers processing groups at once, defaulting to 1.
+	// Send waits for a free worker before dispatching the next group.
+	Workers int
+	// Frequency passed to Send.
+	Frequency time.Duration
+	// Backoff, if set, reschedules a group after each failure, given the
+	// number of consecutive failures, rather than by Frequency.
+	Backoff func(name string, failures int) time.Duration
+
+	now      time.Time
+	end      time.Time
+	cancel   context.CancelFunc
+	running  []*job // by when they finish
+	failures map[string]int
+	log      []*Dispatch
+}
+
+// job is a group a worker is processing.
+type job struct {
+	done time.Time
+	d    *Dispatch
+	err  error
+}
+
+// NewHarness returns a harness starting at now, with an empty queue created with opts.
+func NewHarness(now time.Time, worker Worker, frequency time.Duration, opts ...config.QueueOption) *Harness {
+	h := &Harness{
+		Worker:    worker,
+		Frequency: frequency,
+		now:       now,
+		failures:  map[string]int{},
+	}
+	h.Queue = config.NewTestGroupQueue(append(opts, config.WithClock(simClock{h}))...)
+	return h
+}
+
+// Now returns the virtual time.
+func (h *Harness) Now() time.Time {
+	return h.now
+}
+
+// Run sends groups from the queue for d of virtual time, returning the dispatches in order.
+//
+// Groups still processing when Run returns finish during the next Run.
+// Returns early with any error from Send, or nil once Send returns after
+// sending every group with a zero Frequency.
+func (h *Harness) Run(d time.Duration) ([]Dispatch, error) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	h.end = h.now.Add(d)
+	h.cancel = cancel
+	h.log = nil
+
+	err := h.Queue.SendFunc(ctx, h.handle, h.Frequency)
+	if errors.Is(err, context.Canceled) && ctx.Err() != nil {
+		err = nil
+	}
+	out := make([]Dispatch, 0, len(h.log))
+	for _, d := range h.log {
+		out = append(out, *d)
+	}
+	return out, err
+}
+
+// handle starts processing the group once a worker is free.
+func (h *Harness) handle(ctx context.Context, tg *configpb.TestGroup) error {
+	workers := h.Workers
+	if workers <= 0 {
+		workers = 1
+	}
+	for len(h.running) >= workers {
+		done := h.running[0].done
+		if !done.Before(h.end) {
+			h.now = h.end
+			h.cancel()
+			return ctx.Err()
+		}
+		h.finish(done)
+	}
+	took, err := h.Worker(tg.Name)
+	d := &Dispatch{Group: tg.Name, Time: h.now}
+	h.log = append(h.log, d)
+	j := &job{done: h.now.Add(took), d: d, err: err}
+	i := sort.Search(len(h.running), func(i int) bool { return h.running[i].done.After(j.done) })
+	h.running = append(h.running, nil)
+	copy(h.running[i+1:], h.running[i:])
+	h.running[i] = j
+	return nil
+}
+
+// finish advances the clock to when, acking the groups workers finish by then.
+func (h *Harness) finish(when time.Time) {
+	h.now = when
+	for len(h.running) > 0 && !h.running[0].done.After(when) {
+		j := h.running[0]
+		h.running = h.running[1:]
+		d := j.d
+		d.Done, d.Took, d.Err = when, when.Sub(d.Time), j.err
+		h.Queue.AckDuration(d.Group, j.err, d.Took) // removed groups are fine
+		if j.err == nil {
+			delete(h.failures, d.Group)
+			continue
+		}
+		h.failures[d.Group]++
+		if h.Backoff != nil {
+			h.Queue.Fix(d.Group, when.Add(h.Backoff(d.Group, h.failures[d.Group])))
+		}
+	}
+}
+
+// sleep advances the clock on behalf of Send, returning whether Send should wake.
+//
+// Wakes Send after finishing any work due before deadline, so it sees
+// their results, and otherwise at the deadline. Never wakes Send at or
+// after the end of the run, which cancels it instead.
+func (h *Harness) sleep(deadline time.Time) bool {
+	if len(h.running) > 0 {
+		if done := h.running[0].done; !done.After(deadline) && done.Before(h.end) {
+			h.finish(done)
+			return true
+		}
+	}
+	if !deadline.Before(h.end) {
+		h.finish(h.end)
+		h.cancel()
+		return false
+	}
+	h.now = deadline
+	return true
+}
+
+// simClock is the harness's virtual clock.
+type simClock struct {
+	h *Harness
+}
+
+func (c simClock) Now() time.Time {
+	return c.h.now
+}
+
+func (c simClock) NewTimer(d time.Duration) config.Timer {
+	t := simTimer{make(chan time.Time, 1)}
+	if d <= 0 || c.h.sleep(c.h.now.Add(d)) {
+		t.ch <- c.h.now
+	}
+	return t
+}
+
+// simTimer fires when created, or never.
+type simTimer struct {
+	ch chan time.Time
+}
+
+func (t simTimer) C() <-chan time.Time {
+	return t.ch
+}
+
+func (t simTimer) Stop() bool {
+	select {
+	case <-t.ch:
+		return false
+	default:
+		return true
+	}
+}
@@ -0,0 +1,185 @@
+/*
+Copyright 2021 The TestGrid Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package queuesim
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/GoogleCloudPlatform/testgrid/config"
+	configpb "github.com/GoogleCloudPlatform/testgrid/pb/config"
+	"github.com/google/go-cmp/cmp"
+	"github.com/google/go-cmp/cmp/cmpopts"
+)
+
+var start = time.Date(2021, 1, 2, 3, 4, 5, 0, time.UTC)
+
+// at returns the time d after start.
+func at(d time.Duration) time.Time {
+	return start.Add(d)
+}
+
+// times returns when each group was dispatched, and whether each failed.
+func times(log []Dispatch) (map[string][]time.Duration, map[string][]bool) {
+	when := map[string][]time.Duration{}
+	failed := map[string][]bool{}
+	for _, d := range log {
+		when[d.Group] = append(when[d.Group], d.Time.Sub(start))
+		failed[d.Group] = append(failed[d.Group], d.Err != nil)
+	}
+	return when, failed
+}
+
+func TestSteadyState(t *testing.T) {
+	h := NewHarness(start, func(string) (time.Duration, error) {
+		return time.Minute, nil
+	}, 10*time.Minute)
+	h.Workers = 2
+	h.Queue.Init([]*configpb.TestGroup{{Name: "a"}, {Name: "b"}, {Name: "c"}}, start)
+
+	got, err := h.Run(30 * time.Minute)
+	if err != nil {
+		t.Fatalf("Run() got unexpected error: %v", err)
+	}
+	dispatch := func(name string, when time.Duration) Dispatch {
+		return Dispatch{Group: name, Time: at(when), Done: at(when + time.Minute), Took: time.Minute}
+	}
+	want := []Dispatch{
+		dispatch("a", 0),
+		dispatch("b", 0),
+		dispatch("c", time.Minute), // waits for a worker
+		dispatch("a", 10*time.Minute),
+		dispatch("b", 10*time.Minute),
+		dispatch("c", 11*time.Minute),
+		dispatch("a", 20*time.Minute),
+		dispatch("b", 20*time.Minute),
+		dispatch("c", 21*time.Minute),
+	}
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Errorf("Run() got unexpected dispatches (-want +got):\n%s", diff)
+	}
+	if !h.Now().Equal(at(30 * time.Minute)) {
+		t.Errorf("Now() got %s, want %s", h.Now(), at(30*time.Minute))
+	}
+}
+
+func TestFailureStorm(t *testing.T) {
+	var h *Harness
+	h = NewHarness(start, func(name string) (time.Duration, error) {
+		if name == "flaky" && h.Now().Before(at(time.Hour)) {
+			return time.Minute, errors.New("storm")
+		}
+		return time.Minute, nil
+	}, 10*time.Minute)
+	h.Workers = 2
+	h.Backoff = func(_ string, failures int) time.Duration {
+		return time.Minute << (failures - 1)
+	}
+	h.Queue.Init([]*configpb.TestGroup{{Name: "flaky"}, {Name: "healthy"}}, start)
+
+	got, err := h.Run(100 * time.Minute)
+	if err != nil {
+		t.Fatalf("Run() got unexpected error: %v", err)
+	}
+	when, failed := times(got)
+	wantWhen := map[string][]time.Duration{
+		"flaky": {
+			0,
+			2 * time.Minute,  // 1m after failing
+			5 * time.Minute,  // 2m after failing
+			10 * time.Minute, // 4m
+			19 * time.Minute, // 8m
+			36 * time.Minute, // 16m
+			69 * time.Minute, // 32m, after the storm
+			79 * time.Minute,
+			89 * time.Minute,
+			99 * time.Minute,
+		},
+		"healthy": {
+			0,
+			10 * time.Minute,
+			20 * time.Minute,
+			30 * time.Minute,
+			40 * time.Minute,
+			50 * time.Minute,
+			60 * time.Minute,
+			70 * time.Minute,
+			80 * time.Minute,
+			90 * time.Minute,
+		},
+	}
+	if diff := cmp.Diff(wantWhen, when); diff != "" {
+		t.Errorf("Run() got unexpected dispatch times (-want +got):\n%s", diff)
+	}
+	wantFailed := map[string][]bool{
+		"flaky":   {true, true, true, true, true, true, false, false, false, false},
+		"healthy": make([]bool, 10),
+	}
+	if diff := cmp.Diff(wantFailed, failed); diff != "" {
+		t.Errorf("Run() got unexpected failures (-want +got):\n%s", diff)
+	}
+}
+
+func TestErrorBudget(t *testing.T) {
+	var h *Harness
+	h = NewHarness(start, func(name string) (time.Duration, error) {
+		if name == "failing" {
+			return time.Minute, errors.New("boom")
+		}
+		return time.Minute, nil
+	}, 10*time.Minute, config.WithErrorBudget(1, time.Hour))
+	h.Queue.Init([]*configpb.TestGroup{{Name: "failing"}, {Name: "healthy"}}, start)
+
+	got, err := h.Run(21 * time.Minute)
+	if err != nil {
+		t.Fatalf("Run() got unexpected error: %v", err)
+	}
+	when, _ := times(got)
+	want := map[string][]time.Duration{
+		"failing": {0, 11 * time.Minute}, // after the healthy group, once over budget
+		"healthy": {time.Minute, 10 * time.Minute, 20 * time.Minute},
+	}
+	if diff := cmp.Diff(want, when); diff != "" {
+		t.Errorf("Run() got unexpected dispatch times (-want +got):\n%s", diff)
+	}
+}
+
+func TestRunContinues(t *testing.T) {
+	h := NewHarness(start, func(string) (time.Duration, error) {
+		return 15 * time.Minute, nil
+	}, 0)
+	h.Queue.Init([]*configpb.TestGroup{{Name: "a"}, {Name: "b"}}, start)
+
+	first, err := h.Run(10 * time.Minute)
+	if err != nil {
+		t.Fatalf("Run() got unexpected error: %v", err)
+	}
+	want := []Dispatch{{Group: "a", Time: start}} // still processing
+	if diff := cmp.Diff(want, first); diff != "" {
+		t.Errorf("Run() got unexpected dispatches (-want +got):\n%s", diff)
+	}
+
+	second, err := h.Run(time.Hour)
+	if err != nil {
+		t.Fatalf("Run() got unexpected error: %v", err)
+	}
+	want = []Dispatch{{Group: "b", Time: at(15 * time.Minute)}} // Send returns once the queue is empty
+	if diff := cmp.Diff(want, second, cmpopts.IgnoreFields(Dispatch{}, "Done", "Took")); diff != "" {
+		t.Errorf("Run() got unexpected dispatches (-want +got):\n%s", diff)
+	}
+}
@@ -0,0 +1,262 @@
+/*
+Copyright 2021 The TestGrid Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package config
+
+import (
+	"context"
+	"errors"
+	"sort"
+	"sync"
+	"time"
+
+	configpb "github.com/GoogleCloudPlatform/testgrid/pb/config"
+	"github.com/sirupsen/logrus"
+)
+
+// ErrAlreadyRegistered means the registry already has a queue with the name.
+var ErrAlreadyRegistered = errors.New("queue already registered")
+
+// QueueRegistry tracks many named queues in one binary, such as one per GCS project.
+//
+// Queues may be registered and deregistered at any time, including while
+// Send is running. The zero value is an empty registry ready to use.
+type QueueRegistry struct {
+	lock   sync.RWMutex
+	queues map[string]*TestGroupQueue
+	sends  map[*registrySend]bool // active calls to Send
+}
+
+// Register adds the queue under name, returning ErrAlreadyRegistered if the name is taken.
+//
+// Active calls to Send start sending from the queue.
+func (r *QueueRegistry) Register(name string, q *TestGroupQueue) error {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	if _, ok := r.queues[name]; ok {
+		return ErrAlreadyRegistered
+	}
+	if r.queues == nil {
+		r.queues = map[string]*TestGroupQueue{}
+	}
+	r.queues[name] = q
+	for s := range r.sends {
+		s.startLocked(name, q)
+	}
+	return nil
+}
+
+// Deregister removes the queue registered under name, returning ErrNotFound if there is none.
+//
+// Active calls to Send stop sending from the queue before Deregister
+// returns, so the queue may be registered again or sent directly.
+func (r *QueueRegistry) Deregister(name string) error {
+	r.lock.Lock()
+	if _, ok := r.queues[name]; !ok {
+		r.lock.Unlock()
+		return ErrNotFound
+	}
+	delete(r.queues, name)
+	var stopped []<-chan struct{}
+	for s := range r.sends {
+		if done := s.stopLocked(name); done != nil {
+			stopped = append(stopped, done)
+		}
+	}
+	r.lock.Unlock()
+	for _, done := range stopped {
+		<-done
+	}
+	return nil
+}
+
+// Queue returns the queue registered under name.
+func (r *QueueRegistry) Queue(name string) (*TestGroupQueue, bool) {
+	r.lock.RLock()
+	defer r.lock.RUnlock()
+	q, ok := r.queues[name]
+	return q, ok
+}
+
+// Names returns the name of each registered queue, sorted.
+func (r *QueueRegistry) Names() []string {
+	r.lock.RLock()
+	defer r.lock.RUnlock()
+	names := make([]string, 0, len(r.queues))
+	for name := range r.queues {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// snapshot returns a copy of the registered queues.
+func (r *QueueRegistry) snapshot() map[string]*TestGroupQueue {
+	r.lock.RLock()
+	defer r.lock.RUnlock()
+	out := make(map[string]*TestGroupQueue, len(r.queues))
+	for name, q := range r.queues {
+		out[name] = q
+	}
+	return out
+}
+
+// Stats sums the stats of every registered queue.
+//
+// Drift, Lag and MaxDepth are the largest of any queue.
+func (r *QueueRegistry) Stats() QueueStats {
+	total := QueueStats{Skipped: map[string]int{}}
+	for _, q := range r.snapshot() {
+		s := q.Stats()
+		total.Depth += s.Depth
+		total.Rejected += s.Rejected
+		total.Excluded += s.Excluded
+		total.Delivered += s.Delivered
+		total.Requeued += s.Requeued
+		total.Filtered += s.Filtered
+		total.Corrupted += s.Corrupted
+		total.Reindexed += s.Reindexed
+		total.ReloadErrors += s.ReloadErrors
+		total.Inits += s.Inits
+		total.Fixes += s.Fixes
+		total.Duplicates += s.Duplicates
+		for reason, n := range s.Skipped {
+			total.Skipped[reason] += n
+		}
+		if s.Drift > total.Drift {
+			total.Drift = s.Drift
+		}
+		if s.Lag > total.Lag {
+			total.Lag = s.Lag
+		}
+		if s.MaxDepth > total.MaxDepth {
+			total.MaxDepth = s.MaxDepth
+		}
+	}
+	return total
+}
+
+// Status of every registered queue: the total depth, and the next group
+// due across all queues, along with its queue and when it is ready.
+func (r *QueueRegistry) Status() (int, string, *configpb.TestGroup, time.Time) {
+	var depth int
+	var queue string
+	var next *configpb.TestGroup
+	var when time.Time
+	for name, q := range r.snapshot() {
+		n, tg, w := q.Status()
+		depth += n
+		if tg != nil && (next == nil || w.Before(when) || w.Equal(when) && name < queue) {
+			queue, next, when = name, tg, w
+		}
+	}
+	return depth, queue, next, when
+}
+
+// Send groups from every registered queue to receivers, each at its own frequency.
+//
+// Calls Send on each queue with the frequency returned for its name,
+// including queues registered while running, see TestGroupQueue.Send.
+// A queue whose Send returns, such as after draining with a zero
+// frequency, stops sending until registered again.
+//
+// Returns the first error from a queue's Send, after stopping the others,
+// or the context's error once it is done.
+func (r *QueueRegistry) Send(ctx context.Context, receivers chan<- *configpb.TestGroup, frequency func(name string) time.Duration) error {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	s := &registrySend{
+		ctx:       ctx,
+		receivers: receivers,
+		frequency: frequency,
+		running:   map[string]*registeredSend{},
+		errs:      make(chan error, 1),
+	}
+	r.lock.Lock()
+	if r.sends == nil {
+		r.sends = map[*registrySend]bool{}
+	}
+	r.sends[s] = true
+	for name, q := range r.queues {
+		s.startLocked(name, q)
+	}
+	r.lock.Unlock()
+
+	var err error
+	select {
+	case <-ctx.Done():
+		err = ctx.Err()
+	case err = <-s.errs:
+	}
+
+	r.lock.Lock()
+	delete(r.sends, s)
+	r.lock.Unlock()
+	cancel()
+	s.wg.Wait()
+	return err
+}
+
+// registrySend tracks the Send on each queue for one call to QueueRegistry.Send.
+type registrySend struct {
+	ctx       context.Context
+	receivers chan<- *configpb.TestGroup
+	frequency func(string) time.Duration
+
+	running map[string]*registeredSend // guarded by the registry's lock
+	wg      sync.WaitGroup
+	errs    chan error
+}
+
+type registeredSend struct {
+	cancel context.CancelFunc
+	done   chan struct{}
+}
+
+func (s *registrySend) startLocked(name string, q *TestGroupQueue) {
+	ctx, cancel := context.WithCancel(s.ctx)
+	rs := &registeredSend{
+		cancel: cancel,
+		done:   make(chan struct{}),
+	}
+	s.running[name] = rs
+	s.wg.Add(1)
+	go func() {
+		defer s.wg.Done()
+		defer close(rs.done)
+		defer cancel()
+		err := q.Send(ctx, s.receivers, s.frequency(name))
+		if err == nil || ctx.Err() != nil {
+			return
+		}
+		logrus.WithError(err).WithField("queue", name).Error("Failed to send registered queue")
+		select {
+		case s.errs <- err:
+		default: // already failing
+		}
+	}()
+}
+
+// stopLocked cancels the Send on the named queue, returning a channel closed once it returns.
+func (s *registrySend) stopLocked(name string) <-chan struct{} {
+	rs, ok := s.running[name]
+	if !ok {
+		return nil
+	}
+	delete(s.running, name)
+	rs.cancel()
+	return rs.done
+}
@@ -0,0 +1,200 @@
+/*
+Copyright 2021 The TestGrid Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package config
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	configpb "github.com/GoogleCloudPlatform/testgrid/pb/config"
+	"github.com/google/go-cmp/cmp"
+	"github.com/google/go-cmp/cmp/cmpopts"
+)
+
+func TestQueueRegistry(t *testing.T) {
+	now := time.Date(2021, 1, 2, 3, 4, 5, 0, time.UTC)
+	var r QueueRegistry
+	var empty QueueRegistry
+	if depth, queue, tg, _ := empty.Status(); depth != 0 || queue != "" || tg != nil {
+		t.Errorf("Status() of an empty registry got %d, %q, %v", depth, queue, tg)
+	}
+
+	var fast, slow TestGroupQueue
+	fast.Init([]*configpb.TestGroup{{Name: "f1"}, {Name: "f2"}}, now.Add(time.Minute))
+	slow.Init([]*configpb.TestGroup{{Name: "s1"}, {Name: ""}}, now)
+	if err := r.Register("fast", &fast); err != nil {
+		t.Fatalf("Register(fast) got unexpected error: %v", err)
+	}
+	if err := r.Register("slow", &slow); err != nil {
+		t.Fatalf("Register(slow) got unexpected error: %v", err)
+	}
+	if err := r.Register("slow", &fast); err != ErrAlreadyRegistered {
+		t.Errorf("Register(slow) again got %v, want %v", err, ErrAlreadyRegistered)
+	}
+	if diff := cmp.Diff([]string{"fast", "slow"}, r.Names()); diff != "" {
+		t.Errorf("Names() got unexpected diff (-want +got):\n%s", diff)
+	}
+
+	depth, queue, tg, when := r.Status()
+	if depth != 3 || queue != "slow" || tg.GetName() != "s1" || !when.Equal(now) {
+		t.Errorf("Status() got %d, %q, %v, %v, want 3, slow, s1, %v", depth, queue, tg, when, now)
+	}
+	stats := r.Stats()
+	want := QueueStats{
+		Depth:    3,
+		Rejected: 1,
+		MaxDepth: 2,
+		Inits:    2,
+		Skipped:  (&TestGroupQueue{}).SkipStats(),
+	}
+	if diff := cmp.Diff(want, stats, cmpopts.IgnoreFields(QueueStats{}, "Lag")); diff != "" {
+		t.Errorf("Stats() got unexpected diff (-want +got):\n%s", diff)
+	}
+	if stats.Lag <= 0 {
+		t.Errorf("Stats() got lag %s, want the time since s1 was due", stats.Lag)
+	}
+
+	if err := r.Deregister("slow"); err != nil {
+		t.Errorf("Deregister(slow) got unexpected error: %v", err)
+	}
+	if err := r.Deregister("slow"); err != ErrNotFound {
+		t.Errorf("Deregister(slow) again got %v, want %v", err, ErrNotFound)
+	}
+	if _, ok := r.Queue("slow"); ok {
+		t.Error("Queue(slow) found a deregistered queue")
+	}
+	if q, ok := r.Queue("fast"); !ok || q != &fast {
+		t.Errorf("Queue(fast) got %p, %t, want %p", q, ok, &fast)
+	}
+}
+
+func TestQueueRegistrySend(t *testing.T) {
+	start := time.Date(2021, 1, 2, 3, 4, 5, 0, time.UTC)
+	clock := NewFakeClock(start)
+	fast := NewTestGroupQueue(WithClock(clock))
+	fast.Init([]*configpb.TestGroup{{Name: "fast"}}, start)
+	slow := NewTestGroupQueue(WithClock(clock))
+	slow.Init([]*configpb.TestGroup{{Name: "slow"}}, start)
+	var r QueueRegistry
+	r.Register("fast", fast)
+	r.Register("slow", slow)
+	frequencies := map[string]time.Duration{
+		"fast": time.Minute,
+		"slow": 10 * time.Minute,
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	ch := make(chan *configpb.TestGroup, 100)
+	errCh := make(chan error, 1)
+	go func() {
+		errCh <- r.Send(ctx, ch, func(name string) time.Duration { return frequencies[name] })
+	}()
+	for i := 0; i < 10; i++ {
+		if err := clock.BlockUntil(ctx, 2); err != nil {
+			t.Fatalf("Send() never slept: %v", err)
+		}
+		clock.Advance(time.Minute)
+	}
+	if err := clock.BlockUntil(ctx, 2); err != nil {
+		t.Fatalf("Send() never slept: %v", err)
+	}
+	cancel()
+	if err := <-errCh; err != context.Canceled {
+		t.Errorf("Send() got %v, want %v", err, context.Canceled)
+	}
+	close(ch)
+	got := map[string]int{}
+	for tg := range ch {
+		got[tg.Name]++
+	}
+	want := map[string]int{"fast": 11, "slow": 2}
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Errorf("Send() got unexpected dispatches (-want +got):\n%s", diff)
+	}
+	if got := r.Stats().Delivered; got != 13 {
+		t.Errorf("Stats() got %d delivered, want 13", got)
+	}
+}
+
+func TestQueueRegistryRegisterWhileSending(t *testing.T) {
+	now := time.Now()
+	var r QueueRegistry
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	ch := make(chan *configpb.TestGroup)
+	errCh := make(chan error, 1)
+	go func() {
+		errCh <- r.Send(ctx, ch, func(name string) time.Duration {
+			if name == "drain" {
+				return 0
+			}
+			return time.Hour
+		})
+	}()
+
+	var drain, recur TestGroupQueue
+	drain.Init([]*configpb.TestGroup{{Name: "a"}, {Name: "b"}}, now)
+	recur.Init([]*configpb.TestGroup{{Name: "c"}}, now)
+	r.Register("drain", &drain)
+	r.Register("recur", &recur)
+	got := map[string]bool{}
+	for i := 0; i < 3; i++ {
+		got[(<-ch).Name] = true
+	}
+	if diff := cmp.Diff(map[string]bool{"a": true, "b": true, "c": true}, got); diff != "" {
+		t.Errorf("Send() got unexpected groups (-want +got):\n%s", diff)
+	}
+
+	if err := r.Deregister("recur"); err != nil {
+		t.Fatalf("Deregister() got unexpected error: %v", err)
+	}
+	direct, stop := context.WithCancel(ctx)
+	stop()
+	if err := recur.Send(direct, ch, time.Hour); err != context.Canceled {
+		t.Errorf("Send() after Deregister() got %v, want %v", err, context.Canceled)
+	}
+
+	cancel()
+	if err := <-errCh; err != context.Canceled {
+		t.Errorf("Send() got %v, want %v", err, context.Canceled)
+	}
+}
+
+func TestQueueRegistrySendError(t *testing.T) {
+	var r QueueRegistry
+	var q TestGroupQueue
+	q.Init([]*configpb.TestGroup{{Name: "hi"}}, time.Now().Add(time.Hour))
+	r.Register("busy", &q)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	ch := make(chan *configpb.TestGroup)
+	errCh := make(chan error, 1)
+	go func() {
+		errCh <- q.Send(ctx, ch, time.Hour)
+	}()
+	for !q.Sending() {
+		time.Sleep(time.Millisecond)
+	}
+	if err := r.Send(ctx, ch, func(string) time.Duration { return time.Hour }); err != ErrAlreadySending {
+		t.Errorf("Send() got %v, want %v", err, ErrAlreadySending)
+	}
+	cancel()
+	<-errCh
+}
@@ -0,0 +1,206 @@
+/*
+Copyright 2021 The TestGrid Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package config
+
+import (
+	"fmt"
+	"sort"
+	"time"
+
+	multierror "github.com/hashicorp/go-multierror"
+	"github.com/sirupsen/logrus"
+)
+
+// WithLinearScan scans the queue for the next group instead of keeping a heap while it holds fewer than below groups.
+//
+// Scanning a handful of groups costs less than sifting them through the heap
+// on every dispatch and fix: BenchmarkStore shows scanning about twice as
+// fast up to 8 groups, even at 16 and slower beyond. The queue switches to
+// the heap as it grows to below groups and back as it shrinks, without
+// changing the schedule. Without this option the queue always keeps a heap.
+func WithLinearScan(below int) QueueOption {
+	return func(q *TestGroupQueue) {
+		q.scanBelow = below
+	}
+}
+
+// store returns the queue's items as a heap, or as an unordered slice to scan while there are fewer than scanBelow.
+//
+// The items are heap ordered whenever there are at least scanBelow of them,
+// so the queue switches to the heap by rebuilding it in pushStoreLocked, and
+// back for free.
+func (q *TestGroupQueue) store() scheduleStore {
+	if len(q.queue) < q.scanBelow {
+		return (*scanQueue)(&q.queue)
+	}
+	return &q.queue
+}
+
+// pushStoreLocked pushes the item, rebuilding the heap when the queue grows out of scanning.
+func (q *TestGroupQueue) pushStoreLocked(it *item) {
+	scanned := len(q.queue) < q.scanBelow
+	q.store().push(it)
+	if scanned && len(q.queue) >= q.scanBelow {
+		q.queue.rebuild()
+	}
+}
+
+// scanQueue holds items in no particular order, scanning them all to find the next one due.
+type scanQueue []*item
+
+var _ scheduleStore = (*scanQueue)(nil)
+
+func (sq scanQueue) Len() int { return len(sq) }
+
+func (sq scanQueue) all() []*item {
+	return sq
+}
+
+func (sq scanQueue) sorted() []*item {
+	out := make([]*item, len(sq))
+	copy(out, sq)
+	sort.Slice(out, func(i, j int) bool { return less(out[i], out[j]) })
+	return out
+}
+
+// first returns the index of the first item due, or -1 when empty.
+func (sq scanQueue) first() int {
+	best := -1
+	for i, it := range sq {
+		if best < 0 || less(it, sq[best]) {
+			best = i
+		}
+	}
+	return best
+}
+
+func (sq scanQueue) peek() *item {
+	if i := sq.first(); i >= 0 {
+		return sq[i]
+	}
+	return nil
+}
+
+func (sq *scanQueue) push(it *item) {
+	if it.tg == nil { // Send must never deliver a nil group
+		logrus.Error("Ignoring push of nil group to queue")
+		return
+	}
+	if sq.holds(it) {
+		logrus.WithField("group", it.tg.GetName()).Error("Ignoring duplicate push to queue")
+		return
+	}
+	it.index = len(*sq)
+	*sq = append(*sq, it)
+}
+
+func (sq *scanQueue) fix(*item) {} // unordered
+
+func (sq scanQueue) holds(it *item) bool {
+	return priorityQueue(sq).contains(it)
+}
+
+func (sq scanQueue) reindex(it *item) bool {
+	return priorityQueue(sq).reindex(it)
+}
+
+func (sq *scanQueue) remove(it *item) {
+	sq.removeAt(it.index)
+}
+
+// removeAt removes the item at i, moving the last item into its place.
+func (sq *scanQueue) removeAt(i int) *item {
+	old := *sq
+	n := len(old) - 1
+	it := old[i]
+	if i != n {
+		old[i] = old[n]
+		old[i].index = i
+	}
+	old[n] = nil
+	*sq = old[:n]
+	it.index = -1
+	return it
+}
+
+func (sq *scanQueue) pop() *item {
+	return sq.removeAt(sq.first())
+}
+
+func (sq *scanQueue) removeIf(drop func(*item) bool) []*item {
+	return (*priorityQueue)(sq).filter(drop)
+}
+
+func (sq *scanQueue) rebuild() {} // unordered
+
+func (sq scanQueue) countBefore(now time.Time) int {
+	var n int
+	for _, it := range sq {
+		if it.when.Before(now) {
+			n++
+		}
+	}
+	return n
+}
+
+func (sq scanQueue) nextAfter(now time.Time) (time.Time, bool) {
+	var next time.Time
+	var ok bool
+	for _, it := range sq {
+		if it.when.After(now) && (!ok || it.when.Before(next)) {
+			next, ok = it.when, true
+		}
+	}
+	return next, ok
+}
+
+func (sq scanQueue) due(now time.Time) []*item {
+	var out []*item
+	for _, it := range sq {
+		if !it.when.After(now) {
+			out = append(out, it)
+		}
+	}
+	return out
+}
+
+func (sq scanQueue) firstDue(now time.Time, ok func(*item) bool) *item {
+	var best *item
+	for _, it := range sq {
+		if !it.when.After(now) && (best == nil || less(it, best)) && ok(it) {
+			best = it
+		}
+	}
+	return best
+}
+
+func (sq scanQueue) check() error {
+	var mErr error
+	for i, it := range sq {
+		if it == nil || it.tg == nil {
+			continue
+		}
+		if it.index != i {
+			mErr = multierror.Append(mErr, fmt.Errorf("%d %q: wrong index %d", i, it.tg.Name, it.index))
+		}
+	}
+	return mErr
+}
+
+func (sq *scanQueue) compact() {
+	(*priorityQueue)(sq).compact()
+}
@@ -0,0 +1,127 @@
+/*
+Copyright 2021 The TestGrid Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package config
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	configpb "github.com/GoogleCloudPlatform/testgrid/pb/config"
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestLinearScan(t *testing.T) {
+	now := time.Date(2021, 1, 2, 3, 4, 5, 0, time.UTC)
+	add := func(n int) func(*TestGroupQueue) error {
+		return func(q *TestGroupQueue) error {
+			for i := 0; i < n; i++ {
+				when := now.Add(time.Duration(i*7%n) * time.Minute)
+				if err := q.Add(&configpb.TestGroup{Name: fmt.Sprintf("group-%d", i)}, when); err != nil {
+					return err
+				}
+			}
+			return nil
+		}
+	}
+	fix := func(name string, d time.Duration) func(*TestGroupQueue) error {
+		return func(q *TestGroupQueue) error {
+			return q.Fix(name, now.Add(d))
+		}
+	}
+	remove := func(names ...string) func(*TestGroupQueue) error {
+		return func(q *TestGroupQueue) error {
+			for _, name := range names {
+				if err := q.Remove(name); err != nil {
+					return err
+				}
+			}
+			return nil
+		}
+	}
+	cases := []struct {
+		name     string
+		ops      []func(*TestGroupQueue) error
+		scanning bool
+	}{
+		{
+			name:     "empty",
+			scanning: true,
+		},
+		{
+			name:     "small",
+			ops:      []func(*TestGroupQueue) error{add(3), fix("group-0", time.Hour), fix("group-2", -time.Minute)},
+			scanning: true,
+		},
+		{
+			name: "grow into heap",
+			ops:  []func(*TestGroupQueue) error{add(3), fix("group-1", 2*time.Hour), add(10), fix("group-5", -time.Hour)},
+		},
+		{
+			name:     "shrink into scan",
+			ops:      []func(*TestGroupQueue) error{add(10), remove("group-0", "group-1", "group-3", "group-4", "group-8", "group-9"), fix("group-7", -time.Hour)},
+			scanning: true,
+		},
+		{
+			name: "grow again",
+			ops: []func(*TestGroupQueue) error{
+				add(10),
+				remove("group-0", "group-3", "group-4", "group-8", "group-9"),
+				fix("group-2", time.Hour),
+				add(6),
+				fix("group-6", -time.Minute),
+			},
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			// each op applied to a queue scanning below 5 groups and to another always keeping a heap
+			scan := NewTestGroupQueue(WithClock(NewFakeClock(now)), WithLinearScan(5))
+			heaped := NewTestGroupQueue(WithClock(NewFakeClock(now)))
+			for i, op := range tc.ops {
+				if err := op(scan); err != nil {
+					t.Fatalf("op %d got unexpected error: %v", i, err)
+				}
+				if err := op(heaped); err != nil {
+					t.Fatalf("op %d got unexpected error: %v", i, err)
+				}
+				if err := scan.Verify(); err != nil {
+					t.Errorf("op %d: Verify() got unexpected error: %v", i, err)
+				}
+				_, want, wantWhen := heaped.Status()
+				_, got, gotWhen := scan.Status()
+				if got.GetName() != want.GetName() || !gotWhen.Equal(wantWhen) {
+					t.Errorf("op %d: Status() got %q at %s, want %q at %s", i, got.GetName(), gotWhen, want.GetName(), wantWhen)
+				}
+			}
+			if _, scanning := scan.store().(*scanQueue); scanning != tc.scanning {
+				t.Errorf("store() got scanning %t, want %t", scanning, tc.scanning)
+			}
+			var want, got []string
+			for heaped.store().Len() > 0 {
+				want = append(want, heaped.store().pop().tg.Name)
+			}
+			for scan.store().Len() > 0 {
+				got = append(got, scan.store().pop().tg.Name)
+			}
+			if diff := cmp.Diff(want, got); diff != "" {
+				t.Errorf("pop() got unexpected diff (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
@@ -0,0 +1,113 @@
+/*
+Copyright 2021 The TestGrid Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package config
+
+import (
+	"strings"
+	"time"
+
+	configpb "github.com/GoogleCloudPlatform/testgrid/pb/config"
+	"github.com/golang/protobuf/proto"
+)
+
+// ScopedQueue administers only the groups of a queue whose names start with a prefix.
+//
+// Groups outside the scope are indistinguishable from groups missing from
+// the queue: methods return ErrNotFound for them, rather than a permission
+// error revealing they exist, and never list them.
+type ScopedQueue struct {
+	q      *TestGroupQueue
+	prefix string
+}
+
+// Scoped returns a handle administering only the groups named with prefix.
+//
+// The handle shares the queue, including its lock, so changes through
+// either are visible to both. An empty prefix scopes every group.
+func (q *TestGroupQueue) Scoped(prefix string) *ScopedQueue {
+	return &ScopedQueue{q: q, prefix: prefix}
+}
+
+func (s *ScopedQueue) in(name string) bool {
+	return strings.HasPrefix(name, s.prefix)
+}
+
+// Fix the next time to send the group, see TestGroupQueue.Fix.
+//
+// Returns ErrNotFound for groups outside the scope.
+func (s *ScopedQueue) Fix(name string, when time.Time) error {
+	if !s.in(name) {
+		return ErrNotFound
+	}
+	return s.q.Fix(name, when)
+}
+
+// FixAll fixes multiple groups inside a single critical section, see TestGroupQueue.FixAll.
+//
+// Reports groups outside the scope as missing in the *FixAllError,
+// after fixing those inside it.
+func (s *ScopedQueue) FixAll(whens map[string]time.Time) error {
+	return s.q.fixAll(whens, s.prefix)
+}
+
+// Prioritize moves the group to the front of the queue, see TestGroupQueue.Prioritize.
+//
+// Returns ErrNotFound for groups outside the scope. The group moves ahead
+// of every group in the queue, not only those in the scope.
+func (s *ScopedQueue) Prioritize(name string) (time.Time, error) {
+	if !s.in(name) {
+		return time.Time{}, ErrNotFound
+	}
+	return s.q.Prioritize(name)
+}
+
+// Status of the groups in the scope: depth, next group and when it is ready, see TestGroupQueue.Status.
+func (s *ScopedQueue) Status() (int, *configpb.TestGroup, time.Time) {
+	q := s.q
+	q.lock.RLock()
+	defer q.lock.RUnlock()
+	var n int
+	var next *item
+	for name, it := range q.items {
+		if !s.in(name) {
+			continue
+		}
+		n++
+		if next == nil || less(it, next) {
+			next = it
+		}
+	}
+	if next == nil {
+		return 0, nil, time.Time{}
+	}
+	tg := next.tg
+	if q.statusCopies {
+		tg = proto.Clone(tg).(*configpb.TestGroup)
+	}
+	return n, tg, next.when
+}
+
+// Items returns every group in the scope, in the order they are due, see TestGroupQueue.Items.
+func (s *ScopedQueue) Items() []QueueItem {
+	var out []QueueItem
+	for _, qi := range s.q.Items() {
+		if s.in(qi.Name) {
+			out = append(out, qi)
+		}
+	}
+	return out
+}
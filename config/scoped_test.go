@@ -0,0 +1,215 @@
+/*
+Copyright 2021 The TestGrid Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package config
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	configpb "github.com/GoogleCloudPlatform/testgrid/pb/config"
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestScoped(t *testing.T) {
+	now := time.Date(2021, 1, 2, 3, 4, 5, 0, time.UTC)
+	cases := []struct {
+		name    string
+		op      func(*ScopedQueue) error
+		err     error
+		missing []string
+		changed []string
+		want    []QueueItem
+	}{
+		{
+			name: "fix in scope",
+			op: func(s *ScopedQueue) error {
+				return s.Fix("team-b", now.Add(-time.Hour))
+			},
+			want: []QueueItem{
+				{Name: "team-b", When: now.Add(-time.Hour)},
+				{Name: "other-a", When: now},
+				{Name: "team-a", When: now.Add(time.Minute)},
+				{Name: "other-b", When: now.Add(2 * time.Minute)},
+			},
+		},
+		{
+			name: "fix out of scope",
+			op: func(s *ScopedQueue) error {
+				return s.Fix("other-b", now.Add(-time.Hour))
+			},
+			err: ErrNotFound,
+		},
+		{
+			name: "fix missing",
+			op: func(s *ScopedQueue) error {
+				return s.Fix("team-c", now.Add(-time.Hour))
+			},
+			err: ErrNotFound,
+		},
+		{
+			name: "prioritize in scope",
+			op: func(s *ScopedQueue) error {
+				_, err := s.Prioritize("team-a")
+				return err
+			},
+			want: []QueueItem{
+				{Name: "team-a", When: now.Add(-time.Nanosecond)},
+				{Name: "other-a", When: now},
+				{Name: "other-b", When: now.Add(2 * time.Minute)},
+				{Name: "team-b", When: now.Add(3 * time.Minute)},
+			},
+		},
+		{
+			name: "prioritize out of scope",
+			op: func(s *ScopedQueue) error {
+				_, err := s.Prioritize("other-b")
+				return err
+			},
+			err: ErrNotFound,
+		},
+		{
+			name: "fix all in scope",
+			op: func(s *ScopedQueue) error {
+				return s.FixAll(map[string]time.Time{
+					"team-a": now.Add(time.Hour),
+					"team-b": now.Add(-time.Hour),
+				})
+			},
+			want: []QueueItem{
+				{Name: "team-b", When: now.Add(-time.Hour)},
+				{Name: "other-a", When: now},
+				{Name: "other-b", When: now.Add(2 * time.Minute)},
+				{Name: "team-a", When: now.Add(time.Hour)},
+			},
+		},
+		{
+			name: "fix all mixed",
+			op: func(s *ScopedQueue) error {
+				return s.FixAll(map[string]time.Time{
+					"other-a": now.Add(time.Hour),
+					"team-b":  now.Add(-time.Hour),
+					"other-c": now.Add(time.Hour),
+					"team-c":  now.Add(time.Hour),
+				})
+			},
+			err:     ErrNotFound,
+			missing: []string{"other-a", "other-c", "team-c"},
+			changed: []string{"team-b"},
+			want: []QueueItem{
+				{Name: "team-b", When: now.Add(-time.Hour)},
+				{Name: "other-a", When: now},
+				{Name: "team-a", When: now.Add(time.Minute)},
+				{Name: "other-b", When: now.Add(2 * time.Minute)},
+			},
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			q := NewTestGroupQueue(WithClock(NewFakeClock(now)))
+			q.InitSchedule([]*configpb.TestGroup{{Name: "other-a"}, {Name: "team-a"}, {Name: "other-b"}, {Name: "team-b"}}, now, map[string]time.Time{
+				"team-a":  now.Add(time.Minute),
+				"other-b": now.Add(2 * time.Minute),
+				"team-b":  now.Add(3 * time.Minute),
+			})
+			before := q.Items()
+			err := tc.op(q.Scoped("team-"))
+			if !errors.Is(err, tc.err) {
+				t.Errorf("got error %v, want %v", err, tc.err)
+			}
+			var fixErr *FixAllError
+			if errors.As(err, &fixErr) {
+				if diff := cmp.Diff(tc.missing, fixErr.Missing); diff != "" {
+					t.Errorf("FixAllError.Missing got unexpected diff (-want +got):\n%s", diff)
+				}
+				if diff := cmp.Diff(tc.changed, fixErr.Changed); diff != "" {
+					t.Errorf("FixAllError.Changed got unexpected diff (-want +got):\n%s", diff)
+				}
+			}
+			want := tc.want
+			if want == nil {
+				want = before // unchanged
+			}
+			var got []QueueItem
+			for _, it := range q.Items() {
+				got = append(got, QueueItem{Name: it.Name, When: it.When})
+			}
+			if diff := cmp.Diff(want, got); diff != "" {
+				t.Errorf("got unexpected diff (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestScopedView(t *testing.T) {
+	now := time.Date(2021, 1, 2, 3, 4, 5, 0, time.UTC)
+	q := NewTestGroupQueue(WithClock(NewFakeClock(now)))
+	q.InitSchedule([]*configpb.TestGroup{{Name: "other-a"}, {Name: "team-a"}, {Name: "team-b"}}, now, map[string]time.Time{
+		"team-a": now.Add(2 * time.Minute),
+		"team-b": now.Add(time.Minute),
+	})
+	cases := []struct {
+		prefix string
+		n      int
+		next   string
+		when   time.Time
+		items  []string
+	}{
+		{
+			prefix: "team-",
+			n:      2,
+			next:   "team-b",
+			when:   now.Add(time.Minute),
+			items:  []string{"team-b", "team-a"},
+		},
+		{
+			prefix: "other-",
+			n:      1,
+			next:   "other-a",
+			when:   now,
+			items:  []string{"other-a"},
+		},
+		{
+			prefix: "none-",
+		},
+		{
+			prefix: "",
+			n:      3,
+			next:   "other-a",
+			when:   now,
+			items:  []string{"other-a", "team-b", "team-a"},
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.prefix, func(t *testing.T) {
+			s := q.Scoped(tc.prefix)
+			n, tg, when := s.Status()
+			if n != tc.n || tg.GetName() != tc.next || !when.Equal(tc.when) {
+				t.Errorf("Status() got %d, %q, %s, want %d, %q, %s", n, tg.GetName(), when, tc.n, tc.next, tc.when)
+			}
+			var items []string
+			for _, it := range s.Items() {
+				items = append(items, it.Name)
+			}
+			if diff := cmp.Diff(tc.items, items); diff != "" {
+				t.Errorf("Items() got unexpected diff (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
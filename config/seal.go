@@ -0,0 +1,63 @@
+/*
+Copyright 2021 The TestGrid Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package config
+
+import (
+	"errors"
+
+	"github.com/sirupsen/logrus"
+)
+
+// ErrSealed is returned by methods changing the schedule of a sealed queue, see Seal.
+var ErrSealed = errors.New("queue sealed")
+
+// Seal rejects further changes to the schedule, such as during shutdown, until Unseal.
+//
+// Keeps a config reload from fighting Send as it drains the queue. These
+// methods return ErrSealed, or report changing nothing, without touching the
+// schedule: Init, InitSchedule, InitDiff, Merge, Add, AddIfAbsent, Fix,
+// FixAll, FixAllProto, FixEach, Remove, Prioritize, PostponeAll,
+// PostponeMatching, Prune and SetShard, including through a ScopedQueue.
+//
+// Send and its variants still dispatch and reschedule groups, and receivers
+// may still Ack them. Settings, such as SetFrequency, pausing and overrides,
+// remain open, as does PopAll, which drains the queue.
+func (q *TestGroupQueue) Seal() {
+	q.lock.Lock()
+	defer q.lock.Unlock()
+	if !q.sealed {
+		logrus.Info("Sealed queue")
+	}
+	q.sealed = true
+}
+
+// Unseal accepts changes to the schedule again after Seal.
+func (q *TestGroupQueue) Unseal() {
+	q.lock.Lock()
+	defer q.lock.Unlock()
+	if q.sealed {
+		logrus.Info("Unsealed queue")
+	}
+	q.sealed = false
+}
+
+// Sealed returns whether the queue rejects changes to its schedule, see Seal.
+func (q *TestGroupQueue) Sealed() bool {
+	q.lock.RLock()
+	defer q.lock.RUnlock()
+	return q.sealed
+}
@@ -0,0 +1,197 @@
+/*
+Copyright 2021 The TestGrid Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package config
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	configpb "github.com/GoogleCloudPlatform/testgrid/pb/config"
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestSeal(t *testing.T) {
+	now := time.Date(2021, 1, 2, 3, 4, 5, 0, time.UTC)
+	groups := []*configpb.TestGroup{{Name: "a"}, {Name: "b"}}
+	cases := []struct {
+		name string
+		op   func(*TestGroupQueue) error
+		err  error
+	}{
+		{
+			name: "Init",
+			op: func(q *TestGroupQueue) error {
+				return q.Init([]*configpb.TestGroup{{Name: "c"}}, now)
+			},
+			err: ErrSealed,
+		},
+		{
+			name: "InitDiff",
+			op: func(q *TestGroupQueue) error {
+				_, err := q.InitDiff([]*configpb.TestGroup{{Name: "c"}}, now)
+				return err
+			},
+			err: ErrSealed,
+		},
+		{
+			name: "Merge",
+			op: func(q *TestGroupQueue) error {
+				return q.Merge([]*configpb.TestGroup{{Name: "c"}}, now)
+			},
+			err: ErrSealed,
+		},
+		{
+			name: "Add",
+			op: func(q *TestGroupQueue) error {
+				return q.Add(&configpb.TestGroup{Name: "c"}, now)
+			},
+			err: ErrSealed,
+		},
+		{
+			name: "AddIfAbsent",
+			op: func(q *TestGroupQueue) error {
+				if q.AddIfAbsent(&configpb.TestGroup{Name: "c"}, now) {
+					return errors.New("added")
+				}
+				return nil
+			},
+		},
+		{
+			name: "Fix",
+			op: func(q *TestGroupQueue) error {
+				return q.Fix("a", now.Add(time.Hour))
+			},
+			err: ErrSealed,
+		},
+		{
+			name: "FixAll",
+			op: func(q *TestGroupQueue) error {
+				return q.FixAll(map[string]time.Time{"a": now.Add(time.Hour)})
+			},
+			err: ErrSealed,
+		},
+		{
+			name: "FixEach",
+			op: func(q *TestGroupQueue) error {
+				return q.FixEach(func(_ string, current time.Time) (time.Time, bool) {
+					return current.Add(time.Hour), true
+				})
+			},
+			err: ErrSealed,
+		},
+		{
+			name: "scoped FixAll",
+			op: func(q *TestGroupQueue) error {
+				return q.Scoped("a").FixAll(map[string]time.Time{"a": now.Add(time.Hour)})
+			},
+			err: ErrSealed,
+		},
+		{
+			name: "Remove",
+			op: func(q *TestGroupQueue) error {
+				return q.Remove("a")
+			},
+			err: ErrSealed,
+		},
+		{
+			name: "Prioritize",
+			op: func(q *TestGroupQueue) error {
+				_, err := q.Prioritize("b")
+				return err
+			},
+			err: ErrSealed,
+		},
+		{
+			name: "PostponeAll",
+			op: func(q *TestGroupQueue) error {
+				_, err := q.PostponeAll(time.Hour)
+				return err
+			},
+			err: ErrSealed,
+		},
+		{
+			name: "PostponeMatching",
+			op: func(q *TestGroupQueue) error {
+				_, err := q.PostponeMatching("a", time.Hour)
+				return err
+			},
+			err: ErrSealed,
+		},
+		{
+			name: "Prune",
+			op: func(q *TestGroupQueue) error {
+				if n := q.Prune(func(string, *configpb.TestGroup, time.Time) bool { return true }); n != 0 {
+					return errors.New("pruned")
+				}
+				return nil
+			},
+		},
+		{
+			name: "SetShard",
+			op: func(q *TestGroupQueue) error {
+				_, err := q.SetShard(1, 2)
+				return err
+			},
+			err: ErrSealed,
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			q := NewTestGroupQueue(WithClock(NewFakeClock(now)))
+			q.InitSchedule(groups, now, map[string]time.Time{"b": now.Add(time.Minute)})
+			want := q.Items()
+			q.Seal()
+			if !q.Sealed() {
+				t.Error("Sealed() got false after Seal()")
+			}
+			if err := tc.op(q); !errors.Is(err, tc.err) {
+				t.Errorf("got error %v, want %v", err, tc.err)
+			}
+			if diff := cmp.Diff(want, q.Items()); diff != "" {
+				t.Errorf("sealed queue changed (-want +got):\n%s", diff)
+			}
+			q.Unseal()
+			if q.Sealed() {
+				t.Error("Sealed() got true after Unseal()")
+			}
+			if err := tc.op(q); err != nil && errors.Is(err, ErrSealed) {
+				t.Errorf("got error %v after Unseal()", err)
+			}
+		})
+	}
+}
+
+func TestSealSend(t *testing.T) {
+	now := time.Date(2021, 1, 2, 3, 4, 5, 0, time.UTC)
+	q := NewTestGroupQueue(WithClock(NewFakeClock(now)))
+	q.Init([]*configpb.TestGroup{{Name: "a"}, {Name: "b"}}, now)
+	q.Seal()
+	drain(q, 2) // reschedules each an hour later
+	want := []QueueItem{
+		{Name: "a", When: now.Add(time.Hour)},
+		{Name: "b", When: now.Add(time.Hour)},
+	}
+	var got []QueueItem
+	for _, it := range q.Items() {
+		got = append(got, QueueItem{Name: it.Name, When: it.When})
+	}
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Errorf("Send() on sealed queue got unexpected diff (-want +got):\n%s", diff)
+	}
+}
@@ -0,0 +1,71 @@
+/*
+Copyright 2021 The TestGrid Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package config
+
+import (
+	"context"
+)
+
+// sentWait notifies WaitSent callers when Send next delivers a group.
+type sentWait struct {
+	done chan struct{}
+	err  error // nil when delivered, ErrNotFound when removed
+}
+
+// WaitSent blocks until Send, or another method that dispatches groups,
+// next delivers the named group to a receiver or handler.
+//
+// Returns ErrNotFound if the group is not in the queue, including while a
+// group Send removes with a zero frequency is being delivered, or once the
+// group is removed before its delivery. Otherwise returns the context's
+// error if it expires first.
+func (q *TestGroupQueue) WaitSent(ctx context.Context, name string) error {
+	q.lock.Lock()
+	name = q.lookupLocked(name)
+	if _, ok := q.items[name]; !ok {
+		q.lock.Unlock()
+		return ErrNotFound
+	}
+	w, ok := q.sent[name]
+	if !ok {
+		if q.sent == nil {
+			q.sent = map[string]*sentWait{}
+		}
+		w = &sentWait{done: make(chan struct{})}
+		q.sent[name] = w
+	}
+	q.lock.Unlock()
+
+	select {
+	case <-w.done:
+		return w.err
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// sentLocked wakes WaitSent callers for a group, returning err to them.
+func (q *TestGroupQueue) sentLocked(name string, err error) {
+	q.warm.remove(name)
+	w, ok := q.sent[name]
+	if !ok {
+		return
+	}
+	w.err = err
+	close(w.done)
+	delete(q.sent, name)
+}
@@ -0,0 +1,127 @@
+/*
+Copyright 2021 The TestGrid Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package config
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	configpb "github.com/GoogleCloudPlatform/testgrid/pb/config"
+)
+
+func TestWaitSent(t *testing.T) {
+	now := time.Date(2021, 1, 2, 3, 4, 5, 0, time.UTC)
+	cases := []struct {
+		name string
+		wait string
+		act  func(*TestGroupQueue, *FakeClock, context.CancelFunc)
+		want error
+	}{
+		{
+			name: "delivered",
+			wait: "later",
+			act: func(_ *TestGroupQueue, clock *FakeClock, _ context.CancelFunc) {
+				clock.Advance(time.Hour)
+			},
+		},
+		{
+			name: "removed",
+			wait: "later",
+			act: func(q *TestGroupQueue, _ *FakeClock, _ context.CancelFunc) {
+				q.Remove("later")
+			},
+			want: ErrNotFound,
+		},
+		{
+			name: "removed by init",
+			wait: "later",
+			act: func(q *TestGroupQueue, _ *FakeClock, _ context.CancelFunc) {
+				q.Init([]*configpb.TestGroup{{Name: "now"}}, now)
+			},
+			want: ErrNotFound,
+		},
+		{
+			name: "popped",
+			wait: "later",
+			act: func(q *TestGroupQueue, _ *FakeClock, _ context.CancelFunc) {
+				q.PopAll()
+			},
+			want: ErrNotFound,
+		},
+		{
+			name: "canceled",
+			wait: "later",
+			act: func(_ *TestGroupQueue, _ *FakeClock, cancel context.CancelFunc) {
+				cancel()
+			},
+			want: context.Canceled,
+		},
+		{
+			name: "missing",
+			wait: "missing",
+			want: ErrNotFound,
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			clock := NewFakeClock(now)
+			q := NewTestGroupQueue(WithClock(clock))
+			q.Init([]*configpb.TestGroup{{Name: "now"}, {Name: "later"}}, now)
+			if err := q.Fix("later", now.Add(time.Hour)); err != nil {
+				t.Fatalf("Fix() got unexpected error: %v", err)
+			}
+
+			ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+			defer cancel()
+			ch := make(chan *configpb.TestGroup, 10)
+			go q.Send(ctx, ch, 2*time.Hour)
+
+			waitCtx, waitCancel := context.WithCancel(ctx)
+			defer waitCancel()
+			errs := make(chan error, 1)
+			go func() {
+				errs <- q.WaitSent(waitCtx, tc.wait)
+			}()
+			if tc.act != nil {
+				for !q.waitingSent(tc.wait) {
+					time.Sleep(time.Millisecond)
+				}
+				tc.act(q, clock, waitCancel)
+			}
+
+			select {
+			case err := <-errs:
+				if !errors.Is(err, tc.want) {
+					t.Errorf("WaitSent() got %v, want %v", err, tc.want)
+				}
+			case <-ctx.Done():
+				t.Fatal("WaitSent() did not return")
+			}
+		})
+	}
+}
+
+// waitingSent returns true when WaitSent is waiting for the group.
+func (q *TestGroupQueue) waitingSent(name string) bool {
+	q.lock.RLock()
+	defer q.lock.RUnlock()
+	_, ok := q.sent[name]
+	return ok
+}
@@ -0,0 +1,105 @@
+/*
+Copyright 2021 The TestGrid Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package config
+
+import (
+	"fmt"
+	"hash/fnv"
+
+	"github.com/sirupsen/logrus"
+)
+
+// WithShard keeps only the groups of shard index out of total, so replicas can split the groups between them.
+//
+// Each group belongs to exactly one shard, see ShardOf, so replicas given
+// the same config and total, each with its own index, together cover every
+// group exactly once without coordinating. Init and Merge skip groups in
+// other shards, counting them as excluded, while Add, AddIfAbsent and
+// AddBlocking reject them with ErrFiltered, like WithNameFilter. A total of
+// zero or less keeps every group.
+func WithShard(index, total int) QueueOption {
+	return func(q *TestGroupQueue) {
+		q.shardIndex = index
+		q.shardTotal = total
+	}
+}
+
+// ShardOf returns the shard of total the group named name belongs to, see WithShard.
+//
+// Shards by the 32-bit FNV-1a hash of the name modulo total, so other
+// tools can route a group to its replica. Every group belongs to shard zero
+// when total is zero or less.
+func ShardOf(name string, total int) int {
+	if total <= 0 {
+		return 0
+	}
+	h := fnv.New32a()
+	h.Write([]byte(name))
+	return int(h.Sum32() % uint32(total))
+}
+
+// SetShard changes the shard the queue keeps, see WithShard, returning how many groups it removed.
+//
+// Removes the groups in other shards at once, so another replica may take
+// them over, including pinned groups, logging a warning for each like Init.
+// Groups newly in the shard join the queue when Init or Merge next adds
+// them. Returns an error, changing nothing, if index is not a shard of a
+// positive total, or ErrSealed if the queue is sealed, see Seal.
+func (q *TestGroupQueue) SetShard(index, total int) (int, error) {
+	if total > 0 && (index < 0 || index >= total) {
+		return 0, fmt.Errorf("shard %d not in [0, %d)", index, total)
+	}
+	defer q.transition()
+	q.lock.Lock()
+	defer q.lock.Unlock()
+	defer q.rouse()
+	defer q.recoverLocked(nil)
+
+	if err := q.frozenLocked(); err != nil {
+		return 0, err
+	}
+	q.shardIndex = index
+	q.shardTotal = total
+	removed := q.store().removeIf(func(it *item) bool { return !q.inShardLocked(it.tg.Name) })
+	for _, it := range removed {
+		if it.pinned {
+			logrus.WithField("group", it.tg.Name).Warning("Removing pinned group from queue")
+		}
+		q.forgetLocked(it)
+	}
+	q.shrinkLocked()
+	logrus.WithFields(logrus.Fields{
+		"shard":   index,
+		"total":   total,
+		"removed": len(removed),
+	}).Info("Changed shard")
+	return len(removed), nil
+}
+
+// inShardLocked returns whether the group named name belongs to the queue's shard.
+//
+// Shards by the normalized name, see WithNameNormalization, so a group
+// stays in its shard however its name is spelt.
+func (q *TestGroupQueue) inShardLocked(name string) bool {
+	if q.shardTotal <= 0 {
+		return true
+	}
+	if q.normalize {
+		name = q.nameKey(name)
+	}
+	return ShardOf(name, q.shardTotal) == q.shardIndex
+}
@@ -0,0 +1,212 @@
+/*
+Copyright 2021 The TestGrid Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package config
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	configpb "github.com/GoogleCloudPlatform/testgrid/pb/config"
+	"github.com/google/go-cmp/cmp"
+	"github.com/sirupsen/logrus"
+	logtest "github.com/sirupsen/logrus/hooks/test"
+)
+
+// shardGroups returns n groups named group-0 through group-(n-1).
+func shardGroups(n int) []*configpb.TestGroup {
+	groups := make([]*configpb.TestGroup, n)
+	for i := range groups {
+		groups[i] = &configpb.TestGroup{Name: fmt.Sprintf("group-%d", i)}
+	}
+	return groups
+}
+
+func TestShardCoverage(t *testing.T) {
+	level := logrus.GetLevel()
+	logrus.SetLevel(logrus.WarnLevel) // skip logging each added group
+	defer logrus.SetLevel(level)
+	now := time.Date(2021, 1, 2, 3, 4, 5, 0, time.UTC)
+	groups := shardGroups(100)
+	for _, total := range []int{1, 2, 3, 7} {
+		t.Run(fmt.Sprintf("total=%d", total), func(t *testing.T) {
+			owners := map[string]int{}
+			for index := 0; index < total; index++ {
+				q := NewTestGroupQueue(WithClock(NewFakeClock(now)), WithShard(index, total))
+				if err := q.Init(groups, now); err != nil {
+					t.Fatalf("Init() got unexpected error: %v", err)
+				}
+				items := q.Items()
+				if len(items) == 0 {
+					t.Errorf("shard %d got no groups", index)
+				}
+				for _, it := range items {
+					if prev, ok := owners[it.Name]; ok {
+						t.Errorf("%q in shards %d and %d", it.Name, prev, index)
+					}
+					owners[it.Name] = index
+					if got := ShardOf(it.Name, total); got != index {
+						t.Errorf("ShardOf(%q) got %d, want %d", it.Name, got, index)
+					}
+				}
+				if got, want := q.Stats().Excluded, len(groups)-len(items); got != want {
+					t.Errorf("shard %d excluded %d groups, want %d", index, got, want)
+				}
+			}
+			if len(owners) != len(groups) {
+				t.Errorf("shards got %d groups, want all %d", len(owners), len(groups))
+			}
+		})
+	}
+}
+
+func TestShardAdd(t *testing.T) {
+	now := time.Date(2021, 1, 2, 3, 4, 5, 0, time.UTC)
+	const total = 2
+	for _, tg := range shardGroups(4) {
+		index := ShardOf(tg.Name, total)
+		q := NewTestGroupQueue(WithClock(NewFakeClock(now)), WithShard(index, total))
+		if err := q.Add(tg, now); err != nil {
+			t.Errorf("Add(%q) to shard %d got unexpected error: %v", tg.Name, index, err)
+		}
+		q = NewTestGroupQueue(WithClock(NewFakeClock(now)), WithShard(1-index, total))
+		if err := q.Add(tg, now); !errors.Is(err, ErrFiltered) {
+			t.Errorf("Add(%q) to shard %d got error %v, want %v", tg.Name, 1-index, err, ErrFiltered)
+		}
+		if q.AddIfAbsent(tg, now) {
+			t.Errorf("AddIfAbsent(%q) to shard %d added the group", tg.Name, 1-index)
+		}
+	}
+}
+
+func TestSetShard(t *testing.T) {
+	now := time.Date(2021, 1, 2, 3, 4, 5, 0, time.UTC)
+	groups := shardGroups(10)
+	inShard := func(index, total int) []string {
+		var names []string
+		for _, tg := range groups {
+			if ShardOf(tg.Name, total) == index {
+				names = append(names, tg.Name)
+			}
+		}
+		return names
+	}
+	cases := []struct {
+		name     string
+		index    int
+		total    int
+		pin      bool
+		sealed   bool
+		err      bool
+		removed  int
+		warnings int
+		want     []string
+	}{
+		{
+			name:  "same",
+			index: 0,
+			total: 2,
+			want:  inShard(0, 2),
+		},
+		{
+			name:    "other",
+			index:   1,
+			total:   2,
+			removed: len(inShard(0, 2)),
+		},
+		{
+			name:     "other pinned",
+			index:    1,
+			total:    2,
+			pin:      true,
+			removed:  len(inShard(0, 2)),
+			warnings: len(inShard(0, 2)),
+		},
+		{
+			name:    "narrower",
+			index:   0,
+			total:   4,
+			removed: len(inShard(0, 2)) - len(inShard(0, 4)),
+			want:    inShard(0, 4),
+		},
+		{
+			name: "unsharded",
+			want: inShard(0, 2),
+		},
+		{
+			name:  "invalid",
+			index: 2,
+			total: 2,
+			err:   true,
+			want:  inShard(0, 2),
+		},
+		{
+			name:   "sealed",
+			index:  1,
+			total:  2,
+			sealed: true,
+			err:    true,
+			want:   inShard(0, 2),
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			q := NewTestGroupQueue(WithClock(NewFakeClock(now)), WithShard(0, 2))
+			q.Init(groups, now)
+			if tc.pin {
+				for _, name := range inShard(0, 2) {
+					q.Pin(name)
+				}
+			}
+			if tc.sealed {
+				q.Seal()
+			}
+			hook := logtest.NewGlobal()
+			defer hook.Reset()
+			removed, err := q.SetShard(tc.index, tc.total)
+			switch {
+			case err != nil && !tc.err:
+				t.Errorf("SetShard() got unexpected error: %v", err)
+			case err == nil && tc.err:
+				t.Error("SetShard() failed to return an error")
+			case removed != tc.removed:
+				t.Errorf("SetShard() got %d removed, want %d", removed, tc.removed)
+			}
+			var got []string
+			for _, it := range q.Items() {
+				got = append(got, it.Name)
+			}
+			if diff := cmp.Diff(tc.want, got); diff != "" {
+				t.Errorf("SetShard() got unexpected diff (-want +got):\n%s", diff)
+			}
+			var warnings int
+			for _, e := range hook.AllEntries() {
+				if e.Message == "Removing pinned group from queue" {
+					warnings++
+				}
+			}
+			if warnings != tc.warnings {
+				t.Errorf("SetShard() logged %d pinned warnings, want %d", warnings, tc.warnings)
+			}
+			if err := q.Verify(); err != nil {
+				t.Errorf("Verify() got unexpected error: %v", err)
+			}
+		})
+	}
+}
@@ -0,0 +1,188 @@
+/*
+Copyright 2021 The TestGrid Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package config
+
+import (
+	"errors"
+	"time"
+
+	multierror "github.com/hashicorp/go-multierror"
+	"github.com/sirupsen/logrus"
+)
+
+// DefaultSlowWeight is the weight of each reported duration in a group's average, see SlowPolicy.
+const DefaultSlowWeight = 0.25
+
+// SlowPolicy quarantines groups whose processing consistently exceeds an SLO.
+//
+// Quarantined groups run at a reduced cadence, and optionally only during
+// off-peak hours, so a few chronically slow groups do not starve the
+// workers while the queue catches up. See WithSlowPolicy.
+type SlowPolicy struct {
+	// SLO quarantines groups whose average processing time exceeds it.
+	SLO time.Duration
+	// Weight of each reported duration in the average, in (0, 1], where
+	// higher weights react faster. Zero uses DefaultSlowWeight.
+	Weight float64
+	// Interval between dispatches of quarantined groups, when longer than
+	// their usual interval. Zero keeps their usual interval.
+	Interval time.Duration
+	// OffPeakStart and OffPeakEnd are the hours of the day, from 0 to 23,
+	// between which Send dispatches quarantined groups. The hours wrap past
+	// midnight when the start is later than the end. Equal hours, such as
+	// the zero value, allow any hour.
+	OffPeakStart, OffPeakEnd int
+	// Location of the off-peak hours, defaulting to UTC.
+	Location *time.Location
+}
+
+// Validate returns an error describing any invalid settings.
+func (p SlowPolicy) Validate() error {
+	var mErr error
+	if p.SLO <= 0 {
+		mErr = multierror.Append(mErr, errors.New("slow policy requires a positive SLO"))
+	}
+	if p.Weight < 0 || p.Weight > 1 {
+		mErr = multierror.Append(mErr, errors.New("slow policy weight outside [0, 1]"))
+	}
+	if p.Interval < 0 {
+		mErr = multierror.Append(mErr, errors.New("negative slow policy interval"))
+	}
+	if p.OffPeakStart < 0 || p.OffPeakStart > 23 || p.OffPeakEnd < 0 || p.OffPeakEnd > 23 {
+		mErr = multierror.Append(mErr, errors.New("slow policy off-peak hours outside [0, 23]"))
+	}
+	return mErr
+}
+
+// WithSlowPolicy quarantines groups whose processing time, as reported by AckDuration, consistently exceeds an SLO.
+//
+// Each report updates the group's average processing time. Groups are
+// quarantined while their average exceeds the SLO, and released once it
+// recovers, at which point a group held for off-peak hours becomes due
+// immediately. Send skips quarantined groups due outside off-peak hours,
+// counting them as filtered and rescheduling them to the start of the next
+// off-peak hours. Pinned groups are never held, see Pin.
+func WithSlowPolicy(p SlowPolicy) QueueOption {
+	return func(q *TestGroupQueue) {
+		if p.Weight == 0 {
+			p.Weight = DefaultSlowWeight
+		}
+		if p.Location == nil {
+			p.Location = time.UTC
+		}
+		q.slow = &p
+	}
+}
+
+// AckDuration reports the result of processing the group and how long it took, see Ack.
+//
+// Updates the group's average processing time, quarantining or releasing
+// the group when the queue has a SlowPolicy, see WithSlowPolicy.
+func (q *TestGroupQueue) AckDuration(name string, err error, took time.Duration) error {
+	q.lock.Lock()
+	defer q.lock.Unlock()
+	defer q.rouse()
+	name = q.lookupLocked(name)
+	if err := q.ackLocked(name, err); err != nil {
+		return err
+	}
+	it := q.items[name]
+	weight := DefaultSlowWeight
+	if q.slow != nil {
+		weight = q.slow.Weight
+	}
+	if it.took == 0 {
+		it.took = took
+	} else {
+		it.took += time.Duration(weight * float64(took-it.took))
+	}
+	if q.slow == nil {
+		return nil
+	}
+	slow := it.took > q.slow.SLO
+	if slow == it.slow {
+		return nil
+	}
+	it.slow = slow
+	log := logrus.WithFields(logrus.Fields{
+		"group":   name,
+		"average": it.took,
+		"slo":     q.slow.SLO,
+	})
+	if slow {
+		log.Warning("Quarantining slow group")
+		return nil
+	}
+	log.Info("Releasing group from quarantine")
+	if it.slowHeld {
+		it.slowHeld = false
+		if now := q.truncate(q.now()); it.when.After(now) {
+			q.fixedLocked(it, now, "recovered")
+			q.scheduleLocked(it, now)
+			q.reorderLocked(it)
+		}
+	}
+	return nil
+}
+
+// slowIntervalLocked returns the interval between dispatches of the item, reduced while quarantined.
+func (q *TestGroupQueue) slowIntervalLocked(it *item, interval time.Duration) time.Duration {
+	if it.slow && q.slow.Interval > interval {
+		return q.slow.Interval
+	}
+	return interval
+}
+
+// quarantineLocked reschedules a quarantined item due outside off-peak hours rather than dispatching it.
+//
+// Returns whether the item was held.
+func (q *TestGroupQueue) quarantineLocked(it *item, now time.Time) bool {
+	if !it.slow || it.pinned {
+		return false
+	}
+	start, ok := q.slow.offPeak(now)
+	if ok {
+		return false
+	}
+	when := q.truncate(start)
+	it.slowHeld = true
+	q.skippedLocked(SkipSlow)
+	q.fixedLocked(it, when, "slow")
+	q.scheduleLocked(it, when)
+	q.reorderLocked(it)
+	return true
+}
+
+// offPeak returns whether now is within off-peak hours, or else when they next start.
+func (p *SlowPolicy) offPeak(now time.Time) (time.Time, bool) {
+	if p.OffPeakStart == p.OffPeakEnd {
+		return now, true
+	}
+	t := now.In(p.Location)
+	h := t.Hour()
+	if p.OffPeakStart < p.OffPeakEnd && h >= p.OffPeakStart && h < p.OffPeakEnd {
+		return now, true
+	}
+	if p.OffPeakStart > p.OffPeakEnd && (h >= p.OffPeakStart || h < p.OffPeakEnd) {
+		return now, true
+	}
+	start := time.Date(t.Year(), t.Month(), t.Day(), p.OffPeakStart, 0, 0, 0, p.Location)
+	if !start.After(t) {
+		start = start.AddDate(0, 0, 1)
+	}
+	return start, false
+}
@@ -0,0 +1,341 @@
+/*
+Copyright 2021 The TestGrid Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package config
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	configpb "github.com/GoogleCloudPlatform/testgrid/pb/config"
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestAckDuration(t *testing.T) {
+	now := time.Date(2021, 1, 2, 3, 4, 5, 0, time.UTC)
+	cases := []struct {
+		name     string
+		policy   *SlowPolicy
+		group    string
+		took     []time.Duration
+		wantTook time.Duration
+		wantSlow bool
+		err      error
+	}{
+		{
+			name:     "tracks average without policy",
+			took:     []time.Duration{5 * time.Minute, 10 * time.Minute, 100 * time.Minute},
+			wantTook: 29*time.Minute + 41*time.Second + 250*time.Millisecond,
+		},
+		{
+			name:     "consistently slow",
+			policy:   &SlowPolicy{SLO: 10 * time.Minute},
+			took:     []time.Duration{20 * time.Minute, 20 * time.Minute},
+			wantTook: 20 * time.Minute,
+			wantSlow: true,
+		},
+		{
+			name:     "one outlier",
+			policy:   &SlowPolicy{SLO: 10 * time.Minute},
+			took:     []time.Duration{5 * time.Minute, 5 * time.Minute, 20 * time.Minute},
+			wantTook: 8*time.Minute + 45*time.Second,
+		},
+		{
+			name:     "recovered",
+			policy:   &SlowPolicy{SLO: 10 * time.Minute},
+			took:     []time.Duration{20 * time.Minute, time.Minute, time.Minute, time.Minute},
+			wantTook: 9*time.Minute + 937500*time.Microsecond,
+		},
+		{
+			name:     "heavier weight",
+			policy:   &SlowPolicy{SLO: 10 * time.Minute, Weight: 1},
+			took:     []time.Duration{20 * time.Minute, time.Minute},
+			wantTook: time.Minute,
+		},
+		{
+			name:  "missing",
+			group: "missing",
+			took:  []time.Duration{time.Minute},
+			err:   ErrNotFound,
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			var opts []QueueOption
+			if tc.policy != nil {
+				opts = append(opts, WithSlowPolicy(*tc.policy))
+			}
+			q := NewTestGroupQueue(append(opts, WithClock(NewFakeClock(now)))...)
+			q.Init([]*configpb.TestGroup{{Name: "hello"}}, now)
+			group := tc.group
+			if group == "" {
+				group = "hello"
+			}
+			var err error
+			for _, took := range tc.took {
+				if err = q.AckDuration(group, nil, took); err != nil {
+					break
+				}
+			}
+			if !errors.Is(err, tc.err) {
+				t.Fatalf("AckDuration() got error %v, want %v", err, tc.err)
+			}
+			want := []QueueItem{{Name: "hello", When: now, Took: tc.wantTook, Slow: tc.wantSlow}}
+			if diff := cmp.Diff(want, q.Items()); diff != "" {
+				t.Errorf("Items() got unexpected diff (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestSlowCadence(t *testing.T) {
+	now := time.Date(2021, 1, 2, 3, 4, 5, 0, time.UTC)
+	clock := NewFakeClock(now)
+	q := NewTestGroupQueue(WithClock(clock), WithSlowPolicy(SlowPolicy{
+		SLO:      10 * time.Minute,
+		Weight:   1,
+		Interval: time.Hour,
+	}))
+	q.Init([]*configpb.TestGroup{{Name: "slow"}, {Name: "fast"}}, now)
+	if err := q.AckDuration("slow", nil, 20*time.Minute); err != nil {
+		t.Fatalf("AckDuration() got unexpected error: %v", err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	ch := make(chan *configpb.TestGroup, 2)
+	go q.Send(ctx, ch, time.Minute)
+	receive := func(want string) {
+		t.Helper()
+		select {
+		case tg := <-ch:
+			if tg.Name != want {
+				t.Fatalf("Send() got %s, want %s", tg.Name, want)
+			}
+		case <-ctx.Done():
+			t.Fatalf("Send() never sent %s", want)
+		}
+	}
+	when := func(name string, want time.Time) {
+		t.Helper()
+		if err := clock.BlockUntil(ctx, 1); err != nil { // Send is sleeping
+			t.Fatalf("BlockUntil() got unexpected error: %v", err)
+		}
+		got, err := q.When(name)
+		if err != nil {
+			t.Fatalf("When(%s) got unexpected error: %v", name, err)
+		}
+		if !got.Equal(want) {
+			t.Errorf("When(%s) got %s, want %s", name, got, want)
+		}
+	}
+
+	receive("slow")
+	receive("fast")
+	when("slow", now.Add(time.Hour))
+	when("fast", now.Add(time.Minute))
+
+	if err := q.AckDuration("slow", nil, time.Minute); err != nil {
+		t.Fatalf("AckDuration() got unexpected error: %v", err)
+	}
+	when("slow", now.Add(time.Hour)) // recovering keeps the current schedule
+	for i := 1; i < 60; i++ {
+		clock.Advance(time.Minute)
+		receive("fast")
+		if err := clock.BlockUntil(ctx, 1); err != nil {
+			t.Fatalf("BlockUntil() got unexpected error: %v", err)
+		}
+	}
+	clock.Advance(time.Minute)
+	receive("slow")
+	receive("fast")
+	when("slow", now.Add(time.Hour+time.Minute))
+}
+
+func TestSlowOffPeak(t *testing.T) {
+	noon := time.Date(2021, 1, 2, 12, 0, 0, 0, time.UTC)
+	cases := []struct {
+		name     string
+		pin      bool
+		recover  bool
+		want     []string
+		wantWhen time.Time
+		skips    int
+	}{
+		{
+			name:     "held until off-peak",
+			want:     []string{"fast"},
+			wantWhen: time.Date(2021, 1, 2, 22, 0, 0, 0, time.UTC),
+			skips:    1,
+		},
+		{
+			name:     "pinned",
+			pin:      true,
+			want:     []string{"slow", "fast"},
+			wantWhen: noon.Add(time.Hour),
+		},
+		{
+			name:     "recovered",
+			recover:  true,
+			want:     []string{"fast", "slow"},
+			wantWhen: noon.Add(time.Hour),
+			skips:    1,
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			clock := NewFakeClock(noon)
+			q := NewTestGroupQueue(WithClock(clock), WithSlowPolicy(SlowPolicy{
+				SLO:          10 * time.Minute,
+				Weight:       1,
+				OffPeakStart: 22,
+				OffPeakEnd:   6,
+			}))
+			q.Init([]*configpb.TestGroup{{Name: "slow"}, {Name: "fast"}}, noon)
+			if err := q.AckDuration("slow", nil, 20*time.Minute); err != nil {
+				t.Fatalf("AckDuration() got unexpected error: %v", err)
+			}
+			if tc.pin {
+				if err := q.Pin("slow"); err != nil {
+					t.Fatalf("Pin() got unexpected error: %v", err)
+				}
+			}
+
+			ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+			defer cancel()
+			ch := make(chan *configpb.TestGroup, 2)
+			go q.Send(ctx, ch, time.Hour)
+			var got []string
+			receive := func() {
+				select {
+				case tg := <-ch:
+					got = append(got, tg.Name)
+				case <-ctx.Done():
+					t.Fatal("Send() sent too few groups")
+				}
+			}
+			for range tc.want {
+				if tc.recover && len(got) == 1 {
+					if err := clock.BlockUntil(ctx, 1); err != nil { // Send is sleeping
+						t.Fatalf("BlockUntil() got unexpected error: %v", err)
+					}
+					if err := q.AckDuration("slow", nil, time.Minute); err != nil {
+						t.Fatalf("AckDuration() got unexpected error: %v", err)
+					}
+				}
+				receive()
+			}
+			if diff := cmp.Diff(tc.want, got); diff != "" {
+				t.Errorf("Send() got unexpected groups (-want +got):\n%s", diff)
+			}
+			if err := clock.BlockUntil(ctx, 1); err != nil {
+				t.Fatalf("BlockUntil() got unexpected error: %v", err)
+			}
+			if when, err := q.When("slow"); err != nil || !when.Equal(tc.wantWhen) {
+				t.Errorf("When(slow) got %s, %v, want %s", when, err, tc.wantWhen)
+			}
+			if n := q.SkipStats()[SkipSlow]; n != tc.skips {
+				t.Errorf("SkipStats() got %d slow skips, want %d", n, tc.skips)
+			}
+		})
+	}
+}
+
+func TestOffPeak(t *testing.T) {
+	est := time.FixedZone("EST", -5*60*60)
+	cases := []struct {
+		name       string
+		start, end int
+		loc        *time.Location
+		now        time.Time
+		want       time.Time
+		ok         bool
+	}{
+		{
+			name: "any hour",
+			now:  time.Date(2021, 1, 2, 12, 0, 0, 0, time.UTC),
+			ok:   true,
+		},
+		{
+			name:  "within",
+			start: 1,
+			end:   5,
+			now:   time.Date(2021, 1, 2, 3, 0, 0, 0, time.UTC),
+			ok:    true,
+		},
+		{
+			name:  "before",
+			start: 1,
+			end:   5,
+			now:   time.Date(2021, 1, 2, 0, 30, 0, 0, time.UTC),
+			want:  time.Date(2021, 1, 2, 1, 0, 0, 0, time.UTC),
+		},
+		{
+			name:  "at the end",
+			start: 1,
+			end:   5,
+			now:   time.Date(2021, 1, 2, 5, 0, 0, 0, time.UTC),
+			want:  time.Date(2021, 1, 3, 1, 0, 0, 0, time.UTC),
+		},
+		{
+			name:  "wraps before midnight",
+			start: 22,
+			end:   6,
+			now:   time.Date(2021, 1, 2, 23, 0, 0, 0, time.UTC),
+			ok:    true,
+		},
+		{
+			name:  "wraps after midnight",
+			start: 22,
+			end:   6,
+			now:   time.Date(2021, 1, 2, 3, 0, 0, 0, time.UTC),
+			ok:    true,
+		},
+		{
+			name:  "outside wrapped hours",
+			start: 22,
+			end:   6,
+			now:   time.Date(2021, 1, 2, 12, 0, 0, 0, time.UTC),
+			want:  time.Date(2021, 1, 2, 22, 0, 0, 0, time.UTC),
+		},
+		{
+			name:  "location",
+			start: 22,
+			end:   6,
+			loc:   est,
+			now:   time.Date(2021, 1, 2, 12, 0, 0, 0, time.UTC),
+			want:  time.Date(2021, 1, 3, 3, 0, 0, 0, time.UTC),
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			var q TestGroupQueue
+			WithSlowPolicy(SlowPolicy{SLO: time.Minute, OffPeakStart: tc.start, OffPeakEnd: tc.end, Location: tc.loc})(&q)
+			got, ok := q.slow.offPeak(tc.now)
+			if ok != tc.ok {
+				t.Fatalf("offPeak() got ok %t, want %t", ok, tc.ok)
+			}
+			if !ok && !got.Equal(tc.want) {
+				t.Errorf("offPeak() got %s, want %s", got, tc.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,72 @@
+/*
+Copyright 2021 The TestGrid Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package config
+
+import (
+	"sort"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+// WithFixSmoothing spreads groups a single FixAll or FixEach makes due over window, when it makes more than threshold due.
+//
+// Fixing thousands of groups to now, such as when restoring their schedule
+// after an outage, would otherwise have Send dispatch them all at once,
+// the stampede InitSchedule lets callers avoid. Groups keep their relative
+// order, by when they were fixed to and then by name, spaced evenly from
+// now. Only groups fixed to now or earlier are spread; those fixed to the
+// future keep their exact time. Without this option groups keep exactly
+// the times they are fixed to.
+func WithFixSmoothing(threshold int, window time.Duration) QueueOption {
+	return func(q *TestGroupQueue) {
+		q.smoothThreshold = threshold
+		q.smoothWindow = window
+	}
+}
+
+// smoothLocked spreads fixes making groups due over the smoothing window, see WithFixSmoothing.
+//
+// Reorders fixes by when, in place, so groups spread to the same time after
+// truncation still queue in order. Returns whether it spread any.
+func (q *TestGroupQueue) smoothLocked(fixes []fixedItem) bool {
+	if q.smoothThreshold <= 0 || q.smoothWindow <= 0 || len(fixes) <= q.smoothThreshold {
+		return false
+	}
+	now := q.now()
+	var due int
+	for _, f := range fixes {
+		if !f.when.After(now) {
+			due++
+		}
+	}
+	if due <= q.smoothThreshold {
+		return false
+	}
+	sort.SliceStable(fixes, func(i, j int) bool {
+		return fixes[i].when.Before(fixes[j].when)
+	})
+	for i := 0; i < due; i++ { // due groups sort first
+		offset := q.smoothWindow * time.Duration(i) / time.Duration(due)
+		fixes[i].when = q.truncate(now.Add(offset))
+	}
+	logrus.WithFields(logrus.Fields{
+		"groups": due,
+		"window": q.smoothWindow,
+	}).Info("Spreading groups fixed to be due at once")
+	return true
+}
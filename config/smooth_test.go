@@ -0,0 +1,120 @@
+/*
+Copyright 2021 The TestGrid Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package config
+
+import (
+	"testing"
+	"time"
+
+	configpb "github.com/GoogleCloudPlatform/testgrid/pb/config"
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestFixSmoothing(t *testing.T) {
+	now := time.Date(2021, 1, 2, 3, 4, 5, 0, time.UTC)
+	whens := map[string]time.Time{
+		"a": now,
+		"b": now.Add(-time.Minute),
+		"c": now,
+		"d": now.Add(2 * time.Hour),
+	}
+	fixAll := func(q *TestGroupQueue) error {
+		return q.FixAll(whens)
+	}
+	fixEach := func(q *TestGroupQueue) error {
+		return q.FixEach(func(name string, _ time.Time) (time.Time, bool) {
+			when, ok := whens[name]
+			return when, ok
+		})
+	}
+	exact := []QueueItem{
+		{Name: "b", When: now.Add(-time.Minute)},
+		{Name: "a", When: now},
+		{Name: "c", When: now},
+		{Name: "e", When: now.Add(time.Hour)},
+		{Name: "d", When: now.Add(2 * time.Hour)},
+	}
+	spread := []QueueItem{
+		{Name: "b", When: now},
+		{Name: "a", When: now.Add(80 * time.Second)},
+		{Name: "c", When: now.Add(160 * time.Second)},
+		{Name: "e", When: now.Add(time.Hour)},
+		{Name: "d", When: now.Add(2 * time.Hour)},
+	}
+	cases := []struct {
+		name string
+		opts []QueueOption
+		fix  func(*TestGroupQueue) error
+		want []QueueItem
+	}{
+		{
+			name: "basically works",
+			fix:  fixAll,
+			want: exact,
+		},
+		{
+			name: "below threshold",
+			opts: []QueueOption{WithFixSmoothing(3, 4*time.Minute)},
+			fix:  fixAll,
+			want: exact,
+		},
+		{
+			name: "spread",
+			opts: []QueueOption{WithFixSmoothing(2, 4*time.Minute)},
+			fix:  fixAll,
+			want: spread,
+		},
+		{
+			name: "spread each",
+			opts: []QueueOption{WithFixSmoothing(2, 4*time.Minute)},
+			fix:  fixEach,
+			want: spread,
+		},
+		{
+			name: "granularity",
+			opts: []QueueOption{WithFixSmoothing(2, 4*time.Minute), WithGranularity(time.Minute)},
+			fix:  fixAll,
+			want: []QueueItem{
+				{Name: "b", When: now.Truncate(time.Minute)},
+				{Name: "a", When: now.Add(80 * time.Second).Truncate(time.Minute)},
+				{Name: "c", When: now.Add(160 * time.Second).Truncate(time.Minute)},
+				{Name: "e", When: now.Add(time.Hour).Truncate(time.Minute)},
+				{Name: "d", When: now.Add(2 * time.Hour).Truncate(time.Minute)},
+			},
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			q := NewTestGroupQueue(append([]QueueOption{WithClock(NewFakeClock(now))}, tc.opts...)...)
+			q.Init([]*configpb.TestGroup{{Name: "a"}, {Name: "b"}, {Name: "c"}, {Name: "d"}, {Name: "e"}}, now.Add(time.Hour))
+			if err := tc.fix(q); err != nil {
+				t.Fatalf("fix got unexpected error: %v", err)
+			}
+			var got []QueueItem
+			for _, it := range q.Items() {
+				got = append(got, QueueItem{Name: it.Name, When: it.When})
+			}
+			if diff := cmp.Diff(tc.want, got); diff != "" {
+				t.Errorf("got unexpected diff (-want +got):\n%s", diff)
+			}
+			if err := q.Verify(); err != nil {
+				t.Errorf("Verify() got unexpected error: %v", err)
+			}
+		})
+	}
+}
@@ -0,0 +1,51 @@
+/*
+Copyright 2021 The TestGrid Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package config
+
+import (
+	"time"
+)
+
+// ScheduleSnapshot records when each group in a queue is due.
+//
+// Times are in UTC, so the JSON encoding is RFC3339 with an explicit offset.
+type ScheduleSnapshot struct {
+	Taken  time.Time            `json:"taken"`
+	Groups map[string]time.Time `json:"groups"`
+}
+
+// Snapshot returns when each group in the queue is due.
+func (q *TestGroupQueue) Snapshot() ScheduleSnapshot {
+	q.lock.RLock()
+	defer q.lock.RUnlock()
+	groups := make(map[string]time.Time, len(q.items))
+	for name, it := range q.items {
+		groups[name] = it.when.UTC()
+	}
+	return ScheduleSnapshot{
+		Taken:  q.now().UTC(),
+		Groups: groups,
+	}
+}
+
+// Restore reschedules groups to when the snapshot says they are due.
+//
+// Times may be in any zone; they are normalized to UTC.
+// Groups in the snapshot but not the queue are ignored and returned in an ErrNotFound error.
+func (q *TestGroupQueue) Restore(s ScheduleSnapshot) error {
+	return q.FixAll(s.Groups)
+}
@@ -0,0 +1,141 @@
+/*
+Copyright 2021 The TestGrid Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package config
+
+import (
+	"encoding/json"
+	"errors"
+	"testing"
+	"time"
+
+	configpb "github.com/GoogleCloudPlatform/testgrid/pb/config"
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestUTC(t *testing.T) {
+	base := time.Date(2021, 3, 14, 9, 30, 0, 0, time.UTC)
+	east := time.FixedZone("east", 9*60*60)
+	west := time.FixedZone("west", -7*60*60)
+
+	var q TestGroupQueue
+	q.Init([]*configpb.TestGroup{{Name: "init"}, {Name: "fix"}, {Name: "all"}}, base.In(east))
+	if err := q.Add(&configpb.TestGroup{Name: "add"}, base.Add(time.Minute).In(west)); err != nil {
+		t.Fatalf("Add() got unexpected error: %v", err)
+	}
+	if err := q.Fix("fix", base.Add(-time.Minute).In(west)); err != nil {
+		t.Fatalf("Fix() got unexpected error: %v", err)
+	}
+	if err := q.FixAll(map[string]time.Time{"all": base.Add(time.Hour).In(east)}); err != nil {
+		t.Fatalf("FixAll() got unexpected error: %v", err)
+	}
+
+	want := []QueueItem{
+		{Name: "fix", When: base.Add(-time.Minute)},
+		{Name: "init", When: base},
+		{Name: "add", When: base.Add(time.Minute)},
+		{Name: "all", When: base.Add(time.Hour)},
+	}
+	got := q.Items()
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Errorf("Items() got unexpected diff (-want +got):\n%s", diff)
+	}
+	for _, it := range got {
+		if loc := it.When.Location(); loc != time.UTC {
+			t.Errorf("Items() %s got location %v, want UTC", it.Name, loc)
+		}
+	}
+	if _, _, when := q.Status(); when.Location() != time.UTC {
+		t.Errorf("Status() got location %v, want UTC", when.Location())
+	}
+	if when, err := q.When("add"); err != nil || when.Location() != time.UTC {
+		t.Errorf("When() got %v, %v, want UTC", when, err)
+	}
+}
+
+func TestSnapshot(t *testing.T) {
+	base := time.Date(2021, 11, 7, 1, 30, 0, 123456789, time.FixedZone("dst", -4*60*60))
+	cases := []struct {
+		name   string
+		groups map[string]time.Time
+	}{
+		{
+			name:   "empty",
+			groups: map[string]time.Time{},
+		},
+		{
+			name: "mixed zones",
+			groups: map[string]time.Time{
+				"east": base.In(time.FixedZone("east", 5*60*60+30*60)),
+				"west": base.Add(time.Hour).In(time.FixedZone("standard", -5*60*60)),
+				"utc":  base.Add(-time.Nanosecond).UTC(),
+			},
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			var tgs []*configpb.TestGroup
+			for name := range tc.groups {
+				tgs = append(tgs, &configpb.TestGroup{Name: name})
+			}
+			var q TestGroupQueue
+			q.Init(tgs, base)
+			if err := q.FixAll(tc.groups); err != nil {
+				t.Fatalf("FixAll() got unexpected error: %v", err)
+			}
+
+			buf, err := json.Marshal(q.Snapshot())
+			if err != nil {
+				t.Fatalf("Marshal() got unexpected error: %v", err)
+			}
+			var s ScheduleSnapshot
+			if err := json.Unmarshal(buf, &s); err != nil {
+				t.Fatalf("Unmarshal() got unexpected error: %v", err)
+			}
+
+			var restored TestGroupQueue
+			restored.Init(tgs, base.Add(24*time.Hour))
+			if err := restored.Restore(s); err != nil {
+				t.Fatalf("Restore() got unexpected error: %v", err)
+			}
+			if diff := cmp.Diff(q.Items(), restored.Items()); diff != "" {
+				t.Errorf("Restore() got unexpected diff (-want +got):\n%s", diff)
+			}
+			if diff := cmp.Diff(q.Snapshot().Groups, restored.Snapshot().Groups); diff != "" {
+				t.Errorf("Snapshot() got unexpected diff (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestRestoreMissing(t *testing.T) {
+	var q TestGroupQueue
+	now := time.Now()
+	q.Init([]*configpb.TestGroup{{Name: "hello"}}, now)
+	err := q.Restore(ScheduleSnapshot{
+		Groups: map[string]time.Time{
+			"hello": now.Add(time.Minute),
+			"gone":  now,
+		},
+	})
+	if !errors.Is(err, ErrNotFound) {
+		t.Errorf("Restore() got error %v, want ErrNotFound", err)
+	}
+	if got, err := q.When("hello"); err != nil || !got.Equal(now.Add(time.Minute)) {
+		t.Errorf("When() got %v, %v, want %v", got, err, now.Add(time.Minute))
+	}
+}
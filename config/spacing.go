@@ -0,0 +1,83 @@
+/*
+Copyright 2021 The TestGrid Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package config
+
+import (
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+// WithMinSpacing prevents Send from dispatching a group within d of its previous dispatch.
+//
+// Send reschedules a group due too soon to d after its previous dispatch,
+// however it became due, such as by Fix, Add or a short frequency.
+// SetMinSpacing overrides d for individual groups, and Prioritize bypasses
+// the spacing for the group's next dispatch. Flush and SendWindowed ignore it.
+func WithMinSpacing(d time.Duration) QueueOption {
+	return func(q *TestGroupQueue) {
+		q.minSpacing = d
+	}
+}
+
+// SetMinSpacing overrides the queue's minimum spacing for the group, see WithMinSpacing.
+//
+// A zero d reverts to the queue's minimum spacing.
+func (q *TestGroupQueue) SetMinSpacing(name string, d time.Duration) error {
+	q.lock.Lock()
+	defer q.lock.Unlock()
+	name = q.lookupLocked(name)
+	it, ok := q.items[name]
+	if !ok {
+		return ErrNotFound
+	}
+	it.spacing = d
+	return nil
+}
+
+// spaceLocked reschedules the item when dispatching it now would be too soon after its previous dispatch.
+//
+// Returns whether the item was rescheduled.
+func (q *TestGroupQueue) spaceLocked(it *item, now time.Time) bool {
+	d := q.minSpacing
+	if it.spacing > 0 {
+		d = it.spacing
+	}
+	if o, ok := q.overrideLocked(it.tg.Name, now); ok && time.Duration(o.MinInterval) > d {
+		d = time.Duration(o.MinInterval)
+	}
+	if d <= 0 || it.dispatched.IsZero() || it.urgent {
+		return false
+	}
+	earliest := it.dispatched.Add(d)
+	if !now.Before(earliest) {
+		return false
+	}
+	when := q.truncate(earliest)
+	if when.Before(earliest) {
+		when = when.Add(q.granularity) // never earlier than the spacing
+	}
+	logrus.WithFields(logrus.Fields{
+		"group": it.tg.Name,
+		"when":  when,
+	}).Info("Spacing out group dispatches")
+	q.skippedLocked(SkipSpacing)
+	q.fixedLocked(it, when, "spacing")
+	q.scheduleLocked(it, when)
+	q.reorderLocked(it)
+	return true
+}
@@ -0,0 +1,167 @@
+/*
+Copyright 2021 The TestGrid Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package config
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	configpb "github.com/GoogleCloudPlatform/testgrid/pb/config"
+)
+
+func TestMinSpacing(t *testing.T) {
+	start := time.Date(2021, 1, 2, 3, 4, 5, 0, time.UTC)
+	cases := []struct {
+		name    string
+		opts    []QueueOption
+		spacing time.Duration // for the group
+		urgent  bool          // prioritize rather than fix
+
+		immediate bool
+		want      time.Time
+	}{
+		{
+			name:      "no spacing",
+			immediate: true,
+		},
+		{
+			name: "queue spacing",
+			opts: []QueueOption{WithMinSpacing(time.Minute)},
+			want: start.Add(time.Minute),
+		},
+		{
+			name:    "group spacing overrides queue",
+			opts:    []QueueOption{WithMinSpacing(time.Minute)},
+			spacing: 2 * time.Minute,
+			want:    start.Add(2 * time.Minute),
+		},
+		{
+			name:    "group spacing without queue spacing",
+			spacing: 2 * time.Minute,
+			want:    start.Add(2 * time.Minute),
+		},
+		{
+			name: "spacing rounds up to granularity",
+			opts: []QueueOption{
+				WithMinSpacing(90 * time.Second),
+				WithGranularity(time.Minute),
+			},
+			want: start.Truncate(time.Minute).Add(2 * time.Minute),
+		},
+		{
+			name:      "prioritize bypasses spacing",
+			opts:      []QueueOption{WithMinSpacing(time.Minute)},
+			urgent:    true,
+			immediate: true,
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			clock := NewFakeClock(start)
+			q := NewTestGroupQueue(append(tc.opts, WithClock(clock))...)
+			q.Init([]*configpb.TestGroup{{Name: "hi"}}, start)
+			if tc.spacing > 0 {
+				if err := q.SetMinSpacing("hi", tc.spacing); err != nil {
+					t.Fatalf("SetMinSpacing() got unexpected error: %v", err)
+				}
+			}
+
+			ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+			defer cancel()
+			ch := make(chan *configpb.TestGroup)
+			go q.Send(ctx, ch, time.Hour)
+			<-ch
+
+			if tc.urgent {
+				q.Prioritize("hi")
+			} else {
+				q.Fix("hi", clock.Now())
+			}
+			if tc.immediate {
+				select {
+				case <-ch:
+				case <-ctx.Done():
+					t.Fatal("Send() did not dispatch the group again")
+				}
+				return
+			}
+
+			for {
+				got, err := q.When("hi")
+				if err != nil {
+					t.Fatalf("When() got unexpected error: %v", err)
+				}
+				if got.Equal(tc.want) {
+					break
+				}
+				if ctx.Err() != nil {
+					t.Fatalf("When() got %v, want %v", got, tc.want)
+				}
+				time.Sleep(time.Millisecond)
+			}
+			select {
+			case tg := <-ch:
+				t.Fatalf("Send() dispatched %s too soon", tg.Name)
+			default:
+			}
+			clock.Advance(tc.want.Sub(clock.Now()))
+			select {
+			case <-ch:
+			case <-ctx.Done():
+				t.Fatal("Send() did not dispatch the group after the spacing")
+			}
+		})
+	}
+
+	if err := NewTestGroupQueue().SetMinSpacing("missing", time.Minute); err == nil {
+		t.Error("SetMinSpacing() wanted an error for a missing group")
+	}
+}
+
+func TestMinSpacingHammer(t *testing.T) {
+	const (
+		spacing  = 100 * time.Millisecond
+		duration = 350 * time.Millisecond
+	)
+	q := NewTestGroupQueue(WithMinSpacing(spacing))
+	q.Init([]*configpb.TestGroup{{Name: "hi"}}, time.Now())
+
+	ctx, cancel := context.WithTimeout(context.Background(), duration)
+	defer cancel()
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		for ctx.Err() == nil {
+			q.Fix("hi", time.Now())
+			time.Sleep(time.Millisecond)
+		}
+	}()
+	var dispatches int
+	q.SendFunc(ctx, func(context.Context, *configpb.TestGroup) error {
+		dispatches++
+		return nil
+	}, time.Hour)
+	wg.Wait()
+
+	if max := int(duration/spacing) + 1; dispatches < 2 || dispatches > max {
+		t.Errorf("SendFunc() dispatched %d times, want between 2 and %d", dispatches, max)
+	}
+}
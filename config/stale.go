@@ -0,0 +1,58 @@
+/*
+Copyright 2021 The TestGrid Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package config
+
+import (
+	"time"
+
+	configpb "github.com/GoogleCloudPlatform/testgrid/pb/config"
+	"github.com/sirupsen/logrus"
+)
+
+// WithStalePredicate makes Send skip delivering groups stale reports as stale.
+//
+// Send calls stale with each group it dispatches, when the group was
+// scheduled and when Send dispatched it, without holding the lock. A stale
+// group is rescheduled as if delivered, or dropped when Send's frequency is
+// zero, counting a SkipStale skip, so groups may define staleness however
+// suits them, such as only during business hours. Send never skips pinned
+// groups as stale, nor any group without a predicate, see Pin.
+func WithStalePredicate(stale func(tg *configpb.TestGroup, scheduled, now time.Time) bool) QueueOption {
+	return func(q *TestGroupQueue) {
+		q.stale = stale
+	}
+}
+
+// skipStale returns true after skipping a dispatch the stale predicate rejects.
+func (q *TestGroupQueue) skipStale(d Dispatch, popped *item) bool {
+	if q.stale == nil || !q.stale(d.Group, d.When, d.Time) {
+		return false
+	}
+	if popped != nil {
+		q.transition()
+	}
+	q.lock.Lock()
+	q.landLocked(d.Group.Name)
+	q.skippedLocked(SkipStale)
+	q.lock.Unlock()
+	logrus.WithFields(logrus.Fields{
+		"group":     d.Group.Name,
+		"scheduled": d.When,
+		"next":      d.Next,
+	}).Info("Skipping stale group")
+	return true
+}
@@ -0,0 +1,125 @@
+/*
+Copyright 2021 The TestGrid Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package config
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	configpb "github.com/GoogleCloudPlatform/testgrid/pb/config"
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestStalePredicate(t *testing.T) {
+	now := time.Date(2021, 1, 2, 3, 4, 5, 0, time.UTC)
+	late := func(_ *configpb.TestGroup, scheduled, now time.Time) bool {
+		return now.Sub(scheduled) > 30*time.Minute
+	}
+	cases := []struct {
+		name      string
+		stale     func(*configpb.TestGroup, time.Time, time.Time) bool
+		frequency time.Duration
+		pin       string
+		delivered []string
+		skips     int
+		remaining map[string]time.Time
+	}{
+		{
+			name:      "unset",
+			delivered: []string{"old", "new"},
+		},
+		{
+			name:      "drop stale",
+			stale:     late,
+			delivered: []string{"new"},
+			skips:     1,
+		},
+		{
+			name:      "reschedule stale",
+			stale:     late,
+			frequency: time.Hour,
+			delivered: []string{"new"},
+			skips:     1,
+			remaining: map[string]time.Time{
+				"old": now.Add(time.Hour),
+				"new": now.Add(time.Hour),
+			},
+		},
+		{
+			name: "by group",
+			stale: func(tg *configpb.TestGroup, _, _ time.Time) bool {
+				return tg.Name == "new"
+			},
+			delivered: []string{"old"},
+			skips:     1,
+		},
+		{
+			name:      "pinned",
+			stale:     late,
+			pin:       "old",
+			delivered: []string{"old", "new"},
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			opts := []QueueOption{WithClock(NewFakeClock(now))}
+			if tc.stale != nil {
+				opts = append(opts, WithStalePredicate(tc.stale))
+			}
+			q := NewTestGroupQueue(opts...)
+			q.InitSchedule([]*configpb.TestGroup{{Name: "old"}, {Name: "new"}}, now, map[string]time.Time{
+				"old": now.Add(-time.Hour),
+			})
+			if tc.pin != "" {
+				q.Pin(tc.pin)
+			}
+
+			ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+			defer cancel()
+			var delivered []string
+			q.SendFunc(ctx, func(_ context.Context, tg *configpb.TestGroup) error {
+				delivered = append(delivered, tg.Name)
+				if tg.Name == "new" {
+					cancel() // the last due group
+				}
+				return nil
+			}, tc.frequency)
+
+			if diff := cmp.Diff(tc.delivered, delivered); diff != "" {
+				t.Errorf("SendFunc() got unexpected deliveries (-want +got):\n%s", diff)
+			}
+			if got := q.SkipStats()[SkipStale]; got != tc.skips {
+				t.Errorf("SkipStats() got %d stale, want %d", got, tc.skips)
+			}
+			if got := q.InFlight(); len(got) != 0 {
+				t.Errorf("InFlight() got %v after skipping, want none", got)
+			}
+			got := map[string]time.Time{}
+			for _, it := range q.Items() {
+				got[it.Name] = it.When
+			}
+			if len(tc.remaining) == 0 {
+				tc.remaining = map[string]time.Time{}
+			}
+			if diff := cmp.Diff(tc.remaining, got); diff != "" {
+				t.Errorf("Items() got unexpected diff (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
@@ -0,0 +1,254 @@
+/*
+Copyright 2021 The TestGrid Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package config
+
+import (
+	"container/heap"
+	"fmt"
+	"sort"
+	"time"
+
+	multierror "github.com/hashicorp/go-multierror"
+	"github.com/sirupsen/logrus"
+)
+
+// scheduleStore orders the queue's items by when they are due.
+//
+// The queue reaches its items only through these methods, always while
+// holding its lock, so another store, such as scanQueue for small queues or a
+// skip list with cheaper bulk updates for very large queues, may replace the
+// heap of priorityQueue.
+// Stores order items by less.
+type scheduleStore interface {
+	// Len returns the number of items.
+	Len() int
+	// all returns every item, in no particular order.
+	all() []*item
+	// sorted returns a copy of every item, in the order they are due.
+	sorted() []*item
+	// peek returns the first item due, or nil when empty.
+	peek() *item
+	// push adds an item.
+	push(it *item)
+	// fix reorders an item after its when, hot or seq changed.
+	fix(it *item)
+	// holds returns whether the item's index locates it, cheaply.
+	holds(it *item) bool
+	// reindex locates the item by scanning, repairing its index, or returns false if absent.
+	reindex(it *item) bool
+	// remove an item.
+	remove(it *item)
+	// pop removes and returns the first item due.
+	pop() *item
+	// removeIf removes every item drop accepts, reordering once, and returns them.
+	removeIf(drop func(*item) bool) []*item
+	// rebuild reorders every item, after changing many at once.
+	rebuild()
+	// countBefore returns the number of items scheduled before now.
+	countBefore(now time.Time) int
+	// nextAfter returns the earliest time after now an item is due.
+	nextAfter(now time.Time) (time.Time, bool)
+	// due returns every item due at now, in no particular order.
+	due(now time.Time) []*item
+	// firstDue returns the first item due at now that ok accepts, or nil.
+	firstDue(now time.Time, ok func(*item) bool) *item
+	// check returns an error describing any item out of order.
+	check() error
+	// compact releases memory held for items since removed.
+	compact()
+}
+
+var _ scheduleStore = (*priorityQueue)(nil)
+
+// less returns true when a is dispatched before b.
+func less(a, b *item) bool {
+	if !a.when.Equal(b.when) {
+		return a.when.Before(b.when)
+	}
+	if a.hot != b.hot {
+		return a.hot
+	}
+	return a.seq < b.seq
+}
+
+func (pq priorityQueue) all() []*item {
+	return pq
+}
+
+func (pq priorityQueue) sorted() []*item {
+	out := make([]*item, len(pq))
+	copy(out, pq)
+	sort.Slice(out, func(i, j int) bool { return less(out[i], out[j]) })
+	return out
+}
+
+func (pq *priorityQueue) push(it *item) {
+	if it.tg == nil { // Send must never deliver a nil group
+		logrus.Error("Ignoring push of nil group to queue")
+		return
+	}
+	heap.Push(pq, it)
+}
+
+func (pq *priorityQueue) fix(it *item) {
+	heap.Fix(pq, it.index)
+}
+
+func (pq priorityQueue) holds(it *item) bool {
+	return it.index >= 0 && it.index < len(pq) && pq[it.index] == it
+}
+
+func (pq priorityQueue) reindex(it *item) bool {
+	for i, other := range pq {
+		if other == it {
+			it.index = i
+			return true
+		}
+	}
+	return false
+}
+
+func (pq *priorityQueue) remove(it *item) {
+	heap.Remove(pq, it.index)
+}
+
+func (pq *priorityQueue) pop() *item {
+	return heap.Pop(pq).(*item)
+}
+
+func (pq *priorityQueue) removeIf(drop func(*item) bool) []*item {
+	removed := pq.filter(drop)
+	if len(removed) > 0 {
+		heap.Init(pq)
+	}
+	return removed
+}
+
+// filter removes every item drop accepts, keeping the rest in order, and returns them.
+func (pq *priorityQueue) filter(drop func(*item) bool) []*item {
+	var removed []*item
+	keep := (*pq)[:0]
+	for _, it := range *pq {
+		if drop(it) {
+			it.index = -1
+			removed = append(removed, it)
+			continue
+		}
+		it.index = len(keep)
+		keep = append(keep, it)
+	}
+	for i := len(keep); i < len(*pq); i++ {
+		(*pq)[i] = nil // release removed items
+	}
+	*pq = keep
+	return removed
+}
+
+func (pq *priorityQueue) rebuild() {
+	heap.Init(pq)
+}
+
+func (pq priorityQueue) countBefore(now time.Time) int {
+	return pq.countFrom(0, now)
+}
+
+// countFrom returns the number of items in the subtree rooted at i scheduled before now.
+func (pq priorityQueue) countFrom(i int, now time.Time) int {
+	if i >= len(pq) || !pq[i].when.Before(now) {
+		return 0 // children are no earlier than their parent
+	}
+	return 1 + pq.countFrom(2*i+1, now) + pq.countFrom(2*i+2, now)
+}
+
+func (pq priorityQueue) nextAfter(now time.Time) (time.Time, bool) {
+	return pq.nextFrom(0, now)
+}
+
+// nextFrom returns the earliest time after now an item in the subtree rooted at i is due.
+func (pq priorityQueue) nextFrom(i int, now time.Time) (time.Time, bool) {
+	if i >= len(pq) {
+		return time.Time{}, false
+	}
+	if when := pq[i].when; when.After(now) {
+		return when, true // children are no earlier than their parent
+	}
+	left, lok := pq.nextFrom(2*i+1, now)
+	right, rok := pq.nextFrom(2*i+2, now)
+	if !lok || rok && right.Before(left) {
+		return right, rok
+	}
+	return left, lok
+}
+
+func (pq priorityQueue) due(now time.Time) []*item {
+	return pq.dueFrom(0, now, nil)
+}
+
+// dueFrom appends the items due at now in the subtree rooted at i to out.
+func (pq priorityQueue) dueFrom(i int, now time.Time, out []*item) []*item {
+	if i >= len(pq) || pq[i].when.After(now) {
+		return out // children are no earlier than their parent
+	}
+	out = append(out, pq[i])
+	out = pq.dueFrom(2*i+1, now, out)
+	return pq.dueFrom(2*i+2, now, out)
+}
+
+func (pq priorityQueue) firstDue(now time.Time, ok func(*item) bool) *item {
+	return pq.firstDueFrom(0, now, ok, nil)
+}
+
+// firstDueFrom returns the first item due at now that ok accepts in the subtree rooted at i, or best.
+func (pq priorityQueue) firstDueFrom(i int, now time.Time, ok func(*item) bool, best *item) *item {
+	if i >= len(pq) || pq[i].when.After(now) {
+		return best // children are no earlier than their parent
+	}
+	if it := pq[i]; (best == nil || less(it, best)) && ok(it) {
+		best = it
+	}
+	best = pq.firstDueFrom(2*i+1, now, ok, best)
+	return pq.firstDueFrom(2*i+2, now, ok, best)
+}
+
+func (pq priorityQueue) check() error {
+	var mErr error
+	for i, it := range pq {
+		if it == nil || it.tg == nil {
+			continue
+		}
+		name := it.tg.Name
+		if it.index != i {
+			mErr = multierror.Append(mErr, fmt.Errorf("%d %q: wrong index %d", i, name, it.index))
+		}
+		if i == 0 {
+			continue
+		}
+		if parent := pq[(i-1)/2]; parent != nil && less(it, parent) {
+			mErr = multierror.Append(mErr, fmt.Errorf("%d %q: scheduled before its parent", i, name))
+		}
+	}
+	return mErr
+}
+
+func (pq *priorityQueue) compact() {
+	queue := make(priorityQueue, len(*pq))
+	for i, it := range *pq {
+		it.index = i
+		queue[i] = it
+	}
+	*pq = queue
+}
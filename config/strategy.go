@@ -0,0 +1,98 @@
+/*
+Copyright 2021 The TestGrid Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package config
+
+import (
+	"sort"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+// Strategy picks the next group Send dispatches, for example by predicting
+// which groups have new results.
+//
+// Send calls Next while holding the queue lock, so implementations must not
+// call back into the queue. Send reschedules the group it picks as usual.
+type Strategy interface {
+	// Next returns the name of the group to dispatch from view, which
+	// holds every due group with the most overdue first, or false to
+	// dispatch the most overdue group.
+	Next(view []ItemView, now time.Time) (name string, ok bool)
+}
+
+// ItemView is a snapshot of a due group offered to a Strategy.
+type ItemView struct {
+	Name       string
+	When       time.Time // When the group was due.
+	Dispatched time.Time // When Send last dispatched the group, zero if never.
+}
+
+// EarliestFirst is the default Strategy, dispatching the most overdue group.
+type EarliestFirst struct{}
+
+// Next returns the first group in view.
+func (EarliestFirst) Next(view []ItemView, _ time.Time) (string, bool) {
+	if len(view) == 0 {
+		return "", false
+	}
+	return view[0].Name, true
+}
+
+// WithStrategy replaces the default most-overdue-first dispatch order with s.
+//
+// Send falls back to the most overdue group, logging a warning, whenever s
+// picks a group that is not in the queue or not yet due. Replaces any
+// DispatchPolicy, as WithDispatchPolicy replaces any Strategy, so the last
+// option applied wins.
+func WithStrategy(s Strategy) QueueOption {
+	return func(q *TestGroupQueue) {
+		q.strategy = s
+		q.policy = nil
+	}
+}
+
+// strategyLocked returns the due item the strategy picks, or head when it picks none or an invalid one.
+func (q *TestGroupQueue) strategyLocked(head *item, now time.Time) *item {
+	due := q.store().due(now)
+	sort.Slice(due, func(i, j int) bool { return less(due[i], due[j]) })
+	view := make([]ItemView, 0, len(due))
+	for _, it := range due {
+		view = append(view, ItemView{
+			Name:       it.tg.Name,
+			When:       it.when,
+			Dispatched: it.dispatched,
+		})
+	}
+	name, ok := q.strategy.Next(view, now)
+	if !ok {
+		return head
+	}
+	it, ok := q.items[q.lookupLocked(name)]
+	switch {
+	case !ok:
+		logrus.WithField("group", name).Warning("Strategy picked a group not in the queue, dispatching the most overdue")
+		return head
+	case it.when.After(now):
+		logrus.WithFields(logrus.Fields{
+			"group": name,
+			"when":  it.when,
+		}).Warning("Strategy picked a group not yet due, dispatching the most overdue")
+		return head
+	}
+	return it
+}
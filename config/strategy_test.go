@@ -0,0 +1,195 @@
+/*
+Copyright 2021 The TestGrid Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package config
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	configpb "github.com/GoogleCloudPlatform/testgrid/pb/config"
+	"github.com/google/go-cmp/cmp"
+)
+
+// strategyFunc adapts a function to a Strategy.
+type strategyFunc func([]ItemView, time.Time) (string, bool)
+
+func (f strategyFunc) Next(view []ItemView, now time.Time) (string, bool) {
+	return f(view, now)
+}
+
+func TestStrategy(t *testing.T) {
+	now := time.Date(2021, 1, 2, 3, 4, 5, 0, time.UTC)
+	cases := []struct {
+		name     string
+		strategy Strategy
+		want     []string
+	}{
+		{
+			name: "default",
+			want: []string{"a", "b", "c", "d"},
+		},
+		{
+			name:     "earliest first",
+			strategy: EarliestFirst{},
+			want:     []string{"a", "b", "c", "d"},
+		},
+		{
+			name: "reverse",
+			strategy: strategyFunc(func(view []ItemView, _ time.Time) (string, bool) {
+				return view[len(view)-1].Name, true
+			}),
+			want: []string{"c", "b", "a", "d"},
+		},
+		{
+			name: "declines",
+			strategy: strategyFunc(func([]ItemView, time.Time) (string, bool) {
+				return "c", false
+			}),
+			want: []string{"a", "b", "c", "d"},
+		},
+		{
+			name: "unknown group",
+			strategy: strategyFunc(func([]ItemView, time.Time) (string, bool) {
+				return "missing", true
+			}),
+			want: []string{"a", "b", "c", "d"},
+		},
+		{
+			name: "group not due",
+			strategy: strategyFunc(func([]ItemView, time.Time) (string, bool) {
+				return "d", true
+			}),
+			want: []string{"a", "b", "c", "d"},
+		},
+		{
+			name: "view is a copy",
+			strategy: strategyFunc(func(view []ItemView, _ time.Time) (string, bool) {
+				for i := range view {
+					view[i].Name = "changed"
+					view[i].When = time.Time{}
+				}
+				return "", false
+			}),
+			want: []string{"a", "b", "c", "d"},
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			clock := NewFakeClock(now)
+			var opts []QueueOption
+			if tc.strategy != nil {
+				opts = append(opts, WithStrategy(tc.strategy))
+			}
+			q := NewTestGroupQueue(append(opts, WithClock(clock))...)
+			q.Init([]*configpb.TestGroup{{Name: "a"}, {Name: "b"}, {Name: "c"}, {Name: "d"}}, now)
+			if err := q.FixAll(map[string]time.Time{
+				"a": now.Add(-3 * time.Minute),
+				"b": now.Add(-2 * time.Minute),
+				"c": now.Add(-time.Minute),
+				"d": now.Add(time.Minute),
+			}); err != nil {
+				t.Fatalf("FixAll() got unexpected error: %v", err)
+			}
+
+			ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+			defer cancel()
+			var got []string
+			q.SendFunc(ctx, func(_ context.Context, tg *configpb.TestGroup) error {
+				got = append(got, tg.Name)
+				switch len(got) {
+				case 3:
+					clock.Advance(time.Minute) // d is due
+				case len(tc.want):
+					cancel()
+				}
+				return nil
+			}, 0)
+			if diff := cmp.Diff(tc.want, got); diff != "" {
+				t.Errorf("SendFunc() got unexpected dispatches (-want +got):\n%s", diff)
+			}
+			if err := q.Verify(); err != nil {
+				t.Errorf("Verify() got unexpected error: %v", err)
+			}
+		})
+	}
+}
+
+func TestStrategyView(t *testing.T) {
+	now := time.Date(2021, 1, 2, 3, 4, 5, 0, time.UTC)
+	var got []ItemView
+	q := NewTestGroupQueue(WithClock(NewFakeClock(now)), WithStrategy(strategyFunc(func(view []ItemView, _ time.Time) (string, bool) {
+		if got == nil {
+			got = append([]ItemView(nil), view...)
+		}
+		return "", false
+	})))
+	q.Init([]*configpb.TestGroup{{Name: "a"}, {Name: "b"}, {Name: "later"}}, now)
+	if err := q.FixAll(map[string]time.Time{
+		"b":     now.Add(-time.Minute),
+		"later": now.Add(time.Hour),
+	}); err != nil {
+		t.Fatalf("FixAll() got unexpected error: %v", err)
+	}
+
+	ch := make(chan *configpb.TestGroup, 1)
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	go q.Send(ctx, ch, time.Hour)
+	<-ch
+
+	want := []ItemView{
+		{Name: "b", When: now.Add(-time.Minute)},
+		{Name: "a", When: now},
+	}
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Errorf("Next() got unexpected view (-want +got):\n%s", diff)
+	}
+}
+
+func TestStrategyReplacesPolicy(t *testing.T) {
+	cases := []struct {
+		name     string
+		opts     []QueueOption
+		policy   bool
+		strategy bool
+	}{
+		{
+			name:     "strategy last",
+			opts:     []QueueOption{WithDispatchPolicy(NewPrefixFairness("a-")), WithStrategy(EarliestFirst{})},
+			strategy: true,
+		},
+		{
+			name:   "policy last",
+			opts:   []QueueOption{WithStrategy(EarliestFirst{}), WithDispatchPolicy(NewPrefixFairness("a-"))},
+			policy: true,
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			q := NewTestGroupQueue(tc.opts...)
+			if got := q.policy != nil; got != tc.policy {
+				t.Errorf("policy set got %t, want %t", got, tc.policy)
+			}
+			if got := q.strategy != nil; got != tc.strategy {
+				t.Errorf("strategy set got %t, want %t", got, tc.strategy)
+			}
+		})
+	}
+}
@@ -0,0 +1,116 @@
+/*
+Copyright 2021 The TestGrid Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package config
+
+import (
+	"sync"
+	"time"
+)
+
+// WithSleepTimer makes Send sleep until after fires rather than using a timer from the queue's clock.
+//
+// Intended for hosts running many queues, which may share a SharedTicker
+// so their idle Sends wake together rather than each on its own timer.
+// Send abandons the channel when roused early, so after must never block
+// sending on it, for example by buffering it. The queue's clock still tells
+// the time.
+func WithSleepTimer(after func(d time.Duration) <-chan time.Time) QueueOption {
+	return func(q *TestGroupQueue) {
+		q.sleepTimer = after
+	}
+}
+
+// afterTimer adapts a channel from WithSleepTimer to a Timer.
+type afterTimer struct {
+	ch <-chan time.Time
+}
+
+func (t afterTimer) C() <-chan time.Time { return t.ch }
+
+func (t afterTimer) Stop() bool { return false }
+
+// SharedTicker coalesces sleeps onto a single ticker, see WithSleepTimer.
+//
+// Each sleep ends on the first tick at or after its duration elapses, so
+// sleeps end up to one interval late. Sleeps abandoned by a roused Send
+// are released once they would have ended.
+type SharedTicker struct {
+	lock    sync.Mutex
+	ticker  *time.Ticker
+	stop    chan struct{}
+	waiters []tickWaiter
+}
+
+// tickWaiter is a sleep waiting for a tick.
+type tickWaiter struct {
+	until time.Time
+	ch    chan time.Time
+}
+
+// NewSharedTicker returns a ticker that ticks every interval, until stopped.
+func NewSharedTicker(interval time.Duration) *SharedTicker {
+	t := &SharedTicker{
+		ticker: time.NewTicker(interval),
+		stop:   make(chan struct{}),
+	}
+	go t.run()
+	return t
+}
+
+// After returns a channel that receives the time on the first tick once d elapses.
+func (t *SharedTicker) After(d time.Duration) <-chan time.Time {
+	ch := make(chan time.Time, 1)
+	t.lock.Lock()
+	t.waiters = append(t.waiters, tickWaiter{until: time.Now().Add(d), ch: ch})
+	t.lock.Unlock()
+	return ch
+}
+
+// Stop the ticker. Pending sleeps never end.
+func (t *SharedTicker) Stop() {
+	t.ticker.Stop()
+	close(t.stop)
+}
+
+func (t *SharedTicker) run() {
+	for {
+		select {
+		case <-t.stop:
+			return
+		case now := <-t.ticker.C:
+			t.tick(now)
+		}
+	}
+}
+
+// tick ends the sleeps elapsed by now.
+func (t *SharedTicker) tick(now time.Time) {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	waiting := t.waiters[:0]
+	for _, w := range t.waiters {
+		if w.until.After(now) {
+			waiting = append(waiting, w)
+			continue
+		}
+		w.ch <- now
+	}
+	for i := len(waiting); i < len(t.waiters); i++ {
+		t.waiters[i] = tickWaiter{} // release ended sleeps
+	}
+	t.waiters = waiting
+}
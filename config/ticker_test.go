@@ -0,0 +1,95 @@
+/*
+Copyright 2021 The TestGrid Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package config
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	configpb "github.com/GoogleCloudPlatform/testgrid/pb/config"
+)
+
+func TestSleepTimer(t *testing.T) {
+	now := time.Date(2021, 1, 2, 3, 4, 5, 0, time.UTC)
+	sleeps := make(chan time.Duration)
+	wake := make(chan time.Time, 1)
+	q := NewTestGroupQueue(WithClock(NewFakeClock(now)), WithSleepTimer(func(d time.Duration) <-chan time.Time {
+		sleeps <- d
+		return wake
+	}))
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	ch := make(chan *configpb.TestGroup, 1)
+	go q.Send(ctx, ch, time.Minute)
+
+	sleep := func(want time.Duration) {
+		t.Helper()
+		select {
+		case got := <-sleeps:
+			if got != want {
+				t.Errorf("Send() slept for %s, want %s", got, want)
+			}
+		case <-ctx.Done():
+			t.Fatal("Send() never slept")
+		}
+	}
+	sleep(time.Second) // idle
+	wake <- now
+	sleep(time.Second) // still idle
+
+	q.Add(&configpb.TestGroup{Name: "hello"}, now) // rouses Send
+	select {
+	case tg := <-ch:
+		if tg.Name != "hello" {
+			t.Errorf("Send() got %s, want hello", tg.Name)
+		}
+	case <-ctx.Done():
+		t.Fatal("Send() kept sleeping after Add()")
+	}
+	sleep(time.Minute)
+}
+
+func TestSharedTicker(t *testing.T) {
+	ticker := NewSharedTicker(10 * time.Millisecond)
+	defer ticker.Stop()
+
+	start := time.Now()
+	short := ticker.After(0)
+	other := ticker.After(time.Millisecond)
+	long := ticker.After(50 * time.Millisecond)
+
+	first := <-short
+	if second := <-other; !second.Equal(first) {
+		t.Errorf("After() sleeps ended on different ticks: %s and %s", first, second)
+	}
+	select {
+	case <-long:
+		t.Error("After(50ms) ended on the first tick")
+	default:
+	}
+	if ended := <-long; ended.Sub(start) < 50*time.Millisecond {
+		t.Errorf("After(50ms) ended after %s", ended.Sub(start))
+	}
+
+	ticker.lock.Lock()
+	defer ticker.lock.Unlock()
+	if n := len(ticker.waiters); n != 0 {
+		t.Errorf("SharedTicker kept %d ended sleeps", n)
+	}
+}
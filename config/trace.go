@@ -0,0 +1,68 @@
+/*
+Copyright 2021 The TestGrid Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package config
+
+import (
+	"context"
+	"time"
+)
+
+// Tracer starts a span for each group Send dispatches, see WithTracer.
+//
+// The interface is small enough to adapt to OpenTelemetry or another
+// tracing library without the queue depending on it.
+type Tracer interface {
+	// Start a span for the dispatch, returning a context carrying it.
+	Start(ctx context.Context, attrs SpanAttributes) (context.Context, Span)
+}
+
+// Span traces the delivery of a group.
+type Span interface {
+	// End the span, recording the error delivering the group, if any.
+	End(err error)
+}
+
+// SpanAttributes describe a dispatched group.
+type SpanAttributes struct {
+	Group string
+	When  time.Time     // When the group was due.
+	Lag   time.Duration // How long after When Send dispatched it.
+}
+
+// WithTracer starts a span with t for each group Send, SendFunc, SendFuncDelay or Flush dispatches.
+//
+// The span covers delivery: until a receiver accepts the group, or until
+// the handler returns, which receives the span's context.
+func WithTracer(t Tracer) QueueOption {
+	return func(q *TestGroupQueue) {
+		q.tracer = t
+	}
+}
+
+// startSpan returns the context to deliver a group due at when and dispatched at now.
+//
+// The span is nil without a tracer.
+func (q *TestGroupQueue) startSpan(ctx context.Context, name string, when, now time.Time) (context.Context, Span) {
+	if q.tracer == nil {
+		return ctx, nil
+	}
+	return q.tracer.Start(ctx, SpanAttributes{
+		Group: name,
+		When:  when,
+		Lag:   now.Sub(when),
+	})
+}
@@ -0,0 +1,102 @@
+/*
+Copyright 2021 The TestGrid Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package config
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	configpb "github.com/GoogleCloudPlatform/testgrid/pb/config"
+	"github.com/google/go-cmp/cmp"
+)
+
+type fakeTracer struct {
+	lock  sync.Mutex
+	spans []*fakeSpan
+}
+
+type fakeSpan struct {
+	attrs SpanAttributes
+	ended bool
+	err   error
+}
+
+type spanKey struct{}
+
+func (t *fakeTracer) Start(ctx context.Context, attrs SpanAttributes) (context.Context, Span) {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	s := &fakeSpan{attrs: attrs}
+	t.spans = append(t.spans, s)
+	return context.WithValue(ctx, spanKey{}, s), s
+}
+
+func (s *fakeSpan) End(err error) {
+	s.ended = true
+	s.err = err
+}
+
+func TestTracer(t *testing.T) {
+	start := time.Date(2021, 1, 2, 3, 4, 5, 0, time.UTC)
+	var tracer fakeTracer
+	q := NewTestGroupQueue(WithClock(NewFakeClock(start)), WithTracer(&tracer))
+	q.Init([]*configpb.TestGroup{{Name: "hi"}, {Name: "there"}}, start)
+	q.Fix("hi", start.Add(-time.Minute))
+	boom := errors.New("boom")
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	err := q.SendFunc(ctx, func(ctx context.Context, tg *configpb.TestGroup) error {
+		s, ok := ctx.Value(spanKey{}).(*fakeSpan)
+		switch {
+		case !ok:
+			t.Errorf("SendFunc() handler got context without a span for %s", tg.Name)
+		case s.attrs.Group != tg.Name:
+			t.Errorf("SendFunc() handler got span for %s, want %s", s.attrs.Group, tg.Name)
+		case s.ended:
+			t.Errorf("SendFunc() ended span for %s before the handler returned", tg.Name)
+		}
+		if tg.Name == "there" {
+			return boom
+		}
+		return nil
+	}, time.Hour)
+	if err != boom {
+		t.Errorf("SendFunc() got %v, want %v", err, boom)
+	}
+
+	want := []fakeSpan{
+		{
+			attrs: SpanAttributes{Group: "hi", When: start.Add(-time.Minute), Lag: time.Minute},
+			ended: true,
+		},
+		{
+			attrs: SpanAttributes{Group: "there", When: start},
+			ended: true,
+			err:   boom,
+		},
+	}
+	var got []fakeSpan
+	for _, s := range tracer.spans {
+		got = append(got, *s)
+	}
+	if diff := cmp.Diff(want, got, cmp.AllowUnexported(fakeSpan{}), cmp.Comparer(func(a, b error) bool { return a == b })); diff != "" {
+		t.Errorf("SendFunc() got unexpected spans (-want +got):\n%s", diff)
+	}
+}
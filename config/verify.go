@@ -0,0 +1,188 @@
+/*
+Copyright 2021 The TestGrid Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package config
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+
+	multierror "github.com/hashicorp/go-multierror"
+	"github.com/sirupsen/logrus"
+)
+
+// ErrCorrupted is wrapped by errors from methods that recovered from a corrupt queue.
+var ErrCorrupted = errors.New("queue corrupted")
+
+// Verify returns an error describing any inconsistency in the queue's internal structure.
+func (q *TestGroupQueue) Verify() error {
+	q.lock.RLock()
+	defer q.lock.RUnlock()
+	return q.verifyLocked()
+}
+
+// Reheapify restores the queue's order after something rescheduled its items
+// without going through the queue, such as a debug hook writing to them directly.
+//
+// Normal operations never require this: it is a safety valve for operators
+// who find a problem with Verify.
+func (q *TestGroupQueue) Reheapify() {
+	q.lock.Lock()
+	defer q.lock.Unlock()
+	defer q.rouse()
+	q.store().rebuild()
+	q.reprintLocked()
+	logrus.WithField("groups", q.store().Len()).Info("Reheapified queue")
+}
+
+func (q *TestGroupQueue) verifyLocked() error {
+	var mErr error
+	for i, it := range q.store().all() {
+		switch {
+		case it == nil:
+			mErr = multierror.Append(mErr, fmt.Errorf("%d: nil item", i))
+			continue
+		case it.tg == nil:
+			mErr = multierror.Append(mErr, fmt.Errorf("%d: nil group", i))
+			continue
+		}
+		if name := it.tg.Name; q.items[name] != it {
+			mErr = multierror.Append(mErr, fmt.Errorf("%d %q: missing from items", i, name))
+		}
+	}
+	if err := q.store().check(); err != nil {
+		mErr = multierror.Append(mErr, err)
+	}
+	if len(q.items) != q.store().Len() {
+		mErr = multierror.Append(mErr, fmt.Errorf("%d items but %d queued", len(q.items), q.store().Len()))
+	}
+	var print uint64
+	for name, it := range q.items {
+		if it != nil && it.tg != nil {
+			print += groupPrint(name, it.when)
+		}
+	}
+	if print != q.print {
+		mErr = multierror.Append(mErr, fmt.Errorf("fingerprint %x but items hash to %x", q.print, print))
+	}
+	return mErr
+}
+
+// peekLocked returns the first item due, first repairing the queue if it holds a nil group.
+//
+// Keeps Send from ever delivering a nil group, even from a corrupt queue.
+func (q *TestGroupQueue) peekLocked() *item {
+	it := q.store().peek()
+	if it == nil || it.tg != nil {
+		return it
+	}
+	dropped := q.repairLocked()
+	logrus.WithField("dropped", dropped).Error("Repaired queue holding a nil group")
+	return q.store().peek()
+}
+
+// reorderLocked reorders the item after rescheduling it, see scheduleStore.fix.
+//
+// First repairs the item's index if stale, which would otherwise make the
+// store silently reorder some other item, logging and counting the repair.
+func (q *TestGroupQueue) reorderLocked(it *item) {
+	if q.store().holds(it) {
+		q.store().fix(it)
+		return
+	}
+	q.reindexed++
+	stale := it.index
+	found := q.store().reindex(it)
+	logrus.WithFields(logrus.Fields{
+		"group": it.tg.Name,
+		"index": stale,
+		"found": found,
+	}).Error("Repairing stale queue index")
+	if !found {
+		q.pushStoreLocked(it)
+		return
+	}
+	q.store().fix(it)
+}
+
+// recoverLocked repairs the queue after a panic, such as from a corrupt heap, setting err if non-nil.
+//
+// Must be deferred while holding the lock.
+func (q *TestGroupQueue) recoverLocked(err *error) {
+	r := recover()
+	if r == nil {
+		return
+	}
+	problems := q.verifyLocked()
+	dropped := q.repairLocked()
+	logrus.WithFields(logrus.Fields{
+		"panic":    r,
+		"problems": problems,
+		"dropped":  dropped,
+	}).Error("Repaired corrupt queue")
+	if err != nil {
+		*err = fmt.Errorf("%w: recovered from %v, dropped %d invalid items %q", ErrCorrupted, r, len(dropped), dropped)
+	}
+}
+
+// repairLocked rebuilds the queue from its valid items, returning the names of those it dropped.
+//
+// Keeps items missing from either the heap or the map, as long as they are otherwise valid.
+func (q *TestGroupQueue) repairLocked() []string {
+	q.corrupted++
+	var dropped []string
+	queue := make(priorityQueue, 0, len(q.items))
+	items := make(map[string]*item, len(q.items))
+	keep := func(it *item) {
+		it.index = len(queue)
+		queue = append(queue, it)
+		items[it.tg.Name] = it
+	}
+	for _, it := range q.store().all() {
+		switch {
+		case it == nil:
+			dropped = append(dropped, "<nil item>")
+		case it.tg == nil:
+			dropped = append(dropped, "<nil group>")
+		case validateGroup(it.tg) != nil:
+			dropped = append(dropped, it.tg.Name)
+		case items[it.tg.Name] != nil: // duplicate
+			dropped = append(dropped, it.tg.Name)
+		default:
+			keep(it)
+		}
+	}
+	for name, it := range q.items {
+		switch {
+		case items[name] != nil:
+		case it == nil, it.tg == nil, it.tg.Name != name:
+			dropped = append(dropped, name)
+		default:
+			keep(it)
+		}
+	}
+	queue.rebuild()
+	q.queue = queue
+	q.items = items
+	q.realiasLocked()
+	q.reprintLocked()
+	if len(dropped) > 0 {
+		q.shrinkLocked()
+	}
+	sort.Strings(dropped)
+	return dropped
+}
@@ -0,0 +1,278 @@
+/*
+Copyright 2021 The TestGrid Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package config
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	configpb "github.com/GoogleCloudPlatform/testgrid/pb/config"
+	"github.com/google/go-cmp/cmp"
+)
+
+func newVerifyQueue(now time.Time) *TestGroupQueue {
+	var q TestGroupQueue
+	q.Init([]*configpb.TestGroup{{Name: "a"}, {Name: "b"}, {Name: "c"}}, now)
+	q.Fix("b", now.Add(time.Minute))
+	q.Fix("c", now.Add(2*time.Minute))
+	return &q
+}
+
+func TestVerify(t *testing.T) {
+	now := time.Date(2021, 1, 2, 3, 4, 5, 0, time.UTC)
+	cases := []struct {
+		name    string
+		corrupt func(*TestGroupQueue)
+		err     bool
+	}{
+		{
+			name:    "healthy",
+			corrupt: func(*TestGroupQueue) {},
+		},
+		{
+			name: "nil item",
+			corrupt: func(q *TestGroupQueue) {
+				q.queue = append(q.queue, nil)
+			},
+			err: true,
+		},
+		{
+			name: "nil group",
+			corrupt: func(q *TestGroupQueue) {
+				q.queue[1].tg = nil
+			},
+			err: true,
+		},
+		{
+			name: "wrong index",
+			corrupt: func(q *TestGroupQueue) {
+				q.queue[1].index = 2
+			},
+			err: true,
+		},
+		{
+			name: "missing from items",
+			corrupt: func(q *TestGroupQueue) {
+				delete(q.items, "b")
+			},
+			err: true,
+		},
+		{
+			name: "out of order",
+			corrupt: func(q *TestGroupQueue) {
+				q.queue[0].when = now.Add(time.Hour)
+			},
+			err: true,
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			q := newVerifyQueue(now)
+			tc.corrupt(q)
+			if err := q.Verify(); (err != nil) != tc.err {
+				t.Errorf("Verify() got %v, wanted err=%t", err, tc.err)
+			}
+		})
+	}
+}
+
+func TestRecoverCorruption(t *testing.T) {
+	now := time.Date(2021, 1, 2, 3, 4, 5, 0, time.UTC)
+	cases := []struct {
+		name    string
+		corrupt func(*TestGroupQueue)
+		mutate  func(*TestGroupQueue) error
+		want    []string
+	}{
+		{
+			name: "nil item during FixAll",
+			corrupt: func(q *TestGroupQueue) {
+				q.queue = append(q.queue, nil)
+			},
+			mutate: func(q *TestGroupQueue) error {
+				return q.FixAll(map[string]time.Time{"a": now.Add(time.Hour)})
+			},
+			want: []string{"b", "c", "a"},
+		},
+		{
+			name: "nil group during Remove",
+			corrupt: func(q *TestGroupQueue) {
+				q.items["b"].tg = nil
+			},
+			mutate: func(q *TestGroupQueue) error {
+				return q.Remove("b")
+			},
+			want: []string{"a", "c"},
+		},
+		{
+			name: "wrong index during Remove",
+			corrupt: func(q *TestGroupQueue) {
+				q.items["a"].index = 99
+			},
+			mutate: func(q *TestGroupQueue) error {
+				return q.Remove("a")
+			},
+			want: []string{"a", "b", "c"},
+		},
+		{
+			name: "nil item in items during Init",
+			corrupt: func(q *TestGroupQueue) {
+				q.items["ghost"] = nil
+			},
+			mutate: func(q *TestGroupQueue) error {
+				return q.Init([]*configpb.TestGroup{{Name: "a"}, {Name: "b"}, {Name: "c"}}, now)
+			},
+			want: []string{"a", "b", "c"},
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			q := newVerifyQueue(now)
+			tc.corrupt(q)
+			if err := tc.mutate(q); !errors.Is(err, ErrCorrupted) {
+				t.Errorf("mutate got %v, want ErrCorrupted", err)
+			}
+			if err := q.Verify(); err != nil {
+				t.Errorf("Verify() after recovery got unexpected error: %v", err)
+			}
+			if n := q.Stats().Corrupted; n != 1 {
+				t.Errorf("Stats() got %d corruptions, want 1", n)
+			}
+			var got []string
+			for _, it := range q.Items() {
+				got = append(got, it.Name)
+			}
+			if diff := cmp.Diff(tc.want, got); diff != "" {
+				t.Errorf("Items() got unexpected diff (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestReorderStaleIndex(t *testing.T) {
+	now := time.Date(2021, 1, 2, 3, 4, 5, 0, time.UTC)
+	cases := []struct {
+		name      string
+		desync    func(*TestGroupQueue)
+		reindexed int64
+	}{
+		{
+			name: "consistent",
+		},
+		{
+			name: "another's",
+			desync: func(q *TestGroupQueue) {
+				q.items["a"].index = q.items["c"].index
+			},
+			reindexed: 1,
+		},
+		{
+			name: "out of range",
+			desync: func(q *TestGroupQueue) {
+				q.items["a"].index = 10
+			},
+			reindexed: 1,
+		},
+		{
+			name: "missing",
+			desync: func(q *TestGroupQueue) {
+				a := q.items["a"]
+				last := len(q.queue) - 1
+				q.queue[a.index] = q.queue[last]
+				q.queue[a.index].index = a.index
+				q.queue = q.queue[:last]
+				q.queue.rebuild()
+			},
+			reindexed: 1,
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			q := newVerifyQueue(now)
+			if tc.desync != nil {
+				tc.desync(q)
+			}
+			if err := q.Fix("a", now.Add(90*time.Second)); err != nil {
+				t.Fatalf("Fix() got unexpected error: %v", err)
+			}
+			if err := q.Verify(); err != nil {
+				t.Errorf("Verify() got unexpected error: %v", err)
+			}
+			if got := q.Stats().Reindexed; got != tc.reindexed {
+				t.Errorf("Stats() got %d reindexed, want %d", got, tc.reindexed)
+			}
+			var got []string
+			for _, it := range q.Items() {
+				got = append(got, it.Name)
+			}
+			if diff := cmp.Diff([]string{"b", "a", "c"}, got); diff != "" {
+				t.Errorf("Items() got unexpected order (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestReheapify(t *testing.T) {
+	now := time.Date(2021, 1, 2, 3, 4, 5, 0, time.UTC)
+	cases := []struct {
+		name    string
+		corrupt func(*TestGroupQueue)
+		want    []string
+	}{
+		{
+			name:    "healthy",
+			corrupt: func(*TestGroupQueue) {},
+			want:    []string{"a", "b", "c"},
+		},
+		{
+			name: "head delayed",
+			corrupt: func(q *TestGroupQueue) {
+				q.items["a"].when = now.Add(time.Hour)
+			},
+			want: []string{"b", "c", "a"},
+		},
+		{
+			name: "tail advanced",
+			corrupt: func(q *TestGroupQueue) {
+				q.items["c"].when = now.Add(-time.Minute)
+			},
+			want: []string{"c", "a", "b"},
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			q := newVerifyQueue(now)
+			tc.corrupt(q)
+			q.Reheapify()
+			if err := q.Verify(); err != nil {
+				t.Errorf("Verify() got unexpected error: %v", err)
+			}
+			var got []string
+			for range tc.want {
+				got = append(got, q.store().pop().tg.Name)
+			}
+			if diff := cmp.Diff(tc.want, got); diff != "" {
+				t.Errorf("Reheapify() got unexpected order (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
@@ -0,0 +1,81 @@
+/*
+Copyright 2021 The TestGrid Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package config
+
+import (
+	"context"
+	"sync"
+)
+
+// waker lets goroutines, such as calls to Send, sleep until another wakes them.
+//
+// A goroutine deciding whether to sleep first notes the generation, then
+// waits for that generation to pass. Waking after the goroutine noted the
+// generation ends its wait, even if the wake happens before the wait
+// starts, whereas earlier wakes do not. Each wake ends every wait.
+// The zero value is ready to use.
+type waker struct {
+	lock sync.Mutex
+	gen  uint64        // incremented by each wake
+	ch   chan struct{} // closed by the next wake, if anyone is waiting
+}
+
+// generation returns the current generation, to later wait for it to pass.
+func (w *waker) generation() uint64 {
+	w.lock.Lock()
+	defer w.lock.Unlock()
+	return w.gen
+}
+
+// wake every goroutine waiting for the current generation to pass.
+func (w *waker) wake() {
+	w.lock.Lock()
+	defer w.lock.Unlock()
+	w.gen++
+	if w.ch != nil {
+		close(w.ch)
+		w.ch = nil
+	}
+}
+
+// wait until a wake after gen, the timer fires or ctx is done, returning whether it was woken.
+//
+// Consumes the timer, stopping it unless it fired.
+func (w *waker) wait(ctx context.Context, gen uint64, timer Timer) bool {
+	w.lock.Lock()
+	if w.gen != gen {
+		w.lock.Unlock()
+		timer.Stop()
+		return true
+	}
+	if w.ch == nil {
+		w.ch = make(chan struct{})
+	}
+	ch := w.ch
+	w.lock.Unlock()
+
+	select {
+	case <-ch:
+		timer.Stop()
+		return true
+	case <-ctx.Done():
+		timer.Stop()
+		return false
+	case <-timer.C():
+		return false
+	}
+}
@@ -0,0 +1,185 @@
+/*
+Copyright 2021 The TestGrid Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package config
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	configpb "github.com/GoogleCloudPlatform/testgrid/pb/config"
+	"github.com/sirupsen/logrus"
+)
+
+func TestWaker(t *testing.T) {
+	start := time.Date(2021, 1, 2, 3, 4, 5, 0, time.UTC)
+	cases := []struct {
+		name     string
+		before   bool // wake before noting the generation
+		between  bool // wake after noting the generation, before waiting
+		canceled bool
+		want     bool
+	}{
+		{
+			name: "timeout",
+		},
+		{
+			name:   "stale wake",
+			before: true,
+		},
+		{
+			name:    "missed wake",
+			between: true,
+			want:    true,
+		},
+		{
+			name:     "canceled",
+			canceled: true,
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			var w waker
+			clock := NewFakeClock(start)
+			if tc.before {
+				w.wake()
+			}
+			gen := w.generation()
+			if tc.between {
+				w.wake()
+			}
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+			if tc.canceled {
+				cancel()
+			}
+			timer := clock.NewTimer(time.Minute)
+			if !tc.between && !tc.canceled {
+				clock.Advance(time.Minute)
+			}
+			if got := w.wait(ctx, gen, timer); got != tc.want {
+				t.Errorf("wait() got %t, want %t", got, tc.want)
+			}
+		})
+	}
+}
+
+func TestWakerWakesEveryWaiter(t *testing.T) {
+	var w waker
+	clock := NewFakeClock(time.Now())
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	const waiters = 5
+	gen := w.generation()
+	woken := make(chan bool, waiters)
+	for i := 0; i < waiters; i++ {
+		go func() {
+			woken <- w.wait(ctx, gen, clock.NewTimer(time.Hour))
+		}()
+	}
+	if err := clock.BlockUntil(ctx, waiters); err != nil {
+		t.Fatalf("waiters never waited: %v", err)
+	}
+	w.wake()
+	for i := 0; i < waiters; i++ {
+		if !<-woken {
+			t.Error("wait() got false, want true")
+		}
+	}
+}
+
+func TestWakerRace(t *testing.T) {
+	var w waker
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	const rounds = 1000
+	var wg sync.WaitGroup
+	gens := make(chan uint64)
+	wg.Add(1)
+	go func() { // wakes each generation at an arbitrary point in the wait
+		defer wg.Done()
+		for range gens {
+			w.wake()
+		}
+	}()
+	for i := 0; i < rounds; i++ {
+		gen := w.generation()
+		gens <- gen
+		if !w.wait(ctx, gen, realClock{}.NewTimer(time.Hour)) {
+			t.Fatalf("round %d: wait() missed a wake: %v", i, ctx.Err())
+		}
+	}
+	close(gens)
+	wg.Wait()
+}
+
+// sleepHook calls fix once, when Send logs that it is about to sleep.
+type sleepHook struct {
+	once sync.Once
+	fix  func()
+}
+
+func (h *sleepHook) Levels() []logrus.Level {
+	return logrus.AllLevels
+}
+
+func (h *sleepHook) Fire(e *logrus.Entry) error {
+	if e.Message != "Sleeping..." {
+		return nil
+	}
+	h.once.Do(func() {
+		// hooks run holding the logger's lock, so keep fix from logging
+		level := logrus.GetLevel()
+		logrus.SetLevel(logrus.WarnLevel)
+		defer logrus.SetLevel(level)
+		h.fix()
+	})
+	return nil
+}
+
+func TestSendRousedBeforeSleeping(t *testing.T) {
+	now := time.Date(2021, 1, 2, 3, 4, 5, 0, time.UTC)
+	q := NewTestGroupQueue(WithClock(NewFakeClock(now)))
+	q.Init([]*configpb.TestGroup{{Name: "a"}}, now)
+	q.Fix("a", now.Add(time.Hour))
+
+	// fix a after Send chose to sleep an hour, but before it sleeps
+	logger := logrus.StandardLogger()
+	hooks := logger.ReplaceHooks(logrus.LevelHooks{})
+	defer logger.ReplaceHooks(hooks)
+	logger.AddHook(&sleepHook{fix: func() { q.Fix("a", now) }})
+	level := logrus.GetLevel()
+	logrus.SetLevel(logrus.InfoLevel)
+	defer logrus.SetLevel(level)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	ch := make(chan *configpb.TestGroup)
+	go q.Send(ctx, ch, time.Hour)
+	select {
+	case tg := <-ch:
+		if tg.Name != "a" {
+			t.Errorf("Send() got %q, want a", tg.Name)
+		}
+	case <-ctx.Done():
+		t.Fatal("Send() slept through a Fix made before it started sleeping")
+	}
+}
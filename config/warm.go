@@ -0,0 +1,96 @@
+/*
+Copyright 2021 The TestGrid Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package config
+
+import (
+	"context"
+)
+
+// warmup tracks the groups Send must deliver before the queue is warm, see WaitWarm.
+type warmup struct {
+	cold map[string]bool // groups undelivered since Send started, nil before
+	done chan struct{}   // closed once every cold group is delivered
+	warm bool            // done is closed
+}
+
+// WithWarmAddedGroups makes WaitWarm also wait for groups added after Send started.
+//
+// Otherwise only the groups in the queue when Send started must be delivered.
+func WithWarmAddedGroups() QueueOption {
+	return func(q *TestGroupQueue) {
+		q.warmAdded = true
+	}
+}
+
+// WaitWarm blocks until Send has delivered every group at least once since it started.
+//
+// Intended for readiness probes that wait for initial coverage. Each call to
+// Send starts a new cycle, cooling the queue until it delivers every group
+// present when it started, so WaitWarm blocks until Send starts when none is
+// active. Groups removed before their delivery no longer count, and groups
+// added after Send started only count when the queue uses
+// WithWarmAddedGroups. A Send starting with an empty queue warms it at once.
+// Returns the context's error if it expires first.
+func (q *TestGroupQueue) WaitWarm(ctx context.Context) error {
+	q.lock.Lock()
+	if q.warm.done == nil {
+		q.warm.done = make(chan struct{})
+	}
+	done := q.warm.done
+	q.lock.Unlock()
+
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// coolLocked starts a new cycle, waiting for every group to be delivered again.
+func (q *TestGroupQueue) coolLocked() {
+	w := &q.warm
+	if w.done == nil || w.warm {
+		w.done = make(chan struct{})
+		w.warm = false
+	}
+	w.cold = make(map[string]bool, len(q.items))
+	for name := range q.items {
+		w.cold[name] = true
+	}
+	w.remove("") // in case the queue is empty
+}
+
+// add waits for the group to be delivered before the queue is warm.
+func (w *warmup) add(name string) {
+	if w.cold == nil || w.warm {
+		return
+	}
+	w.cold[name] = true
+}
+
+// remove stops waiting for the group, warming the queue after the last one.
+func (w *warmup) remove(name string) {
+	if w.cold == nil || w.warm {
+		return
+	}
+	delete(w.cold, name)
+	if len(w.cold) == 0 {
+		w.warm = true
+		close(w.done)
+	}
+}
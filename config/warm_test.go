@@ -0,0 +1,173 @@
+/*
+Copyright 2021 The TestGrid Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package config
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	configpb "github.com/GoogleCloudPlatform/testgrid/pb/config"
+)
+
+func TestWaitWarm(t *testing.T) {
+	now := time.Date(2021, 1, 2, 3, 4, 5, 0, time.UTC)
+	cases := []struct {
+		name string
+		opts []QueueOption
+		act  func(*TestGroupQueue, *FakeClock, <-chan *configpb.TestGroup)
+		warm bool
+	}{
+		{
+			name: "undelivered",
+		},
+		{
+			name: "delivered",
+			act: func(_ *TestGroupQueue, clock *FakeClock, ch <-chan *configpb.TestGroup) {
+				clock.Advance(time.Hour)
+				<-ch
+			},
+			warm: true,
+		},
+		{
+			name: "removed",
+			act: func(q *TestGroupQueue, _ *FakeClock, _ <-chan *configpb.TestGroup) {
+				q.Remove("later")
+			},
+			warm: true,
+		},
+		{
+			name: "added",
+			act: func(q *TestGroupQueue, clock *FakeClock, ch <-chan *configpb.TestGroup) {
+				q.Add(&configpb.TestGroup{Name: "added"}, now.Add(2*time.Hour))
+				clock.Advance(time.Hour)
+				<-ch
+			},
+			warm: true,
+		},
+		{
+			name: "added with WithWarmAddedGroups",
+			opts: []QueueOption{WithWarmAddedGroups()},
+			act: func(q *TestGroupQueue, clock *FakeClock, ch <-chan *configpb.TestGroup) {
+				q.Add(&configpb.TestGroup{Name: "added"}, now.Add(2*time.Hour))
+				clock.Advance(time.Hour)
+				<-ch
+			},
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			clock := NewFakeClock(now)
+			q := NewTestGroupQueue(append(tc.opts, WithClock(clock))...)
+			q.Init([]*configpb.TestGroup{{Name: "now"}, {Name: "later"}}, now)
+			if err := q.Fix("later", now.Add(time.Hour)); err != nil {
+				t.Fatalf("Fix() got unexpected error: %v", err)
+			}
+
+			ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+			defer cancel()
+			ch := make(chan *configpb.TestGroup, 3)
+			go q.Send(ctx, ch, 24*time.Hour)
+			if tg := <-ch; tg.GetName() != "now" {
+				t.Fatalf("Send() got %v, want now", tg)
+			}
+			if err := clock.BlockUntil(ctx, 1); err != nil { // Send is sleeping
+				t.Fatalf("BlockUntil() got unexpected error: %v", err)
+			}
+			if tc.act != nil {
+				tc.act(q, clock, ch)
+			}
+
+			wait := ctx
+			if !tc.warm {
+				var cancel context.CancelFunc
+				wait, cancel = context.WithTimeout(ctx, 10*time.Millisecond)
+				defer cancel()
+			}
+			switch err := q.WaitWarm(wait); {
+			case tc.warm && err != nil:
+				t.Errorf("WaitWarm() got unexpected error: %v", err)
+			case !tc.warm && err == nil:
+				t.Error("WaitWarm() returned before delivering every group")
+			}
+		})
+	}
+}
+
+func TestWaitWarmCycles(t *testing.T) {
+	q := &TestGroupQueue{}
+	q.Init([]*configpb.TestGroup{{Name: "hi"}}, time.Now().Add(time.Hour))
+
+	cold := func(when string) {
+		t.Helper()
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+		defer cancel()
+		if err := q.WaitWarm(ctx); err == nil {
+			t.Errorf("WaitWarm() returned %s", when)
+		}
+	}
+	// send starts Send, returning a func to stop it.
+	send := func() func() {
+		ctx, cancel := context.WithCancel(context.Background())
+		errs := make(chan error)
+		go func() {
+			errs <- q.Send(ctx, make(chan *configpb.TestGroup, 1), time.Hour)
+		}()
+		for !q.Sending() {
+			time.Sleep(time.Millisecond)
+		}
+		return func() {
+			cancel()
+			<-errs
+		}
+	}
+	warm := func() {
+		t.Helper()
+		if err := q.Fix("hi", time.Now()); err != nil {
+			t.Fatalf("Fix() got unexpected error: %v", err)
+		}
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+		if err := q.WaitWarm(ctx); err != nil {
+			t.Errorf("WaitWarm() got unexpected error: %v", err)
+		}
+	}
+
+	cold("before Send started")
+	stop := send()
+	cold("before Send delivered the group")
+	warm()
+	stop()
+	if err := q.Fix("hi", time.Now().Add(time.Hour)); err != nil {
+		t.Fatalf("Fix() got unexpected error: %v", err)
+	}
+	stop = send()
+	defer stop()
+	cold("before the next Send delivered the group")
+	warm()
+}
+
+func TestWaitWarmEmpty(t *testing.T) {
+	var q TestGroupQueue
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	go q.Send(ctx, make(chan *configpb.TestGroup), time.Hour)
+	if err := q.WaitWarm(ctx); err != nil {
+		t.Errorf("WaitWarm() got unexpected error: %v", err)
+	}
+}
@@ -0,0 +1,143 @@
+/*
+Copyright 2021 The TestGrid Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package config
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"time"
+
+	configpb "github.com/GoogleCloudPlatform/testgrid/pb/config"
+	"github.com/sirupsen/logrus"
+)
+
+// WatchTick is how often WatchFile checks its file for changes.
+const WatchTick = 5 * time.Second
+
+// fileVersion identifies a version of a file, see WatchFile.
+type fileVersion struct {
+	modTime time.Time
+	size    int64
+}
+
+func (v fileVersion) equal(o fileVersion) bool {
+	return v.size == o.size && v.modTime.Equal(o.modTime)
+}
+
+func statFile(path string) (fileVersion, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return fileVersion{}, err
+	}
+	return fileVersion{info.ModTime(), info.Size()}, nil
+}
+
+// WatchFile initializes q from the file at path, then reinitializes it each time the file changes until ctx expires.
+//
+// Suits configs mounted from a ConfigMap, which are replaced in place.
+// Detects changes by polling the file's size and modification time every
+// WatchTick, reloading it only once it has stopped changing for a whole
+// tick, so a burst of writes reinitializes the queue once. Schedules the
+// groups of each version at when().
+//
+// Returns an error if the first version cannot be read, parsed or used to
+// initialize the queue. After that, a version that fails to read or parse
+// leaves the queue as it was, counting the failure in
+// QueueStats.ReloadErrors, until the file changes again. While the queue is
+// sealed, see Seal, or running a FixEach callback, WatchFile logs and retries
+// the reload each tick, so the queue picks up the latest version once it
+// accepts changes again.
+func WatchFile(ctx context.Context, path string, q *TestGroupQueue, parse func([]byte) ([]*configpb.TestGroup, error), when func() time.Time) error {
+	loaded, err := statFile(path)
+	if err != nil {
+		return fmt.Errorf("stat: %w", err)
+	}
+	if err := loadFile(path, q, parse, when); err != nil {
+		return err
+	}
+	go q.watchFile(ctx, path, loaded, parse, when)
+	return nil
+}
+
+// loadFile reads and parses the file at path, initializing q with its groups.
+//
+// Invalid groups are logged rather than returned, see Init, whereas other
+// errors from Init, such as ErrSealed, are returned.
+func loadFile(path string, q *TestGroupQueue, parse func([]byte) ([]*configpb.TestGroup, error), when func() time.Time) error {
+	buf, err := ioutil.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("read: %w", err)
+	}
+	groups, err := parse(buf)
+	if err != nil {
+		return fmt.Errorf("parse: %w", err)
+	}
+	err = q.Init(groups, when())
+	var invalid *InvalidGroupsError
+	if errors.As(err, &invalid) {
+		logrus.WithError(err).WithField("path", path).Warning("Initialized queue from file without invalid groups")
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("init: %w", err)
+	}
+	return nil
+}
+
+// watchFile reloads the file at path once it changes and then settles, see WatchFile.
+func (q *TestGroupQueue) watchFile(ctx context.Context, path string, loaded fileVersion, parse func([]byte) ([]*configpb.TestGroup, error), when func() time.Time) {
+	seen := loaded
+	for {
+		timer := q.clockTimer(WatchTick)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return
+		case <-timer.C():
+		}
+		current, err := statFile(path)
+		if err != nil {
+			logrus.WithError(err).WithField("path", path).Warning("Failed to check watched file")
+			continue
+		}
+		if !current.equal(seen) { // still changing
+			seen = current
+			continue
+		}
+		if current.equal(loaded) {
+			continue
+		}
+		log := logrus.WithField("path", path)
+		err = loadFile(path, q, parse, when)
+		if errors.Is(err, ErrSealed) || errors.Is(err, ErrReentrant) { // retry next tick
+			log.WithError(err).Warning("Deferring reload of watched file until the queue accepts changes")
+			continue
+		}
+		loaded = current
+		if err != nil {
+			q.lock.Lock()
+			q.reloads++
+			q.lock.Unlock()
+			log.WithError(err).Error("Failed to reload watched file, keeping previous groups")
+			continue
+		}
+		log.Info("Reloaded watched file")
+	}
+}
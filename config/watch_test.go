@@ -0,0 +1,203 @@
+/*
+Copyright 2021 The TestGrid Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package config
+
+import (
+	"context"
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	configpb "github.com/GoogleCloudPlatform/testgrid/pb/config"
+	"github.com/google/go-cmp/cmp"
+)
+
+// parseLines parses a group name per line, rejecting "bad".
+func parseLines(buf []byte) ([]*configpb.TestGroup, error) {
+	var groups []*configpb.TestGroup
+	for _, name := range strings.Fields(string(buf)) {
+		if name == "bad" {
+			return nil, errors.New("bad group")
+		}
+		groups = append(groups, &configpb.TestGroup{Name: name})
+	}
+	return groups, nil
+}
+
+// writeVersion writes content to path, marking it modified at when.
+func writeVersion(t *testing.T, path, content string, when time.Time) {
+	t.Helper()
+	if err := ioutil.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatalf("WriteFile() got unexpected error: %v", err)
+	}
+	if err := os.Chtimes(path, when, when); err != nil {
+		t.Fatalf("Chtimes() got unexpected error: %v", err)
+	}
+}
+
+func TestWatchFile(t *testing.T) {
+	now := time.Date(2021, 1, 2, 3, 4, 5, 0, time.UTC)
+	dir, err := ioutil.TempDir("", "")
+	if err != nil {
+		t.Fatalf("TempDir() got unexpected error: %v", err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "config")
+	writeVersion(t, path, "a b", now)
+
+	clock := NewFakeClock(now)
+	q := NewTestGroupQueue(WithClock(clock), WithSleepTimer(never))
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := WatchFile(ctx, path, q, parseLines, clock.Now); err != nil {
+		t.Fatalf("WatchFile() got unexpected error: %v", err)
+	}
+
+	tick := func() {
+		t.Helper()
+		if err := clock.BlockUntil(ctx, 1); err != nil {
+			t.Fatalf("BlockUntil() got unexpected error: %v", err)
+		}
+		clock.Advance(WatchTick)
+		if err := clock.BlockUntil(ctx, 1); err != nil {
+			t.Fatalf("BlockUntil() got unexpected error: %v", err)
+		}
+	}
+	check := func(step string, want []string, inits, reloadErrors int64) {
+		t.Helper()
+		var got []string
+		for _, it := range q.Items() {
+			got = append(got, it.Name)
+		}
+		if diff := cmp.Diff(want, got); diff != "" {
+			t.Errorf("%s: got unexpected groups (-want +got):\n%s", step, diff)
+		}
+		stats := q.Stats()
+		if stats.Inits != inits {
+			t.Errorf("%s: got %d inits, want %d", step, stats.Inits, inits)
+		}
+		if stats.ReloadErrors != reloadErrors {
+			t.Errorf("%s: got %d reload errors, want %d", step, stats.ReloadErrors, reloadErrors)
+		}
+	}
+	check("start", []string{"a", "b"}, 1, 0)
+
+	tick()
+	check("unchanged", []string{"a", "b"}, 1, 0)
+
+	writeVersion(t, path, "a", now.Add(time.Second))
+	tick()
+	writeVersion(t, path, "a c", now.Add(2*time.Second))
+	tick()
+	check("changing", []string{"a", "b"}, 1, 0)
+	tick()
+	check("settled", []string{"a", "c"}, 2, 0)
+	tick()
+	check("reloaded", []string{"a", "c"}, 2, 0)
+
+	writeVersion(t, path, "bad", now.Add(3*time.Second))
+	tick()
+	tick()
+	check("invalid", []string{"a", "c"}, 2, 1)
+	tick()
+	check("still invalid", []string{"a", "c"}, 2, 1)
+
+	writeVersion(t, path, "d", now.Add(4*time.Second))
+	tick()
+	tick()
+	check("fixed", []string{"d"}, 3, 1)
+
+	q.Seal()
+	writeVersion(t, path, "e", now.Add(5*time.Second))
+	tick()
+	tick()
+	check("sealed", []string{"d"}, 3, 1)
+	q.Unseal()
+	tick()
+	check("unsealed", []string{"e"}, 4, 1)
+}
+
+func TestWatchFileStart(t *testing.T) {
+	dir, err := ioutil.TempDir("", "")
+	if err != nil {
+		t.Fatalf("TempDir() got unexpected error: %v", err)
+	}
+	defer os.RemoveAll(dir)
+	now := time.Date(2021, 1, 2, 3, 4, 5, 0, time.UTC)
+
+	cases := []struct {
+		name    string
+		content string // missing if empty
+		sealed  bool
+		want    []string
+		err     bool
+	}{
+		{
+			name: "missing",
+			err:  true,
+		},
+		{
+			name:    "invalid",
+			content: "a bad",
+			err:     true,
+		},
+		{
+			name:    "sealed",
+			content: "a b",
+			sealed:  true,
+			err:     true,
+		},
+		{
+			name:    "valid",
+			content: "a b",
+			want:    []string{"a", "b"},
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			path := filepath.Join(dir, tc.name)
+			if tc.content != "" {
+				writeVersion(t, path, tc.content, now)
+			}
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+			q := NewTestGroupQueue(WithClock(NewFakeClock(now)), WithSleepTimer(never))
+			if tc.sealed {
+				q.Seal()
+			}
+			err := WatchFile(ctx, path, q, parseLines, func() time.Time { return now })
+			switch {
+			case err != nil && !tc.err:
+				t.Errorf("WatchFile() got unexpected error: %v", err)
+			case err == nil && tc.err:
+				t.Error("WatchFile() failed to return an error")
+			}
+			var got []string
+			for _, it := range q.Items() {
+				got = append(got, it.Name)
+			}
+			if diff := cmp.Diff(tc.want, got); diff != "" {
+				t.Errorf("WatchFile() got unexpected groups (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
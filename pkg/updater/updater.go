@@ -228,7 +228,9 @@ func updateTestGroups(ctx context.Context, opener gcs.Opener, stater gcs.Stater,
 
 	generations := make(map[string]int64, len(groups))
 
-	q.Init(groups, time.Now())
+	if err := q.Init(groups, time.Now()); err != nil {
+		logrus.WithError(err).Warning("Failed to queue some groups")
+	}
 
 	if len(groups) > 0 {
 		paths, err := gridPaths(configPath, gridPrefix, groups)
@@ -322,7 +324,10 @@ func Update(parent context.Context, client gcs.ConditionalClient, mets *Metrics,
 		ticker := time.NewTicker(time.Minute)
 		for {
 			depth, next, when := q.Status()
-			log := log.WithField("depth", depth)
+			log := log.WithFields(logrus.Fields{
+				"depth":     depth,
+				"diagnosis": q.Diagnose().String(),
+			})
 			if next != nil {
 				log = log.WithField("next", next.Name)
 			}